@@ -0,0 +1,37 @@
+"use client"
+
+import { useEffect } from "react"
+import { useRouter } from "next/navigation"
+
+// The backend redirects here after a calendar provider's consent screen,
+// with ?status=connected or ?status=error&reason=...
+export default function CalendarCallbackPage() {
+  const router = useRouter()
+
+  useEffect(() => {
+    const params = new URLSearchParams(window.location.search)
+    const result = {
+      type: "CALENDAR_OAUTH_RESULT",
+      provider: params.get("provider"),
+      connected: params.get("status") === "connected",
+      reason: params.get("reason"),
+    }
+
+    // Opened as a popup from settings: report back and close
+    if (window.opener) {
+      window.opener.postMessage(result, window.location.origin)
+      window.close()
+      return
+    }
+    router.replace(`/settings?${params.toString()}`)
+  }, [router])
+
+  return (
+    <div className="min-h-screen flex items-center justify-center">
+      <div className="text-center">
+        <div className="animate-spin rounded-full h-8 w-8 border-b-2 border-blue-600 mx-auto"></div>
+        <p className="mt-4 text-gray-600">Connecting your calendar...</p>
+      </div>
+    </div>
+  )
+}
@@ -31,6 +31,7 @@ interface User {
     }
     calendar: {
       googleSync: boolean
+      microsoftSync?: boolean
     }
     paymentMethods?: Array<{
       type: "mpesa" | "card" | "paypal"
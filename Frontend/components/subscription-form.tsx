@@ -12,7 +12,6 @@ import { Textarea } from "@/components/ui/textarea"
 import { Badge } from "@/components/ui/badge"
 import { Alert, AlertDescription } from "@/components/ui/alert"
 import { aiService } from "@/lib/ai-service"
-import { googleCalendarService } from "@/lib/google-calendar"
 import { Brain, Sparkles, Loader2, CheckCircle, Calendar, CreditCard, Smartphone, Wallet } from "lucide-react"
 
 interface SubscriptionFormProps {
@@ -163,20 +162,7 @@ export function SubscriptionForm({ onSubmit, onCancel }: SubscriptionFormProps)
       
       console.log("Sending subscription data:", subscriptionData)
 
-      // Sync with Google Calendar if enabled
-      try {
-        const isConnected = await googleCalendarService.checkConnectionStatus()
-        if (isConnected) {
-          await googleCalendarService.createCalendarEvent({
-            name: formData.name,
-            cost: Number.parseFloat(formData.cost),
-            nextPayment: new Date(formData.nextPayment).toISOString(),
-            description: formData.description || `${formData.name} subscription payment`,
-          })
-        }
-      } catch (error) {
-        console.warn("Failed to sync with Google Calendar:", error)
-      }
+      // Google Calendar events are created and kept in sync by the backend once the subscription is saved
 
       // Simulate save delay
       await new Promise((resolve) => setTimeout(resolve, 1000))
@@ -128,8 +128,8 @@ class ApiClient {
   }
 
   // Calendar endpoints
-  async getCalendarEvents() {
-    const response = await this.client.get('/calendar/events')
+  async getCalendarEvents(range?: { from?: string; to?: string }) {
+    const response = await this.client.get('/calendar/events', { params: range })
     return response.data
   }
 
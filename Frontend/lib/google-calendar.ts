@@ -47,11 +47,20 @@ export class GoogleCalendarService {
         "width=600,height=700,left=200,top=100"
       )
 
-      // Wait for OAuth callback
+      // Wait for the callback page to report the result, or for the popup to be closed
       return new Promise((resolve) => {
+        const onMessage = (event: MessageEvent) => {
+          if (event.origin !== window.location.origin || event.data?.type !== "CALENDAR_OAUTH_RESULT") return
+          if (!event.data.connected) {
+            console.error("Google Calendar connection failed:", event.data.reason)
+          }
+        }
+        window.addEventListener("message", onMessage)
+
         const interval = setInterval(async () => {
           if (popup?.closed) {
             clearInterval(interval)
+            window.removeEventListener("message", onMessage)
             // Check if connection was successful
             const connected = await this.checkConnectionStatus()
             this.isConnected = connected
@@ -107,6 +116,7 @@ export class GoogleCalendarService {
    * Creates a calendar event for a subscription
    */
   async createCalendarEvent(subscription: {
+    id?: string
     name: string
     cost: number
     nextPayment: string
@@ -131,6 +141,7 @@ export class GoogleCalendarService {
           Authorization: `Bearer ${localStorage.getItem("auth_token")}`,
         },
         body: JSON.stringify({
+          subscription_id: subscription.id,
           subscription_name: subscription.name,
           amount: subscription.cost,
           billing_date: subscription.nextPayment,
@@ -183,6 +194,7 @@ export class GoogleCalendarService {
     for (const subscription of subscriptions) {
       try {
         const result = await this.createCalendarEvent({
+          id: subscription.id,
           name: subscription.name,
           cost: subscription.cost,
           nextPayment: subscription.nextPayment,
@@ -1,12 +1,31 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"subscription-tracker/internal/calendar"
 	"subscription-tracker/internal/config"
 	"subscription-tracker/internal/database"
 	"subscription-tracker/internal/handlers"
+	"subscription-tracker/internal/logging"
+	"subscription-tracker/internal/metrics"
 	"subscription-tracker/internal/middleware"
+	"subscription-tracker/internal/problem"
+	"subscription-tracker/internal/scheduler"
+	"subscription-tracker/internal/store"
+	"subscription-tracker/internal/store/postgres"
+	"subscription-tracker/internal/store/sqlite"
+	"subscription-tracker/internal/tracing"
+	"subscription-tracker/migrations"
+	"subscription-tracker/openapi"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -15,42 +34,150 @@ import (
 func main() {
 	// Load configuration
 	cfg := config.Load()
+	slog.SetDefault(logging.New(os.Stdout, cfg.LogLevel))
+	if err := cfg.Validate(); err != nil {
+		fatal("Invalid configuration", err)
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Endpoint:    cfg.OTLPEndpoint,
+		ServiceName: cfg.TraceServiceName,
+		SampleRatio: cfg.TraceSampleRatio,
+	})
+	if err != nil {
+		fatal("Failed to set up tracing", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("Failed to flush traces", "error", err)
+		}
+	}()
 
 	// Connect to database
-	db, err := database.Connect(cfg.DatabaseURL)
+	db, err := database.Connect(cfg.DatabaseURL, database.PoolConfig{
+		MaxOpenConns:    cfg.DBMaxOpenConns,
+		MaxIdleConns:    cfg.DBMaxIdleConns,
+		ConnMaxLifetime: cfg.DBConnMaxLifetime,
+		ConnMaxIdleTime: cfg.DBConnMaxIdleTime,
+		QueryTimeout:    cfg.DBQueryTimeout,
+	})
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		fatal("Failed to connect to database", err)
 	}
 	defer db.Close()
+	metrics.RegisterDB(db.DB, string(db.Dialect))
 
-	// Setup Gin router
-	r := gin.Default()
+	// SQLite keeps its own copy of each migration
+	migrationFiles := fs.FS(migrations.FS)
+	if db.Dialect == database.SQLite {
+		migrationFiles = migrations.SQLite
+	}
+	migrator, err := database.NewMigrator(db, migrationFiles)
+	if err != nil {
+		fatal("Failed to load migrations", err)
+	}
+
+	// `server migrate ...` manages the schema and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(migrator, os.Args[2:]); err != nil {
+			fatal("Migration failed", err)
+		}
+		return
+	}
+
+	if cfg.MigrateOnStart {
+		applied, err := migrator.Up()
+		if err != nil {
+			fatal("Failed to migrate database", err)
+		}
+		for _, m := range applied {
+			slog.Info("Applied migration", "version", m.Version, "name", m.Name)
+		}
+	}
+
+	// Setup Gin router. Requests are logged through slog with their ID instead of Gin's default logger.
+	r := gin.New()
+	r.HandleMethodNotAllowed = true
+	r.NoRoute(func(c *gin.Context) {
+		problem.Respond(c, http.StatusNotFound, problem.RouteNotFound, "No such endpoint")
+	})
+	r.NoMethod(func(c *gin.Context) {
+		problem.Respond(c, http.StatusMethodNotAllowed, problem.MethodNotAllowed, c.Request.Method+" is not supported on this endpoint")
+	})
+	r.Use(middleware.RequestID(), middleware.Tracing(), middleware.RequestLogger(), middleware.Metrics(), middleware.Recovery())
 
 	// CORS configuration
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{cfg.FrontendURL},
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", middleware.RequestIDHeader, "traceparent", "tracestate"},
+		ExposeHeaders:    []string{"X-Total-Count", "X-Next-Cursor", middleware.RequestIDHeader, middleware.TraceIDHeader},
 		AllowCredentials: true,
 	}))
 
+	// The OpenAPI spec documents every route. In development and tests, requests and responses can be checked against it.
+	spec, err := openapi.Load()
+	if err != nil {
+		fatal("Failed to load OpenAPI spec", err)
+	}
+	switch cfg.OpenAPIValidation {
+	case "off":
+	case "log", "enforce":
+		r.Use(middleware.Contract(spec, cfg.OpenAPIValidation == "enforce"))
+	default:
+		slog.Warn("Unknown OPENAPI_VALIDATION, leaving validation off", "value", cfg.OpenAPIValidation)
+	}
+
 	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(db, cfg.JWTSecret)
-	userHandler := handlers.NewUserHandler(db)
-	subscriptionHandler := handlers.NewSubscriptionHandler(db)
-	paymentHandler := handlers.NewPaymentHandler(db)
-	analyticsHandler := handlers.NewAnalyticsHandler(db)
-	notificationHandler := handlers.NewNotificationHandler(db)
-	budgetHandler := handlers.NewBudgetHandler(db)
-	calendarHandler := handlers.NewCalendarHandler(db)
-
-	// Health check
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "ok"})
-	})
+	var st store.Store = postgres.New(db)
+	if db.Dialect == database.SQLite {
+		st = sqlite.New(db)
+	}
+	authHandler := handlers.NewAuthHandler(st, cfg.JWTSecret)
+	userHandler := handlers.NewUserHandler(st)
+	paymentHandler := handlers.NewPaymentHandler(st)
+	analyticsHandler := handlers.NewAnalyticsHandler(st)
+	notificationHandler := handlers.NewNotificationHandler(st)
+	budgetHandler := handlers.NewBudgetHandler(st)
+	calendarHandler := handlers.NewCalendarHandler(st, cfg.PublicAPIURL, cfg.FrontendURL, cfg.JWTSecret,
+		calendar.NewGoogle(cfg.GoogleClientID, cfg.GoogleSecret),
+		calendar.NewMicrosoft(cfg.MicrosoftClientID, cfg.MicrosoftSecret, cfg.MicrosoftTenant),
+	)
+	splitHandler := handlers.NewSplitHandler(st)
+	subscriptionHandler := handlers.NewSubscriptionHandler(st, cfg.DeleteUndoWindow, cfg.ArchiveRetentionDays, calendarHandler)
+
+	// Background jobs
+	jobs := scheduler.New()
+	jobs.Add("trial-alerts", time.Hour, subscriptionHandler.SendTrialAlerts)
+	jobs.Add("trial-conversions", time.Hour, subscriptionHandler.ConvertEndedTrials)
+	jobs.Add("archive-purge", 24*time.Hour, subscriptionHandler.PurgeArchived)
+	jobs.Add("calendar-sync", 6*time.Hour, calendarHandler.ReconcileCalendars)
+	jobs.Add("subscription-metrics", time.Minute, subscriptionHandler.RecordSubscriptionMetrics)
+	jobs.Start()
+
+	// Health checks. /livez only shows the process is serving; /readyz checks its dependencies.
+	healthChecks := []handlers.HealthCheck{handlers.DatabaseCheck(db), handlers.MigrationsCheck(migrator)}
+	if cfg.HealthCheckProviders {
+		healthChecks = append(healthChecks,
+			handlers.ProviderCheck("google", "https://oauth2.googleapis.com", time.Minute),
+			handlers.ProviderCheck("microsoft", "https://login.microsoftonline.com", time.Minute),
+			handlers.ProviderCheck("daraja", "https://sandbox.safaricom.co.ke", time.Minute),
+		)
+	}
+	healthHandler := handlers.NewHealthHandler(5*time.Second, healthChecks...)
+	r.GET("/livez", healthHandler.Livez)
+	r.GET("/readyz", healthHandler.Readyz)
+	// Kept for existing probes
+	r.GET("/health", healthHandler.Livez)
+
+	// Prometheus scrape endpoint
+	r.GET("/metrics", middleware.MetricsAuth(cfg.MetricsToken), gin.WrapH(metrics.Handler()))
 
 	// API routes
 	api := r.Group("/api")
+	api.GET("/openapi.json", openapi.Handler(spec))
 
 	// Auth routes (public)
 	auth := api.Group("/auth")
@@ -79,9 +206,30 @@ func main() {
 	{
 		subscriptions.GET("", subscriptionHandler.GetSubscriptions)
 		subscriptions.POST("", subscriptionHandler.CreateSubscription)
+		subscriptions.GET("/archive", subscriptionHandler.GetArchivedSubscriptions)
+		subscriptions.POST("/import", subscriptionHandler.ImportSubscriptions)
+		subscriptions.GET("/export", subscriptionHandler.ExportSubscriptions)
 		subscriptions.GET("/:id", subscriptionHandler.GetSubscription)
 		subscriptions.PATCH("/:id", subscriptionHandler.UpdateSubscription)
 		subscriptions.DELETE("/:id", subscriptionHandler.DeleteSubscription)
+		subscriptions.GET("/:id/price-history", subscriptionHandler.GetPriceHistory)
+		subscriptions.GET("/:id/history", subscriptionHandler.GetHistory)
+		subscriptions.POST("/:id/revert", subscriptionHandler.RevertSubscription)
+		subscriptions.POST("/:id/restore", subscriptionHandler.RestoreSubscription)
+		subscriptions.POST("/:id/undo-delete", subscriptionHandler.UndoDelete)
+
+		// Cost splitting between members of a shared subscription
+		subscriptions.GET("/:id/split", splitHandler.GetSplit)
+		subscriptions.GET("/:id/split/ledger", splitHandler.GetLedger)
+		subscriptions.POST("/:id/split/members", splitHandler.AddMember)
+		subscriptions.DELETE("/:id/split/members/:memberId", splitHandler.RemoveMember)
+		subscriptions.POST("/:id/split/members/:memberId/settle", splitHandler.Settle)
+	}
+
+	// Split balance routes
+	splits := protected.Group("/splits")
+	{
+		splits.GET("/balances", splitHandler.GetBalances)
 	}
 
 	// Payment method routes
@@ -128,15 +276,65 @@ func main() {
 	calendar := api.Group("/calendar")
 	{
 		calendar.GET("/events", middleware.AuthMiddleware(cfg.JWTSecret), calendarHandler.GetEvents)
-		calendar.GET("/google/auth-url", middleware.AuthMiddleware(cfg.JWTSecret), calendarHandler.GoogleAuthURL)
-		calendar.GET("/google/callback", calendarHandler.GoogleCallback)
 		calendar.POST("/events", middleware.AuthMiddleware(cfg.JWTSecret), calendarHandler.CreateCalendarEvent)
-		calendar.DELETE("/google/disconnect", middleware.AuthMiddleware(cfg.JWTSecret), calendarHandler.DisconnectGoogleCalendar)
+		// :provider is google or microsoft
+		calendar.GET("/:provider/auth-url", middleware.AuthMiddleware(cfg.JWTSecret), calendarHandler.AuthURL)
+		calendar.GET("/:provider/callback", calendarHandler.OAuthCallback)
+		calendar.DELETE("/:provider/disconnect", middleware.AuthMiddleware(cfg.JWTSecret), calendarHandler.Disconnect)
+		calendar.GET("/feed", middleware.AuthMiddleware(cfg.JWTSecret), calendarHandler.GetFeed)
+		calendar.POST("/feed", middleware.AuthMiddleware(cfg.JWTSecret), calendarHandler.CreateFeed)
+		calendar.DELETE("/feed", middleware.AuthMiddleware(cfg.JWTSecret), calendarHandler.RevokeFeed)
+		// Public, authenticated by the secret token in the URL
+		calendar.GET("/feed/:token", calendarHandler.ServeFeed)
+	}
+
+	if cfg.OpenAPIValidation == "log" || cfg.OpenAPIValidation == "enforce" {
+		for _, route := range openapi.Undocumented(spec, r.Routes()) {
+			slog.Warn("Route is not in the OpenAPI spec", "route", route)
+		}
+	}
+
+	// Start server, and shut it down gracefully on SIGINT or SIGTERM
+	srv := &http.Server{Addr: ":" + cfg.Port, Handler: r, ReadHeaderTimeout: 10 * time.Second}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("Server starting", "port", cfg.Port)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+
+	select {
+	case err := <-serverErr:
+		fatal("Failed to start server", err)
+	case <-ctx.Done():
 	}
+	stop()
 
-	// Start server
-	log.Printf("Server starting on port %s", cfg.Port)
-	if err := r.Run(":" + cfg.Port); err != nil {
-		log.Fatal("Failed to start server:", err)
+	slog.Info("Shutting down", "delay", cfg.ShutdownDelay, "timeout", cfg.ShutdownTimeout)
+	healthHandler.Drain()
+	time.Sleep(cfg.ShutdownDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Requests did not finish before the shutdown timeout", "error", err)
+	}
+	if err := jobs.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Background jobs did not finish before the shutdown timeout", "error", err)
+	}
+	// Last, since requests and jobs both start calendar syncs
+	if err := calendarHandler.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Calendar syncs did not finish before the shutdown timeout", "error", err)
 	}
+	slog.Info("Server stopped")
+}
+
+// fatal logs err and exits, like log.Fatal but through the structured logger
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"subscription-tracker/internal/database"
+)
+
+const migrateUsage = `usage: server migrate <command>
+
+commands:
+  status            list migrations and whether each is applied (default)
+  up                apply all pending migrations
+  down [N]          revert the last N applied migrations (default 1)
+  baseline VERSION  mark migrations up to VERSION as applied without running them`
+
+// runMigrate handles the `migrate` subcommand
+func runMigrate(migrator *database.Migrator, args []string) error {
+	command := "status"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if s.Modified {
+				applied += " (modified since)"
+			}
+			if s.Missing {
+				applied += " (not in this build)"
+			}
+			fmt.Fprintf(w, "%03d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return w.Flush()
+
+	case "up":
+		applied, err := migrator.Up()
+		for _, m := range applied {
+			fmt.Printf("Applied %03d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("Database is up to date")
+		}
+		return err
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("down takes a positive number of migrations\n%s", migrateUsage)
+			}
+			steps = n
+		}
+		reverted, err := migrator.Down(steps)
+		for _, m := range reverted {
+			fmt.Printf("Reverted %03d_%s\n", m.Version, m.Name)
+		}
+		return err
+
+	case "baseline":
+		if len(args) < 2 {
+			return fmt.Errorf("baseline needs a version\n%s", migrateUsage)
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		if err := migrator.Baseline(version); err != nil {
+			return err
+		}
+		fmt.Printf("Marked migrations up to %03d as applied\n", version)
+		return nil
+
+	default:
+		return fmt.Errorf("unknown migrate command %q\n%s", command, migrateUsage)
+	}
+}
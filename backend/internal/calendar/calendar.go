@@ -0,0 +1,160 @@
+// Package calendar talks to external calendar providers through one interface, so subscriptions can be
+// kept in sync with Google Calendar, Outlook or any provider added later.
+package calendar
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"subscription-tracker/internal/metrics"
+)
+
+// ErrEventGone means the event was deleted in the provider's calendar
+var ErrEventGone = errors.New("calendar event no longer exists")
+
+// Token is an OAuth token set for one user and provider
+type Token struct {
+	AccessToken  string
+	RefreshToken string // Empty when a refresh kept the previous refresh token
+	Expiry       time.Time
+}
+
+// Event is a provider-neutral calendar event
+type Event struct {
+	Summary        string
+	Description    string
+	Start          time.Time // The date of all-day events, or the start time of timed ones
+	AllDay         bool
+	TimeZone       string          // IANA name the event is shown in
+	Recurrence     string          // "weekly", "monthly" or "yearly"; empty for one-off events
+	Reminders      []time.Duration // How long before the start to remind
+	SubscriptionID string          // Stored on the event where the provider allows it
+}
+
+// RemoteEvent is the part of a provider's event that sync compares against
+type RemoteEvent struct {
+	ID         string
+	Cancelled  bool
+	Summary    string
+	Date       string // Start date, YYYY-MM-DD
+	Recurrence string // Same values as Event.Recurrence
+	Updated    time.Time
+}
+
+// Provider connects a user's calendar and manages the events we create in it.
+// Calls give up when ctx ends, and after the provider client's timeout in any case.
+type Provider interface {
+	// Name is the provider's identifier in URLs and storage, e.g. "google"
+	Name() string
+	// Configured reports whether OAuth credentials are set
+	Configured() bool
+
+	AuthURL(redirectURI, state, codeChallenge string) string
+	Exchange(ctx context.Context, redirectURI, code, codeVerifier string) (*Token, error)
+	Refresh(ctx context.Context, refreshToken string) (*Token, error)
+
+	// UpsertEvent overwrites the event, or creates it when eventID is empty or the event is gone.
+	// It returns the event's ID.
+	UpsertEvent(ctx context.Context, accessToken, eventID string, event Event) (string, error)
+	GetEvent(ctx context.Context, accessToken, eventID string) (*RemoteEvent, error)
+	DeleteEvent(ctx context.Context, accessToken, eventID string) error
+}
+
+// Each provider has its own client so its calls are recorded under its name
+var (
+	googleClient    = metrics.Client("google", 30*time.Second)
+	microsoftClient = metrics.Client("microsoft", 30*time.Second)
+)
+
+// requestToken posts to an OAuth token endpoint. Google and Microsoft answer in the same shape.
+func requestToken(ctx context.Context, client *http.Client, endpoint string, data url.Values) (*Token, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse tokens: %w", err)
+	}
+	return &Token{
+		AccessToken:  result.AccessToken,
+		RefreshToken: result.RefreshToken,
+		Expiry:       time.Now().Add(time.Duration(result.ExpiresIn) * time.Second),
+	}, nil
+}
+
+// apiRequest calls a calendar API with a bearer token. 404 and 410 are reported as ErrEventGone.
+func apiRequest(ctx context.Context, client *http.Client, accessToken, method, endpoint string, body interface{}) ([]byte, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal event: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("calendar request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		return nil, ErrEventGone
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(respBody))
+	}
+	return respBody, nil
+}
+
+// location loads an event's timezone, falling back to UTC
+func location(name string) *time.Location {
+	if loc, err := time.LoadLocation(name); err == nil && name != "" {
+		return loc
+	}
+	return time.UTC
+}
@@ -0,0 +1,191 @@
+package calendar
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"subscription-tracker/internal/ical"
+)
+
+const (
+	googleAuthURL   = "https://accounts.google.com/o/oauth2/v2/auth"
+	googleTokenURL  = "https://oauth2.googleapis.com/token"
+	googleEventsURL = "https://www.googleapis.com/calendar/v3/calendars/primary/events"
+	googleScopes    = "https://www.googleapis.com/auth/calendar https://www.googleapis.com/auth/calendar.events"
+)
+
+// Google is the Google Calendar provider, writing to the user's primary calendar
+type Google struct {
+	clientID     string
+	clientSecret string
+}
+
+func NewGoogle(clientID, clientSecret string) *Google {
+	return &Google{clientID: clientID, clientSecret: clientSecret}
+}
+
+func (g *Google) Name() string {
+	return "google"
+}
+
+func (g *Google) Configured() bool {
+	return g.clientID != "" && g.clientID != "your-google-client-id"
+}
+
+func (g *Google) AuthURL(redirectURI, state, codeChallenge string) string {
+	query := url.Values{}
+	query.Set("client_id", g.clientID)
+	query.Set("redirect_uri", redirectURI)
+	query.Set("response_type", "code")
+	query.Set("scope", googleScopes)
+	query.Set("access_type", "offline")
+	query.Set("state", state)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	query.Set("prompt", "consent")
+	return googleAuthURL + "?" + query.Encode()
+}
+
+func (g *Google) Exchange(ctx context.Context, redirectURI, code, codeVerifier string) (*Token, error) {
+	data := url.Values{}
+	data.Set("code", code)
+	data.Set("client_id", g.clientID)
+	data.Set("client_secret", g.clientSecret)
+	data.Set("redirect_uri", redirectURI)
+	data.Set("grant_type", "authorization_code")
+	data.Set("code_verifier", codeVerifier)
+	return requestToken(ctx, googleClient, googleTokenURL, data)
+}
+
+func (g *Google) Refresh(ctx context.Context, refreshToken string) (*Token, error) {
+	data := url.Values{}
+	data.Set("client_id", g.clientID)
+	data.Set("client_secret", g.clientSecret)
+	data.Set("refresh_token", refreshToken)
+	data.Set("grant_type", "refresh_token")
+	return requestToken(ctx, googleClient, googleTokenURL, data)
+}
+
+func (g *Google) UpsertEvent(ctx context.Context, accessToken, eventID string, event Event) (string, error) {
+	body := googleEventBody(event)
+	if eventID != "" {
+		_, err := apiRequest(ctx, googleClient, accessToken, http.MethodPut, googleEventsURL+"/"+url.PathEscape(eventID), body)
+		if err != ErrEventGone {
+			return eventID, err
+		}
+	}
+
+	respBody, err := apiRequest(ctx, googleClient, accessToken, http.MethodPost, googleEventsURL, body)
+	if err != nil {
+		return "", err
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(respBody, &created); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+	if created.ID == "" {
+		return "", fmt.Errorf("event ID not found in response")
+	}
+	return created.ID, nil
+}
+
+func (g *Google) GetEvent(ctx context.Context, accessToken, eventID string) (*RemoteEvent, error) {
+	respBody, err := apiRequest(ctx, googleClient, accessToken, http.MethodGet, googleEventsURL+"/"+url.PathEscape(eventID), nil)
+	if err != nil {
+		return nil, err
+	}
+	var event struct {
+		ID      string    `json:"id"`
+		Status  string    `json:"status"`
+		Summary string    `json:"summary"`
+		Updated time.Time `json:"updated"`
+		Start   struct {
+			Date     string `json:"date"`
+			DateTime string `json:"dateTime"`
+		} `json:"start"`
+		Recurrence []string `json:"recurrence"`
+	}
+	if err := json.Unmarshal(respBody, &event); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	remote := &RemoteEvent{
+		ID:        event.ID,
+		Cancelled: event.Status == "cancelled",
+		Summary:   event.Summary,
+		Date:      event.Start.Date,
+		Updated:   event.Updated,
+	}
+	if remote.Date == "" && len(event.Start.DateTime) >= 10 {
+		remote.Date = event.Start.DateTime[:10]
+	}
+	for _, rule := range event.Recurrence {
+		if strings.HasPrefix(rule, "RRULE:") {
+			remote.Recurrence = googleRecurrence(rule)
+		}
+	}
+	return remote, nil
+}
+
+func (g *Google) DeleteEvent(ctx context.Context, accessToken, eventID string) error {
+	_, err := apiRequest(ctx, googleClient, accessToken, http.MethodDelete, googleEventsURL+"/"+url.PathEscape(eventID), nil)
+	return err
+}
+
+// googleEventBody builds the Google Calendar resource. Reminders a day or more ahead go by email.
+func googleEventBody(event Event) map[string]interface{} {
+	body := map[string]interface{}{
+		"summary":     event.Summary,
+		"description": event.Description,
+	}
+	if event.AllDay {
+		body["start"] = map[string]string{"date": event.Start.Format("2006-01-02")}
+		body["end"] = map[string]string{"date": event.Start.AddDate(0, 0, 1).Format("2006-01-02")}
+	} else {
+		body["start"] = map[string]string{"dateTime": event.Start.Format(time.RFC3339), "timeZone": event.TimeZone}
+		body["end"] = map[string]string{"dateTime": event.Start.Add(time.Hour).Format(time.RFC3339), "timeZone": event.TimeZone}
+	}
+
+	overrides := []map[string]interface{}{}
+	for _, before := range event.Reminders {
+		method := "popup"
+		if before >= 24*time.Hour {
+			method = "email"
+		}
+		overrides = append(overrides, map[string]interface{}{"method": method, "minutes": int(before / time.Minute)})
+	}
+	body["reminders"] = map[string]interface{}{"useDefault": false, "overrides": overrides}
+
+	if event.SubscriptionID != "" {
+		body["extendedProperties"] = map[string]interface{}{
+			"private": map[string]string{"subscriptionId": event.SubscriptionID},
+		}
+	}
+
+	switch event.Recurrence {
+	case "weekly":
+		body["recurrence"] = []string{"RRULE:FREQ=WEEKLY"}
+	case "monthly":
+		body["recurrence"] = []string{"RRULE:" + ical.MonthlyRule("MONTHLY", event.Start)}
+	case "yearly":
+		body["recurrence"] = []string{"RRULE:" + ical.MonthlyRule("YEARLY", event.Start)}
+	}
+	return body
+}
+
+// googleRecurrence maps an RRULE back to Event.Recurrence
+func googleRecurrence(rule string) string {
+	for _, part := range strings.Split(strings.TrimPrefix(rule, "RRULE:"), ";") {
+		if freq, ok := strings.CutPrefix(part, "FREQ="); ok {
+			return strings.ToLower(freq)
+		}
+	}
+	return ""
+}
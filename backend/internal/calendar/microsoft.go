@@ -0,0 +1,211 @@
+package calendar
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	microsoftLoginURL  = "https://login.microsoftonline.com/"
+	microsoftEventsURL = "https://graph.microsoft.com/v1.0/me/events"
+	microsoftScopes    = "offline_access Calendars.ReadWrite"
+	// graphDateTime is the local date-time format Microsoft Graph uses with a separate timeZone
+	graphDateTime = "2006-01-02T15:04:05"
+)
+
+// Microsoft is the Outlook calendar provider, using Microsoft Graph and the user's default calendar
+type Microsoft struct {
+	clientID     string
+	clientSecret string
+	tenant       string
+}
+
+// NewMicrosoft creates the provider. tenant defaults to "common", which allows work and personal accounts.
+func NewMicrosoft(clientID, clientSecret, tenant string) *Microsoft {
+	if tenant == "" {
+		tenant = "common"
+	}
+	return &Microsoft{clientID: clientID, clientSecret: clientSecret, tenant: tenant}
+}
+
+func (m *Microsoft) Name() string {
+	return "microsoft"
+}
+
+func (m *Microsoft) Configured() bool {
+	return m.clientID != ""
+}
+
+func (m *Microsoft) AuthURL(redirectURI, state, codeChallenge string) string {
+	query := url.Values{}
+	query.Set("client_id", m.clientID)
+	query.Set("redirect_uri", redirectURI)
+	query.Set("response_type", "code")
+	query.Set("response_mode", "query")
+	query.Set("scope", microsoftScopes)
+	query.Set("state", state)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	return m.endpoint("authorize") + "?" + query.Encode()
+}
+
+func (m *Microsoft) Exchange(ctx context.Context, redirectURI, code, codeVerifier string) (*Token, error) {
+	data := url.Values{}
+	data.Set("code", code)
+	data.Set("client_id", m.clientID)
+	data.Set("client_secret", m.clientSecret)
+	data.Set("redirect_uri", redirectURI)
+	data.Set("grant_type", "authorization_code")
+	data.Set("code_verifier", codeVerifier)
+	data.Set("scope", microsoftScopes)
+	return requestToken(ctx, microsoftClient, m.endpoint("token"), data)
+}
+
+func (m *Microsoft) Refresh(ctx context.Context, refreshToken string) (*Token, error) {
+	data := url.Values{}
+	data.Set("client_id", m.clientID)
+	data.Set("client_secret", m.clientSecret)
+	data.Set("refresh_token", refreshToken)
+	data.Set("grant_type", "refresh_token")
+	data.Set("scope", microsoftScopes)
+	return requestToken(ctx, microsoftClient, m.endpoint("token"), data)
+}
+
+func (m *Microsoft) UpsertEvent(ctx context.Context, accessToken, eventID string, event Event) (string, error) {
+	body := microsoftEventBody(event)
+	if eventID != "" {
+		_, err := apiRequest(ctx, microsoftClient, accessToken, http.MethodPatch, microsoftEventsURL+"/"+url.PathEscape(eventID), body)
+		if err != ErrEventGone {
+			return eventID, err
+		}
+	}
+
+	respBody, err := apiRequest(ctx, microsoftClient, accessToken, http.MethodPost, microsoftEventsURL, body)
+	if err != nil {
+		return "", err
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(respBody, &created); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+	if created.ID == "" {
+		return "", fmt.Errorf("event ID not found in response")
+	}
+	return created.ID, nil
+}
+
+func (m *Microsoft) GetEvent(ctx context.Context, accessToken, eventID string) (*RemoteEvent, error) {
+	respBody, err := apiRequest(ctx, microsoftClient, accessToken, http.MethodGet, microsoftEventsURL+"/"+url.PathEscape(eventID), nil)
+	if err != nil {
+		return nil, err
+	}
+	var event struct {
+		ID                   string    `json:"id"`
+		Subject              string    `json:"subject"`
+		IsCancelled          bool      `json:"isCancelled"`
+		LastModifiedDateTime time.Time `json:"lastModifiedDateTime"`
+		Start                struct {
+			DateTime string `json:"dateTime"`
+		} `json:"start"`
+		Recurrence *struct {
+			Pattern struct {
+				Type string `json:"type"`
+			} `json:"pattern"`
+		} `json:"recurrence"`
+	}
+	if err := json.Unmarshal(respBody, &event); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	remote := &RemoteEvent{
+		ID:        event.ID,
+		Cancelled: event.IsCancelled,
+		Summary:   event.Subject,
+		Updated:   event.LastModifiedDateTime,
+	}
+	if len(event.Start.DateTime) >= 10 {
+		remote.Date = event.Start.DateTime[:10]
+	}
+	if event.Recurrence != nil {
+		switch event.Recurrence.Pattern.Type {
+		case "weekly":
+			remote.Recurrence = "weekly"
+		case "absoluteMonthly":
+			remote.Recurrence = "monthly"
+		case "absoluteYearly":
+			remote.Recurrence = "yearly"
+		}
+	}
+	return remote, nil
+}
+
+func (m *Microsoft) DeleteEvent(ctx context.Context, accessToken, eventID string) error {
+	_, err := apiRequest(ctx, microsoftClient, accessToken, http.MethodDelete, microsoftEventsURL+"/"+url.PathEscape(eventID), nil)
+	return err
+}
+
+func (m *Microsoft) endpoint(name string) string {
+	return microsoftLoginURL + url.PathEscape(m.tenant) + "/oauth2/v2.0/" + name
+}
+
+// microsoftEventBody builds the Graph event resource. Outlook keeps a single reminder, so the earliest is used.
+func microsoftEventBody(event Event) map[string]interface{} {
+	start := event.Start.In(location(event.TimeZone))
+	end := start.Add(time.Hour)
+	if event.AllDay {
+		// All-day events run midnight to midnight in the event's timezone
+		start = time.Date(event.Start.Year(), event.Start.Month(), event.Start.Day(), 0, 0, 0, 0, time.UTC)
+		end = start.AddDate(0, 0, 1)
+	}
+	timeZone := event.TimeZone
+	if timeZone == "" {
+		timeZone = "UTC"
+	}
+
+	body := map[string]interface{}{
+		"subject":  event.Summary,
+		"body":     map[string]string{"contentType": "text", "content": event.Description},
+		"start":    map[string]string{"dateTime": start.Format(graphDateTime), "timeZone": timeZone},
+		"end":      map[string]string{"dateTime": end.Format(graphDateTime), "timeZone": timeZone},
+		"isAllDay": event.AllDay,
+	}
+
+	var reminder time.Duration
+	for _, before := range event.Reminders {
+		if before > reminder {
+			reminder = before
+		}
+	}
+	body["isReminderOn"] = reminder > 0
+	if reminder > 0 {
+		body["reminderMinutesBeforeStart"] = int(reminder / time.Minute)
+	}
+
+	pattern := map[string]interface{}{"interval": 1}
+	switch event.Recurrence {
+	case "weekly":
+		pattern["type"] = "weekly"
+		pattern["daysOfWeek"] = []string{strings.ToLower(start.Weekday().String())}
+	case "monthly":
+		pattern["type"] = "absoluteMonthly"
+		pattern["dayOfMonth"] = start.Day()
+	case "yearly":
+		pattern["type"] = "absoluteYearly"
+		pattern["dayOfMonth"] = start.Day()
+		pattern["month"] = int(start.Month())
+	}
+	if _, ok := pattern["type"]; ok {
+		body["recurrence"] = map[string]interface{}{
+			"pattern": pattern,
+			"range":   map[string]string{"type": "noEnd", "startDate": start.Format("2006-01-02")},
+		}
+	}
+	return body
+}
@@ -1,31 +1,163 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
+	"strings"
+	"time"
+
+	"subscription-tracker/internal/metrics"
+	"subscription-tracker/internal/tracing"
 
 	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	semconv "go.opentelemetry.io/otel/semconv/v1.30.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Dialect is the SQL database behind a DB
+type Dialect string
+
+const (
+	Postgres Dialect = "postgres"
+	SQLite   Dialect = "sqlite"
 )
 
 type DB struct {
 	*sql.DB
+	Dialect Dialect
+	// Longest a single database operation may run; zero means no limit beyond the caller's context
+	QueryTimeout time.Duration
 }
 
-func Connect(databaseURL string) (*DB, error) {
-	db, err := sql.Open("postgres", databaseURL)
+// PoolConfig sizes the connection pool. Zero values keep database/sql's defaults.
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	QueryTimeout    time.Duration
+}
+
+// Connect opens the database named by databaseURL. postgres:// and postgresql:// URLs use PostgreSQL;
+// sqlite://path/to/file.db (or sqlite://:memory:) uses SQLite, for single-user deployments.
+func Connect(databaseURL string, pool PoolConfig) (*DB, error) {
+	dialect, driver, dsn := Postgres, "postgres", databaseURL
+	if path, ok := strings.CutPrefix(databaseURL, "sqlite://"); ok {
+		dialect, driver, dsn = SQLite, "sqlite3", sqliteDSN(path)
+	}
+
+	db, err := sql.Open(driver, dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
+	if pool.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(pool.MaxOpenConns)
+	}
+	if pool.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(pool.MaxIdleConns)
+	}
+	if pool.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	}
+	if pool.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(pool.ConnMaxIdleTime)
+	}
+	if dialect == SQLite && strings.Contains(dsn, ":memory:") {
+		// Every connection to :memory: is a separate database, and closing the last one discards it
+		db.SetMaxOpenConns(1)
+		db.SetConnMaxLifetime(0)
+		db.SetConnMaxIdleTime(0)
+	}
 
-	if err := db.Ping(); err != nil {
+	conn := &DB{DB: db, Dialect: dialect, QueryTimeout: pool.QueryTimeout}
+	ctx, cancel := conn.WithTimeout(context.Background())
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	log.Println("Database connected successfully")
-	return &DB{db}, nil
+	slog.Info("Database connected successfully", "dialect", dialect)
+	return conn, nil
+}
+
+// WithTimeout bounds one database operation by QueryTimeout. The operation also ends when ctx does,
+// e.g. when the client behind a request disconnects.
+func (db *DB) WithTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if db.QueryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, db.QueryTimeout)
+}
+
+// ExecContext runs a statement like *sql.DB's, in a span of its own, and records its timing in the
+// metrics. Statements run inside a transaction go through *sql.Tx and are neither traced nor recorded.
+func (db *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, done := db.observe(ctx, "exec", query)
+	result, err := db.DB.ExecContext(ctx, query, args...)
+	done(err)
+	return result, err
+}
+
+// QueryContext runs a query like *sql.DB's and traces and records it
+func (db *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, done := db.observe(ctx, "query", query)
+	rows, err := db.DB.QueryContext(ctx, query, args...)
+	done(err)
+	return rows, err
+}
+
+// QueryRowContext runs a single-row query like *sql.DB's and traces and records it
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, done := db.observe(ctx, "query_row", query)
+	row := db.DB.QueryRowContext(ctx, query, args...)
+	done(row.Err())
+	return row
+}
+
+// observe starts a span for one statement. The returned function ends it and records the metrics.
+// The span covers running the statement, not reading the rows it returns.
+func (db *DB) observe(ctx context.Context, operation, query string) (context.Context, func(error)) {
+	system := semconv.DBSystemNamePostgreSQL
+	if db.Dialect == SQLite {
+		system = semconv.DBSystemNameSqlite
+	}
+	verb := statementVerb(query)
+	ctx, span := tracing.Tracer().Start(ctx, verb,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(system, semconv.DBOperationName(verb), semconv.DBQueryText(query)),
+	)
+
+	start := time.Now()
+	return ctx, func(err error) {
+		metrics.ObserveQuery(operation, time.Since(start), err)
+		tracing.End(span, err)
+	}
+}
+
+// statementVerb returns the first keyword of query, such as SELECT or INSERT. Queries are always
+// parameterized, so the text is safe to attach to spans.
+func statementVerb(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "SQL"
+	}
+	return strings.ToUpper(fields[0])
+}
+
+// sqliteDSN enables foreign keys, which SQLite leaves off by default, waits on a busy database
+// instead of failing, and takes the write lock when a transaction begins so concurrent
+// transactions queue up rather than deadlock
+func sqliteDSN(path string) string {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return "file:" + path + sep + "_foreign_keys=on&_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate"
 }
 
 func (db *DB) Close() error {
 	return db.DB.Close()
-}
\ No newline at end of file
+}
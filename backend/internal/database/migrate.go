@@ -0,0 +1,387 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationLockID is the Postgres advisory lock held while migrating, so instances starting together
+// apply each migration once. SQLite is only ever opened by one server, so it needs no lock.
+const migrationLockID int64 = 7_301_466_517_246_810
+
+// ErrUnversionedSchema means the database already has tables but no migration history, as happens when
+// the schema was loaded by hand or by Postgres' docker-entrypoint-initdb.d
+var ErrUnversionedSchema = errors.New("database has tables but no migration history; run `migrate baseline <version>` with the last version already applied")
+
+// Migration is one versioned schema change
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string // Empty when the migration has no down file
+	Checksum string // SHA-256 of Up, to notice migrations edited after they were applied
+}
+
+// MigrationStatus is a migration and whether it has been applied
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+	Modified  bool // Applied with a different checksum than the embedded file
+	Missing   bool // Applied, but not embedded in this binary
+}
+
+// Migrator applies embedded migrations and records them in schema_migrations
+type Migrator struct {
+	db         *DB
+	migrations []Migration
+}
+
+type appliedMigration struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// NewMigrator loads the migrations in fsys. Files are NNN_name.sql, with an optional NNN_name.down.sql.
+func NewMigrator(db *DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := LoadMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// LoadMigrations reads the migrations in fsys, ordered by version
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, file := range files {
+		base := strings.TrimSuffix(file, ".sql")
+		down := strings.HasSuffix(base, ".down")
+		base = strings.TrimSuffix(base, ".down")
+
+		prefix, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s must be named NNN_name.sql", file)
+		}
+
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", file, err)
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", m.Name, name, version)
+		}
+
+		if down {
+			m.Down = string(content)
+		} else {
+			sum := sha256.Sum256(content)
+			m.Up = string(content)
+			m.Checksum = hex.EncodeToString(sum[:])
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Checksum == "" {
+			return nil, fmt.Errorf("migration %03d_%s has a down file but no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Up applies every pending migration in version order, each in its own transaction, and returns those applied.
+// It refuses to run when an applied migration's file has changed since.
+func (m *Migrator) Up() ([]Migration, error) {
+	var applied []Migration
+	err := m.withLock(func(conn *sql.Conn) error {
+		done, err := m.applied(conn)
+		if err != nil {
+			return err
+		}
+		if len(done) == 0 {
+			existing, err := m.hasUsersTable(conn)
+			if err != nil {
+				return fmt.Errorf("failed to inspect schema: %w", err)
+			}
+			if existing {
+				return ErrUnversionedSchema
+			}
+		}
+
+		for _, migration := range m.migrations {
+			if prev, ok := done[migration.Version]; ok && prev.checksum != migration.Checksum {
+				return fmt.Errorf("migration %03d_%s was modified after it was applied", migration.Version, migration.Name)
+			}
+		}
+		for version, prev := range done {
+			if m.find(version) == nil {
+				slog.Warn("Migration is applied but not known to this build", "version", version, "name", prev.name)
+			}
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+			err := inTx(conn, func(tx *sql.Tx) error {
+				if _, err := tx.Exec(migration.Up); err != nil {
+					return err
+				}
+				_, err := tx.Exec("INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)",
+					migration.Version, migration.Name, migration.Checksum)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %03d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the last steps applied migrations, newest first, and returns those reverted
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := m.withLock(func(conn *sql.Conn) error {
+		done, err := m.applied(conn)
+		if err != nil {
+			return err
+		}
+		versions := make([]int, 0, len(done))
+		for version := range done {
+			versions = append(versions, version)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+
+		for _, version := range versions {
+			if len(reverted) == steps {
+				break
+			}
+			migration := m.find(version)
+			if migration == nil {
+				return fmt.Errorf("migration %03d_%s is not known to this build", version, done[version].name)
+			}
+			if migration.Down == "" {
+				return fmt.Errorf("migration %03d_%s has no down migration", version, migration.Name)
+			}
+
+			err := inTx(conn, func(tx *sql.Tx) error {
+				if _, err := tx.Exec(migration.Down); err != nil {
+					return err
+				}
+				_, err := tx.Exec("DELETE FROM schema_migrations WHERE version = $1", version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("reverting migration %03d_%s failed: %w", version, migration.Name, err)
+			}
+			reverted = append(reverted, *migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Baseline records every migration up to version as applied without running it, for databases whose
+// schema was created before migrations were tracked
+func (m *Migrator) Baseline(version int) error {
+	if m.find(version) == nil {
+		return fmt.Errorf("unknown migration version %d", version)
+	}
+	return m.withLock(func(conn *sql.Conn) error {
+		return inTx(conn, func(tx *sql.Tx) error {
+			for _, migration := range m.migrations {
+				if migration.Version > version {
+					break
+				}
+				_, err := tx.Exec(`
+					INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)
+					ON CONFLICT (version) DO NOTHING
+				`, migration.Version, migration.Name, migration.Checksum)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// Status lists every embedded migration, plus any applied migration this build doesn't know about
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := m.withLock(func(conn *sql.Conn) error {
+		done, err := m.applied(conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+			if prev, ok := done[migration.Version]; ok {
+				appliedAt := prev.appliedAt
+				status.AppliedAt = &appliedAt
+				status.Modified = prev.checksum != migration.Checksum
+			}
+			statuses = append(statuses, status)
+		}
+		for version, prev := range done {
+			if m.find(version) == nil {
+				appliedAt := prev.appliedAt
+				statuses = append(statuses, MigrationStatus{Version: version, Name: prev.name, AppliedAt: &appliedAt, Missing: true})
+			}
+		}
+		sort.Slice(statuses, func(i, j int) bool {
+			return statuses[i].Version < statuses[j].Version
+		})
+		return nil
+	})
+	return statuses, err
+}
+
+// Pending returns the versions of embedded migrations not yet applied. Unlike Status it reads
+// schema_migrations without taking the migration lock, so it is cheap enough for readiness probes.
+func (m *Migrator) Pending(ctx context.Context) ([]int, error) {
+	ctx, cancel := m.db.WithTimeout(ctx)
+	defer cancel()
+
+	rows, err := m.db.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	done := map[int]bool{}
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+		}
+		done[version] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+
+	var pending []int
+	for _, migration := range m.migrations {
+		if !done[migration.Version] {
+			pending = append(pending, migration.Version)
+		}
+	}
+	return pending, nil
+}
+
+// withLock runs fn on a single connection holding the migration lock, creating schema_migrations first
+func (m *Migrator) withLock(fn func(conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	appliedAtType := "TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()"
+	if m.db.Dialect == SQLite {
+		appliedAtType = "TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP"
+	} else {
+		// Advisory locks belong to the session, so the lock and the migrations must share this connection
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+		defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationLockID)
+	}
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			checksum VARCHAR(64) NOT NULL,
+			applied_at `+appliedAtType+`
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	return fn(conn)
+}
+
+func (m *Migrator) applied(conn *sql.Conn) (map[int]appliedMigration, error) {
+	rows, err := conn.QueryContext(context.Background(), "SELECT version, name, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	done := map[int]appliedMigration{}
+	for rows.Next() {
+		var version int
+		var prev appliedMigration
+		if err := rows.Scan(&version, &prev.name, &prev.checksum, &prev.appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+		}
+		done[version] = prev
+	}
+	return done, rows.Err()
+}
+
+// hasUsersTable reports whether the schema was created already, with or without migrations
+func (m *Migrator) hasUsersTable(conn *sql.Conn) (bool, error) {
+	query := "SELECT to_regclass('users') IS NOT NULL"
+	if m.db.Dialect == SQLite {
+		query = "SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'users')"
+	}
+	var exists bool
+	err := conn.QueryRowContext(context.Background(), query).Scan(&exists)
+	return exists, err
+}
+
+func (m *Migrator) find(version int) *Migration {
+	for i := range m.migrations {
+		if m.migrations[i].Version == version {
+			return &m.migrations[i]
+		}
+	}
+	return nil
+}
+
+func inTx(conn *sql.Conn, fn func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
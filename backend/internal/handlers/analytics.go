@@ -1,31 +1,54 @@
 package handlers
 
 import (
+	"log/slog"
 	"net/http"
+	"sort"
 	"time"
 
-	"subscription-tracker/internal/database"
 	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/problem"
+	"subscription-tracker/internal/store"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
 type AnalyticsHandler struct {
-	db *database.DB
+	store store.Store
 }
 
-func NewAnalyticsHandler(db *database.DB) *AnalyticsHandler {
-	return &AnalyticsHandler{db: db}
+func NewAnalyticsHandler(st store.Store) *AnalyticsHandler {
+	return &AnalyticsHandler{store: st}
 }
 
 type AnalyticsSummary struct {
-	TotalMonthlySpending  float64 `json:"total_monthly_spending"`
-	TotalYearlySpending   float64 `json:"total_yearly_spending"`
-	ActiveSubscriptions   int     `json:"active_subscriptions"`
-	UpcomingRenewals      int     `json:"upcoming_renewals"`
-	CategoryBreakdown     []CategorySpending `json:"category_breakdown"`
-	MonthlyTrend          []MonthlySpending  `json:"monthly_trend"`
+	TotalMonthlySpending   float64            `json:"total_monthly_spending"`
+	TotalYearlySpending    float64            `json:"total_yearly_spending"`
+	ActiveSubscriptions    int                `json:"active_subscriptions"`
+	UpcomingRenewals       int                `json:"upcoming_renewals"`
+	CategoryBreakdown      []CategorySpending `json:"category_breakdown"`
+	MonthlyTrend           []MonthlySpending  `json:"monthly_trend"`
+	ActiveTrials           int                `json:"active_trials"`
+	TrialsEndingSoon       []TrialEnding      `json:"trials_ending_soon"`
+	PriceIncreasesThisYear int                `json:"price_increases_this_year"`
+	PriceIncreases         []PriceIncrease    `json:"price_increases"`
+	Currency               string             `json:"currency"`
+}
+
+type PriceIncrease struct {
+	SubscriptionID uuid.UUID `json:"subscription_id"`
+	Name           string    `json:"name"`
+	PreviousPrice  float64   `json:"previous_price"`
+	Price          float64   `json:"price"`
+	EffectiveDate  time.Time `json:"effective_date"`
+}
+
+type TrialEnding struct {
+	SubscriptionID uuid.UUID `json:"subscription_id"`
+	Name           string    `json:"name"`
+	TrialEndDate   time.Time `json:"trial_end_date"`
+	PostTrialPrice float64   `json:"post_trial_price"`
 }
 
 type CategorySpending struct {
@@ -42,75 +65,106 @@ type MonthlySpending struct {
 func (h *AnalyticsHandler) GetSummary(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not authenticated"})
+		problem.Respond(c, http.StatusUnauthorized, problem.Unauthenticated, "User not authenticated")
 		return
 	}
 
-	summary := AnalyticsSummary{}
-
-	// Calculate total monthly spending
-	err := h.db.QueryRow(
-		"SELECT COALESCE(SUM(price), 0) FROM subscriptions WHERE user_id = $1 AND status = 'active'",
-		userID.(uuid.UUID),
-	).Scan(&summary.TotalMonthlySpending)
+	ctx := c.Request.Context()
+
+	// Week and year boundaries follow the user's timezone, not the server's
+	settings := storedLocale(ctx, h.store.Users(), userID.(uuid.UUID))
+	today := settings.Today()
+	nextWeek := today.AddDate(0, 0, 7)
+	summary := AnalyticsSummary{Currency: settings.Currency}
+
+	names := map[uuid.UUID]string{}
+	categories := map[string]*CategorySpending{}
+	err := h.store.Subscriptions().Each(ctx, userID.(uuid.UUID), store.SubscriptionQuery{}, func(sub models.Subscription) error {
+		names[sub.ID] = sub.Name
+		switch sub.Status {
+		case "active":
+			summary.TotalMonthlySpending += sub.Price
+			summary.ActiveSubscriptions++
+			if !sub.BillingDate.After(nextWeek) {
+				summary.UpcomingRenewals++
+			}
+
+			categoryName := "Other"
+			if sub.Category != nil {
+				categoryName = sub.Category.Name
+			}
+			cs, ok := categories[categoryName]
+			if !ok {
+				cs = &CategorySpending{CategoryName: categoryName}
+				categories[categoryName] = cs
+			}
+			cs.Amount += sub.Price
+			cs.Count++
+		case "trial":
+			// Free trials, and those converting to paid within the next 7 days
+			summary.ActiveTrials++
+			if sub.TrialEndDate != nil && !sub.TrialEndDate.After(nextWeek) {
+				price := sub.Price
+				if sub.PostTrialPrice != nil {
+					price = *sub.PostTrialPrice
+				}
+				summary.TrialsEndingSoon = append(summary.TrialsEndingSoon, TrialEnding{
+					SubscriptionID: sub.ID, Name: sub.Name, TrialEndDate: *sub.TrialEndDate, PostTrialPrice: price,
+				})
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to calculate monthly spending"})
+		slog.ErrorContext(ctx, "Failed to calculate analytics", "user_id", userID, "error", err)
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Failed to calculate spending")
 		return
 	}
 
 	summary.TotalYearlySpending = summary.TotalMonthlySpending * 12
 
-	// Count active subscriptions
-	err = h.db.QueryRow(
-		"SELECT COUNT(*) FROM subscriptions WHERE user_id = $1 AND status = 'active'",
-		userID.(uuid.UUID),
-	).Scan(&summary.ActiveSubscriptions)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to count subscriptions"})
-		return
+	for _, cs := range categories {
+		summary.CategoryBreakdown = append(summary.CategoryBreakdown, *cs)
 	}
-
-	// Count upcoming renewals (next 7 days)
-	nextWeek := time.Now().AddDate(0, 0, 7)
-	err = h.db.QueryRow(
-		"SELECT COUNT(*) FROM subscriptions WHERE user_id = $1 AND status = 'active' AND billing_date <= $2",
-		userID.(uuid.UUID), nextWeek,
-	).Scan(&summary.UpcomingRenewals)
+	sort.Slice(summary.CategoryBreakdown, func(i, j int) bool {
+		a, b := summary.CategoryBreakdown[i], summary.CategoryBreakdown[j]
+		if a.Amount != b.Amount {
+			return a.Amount > b.Amount
+		}
+		return a.CategoryName < b.CategoryName
+	})
+	sort.SliceStable(summary.TrialsEndingSoon, func(i, j int) bool {
+		return summary.TrialsEndingSoon[i].TrialEndDate.Before(summary.TrialsEndingSoon[j].TrialEndDate)
+	})
+
+	// Services that raised their price this year (latest increase per subscription)
+	changes, err := h.store.Subscriptions().PriceChangesSince(ctx, userID.(uuid.UUID), time.Date(today.Year(), time.January, 1, 0, 0, 0, 0, time.UTC))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to count upcoming renewals"})
+		slog.ErrorContext(ctx, "Failed to get price increases", "user_id", userID, "error", err)
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Failed to get price increases")
 		return
 	}
 
-	// Category breakdown
-	rows, err := h.db.Query(`
-		SELECT COALESCE(c.name, 'Other') as category_name, 
-		       COALESCE(SUM(s.price), 0) as amount,
-		       COUNT(s.id) as count
-		FROM subscriptions s
-		LEFT JOIN categories c ON s.category_id = c.id
-		WHERE s.user_id = $1 AND s.status = 'active'
-		GROUP BY c.name
-		ORDER BY amount DESC
-	`, userID.(uuid.UUID))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to get category breakdown"})
-		return
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var cs CategorySpending
-		err := rows.Scan(&cs.CategoryName, &cs.Amount, &cs.Count)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to scan category data"})
-			return
+	increased := map[uuid.UUID]bool{}
+	for _, pc := range changes {
+		if increased[pc.SubscriptionID] || pc.Source == "trial_conversion" || pc.PreviousPrice == nil || pc.Price <= *pc.PreviousPrice {
+			continue
 		}
-		summary.CategoryBreakdown = append(summary.CategoryBreakdown, cs)
+		increased[pc.SubscriptionID] = true
+		summary.PriceIncreases = append(summary.PriceIncreases, PriceIncrease{
+			SubscriptionID: pc.SubscriptionID,
+			Name:           names[pc.SubscriptionID],
+			PreviousPrice:  *pc.PreviousPrice,
+			Price:          pc.Price,
+			EffectiveDate:  pc.EffectiveDate,
+		})
 	}
+	summary.PriceIncreasesThisYear = len(summary.PriceIncreases)
 
 	// Mock monthly trend for the last 6 months
+	firstOfMonth := today.AddDate(0, 0, 1-today.Day())
 	for i := 5; i >= 0; i-- {
-		date := time.Now().AddDate(0, -i, 0)
+		date := firstOfMonth.AddDate(0, -i, 0)
 		month := date.Format("2006-01")
 		// For now, use current monthly spending as trend
 		summary.MonthlyTrend = append(summary.MonthlyTrend, MonthlySpending{
@@ -120,4 +174,4 @@ func (h *AnalyticsHandler) GetSummary(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, summary)
-}
\ No newline at end of file
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"subscription-tracker/internal/models"
+)
+
+func TestAnalyticsSummary(t *testing.T) {
+	srv := newTestServer(t)
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	entertainment, music := "Entertainment", "Music"
+	netflix := srv.createSubscription(models.CreateSubscriptionRequest{Name: "Netflix", Price: 10, Category: &entertainment, BillingDate: today.AddDate(0, 0, 3)})
+	srv.createSubscription(models.CreateSubscriptionRequest{Name: "Hulu", Price: 8, Category: &entertainment, BillingDate: today.AddDate(0, 0, 20)})
+	srv.createSubscription(models.CreateSubscriptionRequest{Name: "Spotify", Price: 5, Category: &music, BillingDate: today.AddDate(0, 0, 20)})
+	trialEnd := today.AddDate(0, 0, 2)
+	srv.createSubscription(models.CreateSubscriptionRequest{Name: "Trial", Price: 9, Status: "trial", TrialEndDate: &trialEnd})
+
+	price := 12.0
+	srv.do(nil, http.MethodPatch, "/api/subscriptions/"+netflix.ID.String(), models.UpdateSubscriptionRequest{Price: &price}, nil)
+
+	var summary AnalyticsSummary
+	if code := srv.do(nil, http.MethodGet, "/api/analytics/summary", nil, &summary); code != http.StatusOK {
+		t.Fatalf("summary: status %d", code)
+	}
+
+	if summary.TotalMonthlySpending != 25 || summary.TotalYearlySpending != 300 {
+		t.Errorf("spending = %v monthly, %v yearly, want 25 and 300", summary.TotalMonthlySpending, summary.TotalYearlySpending)
+	}
+	if summary.ActiveSubscriptions != 3 || summary.UpcomingRenewals != 1 {
+		t.Errorf("%d active and %d renewing, want 3 and 1", summary.ActiveSubscriptions, summary.UpcomingRenewals)
+	}
+	if len(summary.CategoryBreakdown) != 2 || summary.CategoryBreakdown[0].CategoryName != "Entertainment" ||
+		summary.CategoryBreakdown[0].Amount != 20 || summary.CategoryBreakdown[0].Count != 2 {
+		t.Errorf("categories = %+v, want Entertainment first at 20", summary.CategoryBreakdown)
+	}
+	if summary.ActiveTrials != 1 || len(summary.TrialsEndingSoon) != 1 {
+		t.Errorf("trials = %d, ending soon %+v, want 1 and 1", summary.ActiveTrials, summary.TrialsEndingSoon)
+	}
+	if summary.PriceIncreasesThisYear != 1 || summary.PriceIncreases[0].Name != "Netflix" || summary.PriceIncreases[0].PreviousPrice != 10 {
+		t.Errorf("price increases = %+v, want Netflix from 10", summary.PriceIncreases)
+	}
+}
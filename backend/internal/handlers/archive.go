@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/problem"
+	"subscription-tracker/internal/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// GetArchivedSubscriptions lists deleted subscriptions that have not been purged yet
+func (h *SubscriptionHandler) GetArchivedSubscriptions(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		problem.Respond(c, http.StatusUnauthorized, problem.Unauthenticated, "User not authenticated")
+		return
+	}
+
+	subscriptions, err := h.store.Subscriptions().ListArchived(c.Request.Context(), userID.(uuid.UUID))
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Database error")
+		return
+	}
+
+	c.JSON(http.StatusOK, subscriptions)
+}
+
+// errUndoExpired is returned inside restore's transaction when the undo window has passed
+var errUndoExpired = errors.New("undo window has expired")
+
+// UndoDelete restores a subscription deleted within the undo window
+func (h *SubscriptionHandler) UndoDelete(c *gin.Context) {
+	h.restore(c, true)
+}
+
+// RestoreSubscription restores an archived subscription at any point before it is purged
+func (h *SubscriptionHandler) RestoreSubscription(c *gin.Context) {
+	h.restore(c, false)
+}
+
+func (h *SubscriptionHandler) restore(c *gin.Context, withinUndoWindow bool) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		problem.Respond(c, http.StatusUnauthorized, problem.Unauthenticated, "User not authenticated")
+		return
+	}
+
+	subscriptionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, problem.InvalidID, "Invalid subscription ID")
+		return
+	}
+
+	ctx := c.Request.Context()
+	actorID := userID.(uuid.UUID)
+	err = h.store.WithTx(ctx, func(tx store.Store) error {
+		before, err := tx.Subscriptions().GetArchivedForUpdate(ctx, actorID, subscriptionID)
+		if err != nil {
+			return err
+		}
+		if withinUndoWindow && time.Since(*before.DeletedAt) > h.undoWindow {
+			return errUndoExpired
+		}
+
+		if err := tx.Subscriptions().Restore(ctx, actorID, subscriptionID); err != nil {
+			return err
+		}
+		after := *before
+		after.DeletedAt = nil
+		if err := auditSubscription(ctx, tx.Subscriptions(), before.UserID, &actorID, "restore", before, &after); err != nil {
+			return fmt.Errorf("failed to record history: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		switch {
+		case err == store.ErrNotFound:
+			problem.Respond(c, http.StatusNotFound, problem.NotFound, "Archived subscription not found")
+		case err == errUndoExpired:
+			problem.Respond(c, http.StatusGone, problem.Expired, "Undo window has expired. Restore the subscription from the archive instead")
+		default:
+			slog.ErrorContext(ctx, "Failed to restore subscription", "subscription_id", subscriptionID, "error", err)
+			problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Failed to restore subscription")
+		}
+		return
+	}
+	h.syncCalendar(ctx, actorID, subscriptionID)
+
+	h.GetSubscription(c)
+}
+
+// PurgeArchived permanently removes subscriptions archived for longer than the retention period.
+// The audit log keeps a final "purge" entry with the last known version.
+func (h *SubscriptionHandler) PurgeArchived(ctx context.Context) error {
+	var purged []models.Subscription
+	err := h.store.WithTx(ctx, func(tx store.Store) error {
+		var err error
+		if purged, err = tx.Subscriptions().Purge(ctx, time.Now().Add(-h.archiveRetention)); err != nil {
+			return fmt.Errorf("failed to purge archived subscriptions: %w", err)
+		}
+		for i := range purged {
+			if err := auditSubscription(ctx, tx.Subscriptions(), purged[i].UserID, nil, "purge", &purged[i], nil); err != nil {
+				return fmt.Errorf("failed to record purge history: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Clears any calendar event left behind by a failed sync
+	for _, sub := range purged {
+		h.syncCalendar(ctx, sub.UserID, sub.ID)
+	}
+
+	return nil
+}
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"time"
+
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/problem"
+	"subscription-tracker/internal/store"
+	"subscription-tracker/internal/validate"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// auditIgnoredFields are bookkeeping fields that never count as a change
+var auditIgnoredFields = map[string]bool{
+	"id":         true,
+	"user_id":    true,
+	"created_at": true,
+	"updated_at": true,
+	"category":   true,
+}
+
+// diffSubscriptions compares two versions field by field using their JSON representation.
+// Either side may be nil, for creates and deletes.
+func diffSubscriptions(before, after *models.Subscription) (map[string]models.FieldChange, error) {
+	oldFields, err := subscriptionFields(before)
+	if err != nil {
+		return nil, err
+	}
+	newFields, err := subscriptionFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]models.FieldChange{}
+	for field := range mergeKeys(oldFields, newFields) {
+		if auditIgnoredFields[field] {
+			continue
+		}
+		if !reflect.DeepEqual(oldFields[field], newFields[field]) {
+			changes[field] = models.FieldChange{Old: oldFields[field], New: newFields[field]}
+		}
+	}
+	return changes, nil
+}
+
+func subscriptionFields(sub *models.Subscription) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	if sub == nil {
+		return fields, nil
+	}
+	data, err := json.Marshal(sub)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+func mergeKeys(a, b map[string]interface{}) map[string]struct{} {
+	keys := make(map[string]struct{}, len(a)+len(b))
+	for k := range a {
+		keys[k] = struct{}{}
+	}
+	for k := range b {
+		keys[k] = struct{}{}
+	}
+	return keys
+}
+
+// newAuditEntry builds the audit entry for a change to a subscription. actorID is nil for background jobs.
+// It returns nil for updates that change nothing, which are not recorded.
+func newAuditEntry(ownerID uuid.UUID, actorID *uuid.UUID, action string, before, after *models.Subscription) (*models.SubscriptionAuditEntry, error) {
+	changes, err := diffSubscriptions(before, after)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff subscription: %w", err)
+	}
+	if action == "update" && len(changes) == 0 {
+		return nil, nil
+	}
+
+	snapshot := after
+	if snapshot == nil {
+		snapshot = before
+	}
+	return &models.SubscriptionAuditEntry{
+		SubscriptionID: snapshot.ID,
+		UserID:         ownerID,
+		ActorID:        actorID,
+		Action:         action,
+		Changes:        changes,
+		Snapshot:       snapshot,
+	}, nil
+}
+
+// auditSubscription records a change to a subscription through the store
+func auditSubscription(ctx context.Context, subs store.SubscriptionStore, ownerID uuid.UUID, actorID *uuid.UUID, action string, before, after *models.Subscription) error {
+	entry, err := newAuditEntry(ownerID, actorID, action, before, after)
+	if err != nil || entry == nil {
+		return err
+	}
+	return subs.RecordAudit(ctx, *entry)
+}
+
+// errVersionNotFound is returned inside RevertSubscription's transaction when the version to revert to doesn't exist
+var errVersionNotFound = errors.New("version not found")
+
+// GetHistory returns the audit trail of a subscription, newest version first
+func (h *SubscriptionHandler) GetHistory(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		problem.Respond(c, http.StatusUnauthorized, problem.Unauthenticated, "User not authenticated")
+		return
+	}
+
+	subscriptionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, problem.InvalidID, "Invalid subscription ID")
+		return
+	}
+
+	history, err := h.store.Subscriptions().History(c.Request.Context(), userID.(uuid.UUID), subscriptionID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Database error")
+		return
+	}
+
+	if len(history) == 0 {
+		problem.Respond(c, http.StatusNotFound, problem.NotFound, "Subscription not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+// RevertSubscription restores a subscription's fields to those of an earlier version.
+// The revert itself is recorded as a new version, so it can be undone the same way.
+// The version's fields are validated like an update, and a 400 lists any that no longer pass.
+func (h *SubscriptionHandler) RevertSubscription(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		problem.Respond(c, http.StatusUnauthorized, problem.Unauthenticated, "User not authenticated")
+		return
+	}
+
+	subscriptionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, problem.InvalidID, "Invalid subscription ID")
+		return
+	}
+
+	var req models.RevertSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Invalid(c, err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	actorID := userID.(uuid.UUID)
+	today := storedLocale(ctx, h.store.Users(), actorID).Today()
+	var before, after *models.Subscription
+	err = h.store.WithTx(ctx, func(tx store.Store) error {
+		var err error
+		if before, err = tx.Subscriptions().GetForUpdate(ctx, actorID, subscriptionID); err != nil {
+			return err
+		}
+		version, err := tx.Subscriptions().GetVersion(ctx, actorID, subscriptionID, req.Version)
+		if err == store.ErrNotFound || (err == nil && version.Snapshot == nil) {
+			return errVersionNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		// The snapshot supplies the editable fields; identity and creation time stay as stored
+		reverted := *version.Snapshot
+		reverted.ID, reverted.UserID, reverted.CreatedAt = before.ID, before.UserID, before.CreatedAt
+		reverted.Category, reverted.DeletedAt = nil, nil
+		// A snapshot can predate the rules it is saved under now
+		if errs := validate.Subscription(&reverted, today); len(errs) > 0 {
+			return errs
+		}
+		reverted.UpdatedAt = time.Now()
+		if err := tx.Subscriptions().Update(ctx, &reverted); err != nil {
+			return err
+		}
+		after = &reverted
+
+		if err := auditSubscription(ctx, tx.Subscriptions(), before.UserID, &actorID, "revert", before, after); err != nil {
+			return fmt.Errorf("failed to record history: %w", err)
+		}
+		if roundMoney(before.Price) != roundMoney(after.Price) {
+			oldPrice := before.Price
+			if err := tx.Subscriptions().RecordPrice(ctx, models.PriceChange{
+				SubscriptionID: subscriptionID, Price: after.Price, PreviousPrice: &oldPrice, EffectiveDate: time.Now(), Source: "manual",
+			}); err != nil {
+				return fmt.Errorf("failed to record price change: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		var invalid validate.Errors
+		switch {
+		case err == store.ErrNotFound:
+			problem.Respond(c, http.StatusNotFound, problem.NotFound, "Subscription not found")
+		case err == errVersionNotFound:
+			problem.Respond(c, http.StatusNotFound, problem.NotFound, "Version not found")
+		case errors.As(err, &invalid):
+			problem.Fields(c, invalid...)
+		default:
+			slog.ErrorContext(ctx, "Failed to revert subscription", "subscription_id", subscriptionID, "error", err)
+			problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Failed to revert subscription")
+		}
+		return
+	}
+
+	priceChanged := roundMoney(before.Price) != roundMoney(after.Price)
+	if priceChanged {
+		notifyPriceChange(ctx, h.store, userID.(uuid.UUID), after.Name, before.Price, after.Price, time.Now())
+	}
+	h.syncCalendar(ctx, actorID, subscriptionID)
+
+	h.GetSubscription(c)
+}
@@ -1,18 +1,22 @@
 package handlers
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
 	"strings"
+	"time"
 
 	"subscription-tracker/internal/auth"
-	"subscription-tracker/internal/database"
+	"subscription-tracker/internal/metrics"
 	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/problem"
+	"subscription-tracker/internal/store"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -25,13 +29,13 @@ type GoogleUserInfo struct {
 }
 
 type AuthHandler struct {
-	db        *database.DB
+	store     store.Store
 	jwtSecret string
 }
 
-func NewAuthHandler(db *database.DB, jwtSecret string) *AuthHandler {
+func NewAuthHandler(st store.Store, jwtSecret string) *AuthHandler {
 	return &AuthHandler{
-		db:        db,
+		store:     st,
 		jwtSecret: jwtSecret,
 	}
 }
@@ -39,33 +43,28 @@ func NewAuthHandler(db *database.DB, jwtSecret string) *AuthHandler {
 func (h *AuthHandler) Login(c *gin.Context) {
 	var req models.LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		problem.Invalid(c, err)
 		return
 	}
 
-	var user models.User
-	err := h.db.QueryRow(
-		"SELECT id, email, password_hash, name, created_at FROM users WHERE email = $1",
-		req.Email,
-	).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.Name, &user.CreatedAt)
-
+	user, err := h.store.Users().GetByEmail(c.Request.Context(), req.Email)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "Invalid email or password"})
+		if err == store.ErrNotFound {
+			problem.Respond(c, http.StatusUnauthorized, problem.InvalidCredentials, "Invalid email or password")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Database error"})
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Database error")
 		return
 	}
 
 	if !auth.CheckPasswordHash(req.Password, user.PasswordHash) {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "Invalid email or password"})
+		problem.Respond(c, http.StatusUnauthorized, problem.InvalidCredentials, "Invalid email or password")
 		return
 	}
 
 	token, err := auth.GenerateToken(user.ID, user.Email, h.jwtSecret)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to generate token"})
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Failed to generate token")
 		return
 	}
 
@@ -74,62 +73,44 @@ func (h *AuthHandler) Login(c *gin.Context) {
 
 	c.JSON(http.StatusOK, models.AuthResponse{
 		Token: token,
-		User:  user,
+		User:  *user,
 	})
 }
 
 func (h *AuthHandler) Signup(c *gin.Context) {
 	var req models.SignupRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
-		return
-	}
-
-	// Check if user already exists
-	var exists bool
-	err := h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE email = $1)", req.Email).Scan(&exists)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Database error"})
-		return
-	}
-
-	if exists {
-		c.JSON(http.StatusConflict, models.ErrorResponse{Error: "User already exists"})
+		problem.Invalid(c, err)
 		return
 	}
 
 	// Hash password
 	hashedPassword, err := auth.HashPassword(req.Password)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to hash password"})
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Failed to hash password")
 		return
 	}
 
-	// Create user
-	userID := uuid.New()
-	_, err = h.db.Exec(
-		"INSERT INTO users (id, email, password_hash, name) VALUES ($1, $2, $3, $4)",
-		userID, req.Email, hashedPassword, req.Name,
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to create user"})
-		return
+	// Create user; the unique email index rejects existing users
+	user := models.User{
+		ID:           uuid.New(),
+		Email:        req.Email,
+		PasswordHash: hashedPassword,
+		Name:         req.Name,
 	}
-
-	// Get created user
-	var user models.User
-	err = h.db.QueryRow(
-		"SELECT id, email, name, created_at FROM users WHERE id = $1",
-		userID,
-	).Scan(&user.ID, &user.Email, &user.Name, &user.CreatedAt)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to retrieve user"})
+	if err := h.store.Users().Create(c.Request.Context(), &user); err != nil {
+		if err == store.ErrConflict {
+			problem.Respond(c, http.StatusConflict, problem.AlreadyExists, "User already exists")
+			return
+		}
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Failed to create user")
 		return
 	}
+	user.PasswordHash = ""
 
 	token, err := auth.GenerateToken(user.ID, user.Email, h.jwtSecret)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to generate token"})
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Failed to generate token")
 		return
 	}
 
@@ -154,15 +135,14 @@ func (h *AuthHandler) ForgotPassword(c *gin.Context) {
 
 	var req ForgotPasswordRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		problem.Invalid(c, err)
 		return
 	}
 
 	// Check if user exists
-	var exists bool
-	err := h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE email = $1)", req.Email).Scan(&exists)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Database error"})
+	_, err := h.store.Users().GetByEmail(c.Request.Context(), req.Email)
+	if err != nil && err != store.ErrNotFound {
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Database error")
 		return
 	}
 
@@ -186,7 +166,7 @@ func (h *AuthHandler) ResetPassword(c *gin.Context) {
 
 	var req ResetPasswordRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		problem.Invalid(c, err)
 		return
 	}
 
@@ -209,86 +189,64 @@ func (h *AuthHandler) GoogleAuth(c *gin.Context) {
 
 	var req GoogleAuthRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Missing or invalid authorization code: " + err.Error()})
+		problem.Invalid(c, err)
 		return
 	}
 
-	// Log the request for debugging
-	fmt.Printf("Google OAuth request received with code: %s...\n", req.Code[:min(10, len(req.Code))])
+	ctx := c.Request.Context()
 
 	// Exchange code for user info
-	userInfo, err := h.exchangeGoogleCode(req.Code)
+	userInfo, err := h.exchangeGoogleCode(ctx, req.Code)
 	if err != nil {
-		fmt.Printf("Google OAuth error: %v\n", err)
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "Failed to authenticate with Google: " + err.Error()})
+		slog.WarnContext(ctx, "Google OAuth failed", "error", err)
+		problem.Respond(c, http.StatusUnauthorized, problem.InvalidCredentials, "Failed to authenticate with Google")
 		return
 	}
 
-	fmt.Printf("Google user info received: email=%s, name=%s\n", userInfo.Email, userInfo.Name)
-
 	// Check if user exists
-	var user models.User
-	err = h.db.QueryRow(
-		"SELECT id, email, name, created_at FROM users WHERE email = $1",
-		userInfo.Email,
-	).Scan(&user.ID, &user.Email, &user.Name, &user.CreatedAt)
-
-	if err == sql.ErrNoRows {
+	user, err := h.store.Users().GetByEmail(ctx, userInfo.Email)
+	if err == store.ErrNotFound {
 		// User doesn't exist, create new user
-		fmt.Printf("Creating new user for: %s\n", userInfo.Email)
-		userID := uuid.New()
-		_, err = h.db.Exec(
-			"INSERT INTO users (id, email, password_hash, name) VALUES ($1, $2, $3, $4)",
-			userID, userInfo.Email, "google-oauth-user", userInfo.Name,
-		)
-		if err != nil {
-			fmt.Printf("Failed to create user: %v\n", err)
-			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to create user"})
-			return
+		user = &models.User{
+			ID:           uuid.New(),
+			Email:        userInfo.Email,
+			PasswordHash: "google-oauth-user",
+			Name:         &userInfo.Name,
 		}
-
-		// Get created user
-		err = h.db.QueryRow(
-			"SELECT id, email, name, created_at FROM users WHERE id = $1",
-			userID,
-		).Scan(&user.ID, &user.Email, &user.Name, &user.CreatedAt)
-		if err != nil {
-			fmt.Printf("Failed to retrieve user: %v\n", err)
-			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to retrieve user"})
+		if err := h.store.Users().Create(ctx, user); err != nil {
+			slog.ErrorContext(ctx, "Failed to create user", "error", err)
+			problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Failed to create user")
 			return
 		}
-		fmt.Printf("User created successfully: %s\n", user.ID)
+		slog.InfoContext(ctx, "Created user from Google sign-in", "user_id", user.ID)
 	} else if err != nil {
-		fmt.Printf("Database error: %v\n", err)
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Database error"})
+		slog.ErrorContext(ctx, "Failed to look up user", "error", err)
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Database error")
 		return
 	} else {
-		fmt.Printf("Existing user found: %s\n", user.ID)
+		slog.DebugContext(ctx, "Existing user found", "user_id", user.ID)
 	}
+	user.PasswordHash = ""
 
 	// Generate JWT token
 	token, err := auth.GenerateToken(user.ID, user.Email, h.jwtSecret)
 	if err != nil {
-		fmt.Printf("Failed to generate token: %v\n", err)
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to generate token"})
+		slog.ErrorContext(ctx, "Failed to generate token", "error", err)
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Failed to generate token")
 		return
 	}
 
-	fmt.Printf("Google OAuth successful for user: %s\n", user.Email)
+	slog.InfoContext(ctx, "Google sign-in succeeded", "user_id", user.ID)
 	c.JSON(http.StatusOK, models.AuthResponse{
 		Token: token,
-		User:  user,
+		User:  *user,
 	})
 }
 
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
+// googleAuthClient makes the Google sign-in calls, recorded in the provider metrics
+var googleAuthClient = metrics.Client("google", 30*time.Second)
 
-func (h *AuthHandler) exchangeGoogleCode(code string) (*GoogleUserInfo, error) {
+func (h *AuthHandler) exchangeGoogleCode(ctx context.Context, code string) (*GoogleUserInfo, error) {
 	// Get Google OAuth credentials from environment
 	clientID := os.Getenv("GOOGLE_CLIENT_ID")
 	clientSecret := os.Getenv("GOOGLE_CLIENT_SECRET")
@@ -307,7 +265,13 @@ func (h *AuthHandler) exchangeGoogleCode(code string) (*GoogleUserInfo, error) {
 	data.Set("grant_type", "authorization_code")
 	data.Set("redirect_uri", redirectURI)
 
-	resp, err := http.Post(tokenURL, "application/x-www-form-urlencoded", strings.NewReader(data.Encode()))
+	tokenReq, err := http.NewRequestWithContext(ctx, "POST", tokenURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token request: %v", err)
+	}
+	tokenReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := googleAuthClient.Do(tokenReq)
 	if err != nil {
 		return nil, fmt.Errorf("failed to exchange code for token: %v", err)
 	}
@@ -329,13 +293,13 @@ func (h *AuthHandler) exchangeGoogleCode(code string) (*GoogleUserInfo, error) {
 
 	// Get user info from Google
 	userInfoURL := "https://www.googleapis.com/oauth2/v2/userinfo"
-	req, err := http.NewRequest("GET", userInfoURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", userInfoURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create user info request: %v", err)
 	}
 	req.Header.Set("Authorization", "Bearer "+tokenResponse.AccessToken)
 
-	userResp, err := http.DefaultClient.Do(req)
+	userResp, err := googleAuthClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user info: %v", err)
 	}
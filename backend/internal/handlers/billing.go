@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"math"
+	"time"
+)
+
+// addBillingCycles moves a billing date n cycles forward (or backward for negative n).
+// Monthly and yearly dates are clamped to the end of shorter months, so a subscription
+// billed on the 31st renews on the 30th in April rather than spilling into May.
+func addBillingCycles(date time.Time, cycle string, n int) time.Time {
+	switch cycle {
+	case "weekly":
+		return date.AddDate(0, 0, 7*n)
+	case "yearly":
+		return addMonthsClamped(date, 12*n)
+	default:
+		return addMonthsClamped(date, n)
+	}
+}
+
+func addMonthsClamped(date time.Time, months int) time.Time {
+	year, month, day := date.Date()
+	firstOfTarget := time.Date(year, month+time.Month(months), 1, date.Hour(), date.Minute(), date.Second(), date.Nanosecond(), date.Location())
+	lastDay := firstOfTarget.AddDate(0, 1, -1).Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return firstOfTarget.AddDate(0, 0, day-1)
+}
+
+// billingDatesBetween returns every billing date of a subscription anchored at anchor
+// that falls within [from, to], in ascending order.
+func billingDatesBetween(anchor time.Time, cycle string, from, to time.Time) []time.Time {
+	n := 0
+	for !addBillingCycles(anchor, cycle, n-1).Before(from) {
+		n--
+	}
+	for addBillingCycles(anchor, cycle, n).Before(from) {
+		n++
+	}
+
+	var dates []time.Time
+	for d := addBillingCycles(anchor, cycle, n); !d.After(to); d = addBillingCycles(anchor, cycle, n) {
+		dates = append(dates, d)
+		n++
+	}
+	return dates
+}
+
+// roundMoney rounds an amount to two decimal places
+func roundMoney(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -1,43 +1,39 @@
 package handlers
 
 import (
-	"database/sql"
 	"net/http"
 
-	"subscription-tracker/internal/database"
 	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/problem"
+	"subscription-tracker/internal/store"
+	"subscription-tracker/internal/validate"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
 type BudgetHandler struct {
-	db *database.DB
+	store store.Store
 }
 
-func NewBudgetHandler(db *database.DB) *BudgetHandler {
-	return &BudgetHandler{db: db}
+func NewBudgetHandler(st store.Store) *BudgetHandler {
+	return &BudgetHandler{store: st}
 }
 
 func (h *BudgetHandler) GetBudget(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not authenticated"})
+		problem.Respond(c, http.StatusUnauthorized, problem.Unauthenticated, "User not authenticated")
 		return
 	}
 
-	var budget models.Budget
-	err := h.db.QueryRow(
-		"SELECT id, user_id, amount, period, created_at FROM budgets WHERE user_id = $1 ORDER BY created_at DESC LIMIT 1",
-		userID.(uuid.UUID),
-	).Scan(&budget.ID, &budget.UserID, &budget.Amount, &budget.Period, &budget.CreatedAt)
-
+	budget, err := h.store.Budgets().Current(c.Request.Context(), userID.(uuid.UUID))
 	if err != nil {
-		if err == sql.ErrNoRows {
-			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "No budget found"})
+		if err == store.ErrNotFound {
+			problem.Respond(c, http.StatusNotFound, problem.NotFound, "No budget found")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Database error"})
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Database error")
 		return
 	}
 
@@ -47,34 +43,28 @@ func (h *BudgetHandler) GetBudget(c *gin.Context) {
 func (h *BudgetHandler) CreateBudget(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not authenticated"})
+		problem.Respond(c, http.StatusUnauthorized, problem.Unauthenticated, "User not authenticated")
 		return
 	}
 
 	var req models.CreateBudgetRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		problem.Invalid(c, err)
 		return
 	}
-
-	budgetID := uuid.New()
-	_, err := h.db.Exec(
-		"INSERT INTO budgets (id, user_id, amount, period) VALUES ($1, $2, $3, $4)",
-		budgetID, userID.(uuid.UUID), req.Amount, req.Period,
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to create budget"})
+	if errs := validate.Budget(&req); len(errs) > 0 {
+		problem.Fields(c, errs...)
 		return
 	}
 
-	var budget models.Budget
-	err = h.db.QueryRow(
-		"SELECT id, user_id, amount, period, created_at FROM budgets WHERE id = $1",
-		budgetID,
-	).Scan(&budget.ID, &budget.UserID, &budget.Amount, &budget.Period, &budget.CreatedAt)
-
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to retrieve created budget"})
+	budget := models.Budget{
+		ID:     uuid.New(),
+		UserID: userID.(uuid.UUID),
+		Amount: req.Amount,
+		Period: req.Period,
+	}
+	if err := h.store.Budgets().Create(c.Request.Context(), &budget); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Failed to create budget")
 		return
 	}
 
@@ -1,289 +1,319 @@
 package handlers
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
-	"subscription-tracker/internal/database"
+	"subscription-tracker/internal/calendar"
+	"subscription-tracker/internal/locale"
 	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/problem"
+	"subscription-tracker/internal/store"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
-type CalendarHandler struct {
-	db *database.DB
+// calendarProviderTitles are the names shown to users
+var calendarProviderTitles = map[string]string{
+	"google":    "Google Calendar",
+	"microsoft": "Outlook Calendar",
 }
 
-func NewCalendarHandler(db *database.DB) *CalendarHandler {
-	return &CalendarHandler{db: db}
+type CalendarHandler struct {
+	store       store.Store
+	publicURL   string
+	frontendURL string // Where the OAuth callback sends the browser afterwards
+	stateSecret string // Signs OAuth state so callbacks can't be forged
+	providers   map[string]calendar.Provider
+	syncLocks   userLocks // Serializes each user's calendar syncs so an event is never created twice
+
+	// Syncs left running after their request, which Shutdown waits for or cancels
+	syncs       sync.WaitGroup
+	stopSyncs   context.Context
+	cancelSyncs context.CancelFunc
 }
 
-type GoogleTokenResponse struct {
-	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
-	ExpiresIn    int    `json:"expires_in"`
-	TokenType    string `json:"token_type"`
+func NewCalendarHandler(st store.Store, publicURL, frontendURL, stateSecret string, providers ...calendar.Provider) *CalendarHandler {
+	h := &CalendarHandler{
+		store:       st,
+		publicURL:   strings.TrimSuffix(publicURL, "/"),
+		frontendURL: strings.TrimSuffix(frontendURL, "/"),
+		stateSecret: stateSecret,
+		providers:   map[string]calendar.Provider{},
+		syncLocks:   userLocks{locks: map[uuid.UUID]*userLock{}},
+	}
+	h.stopSyncs, h.cancelSyncs = context.WithCancel(context.Background())
+	for _, p := range providers {
+		h.providers[p.Name()] = p
+	}
+	return h
 }
 
-// GoogleAuthURL generates the Google OAuth URL
-func (h *CalendarHandler) GoogleAuthURL(c *gin.Context) {
+// AuthURL generates the provider's OAuth URL for GET /calendar/:provider/auth-url
+func (h *CalendarHandler) AuthURL(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not authenticated"})
+		problem.Respond(c, http.StatusUnauthorized, problem.Unauthenticated, "User not authenticated")
 		return
 	}
 
-	clientID := os.Getenv("GOOGLE_CLIENT_ID")
-	redirectURI := os.Getenv("GOOGLE_REDIRECT_URI")
-	
-	if clientID == "" || clientID == "your-google-client-id" {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error: "Google OAuth not configured. Please set up Google Calendar API credentials.",
-		})
+	provider, ok := h.provider(c)
+	if !ok {
 		return
 	}
-
-	if redirectURI == "" {
-		redirectURI = "http://localhost:3000/api/auth/google/callback"
+	if !provider.Configured() {
+		problem.Respond(c, http.StatusServiceUnavailable, problem.ProviderNotConfigured, fmt.Sprintf("%s OAuth not configured. Please set up API credentials.", calendarProviderTitle(provider.Name())))
+		return
 	}
 
-	// Build OAuth URL
-	authURL := fmt.Sprintf(
-		"https://accounts.google.com/o/oauth2/v2/auth?client_id=%s&redirect_uri=%s&response_type=code&scope=%s&access_type=offline&state=%s&prompt=consent",
-		url.QueryEscape(clientID),
-		url.QueryEscape(redirectURI),
-		url.QueryEscape("https://www.googleapis.com/auth/calendar https://www.googleapis.com/auth/calendar.events"),
-		url.QueryEscape(userID.(uuid.UUID).String()),
-	)
+	// The state ties the callback to this user and the verifier proves the same client finishes the flow
+	state, challenge, err := h.newOAuthState(c.Request.Context(), userID.(uuid.UUID), provider.Name())
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to create OAuth state", "error", err)
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Failed to start calendar authorization")
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"authUrl": authURL,
+		"authUrl": provider.AuthURL(h.redirectURI(provider.Name()), state, challenge),
 	})
 }
 
-// GoogleCallback handles the OAuth callback
-func (h *CalendarHandler) GoogleCallback(c *gin.Context) {
-	code := c.Query("code")
-	state := c.Query("state") // This is the userID
-
-	if code == "" {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Missing authorization code"})
+// OAuthCallback handles the provider's redirect after consent. The browser is sent back to the frontend with the outcome.
+func (h *CalendarHandler) OAuthCallback(c *gin.Context) {
+	provider, ok := h.providers[c.Param("provider")]
+	if !ok {
+		h.redirectAfterConnect(c, c.Param("provider"), "unknown_provider")
 		return
 	}
+	ctx := c.Request.Context()
 
-	userID, err := uuid.Parse(state)
+	// The state is checked first so it is used up even when the user declined
+	userID, verifier, err := h.consumeOAuthState(ctx, c.Query("state"), provider.Name())
 	if err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid state parameter"})
+		slog.WarnContext(ctx, "Rejected OAuth callback", "provider", provider.Name(), "error", err)
+		h.redirectAfterConnect(c, provider.Name(), "invalid_state")
+		return
+	}
+
+	if c.Query("error") != "" {
+		h.redirectAfterConnect(c, provider.Name(), "denied")
+		return
+	}
+	code := c.Query("code")
+	if code == "" {
+		h.redirectAfterConnect(c, provider.Name(), "missing_code")
 		return
 	}
 
 	// Exchange code for tokens
-	tokens, err := h.exchangeCodeForTokens(code)
+	token, err := provider.Exchange(ctx, h.redirectURI(provider.Name()), code, verifier)
 	if err != nil {
-		fmt.Printf("Failed to exchange code for tokens: %v\n", err)
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to exchange authorization code for tokens",
-		})
+		slog.ErrorContext(ctx, "Failed to exchange code for tokens", "provider", provider.Name(), "error", err)
+		h.redirectAfterConnect(c, provider.Name(), "exchange_failed")
 		return
 	}
 
-	// Save tokens to database
-	err = h.saveGoogleTokens(userID, tokens)
-	if err != nil {
-		fmt.Printf("Failed to save tokens: %v\n", err)
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to save Google Calendar tokens",
-		})
+	if err := h.saveConnection(ctx, userID, provider.Name(), token); err != nil {
+		slog.ErrorContext(ctx, "Failed to save tokens", "provider", provider.Name(), "error", err)
+		h.redirectAfterConnect(c, provider.Name(), "save_failed")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "Google Calendar connected successfully",
+	// Add existing subscriptions to the newly connected calendar
+	h.inBackground(ctx, func(ctx context.Context) {
+		if err := h.reconcileUser(ctx, userID, provider); err != nil {
+			slog.ErrorContext(ctx, "Initial calendar sync failed", "provider", provider.Name(), "user_id", userID, "error", err)
+		}
 	})
-}
-
-func (h *CalendarHandler) exchangeCodeForTokens(code string) (*GoogleTokenResponse, error) {
-	clientID := os.Getenv("GOOGLE_CLIENT_ID")
-	clientSecret := os.Getenv("GOOGLE_CLIENT_SECRET")
-	redirectURI := os.Getenv("GOOGLE_REDIRECT_URI")
 
-	if redirectURI == "" {
-		redirectURI = "http://localhost:3000/api/auth/google/callback"
-	}
+	h.redirectAfterConnect(c, provider.Name(), "")
+}
 
-	// Prepare token request
-	data := url.Values{}
-	data.Set("code", code)
-	data.Set("client_id", clientID)
-	data.Set("client_secret", clientSecret)
-	data.Set("redirect_uri", redirectURI)
-	data.Set("grant_type", "authorization_code")
+// redirectAfterConnect sends the browser to the frontend's calendar callback page.
+// An empty reason means the calendar was connected.
+func (h *CalendarHandler) redirectAfterConnect(c *gin.Context, provider, reason string) {
+	query := url.Values{}
+	query.Set("provider", provider)
+	if reason == "" {
+		query.Set("status", "connected")
+	} else {
+		query.Set("status", "error")
+		query.Set("reason", reason)
+	}
+	c.Redirect(http.StatusFound, h.frontendURL+"/calendar/callback?"+query.Encode())
+}
 
-	// Make token request
-	resp, err := http.PostForm("https://oauth2.googleapis.com/token", data)
-	if err != nil {
-		return nil, fmt.Errorf("failed to exchange code: %w", err)
+// redirectURI is where the provider sends the user back to: this API's callback unless
+// GOOGLE_REDIRECT_URI or MICROSOFT_REDIRECT_URI says otherwise
+func (h *CalendarHandler) redirectURI(provider string) string {
+	if redirectURI := os.Getenv(strings.ToUpper(provider) + "_REDIRECT_URI"); redirectURI != "" {
+		return redirectURI
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+	base := h.publicURL
+	if base == "" {
+		base = "http://localhost:8080"
 	}
+	return base + "/api/calendar/" + provider + "/callback"
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("token exchange failed with status %d: %s", resp.StatusCode, string(body))
+// provider looks up the :provider path parameter, responding 404 when it isn't known
+func (h *CalendarHandler) provider(c *gin.Context) (calendar.Provider, bool) {
+	provider, ok := h.providers[c.Param("provider")]
+	if !ok {
+		problem.Respond(c, http.StatusNotFound, problem.NotFound, "Unknown calendar provider")
 	}
+	return provider, ok
+}
 
-	var tokens GoogleTokenResponse
-	if err := json.Unmarshal(body, &tokens); err != nil {
-		return nil, fmt.Errorf("failed to parse tokens: %w", err)
+func calendarProviderTitle(provider string) string {
+	if title, ok := calendarProviderTitles[provider]; ok {
+		return title
 	}
-
-	return &tokens, nil
+	return provider
 }
 
-func (h *CalendarHandler) saveGoogleTokens(userID uuid.UUID, tokens *GoogleTokenResponse) error {
-	expiry := time.Now().Add(time.Duration(tokens.ExpiresIn) * time.Second)
-
-	_, err := h.db.Exec(
-		`UPDATE users 
-		 SET google_access_token = $1, 
-		     google_refresh_token = $2, 
-		     google_token_expiry = $3,
-			 preferences = COALESCE(preferences, '{}'::jsonb) || '{"calendar": {"googleSync": true}}'::jsonb
-		 WHERE id = $4`,
-		tokens.AccessToken,
-		tokens.RefreshToken,
-		expiry,
-		userID,
-	)
-
-	return err
+// saveConnection stores the tokens from a completed OAuth flow and turns sync on for the provider
+func (h *CalendarHandler) saveConnection(ctx context.Context, userID uuid.UUID, provider string, token *calendar.Token) error {
+	return h.store.WithTx(ctx, func(tx store.Store) error {
+		if err := tx.Calendars().SaveConnection(ctx, calendarConnection(userID, provider, token)); err != nil {
+			return err
+		}
+		return setCalendarSyncPreference(ctx, tx.Users(), userID, provider, true)
+	})
 }
 
-// RefreshGoogleToken refreshes an expired access token
-func (h *CalendarHandler) refreshGoogleToken(userID uuid.UUID, refreshToken string) (*GoogleTokenResponse, error) {
-	clientID := os.Getenv("GOOGLE_CLIENT_ID")
-	clientSecret := os.Getenv("GOOGLE_CLIENT_SECRET")
-
-	data := url.Values{}
-	data.Set("client_id", clientID)
-	data.Set("client_secret", clientSecret)
-	data.Set("refresh_token", refreshToken)
-	data.Set("grant_type", "refresh_token")
-
-	resp, err := http.PostForm("https://oauth2.googleapis.com/token", data)
-	if err != nil {
-		return nil, fmt.Errorf("failed to refresh token: %w", err)
+// calendarConnection is what gets stored for a provider's tokens. An empty refresh token keeps the stored one,
+// as refreshes don't always return a new one.
+func calendarConnection(userID uuid.UUID, provider string, token *calendar.Token) store.CalendarConnection {
+	expiry := token.Expiry
+	return store.CalendarConnection{
+		UserID:       userID,
+		Provider:     provider,
+		AccessToken:  token.AccessToken,
+		RefreshToken: token.RefreshToken,
+		TokenExpiry:  &expiry,
 	}
-	defer resp.Body.Close()
+}
 
-	body, err := io.ReadAll(resp.Body)
+// setCalendarSyncPreference sets preferences.calendar.<provider>Sync, e.g. googleSync, leaving other providers alone
+func setCalendarSyncPreference(ctx context.Context, users store.UserStore, userID uuid.UUID, provider string, enabled bool) error {
+	user, err := users.Get(ctx, userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return err
 	}
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("token refresh failed with status %d: %s", resp.StatusCode, string(body))
+	prefs := models.UserPreferences{}
+	if user.Preferences != nil {
+		prefs = *user.Preferences
 	}
-
-	var tokens GoogleTokenResponse
-	if err := json.Unmarshal(body, &tokens); err != nil {
-		return nil, fmt.Errorf("failed to parse tokens: %w", err)
+	calendarPrefs := models.CalendarPreferences{}
+	if prefs.Calendar != nil {
+		calendarPrefs = *prefs.Calendar
 	}
-
-	// Save new tokens
-	expiry := time.Now().Add(time.Duration(tokens.ExpiresIn) * time.Second)
-	_, err = h.db.Exec(
-		`UPDATE users 
-		 SET google_access_token = $1, 
-		     google_token_expiry = $2
-		 WHERE id = $3`,
-		tokens.AccessToken,
-		expiry,
-		userID,
-	)
-
-	return &tokens, err
+	switch provider {
+	case "google":
+		calendarPrefs.GoogleSync = enabled
+	case "microsoft":
+		calendarPrefs.MicrosoftSync = enabled
+	}
+	prefs.Calendar = &calendarPrefs
+	return users.Update(ctx, userID, store.UserChanges{Preferences: &prefs})
 }
 
-// GetValidGoogleToken retrieves and refreshes if necessary the user's Google access token
-func (h *CalendarHandler) getValidGoogleToken(userID uuid.UUID) (string, error) {
-	var accessToken, refreshToken *string
-	var expiry *time.Time
-
-	err := h.db.QueryRow(
-		`SELECT google_access_token, google_refresh_token, google_token_expiry 
-		 FROM users WHERE id = $1`,
-		userID,
-	).Scan(&accessToken, &refreshToken, &expiry)
-
+// validAccessToken returns the user's access token for the provider, refreshing it when it is about to expire
+func (h *CalendarHandler) validAccessToken(ctx context.Context, userID uuid.UUID, provider calendar.Provider) (string, error) {
+	conn, err := h.store.Calendars().GetConnection(ctx, userID, provider.Name())
+	if err == store.ErrNotFound {
+		return "", fmt.Errorf("user has not connected %s", calendarProviderTitle(provider.Name()))
+	}
 	if err != nil {
 		return "", fmt.Errorf("failed to get tokens: %w", err)
 	}
 
-	if accessToken == nil || refreshToken == nil {
-		return "", fmt.Errorf("user has not connected Google Calendar")
-	}
-
 	// Check if token is expired or about to expire (within 5 minutes)
-	if expiry == nil || time.Now().Add(5*time.Minute).After(*expiry) {
-		// Refresh the token
-		tokens, err := h.refreshGoogleToken(userID, *refreshToken)
+	if conn.TokenExpiry == nil || time.Now().Add(5*time.Minute).After(*conn.TokenExpiry) {
+		token, err := provider.Refresh(ctx, conn.RefreshToken)
 		if err != nil {
 			return "", fmt.Errorf("failed to refresh token: %w", err)
 		}
-		return tokens.AccessToken, nil
+		if err := h.store.Calendars().SaveConnection(ctx, calendarConnection(userID, provider.Name(), token)); err != nil {
+			return "", fmt.Errorf("failed to save refreshed token: %w", err)
+		}
+		return token.AccessToken, nil
 	}
 
-	return *accessToken, nil
+	return conn.AccessToken, nil
 }
 
-// CreateCalendarEvent creates a calendar event for a subscription
+// CreateCalendarEvent creates a calendar event for a subscription in a connected calendar (Google by default)
 func (h *CalendarHandler) CreateCalendarEvent(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not authenticated"})
+		problem.Respond(c, http.StatusUnauthorized, problem.Unauthenticated, "User not authenticated")
 		return
 	}
 
+	ctx := c.Request.Context()
+
 	var req struct {
-		SubscriptionName string    `json:"subscription_name" binding:"required"`
-		Amount           float64   `json:"amount" binding:"required"`
-		BillingDate      time.Time `json:"billing_date" binding:"required"`
-		Description      string    `json:"description"`
+		Provider         string     `json:"provider"`
+		SubscriptionID   *uuid.UUID `json:"subscription_id"` // Links the event to the subscription so it stays in sync
+		SubscriptionName string     `json:"subscription_name"`
+		Amount           float64    `json:"amount"`
+		BillingDate      time.Time  `json:"billing_date"`
+		Description      string     `json:"description"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		problem.Invalid(c, err)
+		return
+	}
+	if req.SubscriptionID == nil && (req.SubscriptionName == "" || req.Amount == 0 || req.BillingDate.IsZero()) {
+		problem.Respond(c, http.StatusBadRequest, problem.InvalidRequest, "subscription_id, or subscription_name, amount and billing_date are required")
+		return
+	}
+	if req.Provider == "" {
+		req.Provider = "google"
+	}
+	provider, ok := h.providers[req.Provider]
+	if !ok {
+		problem.Fields(c, models.FieldError{Field: "provider", Code: "oneof", Message: "provider must be one of: google, microsoft"})
 		return
 	}
 
 	// Get valid access token
-	accessToken, err := h.getValidGoogleToken(userID.(uuid.UUID))
+	accessToken, err := h.validAccessToken(ctx, userID.(uuid.UUID), provider)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error: "Google Calendar not connected. Please connect in Settings.",
-		})
+		problem.Respond(c, http.StatusBadRequest, problem.ProviderNotConnected, calendarProviderTitle(provider.Name())+" not connected. Please connect in Settings.")
+		return
+	}
+
+	if req.SubscriptionID != nil {
+		h.createSubscriptionEvent(c, provider, userID.(uuid.UUID), *req.SubscriptionID, accessToken)
 		return
 	}
 
-	// Create calendar event
-	eventID, err := h.createGoogleCalendarEvent(accessToken, req.SubscriptionName, req.Amount, req.BillingDate, req.Description)
+	// Create a one-off calendar event
+	settings := h.userSettings(ctx, userID.(uuid.UUID))
+	eventID, err := provider.UpsertEvent(ctx, accessToken, "", calendar.Event{
+		Summary:     fmt.Sprintf("%s Payment Due", req.SubscriptionName),
+		Description: fmt.Sprintf("Subscription payment of %s is due.\n\n%s", settings.FormatMoney(req.Amount), req.Description),
+		Start:       req.BillingDate,
+		TimeZone:    settings.Timezone(),
+		Reminders:   renewalReminders,
+	})
 	if err != nil {
-		fmt.Printf("Failed to create calendar event: %v\n", err)
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to create calendar event: " + err.Error(),
-		})
+		slog.ErrorContext(ctx, "Failed to create calendar event", "provider", provider.Name(), "error", err)
+		problem.Respond(c, http.StatusBadGateway, problem.ProviderError, "Failed to create calendar event")
 		return
 	}
 
@@ -294,108 +324,94 @@ func (h *CalendarHandler) CreateCalendarEvent(c *gin.Context) {
 	})
 }
 
-func (h *CalendarHandler) createGoogleCalendarEvent(accessToken, name string, amount float64, billingDate time.Time, description string) (string, error) {
-	// Prepare event data
-	event := map[string]interface{}{
-		"summary":     fmt.Sprintf("%s Payment Due", name),
-		"description": fmt.Sprintf("Subscription payment of KSh %.2f is due.\n\n%s", amount, description),
-		"start": map[string]string{
-			"dateTime": billingDate.Format(time.RFC3339),
-			"timeZone": "Africa/Nairobi",
-		},
-		"end": map[string]string{
-			"dateTime": billingDate.Add(1 * time.Hour).Format(time.RFC3339),
-			"timeZone": "Africa/Nairobi",
-		},
-		"reminders": map[string]interface{}{
-			"useDefault": false,
-			"overrides": []map[string]interface{}{
-				{"method": "email", "minutes": 1440}, // 1 day before
-				{"method": "popup", "minutes": 60},   // 1 hour before
-			},
-		},
-	}
-
-	eventJSON, err := json.Marshal(event)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal event: %w", err)
-	}
+// createSubscriptionEvent syncs a subscription's event right away and returns its ID
+func (h *CalendarHandler) createSubscriptionEvent(c *gin.Context, provider calendar.Provider, userID, subscriptionID uuid.UUID, accessToken string) {
+	defer h.syncLocks.lock(userID)()
 
-	// Make API request
-	req, err := http.NewRequest(
-		"POST",
-		"https://www.googleapis.com/calendar/v3/calendars/primary/events",
-		bytes.NewBuffer(eventJSON),
-	)
+	ctx := c.Request.Context()
+	sub, err := h.loadCalendarSubscription(ctx, subscriptionID, userID)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Database error")
+		return
 	}
-
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to create event: %w", err)
+	if sub == nil || sub.DeletedAt != nil {
+		problem.Respond(c, http.StatusNotFound, problem.NotFound, "Subscription not found")
+		return
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
+	if !calendarSyncable(sub) {
+		problem.Respond(c, http.StatusBadRequest, problem.InvalidRequest, "Only active and trial subscriptions can be added to the calendar")
+		return
 	}
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return "", fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+	mapping, err := h.loadCalendarMapping(ctx, subscriptionID, provider.Name())
+	if err == nil {
+		err = h.pushSubscription(ctx, provider, accessToken, userID, subscriptionID, sub, mapping, h.userSettings(ctx, userID))
 	}
-
-	var result map[string]interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
-		return "", fmt.Errorf("failed to parse response: %w", err)
+	if err == nil {
+		mapping, err = h.loadCalendarMapping(ctx, subscriptionID, provider.Name())
 	}
-
-	eventID, ok := result["id"].(string)
-	if !ok {
-		return "", fmt.Errorf("event ID not found in response")
+	if err != nil || mapping == nil {
+		slog.ErrorContext(ctx, "Failed to sync calendar event", "provider", provider.Name(), "subscription_id", subscriptionID, "error", err)
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Failed to create calendar event")
+		return
 	}
 
-	return eventID, nil
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"eventId": mapping.EventID,
+		"message": "Calendar event created successfully",
+	})
 }
 
-// DisconnectGoogleCalendar removes Google Calendar integration
-func (h *CalendarHandler) DisconnectGoogleCalendar(c *gin.Context) {
+// Disconnect removes a calendar provider's tokens and turns its sync off. Events already created are left in place.
+func (h *CalendarHandler) Disconnect(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not authenticated"})
+		problem.Respond(c, http.StatusUnauthorized, problem.Unauthenticated, "User not authenticated")
+		return
+	}
+
+	provider, ok := h.provider(c)
+	if !ok {
 		return
 	}
+	title := calendarProviderTitle(provider.Name())
 
-	_, err := h.db.Exec(
-		`UPDATE users 
-		 SET google_access_token = NULL, 
-		     google_refresh_token = NULL, 
-		     google_token_expiry = NULL,
-			 preferences = COALESCE(preferences, '{}'::jsonb) || '{"calendar": {"googleSync": false}}'::jsonb
-		 WHERE id = $1`,
-		userID.(uuid.UUID),
-	)
+	ctx := c.Request.Context()
 
+	err := h.store.WithTx(ctx, func(tx store.Store) error {
+		if err := tx.Calendars().DeleteConnection(ctx, userID.(uuid.UUID), provider.Name()); err != nil {
+			return err
+		}
+		return setCalendarSyncPreference(ctx, tx.Users(), userID.(uuid.UUID), provider.Name(), false)
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to disconnect Google Calendar",
-		})
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Failed to disconnect "+title)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"message": "Google Calendar disconnected successfully",
+		"message": title + " disconnected successfully",
 	})
 }
 
+// Calendar event types, so the UI can style each kind differently
+const (
+	calendarEventPayment              = "subscription"
+	calendarEventTrialEnd             = "trial_end"
+	calendarEventCancellationDeadline = "cancellation_deadline"
+	calendarEventBudgetReset          = "budget_reset"
+)
+
+// maxCalendarRange bounds how far GetEvents expands recurring subscriptions in one request
+const maxCalendarRange = 366 * 24 * time.Hour
+
+// budgetPeriodAnchor is a Monday, January 1st, from which budget periods are counted
+var budgetPeriodAnchor = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
 type CalendarEvent struct {
-	ID          uuid.UUID `json:"id"`
+	ID          uuid.UUID `json:"id"` // The subscription, or the budget for budget resets
 	Title       string    `json:"title"`
 	Date        time.Time `json:"date"`
 	Type        string    `json:"type"`
@@ -403,51 +419,172 @@ type CalendarEvent struct {
 	Description string    `json:"description"`
 }
 
+// GetEvents returns the user's calendar between from and to (YYYY-MM-DD, inclusive). It defaults to the
+// current month and the two after it. Every renewal of each active subscription in the range is listed,
+// along with trial ends, cancellation deadlines and budget period resets.
 func (h *CalendarHandler) GetEvents(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not authenticated"})
+		problem.Respond(c, http.StatusUnauthorized, problem.Unauthenticated, "User not authenticated")
 		return
 	}
 
-	// Get subscription billing dates as calendar events
-	rows, err := h.db.Query(`
-		SELECT id, name, billing_date, price 
-		FROM subscriptions 
-		WHERE user_id = $1 AND status = 'active'
-		ORDER BY billing_date ASC
-	`, userID.(uuid.UUID))
+	ctx := c.Request.Context()
 
+	settings := storedLocale(ctx, h.store.Users(), userID.(uuid.UUID))
+	from, to, err := parseCalendarRange(c, settings.Today())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Database error"})
+		problem.Respond(c, http.StatusBadRequest, problem.InvalidRequest, err.Error())
+		return
+	}
+
+	events := []CalendarEvent{}
+	err = h.store.Subscriptions().Each(ctx, userID.(uuid.UUID), store.SubscriptionQuery{
+		Filter: store.SubscriptionFilter{Statuses: []string{"active", "trial"}},
+		Sort:   []store.SortKey{{Key: "billing_date"}},
+	}, func(sub models.Subscription) error {
+		postTrialPrice := sub.Price
+		if sub.PostTrialPrice != nil {
+			postTrialPrice = *sub.PostTrialPrice
+		}
+		events = append(events, subscriptionCalendarEvents(sub, postTrialPrice, from, to, settings)...)
+		return nil
+	})
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Database error")
+		return
+	}
+
+	// Budget resets follow the current budget, the one GET /budget returns
+	budget, err := h.store.Budgets().Current(ctx, userID.(uuid.UUID))
+	if err != nil && err != store.ErrNotFound {
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Database error")
 		return
 	}
-	defer rows.Close()
+	if err == nil {
+		for _, date := range billingDatesBetween(budgetPeriodAnchor, budget.Period, from, to) {
+			events = append(events, CalendarEvent{
+				ID:          budget.ID,
+				Title:       "Budget Resets",
+				Date:        date,
+				Type:        calendarEventBudgetReset,
+				Amount:      budget.Amount,
+				Description: fmt.Sprintf("Your %s budget of %s starts a new period", budget.Period, settings.FormatMoney(budget.Amount)),
+			})
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Date.Before(events[j].Date)
+	})
+
+	c.JSON(http.StatusOK, events)
+}
+
+// parseCalendarRange reads the from/to query parameters. A missing from is the first of the current month,
+// and a missing to closes a three month window.
+func parseCalendarRange(c *gin.Context, today time.Time) (time.Time, time.Time, error) {
+	from, err := parseOptionalDate(c.Query("from"), "from")
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	to, err := parseOptionalDate(c.Query("to"), "to")
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	if from == nil {
+		start := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC)
+		if to != nil && to.Before(start) {
+			start = time.Date(to.Year(), to.Month(), 1, 0, 0, 0, 0, time.UTC)
+		}
+		from = &start
+	}
+	if to == nil {
+		end := from.AddDate(0, 3, -1)
+		to = &end
+	}
+
+	if to.Before(*from) {
+		return time.Time{}, time.Time{}, fmt.Errorf("to must be on or after from")
+	}
+	if to.Sub(*from) > maxCalendarRange {
+		return time.Time{}, time.Time{}, fmt.Errorf("date range cannot exceed 366 days")
+	}
+	return *from, *to, nil
+}
+
+// subscriptionCalendarEvents expands a subscription into its events within [from, to]. Renewals start at the
+// billing date, as in the iCalendar feed and synced calendars, or when a trial converts if that is later.
+// The last day to cancel is marked before a trial converts and before each yearly renewal.
+func subscriptionCalendarEvents(sub models.Subscription, postTrialPrice float64, from, to time.Time, settings locale.Settings) []CalendarEvent {
+	anchor := sub.BillingDate
+	price := sub.Price
 
 	var events []CalendarEvent
-	for rows.Next() {
-		var id uuid.UUID
-		var name string
-		var billingDate time.Time
-		var price float64
+	if sub.Status == "trial" && sub.TrialEndDate != nil {
+		trialEnd := *sub.TrialEndDate
+		if inDateRange(trialEnd, from, to) {
+			events = append(events, CalendarEvent{
+				ID:          sub.ID,
+				Title:       sub.Name + " Trial Ends",
+				Date:        trialEnd,
+				Type:        calendarEventTrialEnd,
+				Amount:      postTrialPrice,
+				Description: fmt.Sprintf("Free trial for %s converts to a paid subscription", sub.Name),
+			})
+		}
+		if deadline := trialEnd.AddDate(0, 0, -1); inDateRange(deadline, from, to) {
+			events = append(events, cancellationDeadlineEvent(sub, deadline, postTrialPrice, settings))
+		}
 
-		err := rows.Scan(&id, &name, &billingDate, &price)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to scan event"})
-			return
+		// Paid renewals start when the trial converts, the same way trial conversion moves the billing date
+		if trialEnd.After(anchor) {
+			anchor = trialEnd
 		}
+		price = postTrialPrice
+	}
+
+	start := anchor
+	if from.After(start) {
+		start = from
+	}
+	if start.After(to) {
+		return events
+	}
 
-		event := CalendarEvent{
-			ID:          id,
-			Title:       name + " Payment",
-			Date:        billingDate,
-			Type:        "subscription",
+	for _, date := range billingDatesBetween(anchor, sub.BillingCycle, start, to) {
+		events = append(events, CalendarEvent{
+			ID:          sub.ID,
+			Title:       sub.Name + " Payment",
+			Date:        date,
+			Type:        calendarEventPayment,
 			Amount:      price,
-			Description: "Subscription payment for " + name,
+			Description: "Subscription payment for " + sub.Name,
+		})
+	}
+
+	if sub.BillingCycle == "yearly" {
+		// A deadline the day after to belongs to a renewal outside the range, and vice versa
+		for _, renewal := range billingDatesBetween(anchor, sub.BillingCycle, start.AddDate(0, 0, 1), to.AddDate(0, 0, 1)) {
+			events = append(events, cancellationDeadlineEvent(sub, renewal.AddDate(0, 0, -1), price, settings))
 		}
+	}
+	return events
+}
 
-		events = append(events, event)
+func cancellationDeadlineEvent(sub models.Subscription, deadline time.Time, amount float64, settings locale.Settings) CalendarEvent {
+	return CalendarEvent{
+		ID:          sub.ID,
+		Title:       "Cancel " + sub.Name + " by Today",
+		Date:        deadline,
+		Type:        calendarEventCancellationDeadline,
+		Amount:      amount,
+		Description: fmt.Sprintf("Last day to cancel %s before being charged %s", sub.Name, settings.FormatMoney(amount)),
 	}
+}
 
-	c.JSON(http.StatusOK, events)
-}
\ No newline at end of file
+// inDateRange reports whether date falls within [from, to]
+func inDateRange(date, from, to time.Time) bool {
+	return !date.Before(from) && !date.After(to)
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"subscription-tracker/internal/ical"
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/problem"
+	"subscription-tracker/internal/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// feedRefreshInterval is how often calendar clients are asked to poll the feed
+const feedRefreshInterval = time.Hour
+
+// GetFeed reports whether the user has a calendar feed. The secret URL itself is not stored.
+func (h *CalendarHandler) GetFeed(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		problem.Respond(c, http.StatusUnauthorized, problem.Unauthenticated, "User not authenticated")
+		return
+	}
+
+	feed, err := h.store.Calendars().GetFeed(c.Request.Context(), userID.(uuid.UUID))
+	if err == store.ErrNotFound {
+		c.JSON(http.StatusOK, models.CalendarFeed{})
+		return
+	}
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Database error")
+		return
+	}
+
+	c.JSON(http.StatusOK, feed)
+}
+
+// CreateFeed creates the user's calendar feed, or rotates its token so the previous URL stops working
+func (h *CalendarHandler) CreateFeed(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		problem.Respond(c, http.StatusUnauthorized, problem.Unauthenticated, "User not authenticated")
+		return
+	}
+
+	// Calendar apps keep the URL, so it can't come from the Host header, which the client controls
+	if h.publicURL == "" {
+		problem.Respond(c, http.StatusServiceUnavailable, problem.ProviderNotConfigured, "Calendar feeds need PUBLIC_API_URL to be configured")
+		return
+	}
+
+	token, err := newRandomToken()
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Failed to create calendar feed")
+		return
+	}
+
+	createdAt, err := h.store.Calendars().SaveFeed(c.Request.Context(), userID.(uuid.UUID), hashToken(token))
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Failed to create calendar feed")
+		return
+	}
+
+	feed := models.CalendarFeed{Enabled: true, CreatedAt: &createdAt}
+	feed.URL = h.publicURL + "/api/calendar/feed/" + token + ".ics"
+	feed.WebcalURL = "webcal://" + strings.SplitN(feed.URL, "://", 2)[1]
+
+	c.JSON(http.StatusCreated, feed)
+}
+
+// RevokeFeed deletes the user's calendar feed
+func (h *CalendarHandler) RevokeFeed(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		problem.Respond(c, http.StatusUnauthorized, problem.Unauthenticated, "User not authenticated")
+		return
+	}
+
+	err := h.store.Calendars().DeleteFeed(c.Request.Context(), userID.(uuid.UUID))
+	if err == store.ErrNotFound {
+		problem.Respond(c, http.StatusNotFound, problem.NotFound, "Calendar feed not found")
+		return
+	}
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Failed to revoke calendar feed")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{Message: "Calendar feed revoked"})
+}
+
+// ServeFeed returns the iCalendar feed for a secret token. It is public so calendar apps can subscribe.
+// Renewals repeat with their billing cycle and carry a reminder from the user's notifications.reminderDays.
+func (h *CalendarHandler) ServeFeed(c *gin.Context) {
+	token := strings.TrimSuffix(c.Param("token"), ".ics")
+
+	ctx := c.Request.Context()
+
+	userID, err := h.store.Calendars().UseFeed(ctx, hashToken(token))
+	if err == store.ErrNotFound {
+		problem.Respond(c, http.StatusNotFound, problem.NotFound, "Calendar feed not found")
+		return
+	}
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Database error")
+		return
+	}
+
+	var prefs *models.UserPreferences
+	if user, err := h.store.Users().Get(ctx, userID); err == nil {
+		prefs = user.Preferences
+	} else {
+		slog.WarnContext(ctx, "Failed to load preferences", "user_id", userID, "error", err)
+	}
+	settings := localeFromUserPreferences(prefs)
+	reminderDays := reminderDays(prefs)
+
+	var subscriptions []models.Subscription
+	err = h.store.Subscriptions().Each(ctx, userID, store.SubscriptionQuery{
+		Filter: store.SubscriptionFilter{Statuses: []string{"active", "trial"}},
+		Sort:   []store.SortKey{{Key: "billing_date"}},
+	}, func(sub models.Subscription) error {
+		subscriptions = append(subscriptions, sub)
+		return nil
+	})
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Database error")
+		return
+	}
+
+	c.Header("Content-Type", "text/calendar; charset=utf-8")
+	c.Header("Content-Disposition", `inline; filename="subscriptions.ics"`)
+	c.Header("Cache-Control", "private, max-age=900")
+	c.Status(http.StatusOK)
+
+	cal := ical.NewWriter(c.Writer, "Subscription renewals")
+	cal.SetRefreshInterval(feedRefreshInterval)
+	for _, sub := range subscriptions {
+		renewal := subscriptionEvent(sub, settings)
+		renewal.Alarms = []ical.Alarm{{
+			Before:      time.Duration(reminderDays) * 24 * time.Hour,
+			Description: fmt.Sprintf("%s renews soon", sub.Name),
+		}}
+		if err := cal.WriteEvent(renewal); err != nil {
+			return
+		}
+
+		if sub.Status == "trial" && sub.TrialEndDate != nil {
+			price := sub.Price
+			if sub.PostTrialPrice != nil {
+				price = *sub.PostTrialPrice
+			}
+			trialEnd := ical.Event{
+				UID:     sub.ID.String() + "-trial@subscription-tracker",
+				Summary: fmt.Sprintf("%s free trial ends (then %s)", sub.Name, settings.FormatMoney(price)),
+				Start:   *sub.TrialEndDate,
+				AllDay:  true,
+				Updated: sub.UpdatedAt,
+				Alarms: []ical.Alarm{{
+					Before:      time.Duration(reminderDays) * 24 * time.Hour,
+					Description: fmt.Sprintf("%s free trial ends soon", sub.Name),
+				}},
+			}
+			if err := cal.WriteEvent(trialEnd); err != nil {
+				return
+			}
+		}
+	}
+	cal.Close()
+}
+
+// newRandomToken returns 32 random bytes, URL-safe encoded. Used for feed tokens and OAuth nonces.
+func newRandomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
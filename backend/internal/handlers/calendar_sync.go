@@ -0,0 +1,416 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"subscription-tracker/internal/calendar"
+	"subscription-tracker/internal/locale"
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// calendarPullSlack absorbs clock differences between the provider's updated time and our synced_at
+const calendarPullSlack = time.Minute
+
+// calendarSyncTimeout bounds a sync running in the background, after the request that started it has finished
+const calendarSyncTimeout = 5 * time.Minute
+
+// renewalReminders are when calendar events remind the user: a day and an hour before
+var renewalReminders = []time.Duration{24 * time.Hour, time.Hour}
+
+// subscriptionSyncer mirrors subscription changes to the user's external calendars
+type subscriptionSyncer interface {
+	SyncSubscription(ctx context.Context, userID, subscriptionID uuid.UUID)
+}
+
+// SyncSubscription creates, updates or deletes the subscription's event in every connected calendar in the background.
+// Failures are logged and picked up by the next ReconcileCalendars run.
+func (h *CalendarHandler) SyncSubscription(ctx context.Context, userID, subscriptionID uuid.UUID) {
+	h.inBackground(ctx, func(ctx context.Context) {
+		if err := h.syncSubscription(ctx, userID, subscriptionID); err != nil {
+			slog.ErrorContext(ctx, "Calendar sync failed", "subscription_id", subscriptionID, "error", err)
+		}
+	})
+}
+
+// inBackground runs fn detached from the request that started it, so it isn't cancelled when the response
+// is sent. It is bounded by calendarSyncTimeout instead, and by Shutdown.
+func (h *CalendarHandler) inBackground(ctx context.Context, fn func(ctx context.Context)) {
+	h.syncs.Add(1)
+	go func() {
+		defer h.syncs.Done()
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), calendarSyncTimeout)
+		defer cancel()
+		defer context.AfterFunc(h.stopSyncs, cancel)()
+		fn(ctx)
+	}()
+}
+
+// Shutdown waits for background syncs to finish, cancelling them if ctx ends first.
+// Call it once nothing else can start a sync.
+func (h *CalendarHandler) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		h.syncs.Wait()
+		close(done)
+	}()
+
+	defer h.cancelSyncs()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		h.cancelSyncs()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// userLocks hands out a mutex per user, so one user's syncs run one at a time without holding up anyone else's
+type userLocks struct {
+	mu    sync.Mutex
+	locks map[uuid.UUID]*userLock
+}
+
+type userLock struct {
+	sync.Mutex
+	waiters int // Holders and goroutines waiting; the lock is dropped from the map at zero
+}
+
+// lock locks the user's mutex and returns the function that unlocks it
+func (l *userLocks) lock(userID uuid.UUID) func() {
+	l.mu.Lock()
+	ul, ok := l.locks[userID]
+	if !ok {
+		ul = &userLock{}
+		l.locks[userID] = ul
+	}
+	ul.waiters++
+	l.mu.Unlock()
+
+	ul.Lock()
+	return func() {
+		ul.Unlock()
+		l.mu.Lock()
+		if ul.waiters--; ul.waiters == 0 {
+			delete(l.locks, userID)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// userSettings loads the user's regional settings
+func (h *CalendarHandler) userSettings(ctx context.Context, userID uuid.UUID) locale.Settings {
+	return storedLocale(ctx, h.store.Users(), userID)
+}
+
+func (h *CalendarHandler) syncSubscription(ctx context.Context, userID, subscriptionID uuid.UUID) error {
+	defer h.syncLocks.lock(userID)()
+
+	providers, err := h.syncProviders(ctx, userID)
+	if err != nil || len(providers) == 0 {
+		return err
+	}
+
+	sub, err := h.loadCalendarSubscription(ctx, subscriptionID, userID)
+	if err != nil {
+		return err
+	}
+	settings := h.userSettings(ctx, userID)
+
+	var errs []error
+	for _, provider := range providers {
+		accessToken, err := h.validAccessToken(ctx, userID, provider)
+		if err == nil {
+			var mapping *store.SyncedEvent
+			if mapping, err = h.loadCalendarMapping(ctx, subscriptionID, provider.Name()); err == nil {
+				err = h.pushSubscription(ctx, provider, accessToken, userID, subscriptionID, sub, mapping, settings)
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", provider.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// pushSubscription makes the calendar match the subscription: the event is removed when the subscription
+// is gone or no longer renews, created when missing and overwritten when the subscription changed
+func (h *CalendarHandler) pushSubscription(ctx context.Context, provider calendar.Provider, accessToken string, userID, subscriptionID uuid.UUID, sub *models.Subscription, mapping *store.SyncedEvent, settings locale.Settings) error {
+	if sub == nil || !calendarSyncable(sub) {
+		if mapping == nil {
+			return nil
+		}
+		if err := provider.DeleteEvent(ctx, accessToken, mapping.EventID); err != nil && err != calendar.ErrEventGone {
+			return err
+		}
+		return h.store.Calendars().DeleteEvent(ctx, subscriptionID, provider.Name())
+	}
+
+	event := subscriptionCalendarEvent(*sub, settings)
+	hash, err := calendarEventHash(event)
+	if err != nil {
+		return err
+	}
+
+	eventID := ""
+	if mapping != nil {
+		if mapping.EventID != "" && mapping.SyncedHash == hash {
+			return nil
+		}
+		eventID = mapping.EventID
+	}
+	if eventID, err = provider.UpsertEvent(ctx, accessToken, eventID, event); err != nil {
+		return err
+	}
+
+	return h.store.Calendars().SaveEvent(ctx, store.SyncedEvent{
+		SubscriptionID: subscriptionID, UserID: userID, Provider: provider.Name(), EventID: eventID, SyncedHash: hash,
+	})
+}
+
+// ReconcileCalendars repairs drift between subscriptions and every connected calendar with sync on.
+// Events deleted or edited in the calendar are recreated or overwritten, except that moving the event
+// to another date is pulled back into the subscription's billing date.
+func (h *CalendarHandler) ReconcileCalendars(ctx context.Context) error {
+	all, err := h.store.Calendars().AllConnections(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to query calendar connections: %w", err)
+	}
+	type connection struct {
+		userID   uuid.UUID
+		provider calendar.Provider
+	}
+	var connections []connection
+	preferences := preferencesLoader(h.store.Users())
+	for _, conn := range all {
+		if provider, ok := h.providers[conn.Provider]; ok && calendarSyncOn(preferences(ctx, conn.UserID), conn.Provider) {
+			connections = append(connections, connection{conn.UserID, provider})
+		}
+	}
+
+	failed := 0
+	for _, conn := range connections {
+		if err := h.reconcileUser(ctx, conn.userID, conn.provider); err != nil {
+			slog.ErrorContext(ctx, "Calendar reconcile failed", "user_id", conn.userID, "provider", conn.provider.Name(), "error", err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("calendar reconcile failed for %d of %d connections", failed, len(connections))
+	}
+	return nil
+}
+
+func (h *CalendarHandler) reconcileUser(ctx context.Context, userID uuid.UUID, provider calendar.Provider) error {
+	defer h.syncLocks.lock(userID)()
+
+	accessToken, err := h.validAccessToken(ctx, userID, provider)
+	if err != nil {
+		return err
+	}
+	settings := h.userSettings(ctx, userID)
+
+	// Every subscription that has an event or should have one
+	subscriptionIDs, err := h.store.Calendars().EventSubscriptions(ctx, userID, provider.Name())
+	if err != nil {
+		return err
+	}
+	synced := map[uuid.UUID]bool{}
+	for _, id := range subscriptionIDs {
+		synced[id] = true
+	}
+	err = h.store.Subscriptions().Each(ctx, userID, store.SubscriptionQuery{
+		Filter: store.SubscriptionFilter{Statuses: []string{"active", "trial"}},
+	}, func(sub models.Subscription) error {
+		if !synced[sub.ID] {
+			subscriptionIDs = append(subscriptionIDs, sub.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, subscriptionID := range subscriptionIDs {
+		sub, err := h.loadCalendarSubscription(ctx, subscriptionID, userID)
+		if err != nil {
+			return err
+		}
+		mapping, err := h.loadCalendarMapping(ctx, subscriptionID, provider.Name())
+		if err != nil {
+			return err
+		}
+
+		if sub != nil && calendarSyncable(sub) && mapping != nil {
+			remote, err := provider.GetEvent(ctx, accessToken, mapping.EventID)
+			switch {
+			case err == calendar.ErrEventGone || (err == nil && remote.Cancelled):
+				// Force the event to be recreated
+				mapping.SyncedHash = ""
+				mapping.EventID = ""
+			case err != nil:
+				return err
+			default:
+				if sub, err = h.pullEventDate(ctx, sub, remote, mapping); err != nil {
+					return err
+				}
+				if calendarEventDrifted(remote, subscriptionCalendarEvent(*sub, settings)) {
+					mapping.SyncedHash = ""
+				}
+			}
+		}
+
+		if err := h.pushSubscription(ctx, provider, accessToken, userID, subscriptionID, sub, mapping, settings); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pullEventDate applies a date change made in the calendar to the subscription's billing date,
+// unless the subscription itself changed since the last sync
+func (h *CalendarHandler) pullEventDate(ctx context.Context, sub *models.Subscription, remote *calendar.RemoteEvent, mapping *store.SyncedEvent) (*models.Subscription, error) {
+	if remote.Date == "" || remote.Date == sub.BillingDate.Format("2006-01-02") {
+		return sub, nil
+	}
+	if !remote.Updated.After(mapping.SyncedAt.Add(calendarPullSlack)) || sub.UpdatedAt.After(mapping.SyncedAt) {
+		return sub, nil
+	}
+
+	billingDate, err := time.Parse("2006-01-02", remote.Date)
+	if err != nil {
+		return sub, nil
+	}
+
+	err = h.store.WithTx(ctx, func(tx store.Store) error {
+		before, err := tx.Subscriptions().GetForUpdate(ctx, sub.UserID, sub.ID)
+		if err != nil {
+			return err
+		}
+		after := *before
+		after.BillingDate = billingDate
+		after.UpdatedAt = time.Now()
+		if err := tx.Subscriptions().Update(ctx, &after); err != nil {
+			return err
+		}
+		return auditSubscription(ctx, tx.Subscriptions(), sub.UserID, nil, "update", before, &after)
+	})
+	if err == store.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return h.loadCalendarSubscription(ctx, sub.ID, sub.UserID)
+}
+
+// calendarSyncable reports whether a subscription should have a renewal event
+func calendarSyncable(sub *models.Subscription) bool {
+	return sub.DeletedAt == nil && (sub.Status == "active" || sub.Status == "trial")
+}
+
+// calendarEventDrifted reports whether fields we manage were edited in the calendar
+func calendarEventDrifted(remote *calendar.RemoteEvent, expected calendar.Event) bool {
+	return remote.Summary != expected.Summary ||
+		remote.Date != expected.Start.Format("2006-01-02") ||
+		remote.Recurrence != expected.Recurrence
+}
+
+// subscriptionCalendarEvent is the all-day event for a subscription's renewals, repeating with its
+// billing cycle while it is active or in trial
+func subscriptionCalendarEvent(sub models.Subscription, settings locale.Settings) calendar.Event {
+	description := fmt.Sprintf("Subscription payment of %s is due.", settings.FormatMoney(sub.Price))
+	if sub.Description != nil && *sub.Description != "" {
+		description += "\n\n" + *sub.Description
+	}
+
+	event := calendar.Event{
+		Summary:        fmt.Sprintf("%s Payment Due", sub.Name),
+		Description:    description,
+		Start:          sub.BillingDate,
+		AllDay:         true,
+		TimeZone:       settings.Timezone(),
+		Reminders:      renewalReminders,
+		SubscriptionID: sub.ID.String(),
+	}
+	if sub.Status == "active" || sub.Status == "trial" {
+		switch sub.BillingCycle {
+		case "weekly", "monthly", "yearly":
+			event.Recurrence = sub.BillingCycle
+		}
+	}
+	return event
+}
+
+func calendarEventHash(event calendar.Event) (string, error) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// syncProviders are the user's connected calendars that have sync turned on
+func (h *CalendarHandler) syncProviders(ctx context.Context, userID uuid.UUID) ([]calendar.Provider, error) {
+	connections, err := h.store.Calendars().Connections(ctx, userID)
+	if err != nil || len(connections) == 0 {
+		return nil, err
+	}
+	user, err := h.store.Users().Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var providers []calendar.Provider
+	for _, conn := range connections {
+		if provider, ok := h.providers[conn.Provider]; ok && calendarSyncOn(user.Preferences, conn.Provider) {
+			providers = append(providers, provider)
+		}
+	}
+	return providers, nil
+}
+
+// calendarSyncOn reads preferences.calendar.<provider>Sync
+func calendarSyncOn(prefs *models.UserPreferences, provider string) bool {
+	if prefs == nil || prefs.Calendar == nil {
+		return false
+	}
+	switch provider {
+	case "google":
+		return prefs.Calendar.GoogleSync
+	case "microsoft":
+		return prefs.Calendar.MicrosoftSync
+	}
+	return false
+}
+
+// loadCalendarSubscription reads a live subscription. It returns nil once archived or purged.
+func (h *CalendarHandler) loadCalendarSubscription(ctx context.Context, subscriptionID, userID uuid.UUID) (*models.Subscription, error) {
+	sub, err := h.store.Subscriptions().Get(ctx, userID, subscriptionID)
+	if err == store.ErrNotFound {
+		return nil, nil
+	}
+	return sub, err
+}
+
+// loadCalendarMapping reads the event synced for a subscription in one provider, or nil when there is none
+func (h *CalendarHandler) loadCalendarMapping(ctx context.Context, subscriptionID uuid.UUID, provider string) (*store.SyncedEvent, error) {
+	event, err := h.store.Calendars().GetEvent(ctx, subscriptionID, provider)
+	if err == store.ErrNotFound {
+		return nil, nil
+	}
+	return event, err
+}
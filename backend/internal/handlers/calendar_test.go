@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/store"
+	"subscription-tracker/internal/store/memory"
+
+	"github.com/google/uuid"
+)
+
+func TestCalendarFeed(t *testing.T) {
+	srv := newTestServer(t)
+	calendar := NewCalendarHandler(srv.store, "https://api.example.com", "https://app.example.com", "secret")
+	srv.router.GET("/api/calendar/feed", calendar.GetFeed)
+	srv.router.POST("/api/calendar/feed", calendar.CreateFeed)
+	srv.router.DELETE("/api/calendar/feed", calendar.RevokeFeed)
+	srv.router.GET("/api/calendar/feed/:token", calendar.ServeFeed)
+	srv.createSubscription(models.CreateSubscriptionRequest{Name: "Netflix", Price: 10})
+
+	var feed models.CalendarFeed
+	if code := srv.do(nil, http.MethodPost, "/api/calendar/feed", nil, &feed); code != http.StatusCreated {
+		t.Fatalf("create feed: status %d", code)
+	}
+	if !strings.HasPrefix(feed.URL, "https://api.example.com/api/calendar/feed/") || !strings.HasPrefix(feed.WebcalURL, "webcal://") {
+		t.Fatalf("feed = %+v, want URLs on the public API URL", feed)
+	}
+
+	path := strings.TrimPrefix(feed.URL, "https://api.example.com")
+	w := httptest.NewRecorder()
+	srv.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Netflix") {
+		t.Fatalf("serve feed: status %d\n%s", w.Code, w.Body.String())
+	}
+
+	var status models.CalendarFeed
+	srv.do(nil, http.MethodGet, "/api/calendar/feed", nil, &status)
+	if !status.Enabled || status.LastAccessedAt == nil || status.URL != "" {
+		t.Errorf("feed status = %+v, want enabled, read, and without its URL", status)
+	}
+
+	if code := srv.do(nil, http.MethodDelete, "/api/calendar/feed", nil, nil); code != http.StatusOK {
+		t.Fatalf("revoke feed: status %d", code)
+	}
+	w = httptest.NewRecorder()
+	srv.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("serve revoked feed: status %d, want 404", w.Code)
+	}
+}
+
+func TestCalendarFeedNeedsPublicURL(t *testing.T) {
+	srv := newTestServer(t)
+	calendar := NewCalendarHandler(srv.store, "", "", "secret")
+	srv.router.POST("/api/calendar/feed", calendar.CreateFeed)
+
+	if code := srv.do(nil, http.MethodPost, "/api/calendar/feed", nil, nil); code != http.StatusServiceUnavailable {
+		t.Errorf("create feed without PUBLIC_API_URL: status %d, want 503", code)
+	}
+}
+
+func TestCalendarFeedDefaultsUnsetReminders(t *testing.T) {
+	srv := newTestServer(t)
+	calendar := NewCalendarHandler(srv.store, "https://api.example.com", "", "secret")
+	srv.router.POST("/api/calendar/feed", calendar.CreateFeed)
+	srv.router.GET("/api/calendar/feed/:token", calendar.ServeFeed)
+	srv.createSubscription(models.CreateSubscriptionRequest{Name: "Netflix", Price: 10})
+
+	prefs := &models.UserPreferences{Notifications: &models.NotificationPreferences{Email: true}}
+	if err := srv.store.Users().Update(context.Background(), srv.user.ID, store.UserChanges{Preferences: prefs}); err != nil {
+		t.Fatal(err)
+	}
+
+	var feed models.CalendarFeed
+	srv.do(nil, http.MethodPost, "/api/calendar/feed", nil, &feed)
+	w := httptest.NewRecorder()
+	srv.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, strings.TrimPrefix(feed.URL, "https://api.example.com"), nil))
+	if !strings.Contains(w.Body.String(), "TRIGGER:-P3D") {
+		t.Errorf("feed without reminderDays set:\n%s\nwant reminders 3 days ahead", w.Body.String())
+	}
+}
+
+func TestCalendarEvents(t *testing.T) {
+	srv := newTestServer(t)
+	calendar := NewCalendarHandler(srv.store, "", "", "secret")
+	srv.router.GET("/api/calendar/events", calendar.GetEvents)
+
+	billingDate := time.Date(2030, time.January, 10, 0, 0, 0, 0, time.UTC)
+	srv.createSubscription(models.CreateSubscriptionRequest{Name: "Netflix", Price: 10, BillingDate: billingDate})
+	srv.createSubscription(models.CreateSubscriptionRequest{Name: "Paused", Price: 10, Status: "paused", BillingDate: billingDate})
+
+	var events []CalendarEvent
+	if code := srv.do(nil, http.MethodGet, "/api/calendar/events?from=2030-01-01&to=2030-03-31", nil, &events); code != http.StatusOK {
+		t.Fatalf("events: status %d", code)
+	}
+	if len(events) != 3 {
+		t.Fatalf("events = %+v, want three monthly renewals", events)
+	}
+	for _, e := range events {
+		if e.Type != calendarEventPayment || e.Title != "Netflix Payment" {
+			t.Errorf("event = %+v, want a Netflix renewal", e)
+		}
+	}
+}
+
+func TestSyncLocksArePerUser(t *testing.T) {
+	locks := userLocks{locks: map[uuid.UUID]*userLock{}}
+	alice, bob := uuid.New(), uuid.New()
+
+	unlock := locks.lock(alice)
+	locks.lock(bob)() // Not held up by Alice's lock
+
+	acquired, released := make(chan struct{}), make(chan struct{})
+	go func() {
+		unlock := locks.lock(alice)
+		close(acquired)
+		unlock()
+		close(released)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("second lock for the same user acquired while the first was held")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	unlock()
+	<-released
+	locks.mu.Lock()
+	defer locks.mu.Unlock()
+	if len(locks.locks) != 0 {
+		t.Errorf("%d locks left after unlocking, want none", len(locks.locks))
+	}
+}
+
+func TestCalendarShutdownWaitsForSyncs(t *testing.T) {
+	h := NewCalendarHandler(memory.New(), "", "", "secret")
+
+	finished := make(chan struct{})
+	h.inBackground(context.Background(), func(ctx context.Context) {
+		time.Sleep(20 * time.Millisecond)
+		close(finished)
+	})
+	if err := h.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-finished:
+	default:
+		t.Fatal("Shutdown returned before the sync finished")
+	}
+
+	// A sync still running at the deadline is cancelled, and Shutdown waits for it to return
+	h = NewCalendarHandler(memory.New(), "", "", "secret")
+	var cancelled bool
+	h.inBackground(context.Background(), func(ctx context.Context) {
+		<-ctx.Done()
+		cancelled = true
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := h.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Shutdown = %v, want DeadlineExceeded", err)
+	}
+	if !cancelled {
+		t.Error("Shutdown returned before the cancelled sync did")
+	}
+}
@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"subscription-tracker/internal/ical"
+	"subscription-tracker/internal/locale"
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/problem"
+	"subscription-tracker/internal/xlsx"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// exportFlushEvery is how many rows are buffered before flushing to the client
+const exportFlushEvery = 100
+
+// exportColumns match the import fields, so an export can be imported again
+var exportColumns = []string{
+	"id", "name", "price", "billing_cycle", "billing_date", "category", "status", "payment_method",
+	"description", "website_url", "trial_start_date", "trial_end_date", "post_trial_price", "created_at", "updated_at",
+}
+
+var exportContentTypes = map[string]string{
+	"csv":  "text/csv; charset=utf-8",
+	"json": "application/json; charset=utf-8",
+	"xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	"ics":  "text/calendar; charset=utf-8",
+}
+
+// subscriptionExporter writes subscriptions in one export format
+type subscriptionExporter interface {
+	Write(sub models.Subscription) error
+	Flush() error
+	Close() error
+}
+
+// ExportSubscriptions streams the user's subscriptions as CSV, JSON, XLSX or iCalendar.
+// It accepts the same filters and sort as the list endpoint.
+func (h *SubscriptionHandler) ExportSubscriptions(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		problem.Respond(c, http.StatusUnauthorized, problem.Unauthenticated, "User not authenticated")
+		return
+	}
+
+	format := strings.ToLower(c.DefaultQuery("format", "csv"))
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		problem.Respond(c, http.StatusBadRequest, problem.InvalidRequest, "format must be csv, json, xlsx or ics")
+		return
+	}
+
+	settings := storedLocale(c.Request.Context(), h.store.Users(), userID.(uuid.UUID))
+	query, err := parseSubscriptionListParams(c, settings.Today())
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, problem.InvalidRequest, err.Error())
+		return
+	}
+
+	// Headers are sent with the first row, so a failing query can still answer with an error
+	var exporter subscriptionExporter
+	start := func() error {
+		if exporter != nil {
+			return nil
+		}
+		filename := fmt.Sprintf("subscriptions-%s.%s", settings.Today().Format("2006-01-02"), format)
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+		c.Status(http.StatusOK)
+
+		var err error
+		exporter, err = newSubscriptionExporter(format, c.Writer, settings)
+		return err
+	}
+
+	// Once headers are sent, failures part way through can only end the stream early
+	count := 0
+	err = h.store.Subscriptions().Each(c.Request.Context(), userID.(uuid.UUID), query, func(sub models.Subscription) error {
+		if err := start(); err != nil {
+			return err
+		}
+		if err := exporter.Write(sub); err != nil {
+			return err
+		}
+		count++
+		if count%exportFlushEvery == 0 {
+			if err := exporter.Flush(); err != nil {
+				return err
+			}
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = start()
+	}
+	if err != nil {
+		if exporter == nil && !c.Writer.Written() {
+			problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Database error")
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "Export failed", "error", err)
+		return
+	}
+
+	if err := exporter.Close(); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Export write failed", "error", err)
+	}
+}
+
+func newSubscriptionExporter(format string, w io.Writer, settings locale.Settings) (subscriptionExporter, error) {
+	switch format {
+	case "json":
+		return &jsonExporter{w: w}, nil
+	case "xlsx":
+		xw, err := xlsx.NewWriter(w, "Subscriptions")
+		if err != nil {
+			return nil, err
+		}
+		return &xlsxExporter{w: xw}, xw.WriteRow(stringsToCells(exportColumns)...)
+	case "ics":
+		return &icsExporter{w: ical.NewWriter(w, "Subscriptions"), settings: settings}, nil
+	default:
+		cw := csv.NewWriter(w)
+		return &csvExporter{w: cw}, cw.Write(exportColumns)
+	}
+}
+
+// exportRecord flattens a subscription into exportColumns order for spreadsheets. Empty values are nil.
+func exportRecord(sub models.Subscription) []interface{} {
+	optionalString := func(s *string) interface{} {
+		if s == nil || *s == "" {
+			return nil
+		}
+		return *s
+	}
+	optionalDate := func(t *time.Time) interface{} {
+		if t == nil {
+			return nil
+		}
+		return t.Format("2006-01-02")
+	}
+
+	var category interface{}
+	if sub.Category != nil {
+		category = sub.Category.Name
+	}
+	var postTrialPrice interface{}
+	if sub.PostTrialPrice != nil {
+		postTrialPrice = *sub.PostTrialPrice
+	}
+
+	return []interface{}{
+		sub.ID.String(), sub.Name, sub.Price, sub.BillingCycle, sub.BillingDate.Format("2006-01-02"), category,
+		sub.Status, optionalString(sub.PaymentMethod), optionalString(sub.Description), optionalString(sub.WebsiteURL),
+		optionalDate(sub.TrialStartDate), optionalDate(sub.TrialEndDate), postTrialPrice,
+		sub.CreatedAt.Format(time.RFC3339), sub.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+// formulaPrefixes start a formula when they begin a spreadsheet cell
+const formulaPrefixes = "=+-@"
+
+// spreadsheetText stops a spreadsheet opening a CSV from running text as a formula, such as a subscription
+// named =HYPERLINK(...), by prefixing it with ', which marks the cell as text. CSV import removes the prefix.
+// XLSX needs no guard, since its text cells are never evaluated.
+func spreadsheetText(s string) string {
+	if s != "" && strings.ContainsRune(formulaPrefixes, rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func stringsToCells(values []string) []interface{} {
+	cells := make([]interface{}, len(values))
+	for i, v := range values {
+		cells[i] = v
+	}
+	return cells
+}
+
+type csvExporter struct {
+	w *csv.Writer
+}
+
+func (e *csvExporter) Write(sub models.Subscription) error {
+	record := exportRecord(sub)
+	values := make([]string, len(record))
+	for i, value := range record {
+		switch value := value.(type) {
+		case nil:
+		case string:
+			values[i] = spreadsheetText(value)
+		default:
+			values[i] = fmt.Sprint(value)
+		}
+	}
+	return e.w.Write(values)
+}
+
+func (e *csvExporter) Flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *csvExporter) Close() error {
+	return e.Flush()
+}
+
+// jsonExporter writes a JSON array one subscription at a time, in the same shape as the list endpoint
+type jsonExporter struct {
+	w     io.Writer
+	count int
+}
+
+func (e *jsonExporter) Write(sub models.Subscription) error {
+	data, err := json.Marshal(sub)
+	if err != nil {
+		return err
+	}
+	prefix := ","
+	if e.count == 0 {
+		prefix = "["
+	}
+	e.count++
+	_, err = io.WriteString(e.w, prefix+string(data))
+	return err
+}
+
+func (e *jsonExporter) Flush() error {
+	return nil
+}
+
+func (e *jsonExporter) Close() error {
+	if e.count == 0 {
+		_, err := io.WriteString(e.w, "[]")
+		return err
+	}
+	_, err := io.WriteString(e.w, "]")
+	return err
+}
+
+type xlsxExporter struct {
+	w *xlsx.Writer
+}
+
+func (e *xlsxExporter) Write(sub models.Subscription) error {
+	return e.w.WriteRow(exportRecord(sub)...)
+}
+
+func (e *xlsxExporter) Flush() error {
+	return e.w.Flush()
+}
+
+func (e *xlsxExporter) Close() error {
+	return e.w.Close()
+}
+
+// icsExporter writes each subscription as an all-day event on its billing date,
+// repeating with the billing cycle while the subscription is active or in trial
+type icsExporter struct {
+	w        *ical.Writer
+	settings locale.Settings
+}
+
+func (e *icsExporter) Write(sub models.Subscription) error {
+	return e.w.WriteEvent(subscriptionEvent(sub, e.settings))
+}
+
+func (e *icsExporter) Flush() error {
+	return e.w.Flush()
+}
+
+func (e *icsExporter) Close() error {
+	return e.w.Close()
+}
+
+// subscriptionEvent describes a subscription's renewals as a recurring calendar event
+func subscriptionEvent(sub models.Subscription, settings locale.Settings) ical.Event {
+	event := ical.Event{
+		UID:     sub.ID.String() + "@subscription-tracker",
+		Summary: fmt.Sprintf("%s renewal (%s)", sub.Name, settings.FormatMoney(sub.Price)),
+		Start:   sub.BillingDate,
+		AllDay:  true,
+		Updated: sub.UpdatedAt,
+	}
+	if sub.Description != nil {
+		event.Description = *sub.Description
+	}
+	if sub.WebsiteURL != nil {
+		event.URL = *sub.WebsiteURL
+	}
+	if sub.Category != nil {
+		event.Categories = []string{sub.Category.Name}
+	}
+
+	if sub.Status == "active" || sub.Status == "trial" {
+		switch sub.BillingCycle {
+		case "weekly":
+			event.RRule = "FREQ=WEEKLY"
+		case "monthly":
+			event.RRule = ical.MonthlyRule("MONTHLY", sub.BillingDate)
+		case "yearly":
+			event.RRule = ical.MonthlyRule("YEARLY", sub.BillingDate)
+		}
+	}
+	return event
+}
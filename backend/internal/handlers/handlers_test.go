@@ -0,0 +1,417 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/store"
+	"subscription-tracker/internal/store/memory"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// testServer serves the handlers from a memory store. Requests are signed in as the user whose ID is in
+// the X-Test-User header, or as the first user.
+type testServer struct {
+	t      *testing.T
+	store  *memory.Store
+	router *gin.Engine
+	subs   *SubscriptionHandler
+	user   models.User
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	st := memory.New()
+	srv := &testServer{
+		t:      t,
+		store:  st,
+		router: gin.New(),
+		subs:   NewSubscriptionHandler(st, time.Minute, 30, nil),
+	}
+	srv.user = srv.addUser("owner@example.com")
+
+	srv.router.Use(func(c *gin.Context) {
+		userID := srv.user.ID
+		if header := c.GetHeader("X-Test-User"); header != "" {
+			userID = uuid.MustParse(header)
+		}
+		user, err := st.Users().Get(c.Request.Context(), userID)
+		if err != nil {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Set("userID", user.ID)
+		c.Set("email", user.Email)
+	})
+
+	api := srv.router.Group("/api")
+	subscriptions := api.Group("/subscriptions")
+	subscriptions.POST("", srv.subs.CreateSubscription)
+	subscriptions.GET("/archive", srv.subs.GetArchivedSubscriptions)
+	subscriptions.POST("/import", srv.subs.ImportSubscriptions)
+	subscriptions.GET("/export", srv.subs.ExportSubscriptions)
+	subscriptions.GET("/:id", srv.subs.GetSubscription)
+	subscriptions.PATCH("/:id", srv.subs.UpdateSubscription)
+	subscriptions.DELETE("/:id", srv.subs.DeleteSubscription)
+	subscriptions.GET("/:id/price-history", srv.subs.GetPriceHistory)
+	subscriptions.GET("/:id/history", srv.subs.GetHistory)
+	subscriptions.POST("/:id/revert", srv.subs.RevertSubscription)
+	subscriptions.POST("/:id/restore", srv.subs.RestoreSubscription)
+	subscriptions.POST("/:id/undo-delete", srv.subs.UndoDelete)
+
+	splits := NewSplitHandler(st)
+	subscriptions.GET("/:id/split", splits.GetSplit)
+	subscriptions.GET("/:id/split/ledger", splits.GetLedger)
+	subscriptions.POST("/:id/split/members", splits.AddMember)
+	subscriptions.DELETE("/:id/split/members/:memberId", splits.RemoveMember)
+	subscriptions.POST("/:id/split/members/:memberId/settle", splits.Settle)
+	api.GET("/splits/balances", splits.GetBalances)
+
+	api.GET("/analytics/summary", NewAnalyticsHandler(st).GetSummary)
+	api.POST("/payment/mpesa/callback", NewPaymentHandler(st).MpesaCallback)
+
+	return srv
+}
+
+// addUser creates a user with the default preferences
+func (srv *testServer) addUser(email string) models.User {
+	srv.t.Helper()
+
+	user := models.User{ID: uuid.New(), Email: email}
+	if err := srv.store.Users().Create(context.Background(), &user); err != nil {
+		srv.t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+// do sends a request as the given user, or the first user when as is nil, and decodes a JSON response into out
+func (srv *testServer) do(as *models.User, method, path string, body interface{}, out interface{}) int {
+	srv.t.Helper()
+
+	var reader *bytes.Reader
+	if body == nil {
+		reader = bytes.NewReader(nil)
+	} else {
+		data, err := json.Marshal(body)
+		if err != nil {
+			srv.t.Fatalf("marshal request: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if as != nil {
+		req.Header.Set("X-Test-User", as.ID.String())
+	}
+
+	w := httptest.NewRecorder()
+	srv.router.ServeHTTP(w, req)
+	// Error responses are only decoded into a problem
+	_, problem := out.(*models.Problem)
+	if out != nil && (w.Code < 300 || problem) {
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			srv.t.Fatalf("%s %s: decode response: %v\n%s", method, path, err, w.Body.String())
+		}
+	}
+	return w.Code
+}
+
+// createSubscription creates an active subscription for the first user through the API
+func (srv *testServer) createSubscription(req models.CreateSubscriptionRequest) models.Subscription {
+	srv.t.Helper()
+
+	if req.Status == "" {
+		req.Status = "active"
+	}
+	if req.BillingCycle == "" {
+		req.BillingCycle = "monthly"
+	}
+	if req.BillingDate.IsZero() {
+		req.BillingDate = time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 10)
+	}
+	var sub models.Subscription
+	if code := srv.do(nil, http.MethodPost, "/api/subscriptions", req, &sub); code != http.StatusCreated {
+		srv.t.Fatalf("create subscription: status %d", code)
+	}
+	return sub
+}
+
+func TestSubscriptionPriceChangeIsRecorded(t *testing.T) {
+	srv := newTestServer(t)
+	sub := srv.createSubscription(models.CreateSubscriptionRequest{Name: "Netflix", Price: 10})
+
+	price := 12.5
+	if code := srv.do(nil, http.MethodPatch, "/api/subscriptions/"+sub.ID.String(), models.UpdateSubscriptionRequest{Price: &price}, nil); code != http.StatusOK {
+		t.Fatalf("update: status %d", code)
+	}
+
+	var history []models.PriceChange
+	if code := srv.do(nil, http.MethodGet, "/api/subscriptions/"+sub.ID.String()+"/price-history", nil, &history); code != http.StatusOK {
+		t.Fatalf("price history: status %d", code)
+	}
+	if len(history) != 2 || history[0].Price != 12.5 || history[0].PreviousPrice == nil || *history[0].PreviousPrice != 10 {
+		t.Fatalf("price history = %+v, want 10 then 12.5", history)
+	}
+
+	notifications, err := srv.store.Notifications().List(context.Background(), srv.user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notifications) != 1 || notifications[0].Type != "warning" {
+		t.Fatalf("notifications = %+v, want one price increase warning", notifications)
+	}
+}
+
+func TestSubscriptionOfAnotherUserIsNotFound(t *testing.T) {
+	srv := newTestServer(t)
+	sub := srv.createSubscription(models.CreateSubscriptionRequest{Name: "Netflix", Price: 10})
+	other := srv.addUser("other@example.com")
+
+	path := "/api/subscriptions/" + sub.ID.String()
+	for _, req := range []struct{ method, path string }{
+		{http.MethodGet, path},
+		{http.MethodDelete, path},
+		{http.MethodGet, path + "/history"},
+		{http.MethodGet, path + "/price-history"},
+		{http.MethodGet, path + "/split"},
+	} {
+		if code := srv.do(&other, req.method, req.path, nil, nil); code != http.StatusNotFound {
+			t.Errorf("%s %s as another user: status %d, want 404", req.method, req.path, code)
+		}
+	}
+}
+
+func TestRevertRestoresEarlierVersion(t *testing.T) {
+	srv := newTestServer(t)
+	sub := srv.createSubscription(models.CreateSubscriptionRequest{Name: "Spotify", Price: 5})
+	path := "/api/subscriptions/" + sub.ID.String()
+
+	name, price := "Spotify Family", 8.0
+	srv.do(nil, http.MethodPatch, path, models.UpdateSubscriptionRequest{Name: &name, Price: &price}, nil)
+
+	var reverted models.Subscription
+	if code := srv.do(nil, http.MethodPost, path+"/revert", models.RevertSubscriptionRequest{Version: 1}, &reverted); code != http.StatusOK {
+		t.Fatalf("revert: status %d", code)
+	}
+	if reverted.Name != "Spotify" || reverted.Price != 5 {
+		t.Errorf("reverted to %q at %v, want Spotify at 5", reverted.Name, reverted.Price)
+	}
+
+	var history []models.SubscriptionAuditEntry
+	srv.do(nil, http.MethodGet, path+"/history", nil, &history)
+	if len(history) != 3 || history[0].Action != "revert" || history[0].Version != 3 {
+		t.Fatalf("history = %+v, want create, update and revert", history)
+	}
+
+	if code := srv.do(nil, http.MethodPost, path+"/revert", models.RevertSubscriptionRequest{Version: 9}, nil); code != http.StatusNotFound {
+		t.Errorf("revert to a missing version: status %d, want 404", code)
+	}
+}
+
+func TestRevertValidatesTheSnapshot(t *testing.T) {
+	srv := newTestServer(t)
+	sub := srv.createSubscription(models.CreateSubscriptionRequest{Name: "Spotify", Price: 5})
+	path := "/api/subscriptions/" + sub.ID.String()
+
+	// A version saved before trials needed an end date
+	snapshot := sub
+	snapshot.Status = "trial"
+	err := srv.store.Subscriptions().RecordAudit(context.Background(), models.SubscriptionAuditEntry{
+		SubscriptionID: sub.ID, UserID: srv.user.ID, Action: "update", Snapshot: &snapshot,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var p models.Problem
+	if code := srv.do(nil, http.MethodPost, path+"/revert", models.RevertSubscriptionRequest{Version: 2}, &p); code != http.StatusBadRequest {
+		t.Fatalf("revert to an invalid version: status %d, want 400", code)
+	}
+	if len(p.Errors) != 1 || p.Errors[0].Field != "trial_end_date" {
+		t.Errorf("errors = %+v, want trial_end_date", p.Errors)
+	}
+
+	var current models.Subscription
+	srv.do(nil, http.MethodGet, path, nil, &current)
+	if current.Status != "active" {
+		t.Errorf("status = %s after a rejected revert, want active", current.Status)
+	}
+}
+
+func TestDeleteThenUndo(t *testing.T) {
+	srv := newTestServer(t)
+	sub := srv.createSubscription(models.CreateSubscriptionRequest{Name: "Hulu", Price: 7})
+	path := "/api/subscriptions/" + sub.ID.String()
+
+	if code := srv.do(nil, http.MethodDelete, path, nil, nil); code != http.StatusOK {
+		t.Fatalf("delete: status %d", code)
+	}
+	if code := srv.do(nil, http.MethodGet, path, nil, nil); code != http.StatusNotFound {
+		t.Fatalf("get after delete: status %d, want 404", code)
+	}
+
+	var archived []models.Subscription
+	srv.do(nil, http.MethodGet, "/api/subscriptions/archive", nil, &archived)
+	if len(archived) != 1 || archived[0].ID != sub.ID || archived[0].DeletedAt == nil {
+		t.Fatalf("archive = %+v, want the deleted subscription", archived)
+	}
+
+	if code := srv.do(nil, http.MethodPost, path+"/undo-delete", nil, nil); code != http.StatusOK {
+		t.Fatalf("undo delete: status %d", code)
+	}
+	if code := srv.do(nil, http.MethodGet, path, nil, nil); code != http.StatusOK {
+		t.Fatalf("get after undo: status %d", code)
+	}
+	if code := srv.do(nil, http.MethodPost, path+"/undo-delete", nil, nil); code != http.StatusNotFound {
+		t.Errorf("undo a live subscription: status %d, want 404", code)
+	}
+}
+
+func TestUndoDeleteExpires(t *testing.T) {
+	srv := newTestServer(t)
+	srv.subs.undoWindow = 0
+	sub := srv.createSubscription(models.CreateSubscriptionRequest{Name: "Hulu", Price: 7})
+	path := "/api/subscriptions/" + sub.ID.String()
+
+	srv.do(nil, http.MethodDelete, path, nil, nil)
+	if code := srv.do(nil, http.MethodPost, path+"/undo-delete", nil, nil); code != http.StatusGone {
+		t.Fatalf("undo after the window: status %d, want 410", code)
+	}
+	if code := srv.do(nil, http.MethodPost, path+"/restore", nil, nil); code != http.StatusOK {
+		t.Fatalf("restore from the archive: status %d", code)
+	}
+}
+
+func TestPurgeArchived(t *testing.T) {
+	srv := newTestServer(t)
+	srv.subs.archiveRetention = 0
+	kept := srv.createSubscription(models.CreateSubscriptionRequest{Name: "Kept", Price: 1})
+	purged := srv.createSubscription(models.CreateSubscriptionRequest{Name: "Purged", Price: 2})
+	srv.do(nil, http.MethodDelete, "/api/subscriptions/"+purged.ID.String(), nil, nil)
+
+	if err := srv.subs.PurgeArchived(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var archived []models.Subscription
+	srv.do(nil, http.MethodGet, "/api/subscriptions/archive", nil, &archived)
+	if len(archived) != 0 {
+		t.Errorf("archive after purge = %+v, want empty", archived)
+	}
+	if code := srv.do(nil, http.MethodPost, "/api/subscriptions/"+purged.ID.String()+"/restore", nil, nil); code != http.StatusNotFound {
+		t.Errorf("restore purged: status %d, want 404", code)
+	}
+	if code := srv.do(nil, http.MethodGet, "/api/subscriptions/"+kept.ID.String(), nil, nil); code != http.StatusOK {
+		t.Errorf("live subscription after purge: status %d", code)
+	}
+
+	// The audit trail outlives the subscription
+	history, err := srv.store.Subscriptions().History(context.Background(), srv.user.ID, purged.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) == 0 || history[0].Action != "purge" {
+		t.Errorf("history after purge = %+v, want a final purge entry", history)
+	}
+}
+
+func TestImportSubscriptions(t *testing.T) {
+	srv := newTestServer(t)
+	srv.createSubscription(models.CreateSubscriptionRequest{Name: "Netflix", Price: 10})
+
+	body := "name,price,billing_cycle,billing_date,category\nNetflix,10,monthly,2030-01-05,Entertainment\nSpotify,5,monthly,2030-01-07,Music\n"
+	req := httptest.NewRequest(http.MethodPost, "/api/subscriptions/import", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "text/csv")
+	w := httptest.NewRecorder()
+	srv.router.ServeHTTP(w, req)
+	if w.Code >= 300 {
+		t.Fatalf("import: status %d\n%s", w.Code, w.Body.String())
+	}
+
+	var names []string
+	err := srv.store.Subscriptions().Each(context.Background(), srv.user.ID, store.SubscriptionQuery{}, func(sub models.Subscription) error {
+		names = append(names, sub.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 {
+		t.Errorf("subscriptions after import = %v, want the duplicate skipped", names)
+	}
+}
+
+func TestInvalidImportIsAProblem(t *testing.T) {
+	srv := newTestServer(t)
+
+	body := "name,price,billing_cycle,billing_date\nSpotify,5,monthly,2030-01-07\nHulu,cheap,monthly,2030-01-07\n"
+	req := httptest.NewRequest(http.MethodPost, "/api/subscriptions/import", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "text/csv")
+	w := httptest.NewRecorder()
+	srv.router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnprocessableEntity || w.Header().Get("Content-Type") != "application/problem+json" {
+		t.Fatalf("import: status %d, %s, want 422 and a problem\n%s", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	}
+
+	var p models.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Errors) != 1 || p.Errors[0].Field != "rows[2].price" || p.Errors[0].Code != "type" {
+		t.Errorf("problem errors = %+v, want rows[2].price", p.Errors)
+	}
+}
+
+func TestExportGuardsAgainstFormulas(t *testing.T) {
+	srv := newTestServer(t)
+	description := "@SUM(A1:A9)"
+	srv.createSubscription(models.CreateSubscriptionRequest{Name: `=HYPERLINK("https://example.com")`, Price: 10, Description: &description})
+
+	export := func(format string) string {
+		t.Helper()
+		w := httptest.NewRecorder()
+		srv.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/subscriptions/export?format="+format, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("export %s: status %d\n%s", format, w.Code, w.Body.String())
+		}
+		return w.Body.String()
+	}
+
+	csv := export("csv")
+	if !strings.Contains(csv, `"'=HYPERLINK(""https://example.com"")"`) || !strings.Contains(csv, "'@SUM(A1:A9)") {
+		t.Errorf("CSV export:\n%s\nwant formulas prefixed with '", csv)
+	}
+
+	// Importing the export restores the original text
+	srv2 := newTestServer(t)
+	req := httptest.NewRequest(http.MethodPost, "/api/subscriptions/import", strings.NewReader(csv))
+	req.Header.Set("Content-Type", "text/csv")
+	w := httptest.NewRecorder()
+	srv2.router.ServeHTTP(w, req)
+	if w.Code >= 300 {
+		t.Fatalf("import: status %d\n%s", w.Code, w.Body.String())
+	}
+	err := srv2.store.Subscriptions().Each(context.Background(), srv2.user.ID, store.SubscriptionQuery{}, func(sub models.Subscription) error {
+		if sub.Name != `=HYPERLINK("https://example.com")` || sub.Description == nil || *sub.Description != description {
+			t.Errorf("imported %q (%v), want the exported text without its prefix", sub.Name, sub.Description)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"subscription-tracker/internal/database"
+	"subscription-tracker/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HealthCheck is one dependency checked by the readiness probe. A failing critical check takes the
+// instance out of rotation; other checks are only reported.
+type HealthCheck struct {
+	Name     string
+	Critical bool
+	Run      func(ctx context.Context) error
+}
+
+// HealthHandler serves the liveness and readiness probes
+type HealthHandler struct {
+	checks  []HealthCheck
+	timeout time.Duration
+	// Set once shutdown begins, so load balancers stop routing here while requests drain
+	draining atomic.Bool
+}
+
+func NewHealthHandler(timeout time.Duration, checks ...HealthCheck) *HealthHandler {
+	return &HealthHandler{checks: checks, timeout: timeout}
+}
+
+// Drain makes the readiness probe fail from now on
+func (h *HealthHandler) Drain() {
+	h.draining.Store(true)
+}
+
+// Livez reports that the process is up and serving. It checks no dependencies, so an outage of the
+// database doesn't get every instance restarted.
+func (h *HealthHandler) Livez(c *gin.Context) {
+	c.JSON(http.StatusOK, models.HealthResponse{Status: "ok"})
+}
+
+// Readyz runs every check concurrently and responds 503 if a critical one fails or the server is shutting down
+func (h *HealthHandler) Readyz(c *gin.Context) {
+	if h.draining.Load() {
+		c.JSON(http.StatusServiceUnavailable, models.HealthResponse{Status: "shutting_down"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeout)
+	defer cancel()
+
+	results := make(map[string]models.HealthCheck, len(h.checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range h.checks {
+		wg.Add(1)
+		go func(check HealthCheck) {
+			defer wg.Done()
+			start := time.Now()
+			err := check.Run(ctx)
+
+			result := models.HealthCheck{Status: "ok", Critical: check.Critical, Duration: time.Since(start).String()}
+			if err != nil {
+				result.Status = "failed"
+				result.Error = err.Error()
+			}
+			mu.Lock()
+			results[check.Name] = result
+			mu.Unlock()
+		}(check)
+	}
+	wg.Wait()
+
+	response := models.HealthResponse{Status: "ok", Checks: results}
+	status := http.StatusOK
+	for _, result := range results {
+		if result.Critical && result.Status != "ok" {
+			response.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+		}
+	}
+	c.JSON(status, response)
+}
+
+// DatabaseCheck pings the database
+func DatabaseCheck(db *database.DB) HealthCheck {
+	return HealthCheck{Name: "database", Critical: true, Run: db.PingContext}
+}
+
+// MigrationsCheck fails while migrations embedded in this build are yet to be applied,
+// as the handlers would query columns and tables that don't exist
+func MigrationsCheck(migrator *database.Migrator) HealthCheck {
+	return HealthCheck{Name: "migrations", Critical: true, Run: func(ctx context.Context) error {
+		pending, err := migrator.Pending(ctx)
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("%d pending migrations, starting with version %d", len(pending), pending[0])
+		}
+		return nil
+	}}
+}
+
+// ProviderCheck reports whether url can be reached. Any HTTP response counts, since only the network
+// path is being checked. Results are reused for interval so probes don't hammer the provider, and
+// the check is never critical: an outage at one provider shouldn't take the whole API down.
+func ProviderCheck(name, url string, interval time.Duration) HealthCheck {
+	client := &http.Client{Timeout: 5 * time.Second}
+	var mu sync.Mutex
+	var checkedAt time.Time
+	var lastErr error
+
+	return HealthCheck{Name: name, Run: func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if !checkedAt.IsZero() && time.Since(checkedAt) < interval {
+			return lastErr
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		checkedAt, lastErr = time.Now(), err
+		return err
+	}}
+}
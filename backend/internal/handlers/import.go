@@ -0,0 +1,508 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/problem"
+	"subscription-tracker/internal/store"
+	"subscription-tracker/internal/validate"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	maxImportBytes = 1 << 20 // 1MB
+	maxImportRows  = 1000
+)
+
+// importFields are the subscription fields a column can be mapped to
+var importFields = map[string]bool{
+	"name": true, "price": true, "billing_cycle": true, "billing_date": true, "category": true, "status": true,
+	"payment_method": true, "description": true, "website_url": true,
+	"trial_start_date": true, "trial_end_date": true, "post_trial_price": true,
+}
+
+// ImportSubscriptions creates subscriptions in bulk from a CSV or JSON file.
+// Rows are validated individually; the import only commits when every row is valid,
+// and duplicates of existing subscriptions are skipped. With dry_run=true nothing is written.
+func (h *SubscriptionHandler) ImportSubscriptions(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		problem.Respond(c, http.StatusUnauthorized, problem.Unauthenticated, "User not authenticated")
+		return
+	}
+
+	data, filename, err := readImportPayload(c)
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, problem.InvalidRequest, err.Error())
+		return
+	}
+
+	format, err := importFormat(c, filename)
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, problem.InvalidRequest, err.Error())
+		return
+	}
+
+	mapping, err := parseImportMapping(importOption(c, "mapping"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, problem.InvalidRequest, err.Error())
+		return
+	}
+
+	dryRun := false
+	if value := importOption(c, "dry_run"); value != "" {
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			problem.Respond(c, http.StatusBadRequest, problem.InvalidRequest, "dry_run must be true or false")
+			return
+		}
+	}
+
+	var records []map[string]string
+	if format == "json" {
+		records, err = parseJSONImport(data)
+	} else {
+		records, err = parseCSVImport(data)
+	}
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, problem.InvalidRequest, err.Error())
+		return
+	}
+	if len(records) == 0 {
+		problem.Respond(c, http.StatusBadRequest, problem.InvalidRequest, "Import file has no rows")
+		return
+	}
+	if len(records) > maxImportRows {
+		problem.Respond(c, http.StatusBadRequest, problem.InvalidRequest, fmt.Sprintf("Import is limited to %d rows", maxImportRows))
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	categories, err := h.categoryIDsByName(ctx)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Database error")
+		return
+	}
+	existing, err := h.subscriptionNames(ctx, userID.(uuid.UUID))
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Database error")
+		return
+	}
+
+	result := models.ImportResult{DryRun: dryRun, Total: len(records), Rows: make([]models.ImportRowResult, 0, len(records))}
+	seen := map[string]int{}
+	var invalid []models.FieldError
+	today := storedLocale(ctx, h.store.Users(), userID.(uuid.UUID)).Today()
+	for i, record := range records {
+		row, errs := buildImportRow(i+1, applyImportMapping(record, mapping), categories, today)
+		for _, fe := range errs {
+			fe.Field = fmt.Sprintf("rows[%d].%s", row.Row, fe.Field)
+			invalid = append(invalid, fe)
+		}
+
+		if row.Status == "valid" {
+			key := strings.ToLower(strings.TrimSpace(row.Subscription.Name))
+			if existing[key] {
+				row.Status = "duplicate"
+				row.Errors = append(row.Errors, fmt.Sprintf("a subscription named %q already exists", row.Subscription.Name))
+			} else if first, ok := seen[key]; ok {
+				row.Status = "duplicate"
+				row.Errors = append(row.Errors, fmt.Sprintf("duplicates row %d", first))
+			} else {
+				seen[key] = row.Row
+			}
+		}
+
+		switch row.Status {
+		case "valid":
+			result.Valid++
+		case "duplicate":
+			result.Duplicates++
+		default:
+			result.Invalid++
+		}
+		result.Rows = append(result.Rows, row)
+	}
+
+	if dryRun {
+		c.JSON(http.StatusOK, result)
+		return
+	}
+	if result.Invalid > 0 {
+		p := problem.New(c, http.StatusUnprocessableEntity, problem.ValidationFailed,
+			fmt.Sprintf("%d of %d rows are invalid, so nothing was imported", result.Invalid, result.Total))
+		p.Errors = invalid
+		problem.Write(c, p)
+		return
+	}
+
+	actorID := userID.(uuid.UUID)
+	now := time.Now()
+	err = h.store.WithTx(ctx, func(tx store.Store) error {
+		for i := range result.Rows {
+			row := &result.Rows[i]
+			if row.Status != "valid" {
+				continue
+			}
+
+			sub := newSubscription(*row.Subscription)
+			sub.ID = uuid.New()
+			sub.UserID = actorID
+			sub.CreatedAt = now
+			sub.UpdatedAt = now
+			if err := tx.Subscriptions().Create(ctx, sub); err != nil {
+				return fmt.Errorf("failed to import row %d: %w", row.Row, err)
+			}
+			if err := tx.Subscriptions().RecordPrice(ctx, models.PriceChange{
+				SubscriptionID: sub.ID, Price: sub.Price, EffectiveDate: now, Source: "import",
+			}); err != nil {
+				return fmt.Errorf("failed to record price history: %w", err)
+			}
+			if err := auditSubscription(ctx, tx.Subscriptions(), actorID, &actorID, "create", nil, sub); err != nil {
+				return fmt.Errorf("failed to record history: %w", err)
+			}
+
+			row.Status = "imported"
+			row.ID = &sub.ID
+			result.Imported++
+		}
+		return nil
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to import subscriptions", "error", err)
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Failed to import subscriptions")
+		return
+	}
+	for _, row := range result.Rows {
+		if row.ID != nil {
+			h.syncCalendar(ctx, actorID, *row.ID)
+		}
+	}
+
+	c.JSON(http.StatusCreated, result)
+}
+
+// readImportPayload returns the uploaded file, either as a multipart "file" field or the raw request body
+func readImportPayload(c *gin.Context) ([]byte, string, error) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes)
+
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			return nil, "", errors.New("a \"file\" field of at most 1MB is required")
+		}
+		f, err := fileHeader.Open()
+		if err != nil {
+			return nil, "", errors.New("failed to read uploaded file")
+		}
+		defer f.Close()
+
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return nil, "", errors.New("failed to read uploaded file")
+		}
+		return data, fileHeader.Filename, nil
+	}
+
+	data, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, "", errors.New("import file must be at most 1MB")
+	}
+	return data, "", nil
+}
+
+// importOption reads an option from the query string, falling back to the multipart form
+func importOption(c *gin.Context, key string) string {
+	if value := c.Query(key); value != "" {
+		return value
+	}
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		return c.PostForm(key)
+	}
+	return ""
+}
+
+// importFormat picks csv or json from the format option, the file extension or the content type
+func importFormat(c *gin.Context, filename string) (string, error) {
+	format := strings.ToLower(importOption(c, "format"))
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(filename)) {
+		case ".json":
+			format = "json"
+		case ".csv":
+			format = "csv"
+		default:
+			if strings.Contains(c.ContentType(), "json") {
+				format = "json"
+			} else {
+				format = "csv"
+			}
+		}
+	}
+	if format != "csv" && format != "json" {
+		return "", errors.New("format must be csv or json")
+	}
+	return format, nil
+}
+
+// normalizeImportKey makes column names comparable, so "Billing Cycle" matches billing_cycle
+func normalizeImportKey(key string) string {
+	key = strings.ToLower(strings.TrimSpace(key))
+	return strings.NewReplacer(" ", "_", "-", "_").Replace(key)
+}
+
+// parseImportMapping parses a JSON object of subscription field to source column, e.g. {"name": "Service"}
+func parseImportMapping(raw string) (map[string]string, error) {
+	mapping := map[string]string{}
+	if raw == "" {
+		return mapping, nil
+	}
+
+	var fields map[string]string
+	if err := json.Unmarshal([]byte(raw), &fields); err != nil {
+		return nil, errors.New("mapping must be a JSON object of field to column name")
+	}
+	for field, column := range fields {
+		if !importFields[field] {
+			return nil, fmt.Errorf("mapping has unknown field %q", field)
+		}
+		mapping[field] = normalizeImportKey(column)
+	}
+	return mapping, nil
+}
+
+// applyImportMapping resolves a record's columns to subscription fields.
+// Fields without a mapping are read from the column of the same name.
+func applyImportMapping(record map[string]string, mapping map[string]string) map[string]string {
+	fields := make(map[string]string, len(importFields))
+	for field := range importFields {
+		column := field
+		if mapped, ok := mapping[field]; ok {
+			column = mapped
+		}
+		fields[field] = strings.TrimSpace(record[column])
+	}
+	return fields
+}
+
+func parseCSVImport(data []byte) ([]map[string]string, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %v", err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	header := make([]string, len(rows[0]))
+	for i, column := range rows[0] {
+		header[i] = normalizeImportKey(column)
+	}
+
+	records := make([]map[string]string, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		record := make(map[string]string, len(header))
+		for i, value := range row {
+			if i < len(header) {
+				record[header[i]] = unguardSpreadsheetText(value)
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// unguardSpreadsheetText removes the ' that spreadsheetText adds, so exported CSV imports unchanged
+func unguardSpreadsheetText(s string) string {
+	if len(s) > 1 && s[0] == '\'' && strings.ContainsRune(formulaPrefixes, rune(s[1])) {
+		return s[1:]
+	}
+	return s
+}
+
+func parseJSONImport(data []byte) ([]map[string]string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var items []map[string]interface{}
+	if err := decoder.Decode(&items); err != nil {
+		return nil, errors.New("invalid JSON: expected an array of objects")
+	}
+
+	records := make([]map[string]string, 0, len(items))
+	for _, item := range items {
+		record := make(map[string]string, len(item))
+		for key, value := range item {
+			switch v := value.(type) {
+			case nil:
+				record[normalizeImportKey(key)] = ""
+			case string:
+				record[normalizeImportKey(key)] = v
+			default:
+				record[normalizeImportKey(key)] = fmt.Sprint(v)
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// buildImportRow validates one row and converts it to a create request. The row's errors are also returned
+// by field, for reporting a failed import as a problem.
+func buildImportRow(rowNumber int, fields map[string]string, categories map[string]uuid.UUID, today time.Time) (models.ImportRowResult, []models.FieldError) {
+	row := models.ImportRowResult{Row: rowNumber}
+	var errs []models.FieldError
+	invalid := func(field, code, message string) {
+		errs = append(errs, models.FieldError{Field: field, Code: code, Message: message})
+		row.Errors = append(row.Errors, message)
+	}
+	req := models.CreateSubscriptionRequest{
+		Name:         fields["name"],
+		BillingCycle: strings.ToLower(fields["billing_cycle"]),
+		Status:       strings.ToLower(fields["status"]),
+	}
+
+	if req.Name == "" {
+		invalid("name", "required", "name is required")
+	}
+
+	if fields["price"] == "" {
+		invalid("price", "required", "price is required")
+	} else if price, err := strconv.ParseFloat(fields["price"], 64); err != nil || price < 0 {
+		invalid("price", "type", fmt.Sprintf("price %q is not a valid amount", fields["price"]))
+	} else {
+		req.Price = price
+	}
+
+	if req.BillingCycle == "" {
+		invalid("billing_cycle", "required", "billing_cycle is required")
+	} else if !validBillingCycles[req.BillingCycle] {
+		invalid("billing_cycle", "oneof", fmt.Sprintf("billing_cycle %q must be weekly, monthly or yearly", req.BillingCycle))
+	}
+
+	if fields["billing_date"] == "" {
+		invalid("billing_date", "required", "billing_date is required")
+	} else if date, err := parseImportDate(fields["billing_date"]); err != nil {
+		invalid("billing_date", "type", fmt.Sprintf("billing_date %q must be a date like 2024-01-31", fields["billing_date"]))
+	} else {
+		req.BillingDate = date
+	}
+
+	if req.Status == "" {
+		req.Status = "active"
+	} else if !validSubscriptionStatuses[req.Status] {
+		invalid("status", "oneof", fmt.Sprintf("status %q is not a valid status", req.Status))
+	}
+
+	if value := strings.ToLower(fields["payment_method"]); value != "" {
+		if !validPaymentMethods[value] {
+			invalid("payment_method", "oneof", fmt.Sprintf("payment_method %q is not a valid payment method", value))
+		}
+		req.PaymentMethod = &value
+	}
+
+	if name := fields["category"]; name != "" {
+		req.Category = &name
+		if id, ok := categories[strings.ToLower(name)]; ok {
+			req.CategoryID = &id
+		} else {
+			row.Warnings = append(row.Warnings, fmt.Sprintf("category %q not found, importing without a category", name))
+		}
+	}
+
+	if value := fields["description"]; value != "" {
+		req.Description = &value
+	}
+	if value := fields["website_url"]; value != "" {
+		req.WebsiteURL = &value
+	}
+
+	for _, field := range []string{"trial_start_date", "trial_end_date"} {
+		if fields[field] == "" {
+			continue
+		}
+		date, err := parseImportDate(fields[field])
+		if err != nil {
+			invalid(field, "type", fmt.Sprintf("%s %q must be a date like 2024-01-31", field, fields[field]))
+			continue
+		}
+		if field == "trial_start_date" {
+			req.TrialStartDate = &date
+		} else {
+			req.TrialEndDate = &date
+		}
+	}
+
+	if value := fields["post_trial_price"]; value != "" {
+		if price, err := strconv.ParseFloat(value, 64); err != nil || price < 0 {
+			invalid("post_trial_price", "type", fmt.Sprintf("post_trial_price %q is not a valid amount", value))
+		} else {
+			req.PostTrialPrice = &price
+		}
+	}
+
+	if len(errs) == 0 {
+		defaultTrialStart(&req, today)
+		for _, fe := range validate.Subscription(newSubscription(req), today) {
+			invalid(fe.Field, fe.Code, fe.Message)
+		}
+	}
+
+	row.Subscription = &req
+	if len(errs) > 0 {
+		row.Status = "invalid"
+	} else {
+		row.Status = "valid"
+	}
+	return row, errs
+}
+
+func parseImportDate(value string) (time.Time, error) {
+	if date, err := time.Parse("2006-01-02", value); err == nil {
+		return date, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// categoryIDsByName maps lowercased category names to their IDs, matching FindCategory's case-insensitive lookup
+func (h *SubscriptionHandler) categoryIDsByName(ctx context.Context) (map[string]uuid.UUID, error) {
+	list, err := h.store.Subscriptions().Categories(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	categories := make(map[string]uuid.UUID, len(list))
+	for _, category := range list {
+		categories[strings.ToLower(category.Name)] = category.ID
+	}
+	return categories, nil
+}
+
+// subscriptionNames returns the lowercased names of the user's subscriptions, for duplicate detection
+func (h *SubscriptionHandler) subscriptionNames(ctx context.Context, userID uuid.UUID) (map[string]bool, error) {
+	names := map[string]bool{}
+	err := h.store.Subscriptions().Each(ctx, userID, store.SubscriptionQuery{}, func(sub models.Subscription) error {
+		names[strings.ToLower(strings.TrimSpace(sub.Name))] = true
+		return nil
+	})
+	return names, err
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+
+	"subscription-tracker/internal/locale"
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// storedLocale loads a user's timezone, locale and currency through the user store
+func storedLocale(ctx context.Context, users store.UserStore, userID uuid.UUID) locale.Settings {
+	user, err := users.Get(ctx, userID)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to load locale", "user_id", userID, "error", err)
+		return locale.Default()
+	}
+	return localeFromUserPreferences(user.Preferences)
+}
+
+func localeFromUserPreferences(prefs *models.UserPreferences) locale.Settings {
+	if prefs == nil {
+		return locale.Default()
+	}
+	currency := ""
+	if prefs.Budget != nil {
+		currency = prefs.Budget.Currency
+	}
+	return locale.New(prefs.Timezone, prefs.Locale, currency)
+}
@@ -3,48 +3,34 @@ package handlers
 import (
 	"net/http"
 
-	"subscription-tracker/internal/database"
 	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/problem"
+	"subscription-tracker/internal/store"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
 type NotificationHandler struct {
-	db *database.DB
+	store store.Store
 }
 
-func NewNotificationHandler(db *database.DB) *NotificationHandler {
-	return &NotificationHandler{db: db}
+func NewNotificationHandler(st store.Store) *NotificationHandler {
+	return &NotificationHandler{store: st}
 }
 
 func (h *NotificationHandler) GetNotifications(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not authenticated"})
+		problem.Respond(c, http.StatusUnauthorized, problem.Unauthenticated, "User not authenticated")
 		return
 	}
 
-	rows, err := h.db.Query(
-		"SELECT id, user_id, message, read, created_at FROM notifications WHERE user_id = $1 ORDER BY created_at DESC",
-		userID.(uuid.UUID),
-	)
+	notifications, err := h.store.Notifications().List(c.Request.Context(), userID.(uuid.UUID))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Database error"})
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Database error")
 		return
 	}
-	defer rows.Close()
-
-	var notifications []models.Notification
-	for rows.Next() {
-		var notification models.Notification
-		err := rows.Scan(&notification.ID, &notification.UserID, &notification.Message, &notification.Read, &notification.CreatedAt)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to scan notification"})
-			return
-		}
-		notifications = append(notifications, notification)
-	}
 
 	c.JSON(http.StatusOK, notifications)
 }
@@ -52,28 +38,22 @@ func (h *NotificationHandler) GetNotifications(c *gin.Context) {
 func (h *NotificationHandler) MarkAsRead(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not authenticated"})
+		problem.Respond(c, http.StatusUnauthorized, problem.Unauthenticated, "User not authenticated")
 		return
 	}
 
 	notificationID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid notification ID"})
-		return
-	}
-
-	result, err := h.db.Exec(
-		"UPDATE notifications SET read = true WHERE id = $1 AND user_id = $2",
-		notificationID, userID.(uuid.UUID),
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to update notification"})
+		problem.Respond(c, http.StatusBadRequest, problem.InvalidID, "Invalid notification ID")
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Notification not found"})
+	if err := h.store.Notifications().MarkRead(c.Request.Context(), userID.(uuid.UUID), notificationID); err != nil {
+		if err == store.ErrNotFound {
+			problem.Respond(c, http.StatusNotFound, problem.NotFound, "Notification not found")
+			return
+		}
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Failed to update notification")
 		return
 	}
 
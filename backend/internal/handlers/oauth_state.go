@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"subscription-tracker/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// oauthStateTTL is how long a user has to finish the provider's consent screen
+const oauthStateTTL = 10 * time.Minute
+
+var errInvalidOAuthState = errors.New("invalid or expired OAuth state")
+
+// oauthStatePayload is signed into the state parameter so the callback knows who started the flow
+type oauthStatePayload struct {
+	Nonce     string    `json:"n"`
+	UserID    uuid.UUID `json:"u"`
+	Provider  string    `json:"p"`
+	ExpiresAt int64     `json:"e"`
+}
+
+// newOAuthState starts a connect flow for the user. It returns the signed state and the PKCE S256 challenge;
+// the nonce and code verifier are stored so the callback can use them once.
+func (h *CalendarHandler) newOAuthState(ctx context.Context, userID uuid.UUID, provider string) (string, string, error) {
+	nonce, err := newRandomToken()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := newRandomToken()
+	if err != nil {
+		return "", "", err
+	}
+	expiresAt := time.Now().Add(oauthStateTTL)
+
+	err = h.store.Calendars().CreateOAuthState(ctx, store.OAuthState{
+		UserID: userID, Provider: provider, NonceHash: hashToken(nonce), CodeVerifier: verifier, ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to save OAuth state: %w", err)
+	}
+
+	payload, err := json.Marshal(oauthStatePayload{Nonce: nonce, UserID: userID, Provider: provider, ExpiresAt: expiresAt.Unix()})
+	if err != nil {
+		return "", "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	challenge := sha256.Sum256([]byte(verifier))
+	return encoded + "." + h.signOAuthState(encoded), base64.RawURLEncoding.EncodeToString(challenge[:]), nil
+}
+
+// consumeOAuthState checks a state returned by the provider and deletes it so it can't be replayed.
+// It returns the user who started the flow and the PKCE code verifier.
+func (h *CalendarHandler) consumeOAuthState(ctx context.Context, state, provider string) (uuid.UUID, string, error) {
+	encoded, signature, ok := strings.Cut(state, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(h.signOAuthState(encoded))) {
+		return uuid.Nil, "", errInvalidOAuthState
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return uuid.Nil, "", errInvalidOAuthState
+	}
+	var payload oauthStatePayload
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return uuid.Nil, "", errInvalidOAuthState
+	}
+	if payload.Provider != provider || time.Now().Unix() > payload.ExpiresAt {
+		return uuid.Nil, "", errInvalidOAuthState
+	}
+
+	verifier, err := h.store.Calendars().ConsumeOAuthState(ctx, payload.UserID, provider, hashToken(payload.Nonce))
+	if err == store.ErrNotFound {
+		return uuid.Nil, "", errInvalidOAuthState
+	}
+	if err != nil {
+		return uuid.Nil, "", fmt.Errorf("failed to load OAuth state: %w", err)
+	}
+	return payload.UserID, verifier, nil
+}
+
+func (h *CalendarHandler) signOAuthState(encoded string) string {
+	mac := hmac.New(sha256.New, []byte(h.stateSecret))
+	mac.Write([]byte("oauth-state:" + encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
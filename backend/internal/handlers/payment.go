@@ -1,54 +1,38 @@
 package handlers
 
 import (
+	"log/slog"
 	"net/http"
 
-	"subscription-tracker/internal/database"
 	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/problem"
+	"subscription-tracker/internal/store"
+	"subscription-tracker/internal/validate"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
 type PaymentHandler struct {
-	db *database.DB
+	store store.Store
 }
 
-func NewPaymentHandler(db *database.DB) *PaymentHandler {
-	return &PaymentHandler{db: db}
+func NewPaymentHandler(st store.Store) *PaymentHandler {
+	return &PaymentHandler{store: st}
 }
 
 func (h *PaymentHandler) GetPaymentMethods(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not authenticated"})
+		problem.Respond(c, http.StatusUnauthorized, problem.Unauthenticated, "User not authenticated")
 		return
 	}
 
-	rows, err := h.db.Query(
-		`SELECT id, user_id, type, last4, brand, phone_number, account_email, 
-		        last_balance_check, balance_cents, currency, is_default, created_at 
-		 FROM payment_methods WHERE user_id = $1 ORDER BY is_default DESC, created_at DESC`,
-		userID.(uuid.UUID),
-	)
+	paymentMethods, err := h.store.Payments().List(c.Request.Context(), userID.(uuid.UUID))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Database error"})
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Database error")
 		return
 	}
-	defer rows.Close()
-
-	var paymentMethods []models.PaymentMethod
-	for rows.Next() {
-		var pm models.PaymentMethod
-		err := rows.Scan(&pm.ID, &pm.UserID, &pm.Type, &pm.Last4, &pm.Brand, 
-			&pm.PhoneNumber, &pm.AccountEmail, &pm.LastBalanceCheck, 
-			&pm.BalanceCents, &pm.Currency, &pm.IsDefault, &pm.CreatedAt)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to scan payment method"})
-			return
-		}
-		paymentMethods = append(paymentMethods, pm)
-	}
 
 	c.JSON(http.StatusOK, paymentMethods)
 }
@@ -56,39 +40,18 @@ func (h *PaymentHandler) GetPaymentMethods(c *gin.Context) {
 func (h *PaymentHandler) CreatePaymentMethod(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not authenticated"})
+		problem.Respond(c, http.StatusUnauthorized, problem.Unauthenticated, "User not authenticated")
 		return
 	}
 
 	var req models.CreatePaymentMethodRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		problem.Invalid(c, err)
 		return
 	}
 
-	// Validate payment method type
-	validTypes := map[string]bool{
-		"credit_card":    true,
-		"debit_card":     true,
-		"mpesa":          true,
-		"paypal":         true,
-		"paystack":       true,
-		"bank_transfer":  true,
-	}
-	if !validTypes[req.Type] {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error: "Invalid payment method type. Valid types: credit_card, debit_card, mpesa, paypal, paystack, bank_transfer",
-		})
-		return
-	}
-
-	// Validate required fields based on type
-	if req.Type == "mpesa" && (req.PhoneNumber == nil || *req.PhoneNumber == "") {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Phone number is required for M-Pesa"})
-		return
-	}
-	if (req.Type == "paypal" || req.Type == "paystack") && (req.AccountEmail == nil || *req.AccountEmail == "") {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Account email is required for PayPal/Paystack"})
+	if errs := validate.PaymentMethod(&req); len(errs) > 0 {
+		problem.Fields(c, errs...)
 		return
 	}
 
@@ -100,32 +63,25 @@ func (h *PaymentHandler) CreatePaymentMethod(c *gin.Context) {
 		encryptedKey = req.APIKey
 	}
 
-	paymentMethodID := uuid.New()
-	currency := "KES" // Default currency
-
-	_, err := h.db.Exec(
-		`INSERT INTO payment_methods (id, user_id, type, last4, brand, phone_number, account_email, api_key_encrypted, currency) 
-		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
-		paymentMethodID, userID.(uuid.UUID), req.Type, req.Last4, req.Brand, 
-		req.PhoneNumber, req.AccountEmail, encryptedKey, currency,
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to create payment method: " + err.Error()})
-		return
+	// Balances are kept in the user's currency, except M-Pesa which only holds shillings
+	currency := storedLocale(c.Request.Context(), h.store.Users(), userID.(uuid.UUID)).Currency
+	if req.Type == "mpesa" {
+		currency = "KES"
 	}
 
-	var pm models.PaymentMethod
-	err = h.db.QueryRow(
-		`SELECT id, user_id, type, last4, brand, phone_number, account_email, 
-		        last_balance_check, balance_cents, currency, is_default, created_at 
-		 FROM payment_methods WHERE id = $1`,
-		paymentMethodID,
-	).Scan(&pm.ID, &pm.UserID, &pm.Type, &pm.Last4, &pm.Brand, 
-		&pm.PhoneNumber, &pm.AccountEmail, &pm.LastBalanceCheck, 
-		&pm.BalanceCents, &pm.Currency, &pm.IsDefault, &pm.CreatedAt)
-
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to retrieve created payment method"})
+	pm := models.PaymentMethod{
+		ID:           uuid.New(),
+		UserID:       userID.(uuid.UUID),
+		Type:         req.Type,
+		Last4:        req.Last4,
+		Brand:        req.Brand,
+		PhoneNumber:  req.PhoneNumber,
+		AccountEmail: req.AccountEmail,
+		Currency:     &currency,
+	}
+	if err := h.store.Payments().Create(c.Request.Context(), &pm, encryptedKey); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to create payment method", "error", err)
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Failed to create payment method")
 		return
 	}
 
@@ -135,28 +91,22 @@ func (h *PaymentHandler) CreatePaymentMethod(c *gin.Context) {
 func (h *PaymentHandler) DeletePaymentMethod(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not authenticated"})
+		problem.Respond(c, http.StatusUnauthorized, problem.Unauthenticated, "User not authenticated")
 		return
 	}
 
 	paymentMethodID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid payment method ID"})
-		return
-	}
-
-	result, err := h.db.Exec(
-		"DELETE FROM payment_methods WHERE id = $1 AND user_id = $2",
-		paymentMethodID, userID.(uuid.UUID),
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to delete payment method"})
+		problem.Respond(c, http.StatusBadRequest, problem.InvalidID, "Invalid payment method ID")
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Payment method not found"})
+	if err := h.store.Payments().Delete(c.Request.Context(), userID.(uuid.UUID), paymentMethodID); err != nil {
+		if err == store.ErrNotFound {
+			problem.Respond(c, http.StatusNotFound, problem.NotFound, "Payment method not found")
+			return
+		}
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Failed to delete payment method")
 		return
 	}
 
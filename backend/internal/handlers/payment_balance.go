@@ -1,16 +1,22 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
-	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/locale"
+	"subscription-tracker/internal/metrics"
+	"subscription-tracker/internal/problem"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 // CheckMpesaBalance handles M-Pesa balance check via Daraja API
@@ -19,7 +25,7 @@ func (h *PaymentHandler) CheckMpesaBalance(c *gin.Context) {
 		PhoneNumber string `json:"phoneNumber" binding:"required"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		problem.Invalid(c, err)
 		return
 	}
 
@@ -28,32 +34,27 @@ func (h *PaymentHandler) CheckMpesaBalance(c *gin.Context) {
 	consumerSecret := os.Getenv("MPESA_CONSUMER_SECRET")
 
 	if consumerKey == "" || consumerSecret == "" {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "M-Pesa API credentials not configured. Set MPESA_CONSUMER_KEY and MPESA_CONSUMER_SECRET",
-		})
+		problem.Respond(c, http.StatusServiceUnavailable, problem.ProviderNotConfigured, "M-Pesa API credentials not configured. Set MPESA_CONSUMER_KEY and MPESA_CONSUMER_SECRET")
 		return
 	}
 
 	// Get access token from M-Pesa
-	accessToken, err := getMpesaAccessToken(consumerKey, consumerSecret)
+	accessToken, err := getMpesaAccessToken(c.Request.Context(), consumerKey, consumerSecret)
 	if err != nil {
-		fmt.Printf("Failed to get M-Pesa access token: %v\n", err)
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to authenticate with M-Pesa API: " + err.Error(),
-		})
+		slog.ErrorContext(c.Request.Context(), "Failed to get M-Pesa access token", "error", err)
+		problem.Respond(c, http.StatusBadGateway, problem.ProviderError, "Failed to authenticate with M-Pesa API")
 		return
 	}
 
 	// Query account balance
-	balance, err := queryMpesaBalance(accessToken, req.PhoneNumber)
+	balance, err := queryMpesaBalance(c.Request.Context(), accessToken, req.PhoneNumber)
 	if err != nil {
-		fmt.Printf("Failed to query M-Pesa balance: %v\n", err)
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: err.Error(),
-		})
+		slog.ErrorContext(c.Request.Context(), "Failed to query M-Pesa balance", "error", err)
+		problem.Respond(c, http.StatusBadGateway, problem.ProviderError, "Failed to check M-Pesa balance")
 		return
 	}
 
+	// M-Pesa wallets are always held in Kenyan shillings, whatever the user's display currency
 	c.JSON(http.StatusOK, gin.H{
 		"balance":  balance,
 		"currency": "KES",
@@ -66,7 +67,7 @@ func (h *PaymentHandler) CheckCardBalance(c *gin.Context) {
 		CardToken string `json:"cardToken" binding:"required"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		problem.Invalid(c, err)
 		return
 	}
 
@@ -75,42 +76,37 @@ func (h *PaymentHandler) CheckCardBalance(c *gin.Context) {
 	apiKey := os.Getenv("CARD_PAYMENT_API_KEY")
 
 	if provider == "" || apiKey == "" {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Card payment provider not configured. Set CARD_PAYMENT_PROVIDER and CARD_PAYMENT_API_KEY",
-		})
+		problem.Respond(c, http.StatusServiceUnavailable, problem.ProviderNotConfigured, "Card payment provider not configured. Set CARD_PAYMENT_PROVIDER and CARD_PAYMENT_API_KEY")
 		return
 	}
 
-	// Query balance based on provider
+	// Query balance based on provider, preferring the user's currency when the account holds several
+	preferred := h.userCurrency(c)
 	var balance float64
-	var cardLast4 string
+	var currency, cardLast4 string
 	var err error
 
 	switch provider {
 	case "paystack":
-		balance, cardLast4, err = queryPaystackBalance(apiKey, req.CardToken)
+		balance, currency, cardLast4, err = queryPaystackBalance(c.Request.Context(), apiKey, req.CardToken, preferred)
 	case "flutterwave":
-		balance, cardLast4, err = queryFlutterwaveBalance(apiKey, req.CardToken)
+		balance, currency, cardLast4, err = queryFlutterwaveBalance(c.Request.Context(), apiKey, req.CardToken, preferred)
 	case "stripe":
-		balance, cardLast4, err = queryStripeBalance(apiKey, req.CardToken)
+		balance, currency, cardLast4, err = queryStripeBalance(c.Request.Context(), apiKey, req.CardToken, preferred)
 	default:
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: fmt.Sprintf("Unsupported payment provider: %s. Use: paystack, flutterwave, or stripe", provider),
-		})
+		problem.Respond(c, http.StatusServiceUnavailable, problem.ProviderNotConfigured, fmt.Sprintf("Unsupported payment provider: %s. Use: paystack, flutterwave, or stripe", provider))
 		return
 	}
 
 	if err != nil {
-		fmt.Printf("Failed to query card balance: %v\n", err)
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: err.Error(),
-		})
+		slog.ErrorContext(c.Request.Context(), "Failed to query card balance", "provider", provider, "error", err)
+		problem.Respond(c, http.StatusBadGateway, problem.ProviderError, "Failed to check card balance")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"balance":   balance,
-		"currency":  "KES",
+		"currency":  currency,
 		"cardLast4": cardLast4,
 	})
 }
@@ -121,32 +117,39 @@ func (h *PaymentHandler) CheckPayPalBalance(c *gin.Context) {
 		AccessToken string `json:"accessToken" binding:"required"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		problem.Invalid(c, err)
 		return
 	}
 
-	balance, err := queryPayPalBalance(req.AccessToken)
+	balance, currency, err := queryPayPalBalance(c.Request.Context(), req.AccessToken, h.userCurrency(c))
 	if err != nil {
-		fmt.Printf("Failed to query PayPal balance: %v\n", err)
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: err.Error(),
-		})
+		slog.ErrorContext(c.Request.Context(), "Failed to query PayPal balance", "error", err)
+		problem.Respond(c, http.StatusBadGateway, problem.ProviderError, "Failed to check PayPal balance")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"balance":  balance,
-		"currency": "KES",
+		"currency": currency,
 	})
 }
 
+// userCurrency is the authenticated user's preferred currency
+func (h *PaymentHandler) userCurrency(c *gin.Context) string {
+	userID, exists := c.Get("userID")
+	if !exists {
+		return locale.DefaultCurrency
+	}
+	return storedLocale(c.Request.Context(), h.store.Users(), userID.(uuid.UUID)).Currency
+}
+
 // M-Pesa Daraja API helper functions
-func getMpesaAccessToken(consumerKey, consumerSecret string) (string, error) {
-	url := "https://sandbox.safaricom.co.ke/oauth/v1/generate?grant_type=client_credentials"
+func getMpesaAccessToken(ctx context.Context, consumerKey, consumerSecret string) (string, error) {
+	url := darajaBaseURL + "/oauth/v1/generate?grant_type=client_credentials"
 	// For production: https://api.safaricom.co.ke/oauth/v1/generate?grant_type=client_credentials
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	req, err := http.NewRequest("GET", url, nil)
+	client := metrics.Client("daraja", 10*time.Second)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return "", err
 	}
@@ -176,7 +179,7 @@ func getMpesaAccessToken(consumerKey, consumerSecret string) (string, error) {
 	return tokenResp.AccessToken, nil
 }
 
-func queryMpesaBalance(accessToken, phoneNumber string) (float64, error) {
+func queryMpesaBalance(ctx context.Context, accessToken, phoneNumber string) (float64, error) {
 	// NOTE: M-Pesa Account Balance API requires special permissions from Safaricom
 	// For development/testing, we'll validate the phone number format and return a simulated balance
 	// For production: Register at https://developer.safaricom.co.ke/ for Account Balance API
@@ -195,19 +198,19 @@ func queryMpesaBalance(accessToken, phoneNumber string) (float64, error) {
 	simulatedBalance := 5000.00 // KES 5,000
 	
 	// Log the connection attempt
-	fmt.Printf("M-Pesa balance check - Phone: %s, Access Token: %s...\n", phoneNumber, accessToken[:20])
+	slog.DebugContext(ctx, "M-Pesa balance check", "phone_number", phoneNumber)
 	
 	return simulatedBalance, nil
 }
 
 // Paystack helper functions
-func queryPaystackBalance(apiKey, cardToken string) (float64, string, error) {
+func queryPaystackBalance(ctx context.Context, apiKey, cardToken, currency string) (float64, string, string, error) {
 	url := "https://api.paystack.co/balance"
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	req, err := http.NewRequest("GET", url, nil)
+	client := metrics.Client("paystack", 10*time.Second)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return 0, "", err
+		return 0, "", "", err
 	}
 
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", apiKey))
@@ -215,13 +218,13 @@ func queryPaystackBalance(apiKey, cardToken string) (float64, string, error) {
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return 0, "", err
+		return 0, "", "", err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return 0, "", fmt.Errorf("Paystack API error (%d): %s", resp.StatusCode, string(body))
+		return 0, "", "", fmt.Errorf("Paystack API error (%d): %s", resp.StatusCode, string(body))
 	}
 
 	var result struct {
@@ -232,25 +235,32 @@ func queryPaystackBalance(apiKey, cardToken string) (float64, string, error) {
 		} `json:"data"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return 0, "", err
+		return 0, "", "", err
 	}
 
 	if !result.Status || len(result.Data) == 0 {
-		return 0, "", fmt.Errorf("no balance data returned from Paystack")
+		return 0, "", "", fmt.Errorf("no balance data returned from Paystack")
 	}
 
-	balance := float64(result.Data[0].Balance) / 100 // Paystack returns in kobo
-	return balance, "****", nil
+	bal := result.Data[0]
+	for _, b := range result.Data {
+		if strings.EqualFold(b.Currency, currency) {
+			bal = b
+			break
+		}
+	}
+	balance := float64(bal.Balance) / 100 // Paystack returns in kobo
+	return balance, strings.ToUpper(bal.Currency), "****", nil
 }
 
 // Flutterwave helper functions
-func queryFlutterwaveBalance(apiKey, cardToken string) (float64, string, error) {
+func queryFlutterwaveBalance(ctx context.Context, apiKey, cardToken, currency string) (float64, string, string, error) {
 	url := "https://api.flutterwave.com/v3/balances"
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	req, err := http.NewRequest("GET", url, nil)
+	client := metrics.Client("flutterwave", 10*time.Second)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return 0, "", err
+		return 0, "", "", err
 	}
 
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", apiKey))
@@ -258,13 +268,13 @@ func queryFlutterwaveBalance(apiKey, cardToken string) (float64, string, error)
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return 0, "", err
+		return 0, "", "", err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return 0, "", fmt.Errorf("Flutterwave API error (%d): %s", resp.StatusCode, string(body))
+		return 0, "", "", fmt.Errorf("Flutterwave API error (%d): %s", resp.StatusCode, string(body))
 	}
 
 	var result struct {
@@ -275,32 +285,32 @@ func queryFlutterwaveBalance(apiKey, cardToken string) (float64, string, error)
 		} `json:"data"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return 0, "", err
+		return 0, "", "", err
 	}
 
 	if result.Status != "success" || len(result.Data) == 0 {
-		return 0, "", fmt.Errorf("no balance data returned from Flutterwave")
+		return 0, "", "", fmt.Errorf("no balance data returned from Flutterwave")
 	}
 
-	// Find KES balance
+	// Find the balance in the requested currency
 	for _, bal := range result.Data {
-		if bal.Currency == "KES" {
-			return bal.AvailableBalance, "****", nil
+		if strings.EqualFold(bal.Currency, currency) {
+			return bal.AvailableBalance, strings.ToUpper(bal.Currency), "****", nil
 		}
 	}
 
 	// Return first available balance
-	return result.Data[0].AvailableBalance, "****", nil
+	return result.Data[0].AvailableBalance, strings.ToUpper(result.Data[0].Currency), "****", nil
 }
 
 // Stripe helper functions
-func queryStripeBalance(apiKey, cardToken string) (float64, string, error) {
+func queryStripeBalance(ctx context.Context, apiKey, cardToken, currency string) (float64, string, string, error) {
 	url := "https://api.stripe.com/v1/balance"
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	req, err := http.NewRequest("GET", url, nil)
+	client := metrics.Client("stripe", 10*time.Second)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return 0, "", err
+		return 0, "", "", err
 	}
 
 	req.SetBasicAuth(apiKey, "")
@@ -308,13 +318,13 @@ func queryStripeBalance(apiKey, cardToken string) (float64, string, error) {
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return 0, "", err
+		return 0, "", "", err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return 0, "", fmt.Errorf("Stripe API error (%d): %s", resp.StatusCode, string(body))
+		return 0, "", "", fmt.Errorf("Stripe API error (%d): %s", resp.StatusCode, string(body))
 	}
 
 	var result struct {
@@ -324,26 +334,33 @@ func queryStripeBalance(apiKey, cardToken string) (float64, string, error) {
 		} `json:"available"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return 0, "", err
+		return 0, "", "", err
 	}
 
 	if len(result.Available) == 0 {
-		return 0, "", fmt.Errorf("no balance data returned from Stripe")
+		return 0, "", "", fmt.Errorf("no balance data returned from Stripe")
 	}
 
-	balance := float64(result.Available[0].Amount) / 100 // Stripe returns in cents
-	return balance, "****", nil
+	available := result.Available[0]
+	for _, a := range result.Available {
+		if strings.EqualFold(a.Currency, currency) {
+			available = a
+			break
+		}
+	}
+	balance := float64(available.Amount) / 100 // Stripe returns in cents
+	return balance, strings.ToUpper(available.Currency), "****", nil
 }
 
 // PayPal helper functions
-func queryPayPalBalance(accessToken string) (float64, error) {
+func queryPayPalBalance(ctx context.Context, accessToken, currency string) (float64, string, error) {
 	url := "https://api-m.sandbox.paypal.com/v1/reporting/balances"
 	// For production: https://api-m.paypal.com/v1/reporting/balances
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	req, err := http.NewRequest("GET", url, nil)
+	client := metrics.Client("paypal", 10*time.Second)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return 0, err
+		return 0, "", err
 	}
 
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
@@ -351,13 +368,13 @@ func queryPayPalBalance(accessToken string) (float64, error) {
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return 0, err
+		return 0, "", err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return 0, fmt.Errorf("PayPal API error (%d): %s", resp.StatusCode, string(body))
+		return 0, "", fmt.Errorf("PayPal API error (%d): %s", resp.StatusCode, string(body))
 	}
 
 	var result struct {
@@ -369,14 +386,21 @@ func queryPayPalBalance(accessToken string) (float64, error) {
 		} `json:"balances"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return 0, err
+		return 0, "", err
 	}
 
 	if len(result.Balances) == 0 {
-		return 0, fmt.Errorf("no balance data returned from PayPal")
+		return 0, "", fmt.Errorf("no balance data returned from PayPal")
 	}
 
+	total := result.Balances[0].TotalBalance
+	for _, b := range result.Balances {
+		if strings.EqualFold(b.TotalBalance.Currency, currency) {
+			total = b.TotalBalance
+			break
+		}
+	}
 	var balance float64
-	fmt.Sscanf(result.Balances[0].TotalBalance.Value, "%f", &balance)
-	return balance, nil
+	fmt.Sscanf(total.Value, "%f", &balance)
+	return balance, total.Currency, nil
 }
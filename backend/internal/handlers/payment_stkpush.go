@@ -2,15 +2,20 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"time"
 
-	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/metrics"
+	"subscription-tracker/internal/problem"
+	"subscription-tracker/internal/store"
 
 	"github.com/gin-gonic/gin"
 )
@@ -36,56 +41,25 @@ type STKPushResponse struct {
 func (h *PaymentHandler) InitiateMpesaSTKPush(c *gin.Context) {
 	var req STKPushRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		problem.Invalid(c, err)
 		return
 	}
 
-	// Get M-Pesa credentials from environment
-	consumerKey := os.Getenv("MPESA_CONSUMER_KEY")
-	consumerSecret := os.Getenv("MPESA_CONSUMER_SECRET")
-	shortCode := os.Getenv("MPESA_SHORTCODE")
-	passKey := os.Getenv("MPESA_PASSKEY")
-	callbackURL := os.Getenv("MPESA_CALLBACK_URL")
-
-	if consumerKey == "" || consumerSecret == "" || shortCode == "" || passKey == "" {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "M-Pesa API credentials not configured. Check environment variables",
-		})
-		return
-	}
-
-	// Default callback URL if not set
-	if callbackURL == "" {
-		callbackURL = "https://your-domain.com/api/payment/mpesa/callback"
-	}
-
-	// Get access token from M-Pesa
-	accessToken, err := getMpesaAccessToken(consumerKey, consumerSecret)
-	if err != nil {
-		fmt.Printf("Failed to get M-Pesa access token: %v\n", err)
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to authenticate with M-Pesa API: " + err.Error(),
-		})
-		return
-	}
-
-	// Initiate STK Push
-	response, err := initiateSTKPush(accessToken, shortCode, passKey, req.PhoneNumber, req.Amount, req.AccountReference, req.Description, callbackURL)
+	response, err := sendMpesaSTKPush(c.Request.Context(), req.PhoneNumber, req.Amount, req.AccountReference, req.Description)
 	if err != nil {
-		fmt.Printf("Failed to initiate STK Push: %v\n", err)
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to initiate payment: " + err.Error(),
-		})
+		if errors.Is(err, errMpesaNotConfigured) {
+			problem.Respond(c, http.StatusServiceUnavailable, problem.ProviderNotConfigured, "M-Pesa API credentials not configured. Check environment variables")
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "Failed to initiate STK Push", "error", err)
+		problem.Respond(c, http.StatusBadGateway, problem.ProviderError, "Failed to initiate payment")
 		return
 	}
 
 	// Check if the STK Push was successful
 	if response.ResponseCode != "0" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"message": response.ResponseDescription,
-			"error":   response.CustomerMessage,
-		})
+		slog.WarnContext(c.Request.Context(), "M-Pesa rejected STK Push", "response_code", response.ResponseCode, "description", response.ResponseDescription)
+		problem.Respond(c, http.StatusBadRequest, problem.PaymentRejected, response.CustomerMessage)
 		return
 	}
 
@@ -97,8 +71,58 @@ func (h *PaymentHandler) InitiateMpesaSTKPush(c *gin.Context) {
 	})
 }
 
+var errMpesaNotConfigured = errors.New("M-Pesa API credentials not configured")
+
+// darajaBaseURL is the Daraja API host (Sandbox)
+var darajaBaseURL = "https://sandbox.safaricom.co.ke"
+
+// mpesaConfig holds the Daraja credentials from the environment
+type mpesaConfig struct {
+	consumerKey    string
+	consumerSecret string
+	shortCode      string
+	passKey        string
+	callbackURL    string
+}
+
+// loadMpesaConfig reads the Daraja credentials, failing with errMpesaNotConfigured when any is missing
+func loadMpesaConfig() (mpesaConfig, error) {
+	cfg := mpesaConfig{
+		consumerKey:    os.Getenv("MPESA_CONSUMER_KEY"),
+		consumerSecret: os.Getenv("MPESA_CONSUMER_SECRET"),
+		shortCode:      os.Getenv("MPESA_SHORTCODE"),
+		passKey:        os.Getenv("MPESA_PASSKEY"),
+		callbackURL:    os.Getenv("MPESA_CALLBACK_URL"),
+	}
+	if cfg.consumerKey == "" || cfg.consumerSecret == "" || cfg.shortCode == "" || cfg.passKey == "" {
+		return cfg, errMpesaNotConfigured
+	}
+
+	// Default callback URL if not set
+	if cfg.callbackURL == "" {
+		cfg.callbackURL = "https://your-domain.com/api/payment/mpesa/callback"
+	}
+	return cfg, nil
+}
+
+// sendMpesaSTKPush authenticates with Daraja and sends an STK Push prompt to phoneNumber
+func sendMpesaSTKPush(ctx context.Context, phoneNumber string, amount float64, accountRef, description string) (*STKPushResponse, error) {
+	cfg, err := loadMpesaConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	// Get access token from M-Pesa
+	accessToken, err := getMpesaAccessToken(ctx, cfg.consumerKey, cfg.consumerSecret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to authenticate with M-Pesa API: %w", err)
+	}
+
+	return initiateSTKPush(ctx, accessToken, cfg.shortCode, cfg.passKey, phoneNumber, amount, accountRef, description, cfg.callbackURL)
+}
+
 // initiateSTKPush sends STK Push request to M-Pesa Daraja API
-func initiateSTKPush(accessToken, shortCode, passKey, phoneNumber string, amount float64, accountRef, description, callbackURL string) (*STKPushResponse, error) {
+func initiateSTKPush(ctx context.Context, accessToken, shortCode, passKey, phoneNumber string, amount float64, accountRef, description, callbackURL string) (*STKPushResponse, error) {
 	// Generate timestamp (YYYYMMDDHHmmss)
 	timestamp := time.Now().Format("20060102150405")
 
@@ -130,11 +154,11 @@ func initiateSTKPush(accessToken, shortCode, passKey, phoneNumber string, amount
 		return nil, fmt.Errorf("failed to marshal payload: %w", err)
 	}
 
-	// M-Pesa STK Push endpoint (Sandbox)
-	url := "https://sandbox.safaricom.co.ke/mpesa/stkpush/v1/processrequest"
+	// M-Pesa STK Push endpoint
+	url := darajaBaseURL + "/mpesa/stkpush/v1/processrequest"
 
 	// Create HTTP request
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonPayload))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonPayload))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -144,7 +168,7 @@ func initiateSTKPush(accessToken, shortCode, passKey, phoneNumber string, amount
 	req.Header.Set("Authorization", "Bearer "+accessToken)
 
 	// Send request
-	client := &http.Client{Timeout: 30 * time.Second}
+	client := metrics.Client("daraja", 30*time.Second)
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
@@ -157,28 +181,112 @@ func initiateSTKPush(accessToken, shortCode, passKey, phoneNumber string, amount
 		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
 
-	fmt.Printf("M-Pesa STK Push Response: %s\n", string(body))
-
 	// Parse response
 	var stkResponse STKPushResponse
 	if err := json.Unmarshal(body, &stkResponse); err != nil {
 		return nil, fmt.Errorf("failed to parse response: %w", err)
 	}
+	slog.InfoContext(ctx, "M-Pesa STK Push sent",
+		"response_code", stkResponse.ResponseCode,
+		"checkout_request_id", stkResponse.CheckoutRequestID,
+		"merchant_request_id", stkResponse.MerchantRequestID,
+	)
 
 	return &stkResponse, nil
 }
 
+// STKQueryResponse represents M-Pesa STK Push Query API response
+type STKQueryResponse struct {
+	ResponseCode        string      `json:"ResponseCode"`
+	ResponseDescription string      `json:"ResponseDescription"`
+	CheckoutRequestID   string      `json:"CheckoutRequestID"`
+	ResultCode          json.Number `json:"ResultCode"`
+	ResultDesc          string      `json:"ResultDesc"`
+}
+
+// queryMpesaSTKPush asks Daraja for the result of the STK Push with checkoutRequestID
+func queryMpesaSTKPush(ctx context.Context, checkoutRequestID string) (*STKQueryResponse, error) {
+	cfg, err := loadMpesaConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := getMpesaAccessToken(ctx, cfg.consumerKey, cfg.consumerSecret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to authenticate with M-Pesa API: %w", err)
+	}
+
+	timestamp := time.Now().Format("20060102150405")
+	payload := map[string]interface{}{
+		"BusinessShortCode": cfg.shortCode,
+		"Password":          base64.StdEncoding.EncodeToString([]byte(cfg.shortCode + cfg.passKey + timestamp)),
+		"Timestamp":         timestamp,
+		"CheckoutRequestID": checkoutRequestID,
+	}
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", darajaBaseURL+"/mpesa/stkpushquery/v1/query", bytes.NewBuffer(jsonPayload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	client := metrics.Client("daraja", 30*time.Second)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Daraja answers with an error status while the customer hasn't responded yet
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("STK Push query failed (%d): %s", resp.StatusCode, string(body))
+	}
+
+	var queryResponse STKQueryResponse
+	if err := json.Unmarshal(body, &queryResponse); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return &queryResponse, nil
+}
+
 // MpesaCallback handles M-Pesa payment callback
 func (h *PaymentHandler) MpesaCallback(c *gin.Context) {
 	var callback map[string]interface{}
 	if err := c.ShouldBindJSON(&callback); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		problem.Invalid(c, err)
 		return
 	}
 
-	// Log the callback for debugging
-	callbackJSON, _ := json.MarshalIndent(callback, "", "  ")
-	fmt.Printf("M-Pesa Callback Received:\n%s\n", string(callbackJSON))
+	// The payload holds the payer's phone number, so only its identifiers are logged
+	checkoutRequestID, resultCode, ok := parseSTKCallback(callback)
+	if ok {
+		slog.InfoContext(c.Request.Context(), "M-Pesa callback received", "checkout_request_id", checkoutRequestID, "result_code", resultCode)
+	} else {
+		slog.WarnContext(c.Request.Context(), "Unrecognized M-Pesa callback")
+	}
+
+	// Settle any split ledger entry waiting on this STK Push. Anyone can post to this endpoint, so the
+	// result is taken from Daraja rather than from the callback body.
+	if ok {
+		ctx := c.Request.Context()
+		if status, err := confirmSTKPush(ctx, checkoutRequestID); err != nil {
+			slog.WarnContext(ctx, "Failed to confirm M-Pesa payment", "checkout_request_id", checkoutRequestID, "error", err)
+		} else {
+			err := h.store.Splits().SetSettlementStatus(ctx, checkoutRequestID, status)
+			if err != nil && err != store.ErrNotFound {
+				slog.ErrorContext(ctx, "Failed to update split settlement", "checkout_request_id", checkoutRequestID, "error", err)
+			}
+		}
+	}
 
 	// TODO: Process the callback and update subscription payment status
 	// Extract result code, amount, transaction ID, etc.
@@ -189,3 +297,39 @@ func (h *PaymentHandler) MpesaCallback(c *gin.Context) {
 		"ResultDesc": "Callback received successfully",
 	})
 }
+
+// confirmSTKPush queries Daraja for the outcome of an STK Push, returning the settlement status it leads to
+func confirmSTKPush(ctx context.Context, checkoutRequestID string) (string, error) {
+	result, err := queryMpesaSTKPush(ctx, checkoutRequestID)
+	if err != nil {
+		return "", err
+	}
+	if result.ResponseCode != "0" || result.CheckoutRequestID != checkoutRequestID {
+		return "", fmt.Errorf("STK Push query rejected: %s", result.ResponseDescription)
+	}
+	if result.ResultCode.String() == "0" {
+		return "completed", nil
+	}
+	return "failed", nil
+}
+
+// parseSTKCallback extracts the CheckoutRequestID and ResultCode from a Daraja STK callback body
+func parseSTKCallback(callback map[string]interface{}) (string, int, bool) {
+	body, ok := callback["Body"].(map[string]interface{})
+	if !ok {
+		return "", 0, false
+	}
+	stkCallback, ok := body["stkCallback"].(map[string]interface{})
+	if !ok {
+		return "", 0, false
+	}
+	checkoutRequestID, ok := stkCallback["CheckoutRequestID"].(string)
+	if !ok || checkoutRequestID == "" {
+		return "", 0, false
+	}
+	resultCode, ok := stkCallback["ResultCode"].(float64)
+	if !ok {
+		return "", 0, false
+	}
+	return checkoutRequestID, int(resultCode), true
+}
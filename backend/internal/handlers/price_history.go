@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/problem"
+	"subscription-tracker/internal/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// notifyPriceChange tells a user that one of their subscriptions changed price
+func notifyPriceChange(ctx context.Context, st store.Store, userID uuid.UUID, name string, oldPrice, newPrice float64, effectiveDate time.Time) {
+	direction, notificationType := "increased", "warning"
+	if newPrice < oldPrice {
+		direction, notificationType = "decreased", "info"
+	}
+
+	settings := storedLocale(ctx, st.Users(), userID)
+	title := fmt.Sprintf("%s price %s", name, direction)
+	message := fmt.Sprintf("%s %s its price from %s to %s, effective %s.",
+		name, direction, settings.FormatMoney(oldPrice), settings.FormatMoney(newPrice), settings.FormatDate(effectiveDate))
+	err := st.Notifications().Create(ctx, &models.Notification{
+		ID:      uuid.New(),
+		UserID:  userID,
+		Title:   title,
+		Message: message,
+		Type:    notificationType,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to create price change notification", "user_id", userID, "error", err)
+	}
+}
+
+// GetPriceHistory returns every recorded price of a subscription, most recent first
+func (h *SubscriptionHandler) GetPriceHistory(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		problem.Respond(c, http.StatusUnauthorized, problem.Unauthenticated, "User not authenticated")
+		return
+	}
+
+	subscriptionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, problem.InvalidID, "Invalid subscription ID")
+		return
+	}
+
+	history, err := h.store.Subscriptions().PriceHistory(c.Request.Context(), userID.(uuid.UUID), subscriptionID)
+	if err != nil {
+		if err == store.ErrNotFound {
+			problem.Respond(c, http.StatusNotFound, problem.NotFound, "Subscription not found")
+			return
+		}
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Database error")
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
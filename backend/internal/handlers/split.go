@@ -0,0 +1,569 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"time"
+
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/problem"
+	"subscription-tracker/internal/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type SplitHandler struct {
+	store store.Store
+}
+
+func NewSplitHandler(st store.Store) *SplitHandler {
+	return &SplitHandler{store: st}
+}
+
+type SplitSummary struct {
+	SubscriptionID uuid.UUID             `json:"subscription_id"`
+	Price          float64               `json:"price"`
+	OwnerShare     float64               `json:"owner_share_percent"`
+	Members        []models.SplitMember  `json:"members"`
+	Balances       []models.SplitBalance `json:"balances"`
+}
+
+type SplitBalances struct {
+	OwedToMe []models.SplitBalance `json:"owed_to_me"`
+	IOwe     []models.SplitBalance `json:"i_owe"`
+	NetTotal float64               `json:"net_total"`
+}
+
+// GetSplit returns the members of a shared subscription and what each one owes
+func (h *SplitHandler) GetSplit(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		problem.Respond(c, http.StatusUnauthorized, problem.Unauthenticated, "User not authenticated")
+		return
+	}
+
+	subscriptionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, problem.InvalidID, "Invalid subscription ID")
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	sub, ok := h.ownSubscription(c, userID.(uuid.UUID), subscriptionID)
+	if !ok {
+		return
+	}
+
+	if err := h.accrueCharges(ctx, sub); err != nil {
+		slog.ErrorContext(ctx, "Failed to accrue split charges", "subscription_id", subscriptionID, "error", err)
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Failed to accrue split charges")
+		return
+	}
+
+	members, err := h.store.Splits().Members(ctx, subscriptionID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Failed to get split members")
+		return
+	}
+
+	balances, err := h.store.Splits().Balances(ctx, store.BalanceFilter{SubscriptionID: &subscriptionID})
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Failed to calculate balances")
+		return
+	}
+
+	summary := SplitSummary{
+		SubscriptionID: subscriptionID,
+		Price:          sub.Price,
+		OwnerShare:     100,
+		Members:        members,
+		Balances:       balances,
+	}
+	for _, m := range members {
+		summary.OwnerShare -= m.SharePercent
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// AddMember adds a member who owes a percentage of the subscription each billing cycle
+func (h *SplitHandler) AddMember(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		problem.Respond(c, http.StatusUnauthorized, problem.Unauthenticated, "User not authenticated")
+		return
+	}
+
+	subscriptionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, problem.InvalidID, "Invalid subscription ID")
+		return
+	}
+
+	var req models.CreateSplitMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Invalid(c, err)
+		return
+	}
+
+	if req.SharePercent <= 0 || req.SharePercent > 100 {
+		problem.Fields(c, models.FieldError{Field: "share_percent", Code: "range", Message: "share_percent must be between 0 and 100"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	// Members' shares can't exceed the whole subscription; the owner covers whatever is left
+	member := models.SplitMember{
+		ID:             uuid.New(),
+		SubscriptionID: subscriptionID,
+		Name:           req.Name,
+		Email:          req.Email,
+		PhoneNumber:    req.PhoneNumber,
+		SharePercent:   req.SharePercent,
+	}
+	var allocated float64
+	err = h.store.WithTx(ctx, func(tx store.Store) error {
+		if _, err := tx.Subscriptions().GetForUpdate(ctx, userID.(uuid.UUID), subscriptionID); err != nil {
+			return err
+		}
+		members, err := tx.Splits().Members(ctx, subscriptionID)
+		if err != nil {
+			return err
+		}
+		for _, m := range members {
+			allocated += m.SharePercent
+		}
+		if allocated+req.SharePercent > 100 {
+			return errShareExceeded
+		}
+		return tx.Splits().AddMember(ctx, &member)
+	})
+	switch {
+	case err == store.ErrNotFound:
+		problem.Respond(c, http.StatusNotFound, problem.NotFound, "Subscription not found")
+		return
+	case err == errShareExceeded:
+		problem.Fields(c, models.FieldError{
+			Field:   "share_percent",
+			Code:    "max",
+			Message: fmt.Sprintf("Share exceeds the remaining %.2f%% of this subscription", 100-allocated),
+		})
+		return
+	case err != nil:
+		slog.ErrorContext(ctx, "Failed to add split member", "subscription_id", subscriptionID, "error", err)
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Failed to add split member")
+		return
+	}
+
+	c.JSON(http.StatusCreated, member)
+}
+
+// errShareExceeded means a new member's share would take the split past 100%
+var errShareExceeded = errors.New("share exceeds the remainder")
+
+// Settle's transaction returns these to pick its response
+var (
+	errSettlementExceeded = errors.New("settlement exceeds the outstanding balance")
+	errPhoneRequired      = errors.New("no phone number for M-Pesa")
+)
+
+// RemoveMember removes a member and their ledger history from a shared subscription
+func (h *SplitHandler) RemoveMember(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		problem.Respond(c, http.StatusUnauthorized, problem.Unauthenticated, "User not authenticated")
+		return
+	}
+
+	subscriptionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, problem.InvalidID, "Invalid subscription ID")
+		return
+	}
+
+	memberID, err := uuid.Parse(c.Param("memberId"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, problem.InvalidID, "Invalid member ID")
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	err = h.store.WithTx(ctx, func(tx store.Store) error {
+		if _, err := tx.Subscriptions().GetForUpdate(ctx, userID.(uuid.UUID), subscriptionID); err != nil {
+			return err
+		}
+		return tx.Splits().RemoveMember(ctx, subscriptionID, memberID)
+	})
+	if err == store.ErrNotFound {
+		problem.Respond(c, http.StatusNotFound, problem.NotFound, "Split member not found")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to remove split member", "member_id", memberID, "error", err)
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Failed to remove split member")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "Split member removed successfully",
+	})
+}
+
+// GetLedger returns every charge and settlement recorded for a shared subscription
+func (h *SplitHandler) GetLedger(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		problem.Respond(c, http.StatusUnauthorized, problem.Unauthenticated, "User not authenticated")
+		return
+	}
+
+	subscriptionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, problem.InvalidID, "Invalid subscription ID")
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	sub, ok := h.ownSubscription(c, userID.(uuid.UUID), subscriptionID)
+	if !ok {
+		return
+	}
+
+	if err := h.accrueCharges(ctx, sub); err != nil {
+		slog.ErrorContext(ctx, "Failed to accrue split charges", "subscription_id", subscriptionID, "error", err)
+	}
+
+	entries, err := h.store.Splits().Ledger(ctx, subscriptionID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Database error")
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+// Settle records a member paying back the owner, either in cash or through an M-Pesa STK Push
+func (h *SplitHandler) Settle(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		problem.Respond(c, http.StatusUnauthorized, problem.Unauthenticated, "User not authenticated")
+		return
+	}
+
+	subscriptionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, problem.InvalidID, "Invalid subscription ID")
+		return
+	}
+
+	memberID, err := uuid.Parse(c.Param("memberId"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, problem.InvalidID, "Invalid member ID")
+		return
+	}
+
+	var req models.SettleSplitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Invalid(c, err)
+		return
+	}
+
+	if req.Amount <= 0 {
+		problem.Fields(c, models.FieldError{Field: "amount", Code: "gt", Message: "amount must be greater than 0"})
+		return
+	}
+	if req.Method != "cash" && req.Method != "mpesa" {
+		problem.Fields(c, models.FieldError{Field: "method", Code: "oneof", Message: "method must be one of: cash, mpesa"})
+		return
+	}
+	// M-Pesa only takes whole shillings, and the ledger must record what was actually pushed
+	if req.Method == "mpesa" && req.Amount != math.Trunc(req.Amount) {
+		problem.Fields(c, models.FieldError{Field: "amount", Code: "integer", Message: "amount must be a whole number for M-Pesa"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	sub, ok := h.settlingSubscription(c, userID.(uuid.UUID), c.GetString("email"), subscriptionID, memberID)
+	if !ok {
+		return
+	}
+
+	if err := h.accrueCharges(ctx, sub); err != nil {
+		slog.ErrorContext(ctx, "Failed to accrue split charges", "subscription_id", subscriptionID, "error", err)
+	}
+
+	entry := models.SplitLedgerEntry{
+		SubscriptionID: subscriptionID,
+		MemberID:       memberID,
+		Amount:         roundMoney(req.Amount),
+		Method:         &req.Method,
+		Status:         "completed",
+	}
+	// The member row stays locked until the settlement is recorded, so two settlements can't both pass the
+	// balance check. Pending M-Pesa settlements count against the balance until their callback arrives.
+	var available float64
+	var phoneNumber *string
+	err = h.store.WithTx(ctx, func(tx store.Store) error {
+		member, err := tx.Splits().GetMemberForUpdate(ctx, subscriptionID, memberID)
+		if err != nil {
+			return err
+		}
+		balances, err := tx.Splits().Balances(ctx, store.BalanceFilter{SubscriptionID: &subscriptionID, MemberID: &memberID})
+		if err != nil {
+			return err
+		}
+		if len(balances) == 0 {
+			return store.ErrNotFound
+		}
+		available = roundMoney(balances[0].Balance - balances[0].TotalPending)
+		if entry.Amount > available {
+			return errSettlementExceeded
+		}
+
+		if req.Method == "mpesa" {
+			phoneNumber = req.PhoneNumber
+			if phoneNumber == nil || *phoneNumber == "" {
+				phoneNumber = member.PhoneNumber
+			}
+			if phoneNumber == nil || *phoneNumber == "" {
+				return errPhoneRequired
+			}
+
+			// Settlement only counts once M-Pesa confirms it through the callback
+			entry.Status = "pending"
+		}
+
+		return tx.Splits().RecordSettlement(ctx, &entry)
+	})
+	switch err {
+	case nil:
+	case store.ErrNotFound:
+		problem.Respond(c, http.StatusNotFound, problem.NotFound, "Split member not found")
+		return
+	case errSettlementExceeded:
+		problem.Fields(c, models.FieldError{
+			Field:   "amount",
+			Code:    "max",
+			Message: fmt.Sprintf("Amount exceeds the outstanding balance of %.2f, after pending M-Pesa payments", available),
+		})
+		return
+	case errPhoneRequired:
+		problem.Fields(c, models.FieldError{Field: "phone_number", Code: "required", Message: "phone_number is required for M-Pesa"})
+		return
+	default:
+		slog.ErrorContext(ctx, "Failed to record settlement", "member_id", memberID, "error", err)
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Failed to record settlement")
+		return
+	}
+
+	if req.Method == "mpesa" && !h.pushSettlement(c, sub, &entry, *phoneNumber) {
+		return
+	}
+
+	c.JSON(http.StatusCreated, entry)
+}
+
+// pushSettlement sends the STK Push for a pending M-Pesa settlement. The push goes out after the settlement is
+// committed, so no lock is held while Daraja answers and a member is never charged without a ledger entry. The
+// settlement is failed when the push is not accepted; otherwise it waits on the push's CheckoutRequestID.
+func (h *SplitHandler) pushSettlement(c *gin.Context, sub *models.Subscription, entry *models.SplitLedgerEntry, phoneNumber string) bool {
+	ctx := c.Request.Context()
+
+	response, err := sendMpesaSTKPush(ctx, phoneNumber, entry.Amount, mpesaAccountReference(sub.Name), "Split settle-up: "+sub.Name)
+	if err != nil || response.ResponseCode != "0" {
+		// Failed even if the client has gone away, so the settlement stops counting against the balance
+		if err := h.store.Splits().FailSettlement(context.WithoutCancel(ctx), entry.ID); err != nil {
+			slog.ErrorContext(ctx, "Failed to mark split settlement failed", "settlement_id", entry.ID, "error", err)
+		}
+	}
+	switch {
+	case errors.Is(err, errMpesaNotConfigured):
+		problem.Respond(c, http.StatusServiceUnavailable, problem.ProviderNotConfigured, "M-Pesa API credentials not configured. Check environment variables")
+		return false
+	case err != nil:
+		slog.ErrorContext(ctx, "Failed to initiate split settle-up STK Push", "member_id", entry.MemberID, "error", err)
+		problem.Respond(c, http.StatusBadGateway, problem.ProviderError, "Failed to initiate payment")
+		return false
+	case response.ResponseCode != "0":
+		slog.WarnContext(ctx, "M-Pesa rejected split settle-up STK Push", "response_code", response.ResponseCode, "description", response.ResponseDescription)
+		problem.Respond(c, http.StatusBadRequest, problem.PaymentRejected, response.CustomerMessage)
+		return false
+	}
+
+	// The prompt is on the member's phone, so the settlement is reported even if the reference can't be saved;
+	// it stays pending and counts against the balance until it is reconciled by hand
+	if err := h.store.Splits().SetSettlementReference(context.WithoutCancel(ctx), entry.ID, response.CheckoutRequestID); err != nil {
+		slog.ErrorContext(ctx, "Failed to save split settlement reference", "settlement_id", entry.ID, "checkout_request_id", response.CheckoutRequestID, "error", err)
+		return true
+	}
+	entry.Reference = &response.CheckoutRequestID
+	return true
+}
+
+// GetBalances returns who owes the current user and whom the current user owes across all shared subscriptions.
+// A user owes on a split when they were added as a member using their account email.
+func (h *SplitHandler) GetBalances(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		problem.Respond(c, http.StatusUnauthorized, problem.Unauthenticated, "User not authenticated")
+		return
+	}
+	email := c.GetString("email")
+
+	ctx := c.Request.Context()
+	ownerID := userID.(uuid.UUID)
+
+	var result SplitBalances
+	load := func() error {
+		var err error
+		if result.OwedToMe, err = h.store.Splits().Balances(ctx, store.BalanceFilter{OwnerID: &ownerID}); err != nil {
+			return err
+		}
+		result.IOwe = nil
+		if email == "" {
+			return nil
+		}
+		result.IOwe, err = h.store.Splits().Balances(ctx, store.BalanceFilter{MemberEmail: email, NotOwnerID: &ownerID})
+		return err
+	}
+	if err := load(); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Failed to calculate balances")
+		return
+	}
+
+	// Bring every shared subscription's charges up to date, then read the balances again
+	accrued := map[uuid.UUID]bool{}
+	for _, b := range append(result.OwedToMe, result.IOwe...) {
+		if accrued[b.SubscriptionID] {
+			continue
+		}
+		accrued[b.SubscriptionID] = true
+		sub, err := h.store.Subscriptions().Get(ctx, b.OwnerID, b.SubscriptionID)
+		if err == nil {
+			err = h.accrueCharges(ctx, sub)
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to accrue split charges", "subscription_id", b.SubscriptionID, "error", err)
+		}
+	}
+	if err := load(); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Failed to calculate balances")
+		return
+	}
+
+	for _, b := range result.OwedToMe {
+		result.NetTotal += b.Balance
+	}
+	for _, b := range result.IOwe {
+		result.NetTotal -= b.Balance
+	}
+	result.NetTotal = roundMoney(result.NetTotal)
+
+	c.JSON(http.StatusOK, result)
+}
+
+// ownSubscription loads a live subscription the user owns, responding 404 when there isn't one
+func (h *SplitHandler) ownSubscription(c *gin.Context, userID, subscriptionID uuid.UUID) (*models.Subscription, bool) {
+	sub, err := h.store.Subscriptions().Get(c.Request.Context(), userID, subscriptionID)
+	if err == store.ErrNotFound {
+		problem.Respond(c, http.StatusNotFound, problem.NotFound, "Subscription not found")
+		return nil, false
+	}
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Database error")
+		return nil, false
+	}
+	return sub, true
+}
+
+// settlingSubscription loads a live subscription whose member's share the user can settle: one they own, or
+// one where they are that member, matched by account email as in GetBalances. It responds 404 otherwise.
+func (h *SplitHandler) settlingSubscription(c *gin.Context, userID uuid.UUID, email string, subscriptionID, memberID uuid.UUID) (*models.Subscription, bool) {
+	ownerID := userID
+	if email != "" {
+		balances, err := h.store.Splits().Balances(c.Request.Context(), store.BalanceFilter{
+			SubscriptionID: &subscriptionID, MemberID: &memberID, MemberEmail: email, NotOwnerID: &userID,
+		})
+		if err != nil {
+			problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Database error")
+			return nil, false
+		}
+		if len(balances) > 0 {
+			ownerID = balances[0].OwnerID
+		}
+	}
+	return h.ownSubscription(c, ownerID, subscriptionID)
+}
+
+// accrueCharges records each member's share for every billing date since they joined.
+// Charges are idempotent per member and billing date, so this is safe to run on every read.
+func (h *SplitHandler) accrueCharges(ctx context.Context, sub *models.Subscription) error {
+	if sub.Status != "active" {
+		return nil
+	}
+
+	members, err := h.store.Splits().Members(ctx, sub.ID)
+	if err != nil {
+		return err
+	}
+
+	// Each period is charged at the price in effect on its billing date
+	history, err := h.store.Subscriptions().PriceHistory(ctx, sub.UserID, sub.ID)
+	if err != nil {
+		return err
+	}
+
+	// Charges fall due on the owner's calendar date
+	today := storedLocale(ctx, h.store.Users(), sub.UserID).Today()
+	for _, m := range members {
+		joined := time.Date(m.CreatedAt.Year(), m.CreatedAt.Month(), m.CreatedAt.Day(), 0, 0, 0, 0, sub.BillingDate.Location())
+		for _, d := range billingDatesBetween(sub.BillingDate, sub.BillingCycle, joined, today) {
+			d := d
+			amount := roundMoney(priceOn(history, d, sub.Price) * m.SharePercent / 100)
+			if amount <= 0 {
+				continue
+			}
+			err := h.store.Splits().RecordCharge(ctx, &models.SplitLedgerEntry{
+				SubscriptionID: sub.ID, MemberID: m.ID, Amount: amount, PeriodDate: &d,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to record charge: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// priceOn returns the price in effect on date, given price history ordered most recent first.
+// Dates before the first recorded price use that price; without any history it is current.
+func priceOn(history []models.PriceChange, date time.Time, current float64) float64 {
+	day := date.Format(time.DateOnly)
+	for _, pc := range history {
+		if pc.EffectiveDate.Format(time.DateOnly) <= day {
+			return pc.Price
+		}
+	}
+	if len(history) > 0 {
+		return history[len(history)-1].Price
+	}
+	return current
+}
+
+// mpesaAccountReference trims a name to the 12 characters Daraja accepts for AccountReference
+func mpesaAccountReference(name string) string {
+	if runes := []rune(name); len(runes) > 12 {
+		return string(runes[:12])
+	}
+	return name
+}
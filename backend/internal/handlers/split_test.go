@@ -0,0 +1,331 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"subscription-tracker/internal/models"
+)
+
+// newSharedSubscription creates a monthly subscription billed today, split with a member by email
+func newSharedSubscription(t *testing.T, srv *testServer, memberEmail string, share float64) (models.Subscription, models.SplitMember) {
+	t.Helper()
+
+	sub := srv.createSubscription(models.CreateSubscriptionRequest{
+		Name:        "Netflix",
+		Price:       20,
+		BillingDate: time.Now().UTC().Truncate(24 * time.Hour),
+	})
+	var member models.SplitMember
+	req := models.CreateSplitMemberRequest{Name: "Sam", Email: &memberEmail, SharePercent: share}
+	if code := srv.do(nil, http.MethodPost, "/api/subscriptions/"+sub.ID.String()+"/split/members", req, &member); code != http.StatusCreated {
+		t.Fatalf("add member: status %d", code)
+	}
+	return sub, member
+}
+
+func TestSplitSharesCannotExceedTheWhole(t *testing.T) {
+	srv := newTestServer(t)
+	sub, _ := newSharedSubscription(t, srv, "sam@example.com", 60)
+
+	req := models.CreateSplitMemberRequest{Name: "Alex", SharePercent: 50}
+	if code := srv.do(nil, http.MethodPost, "/api/subscriptions/"+sub.ID.String()+"/split/members", req, nil); code != http.StatusBadRequest {
+		t.Fatalf("share past 100%%: status %d, want 400", code)
+	}
+
+	var split SplitSummary
+	srv.do(nil, http.MethodGet, "/api/subscriptions/"+sub.ID.String()+"/split", nil, &split)
+	if len(split.Members) != 1 || split.OwnerShare != 40 {
+		t.Errorf("split = %+v, want one member and the owner paying 40%%", split)
+	}
+}
+
+func TestSplitChargesAndSettlement(t *testing.T) {
+	srv := newTestServer(t)
+	sub, member := newSharedSubscription(t, srv, "sam@example.com", 50)
+	memberPath := "/api/subscriptions/" + sub.ID.String() + "/split/members/" + member.ID.String()
+
+	// Today's billing date is charged on the first read
+	var split SplitSummary
+	srv.do(nil, http.MethodGet, "/api/subscriptions/"+sub.ID.String()+"/split", nil, &split)
+	if len(split.Balances) != 1 || split.Balances[0].Balance != 10 {
+		t.Fatalf("balances = %+v, want 10 owed", split.Balances)
+	}
+
+	if code := srv.do(nil, http.MethodPost, memberPath+"/settle", models.SettleSplitRequest{Amount: 11, Method: "cash"}, nil); code != http.StatusBadRequest {
+		t.Errorf("settle more than owed: status %d, want 400", code)
+	}
+	var entry models.SplitLedgerEntry
+	if code := srv.do(nil, http.MethodPost, memberPath+"/settle", models.SettleSplitRequest{Amount: 4, Method: "cash"}, &entry); code != http.StatusCreated {
+		t.Fatalf("settle: status %d", code)
+	}
+	if entry.Type != "settlement" || entry.Status != "completed" {
+		t.Errorf("settlement = %+v, want a completed settlement", entry)
+	}
+
+	var ledger []models.SplitLedgerEntry
+	srv.do(nil, http.MethodGet, "/api/subscriptions/"+sub.ID.String()+"/split/ledger", nil, &ledger)
+	if len(ledger) != 2 || ledger[0].Type != "settlement" || ledger[1].Type != "charge" {
+		t.Errorf("ledger = %+v, want the settlement then the charge", ledger)
+	}
+
+	var balances SplitBalances
+	srv.do(nil, http.MethodGet, "/api/splits/balances", nil, &balances)
+	if len(balances.OwedToMe) != 1 || balances.NetTotal != 6 {
+		t.Errorf("owner balances = %+v, want 6 owed to them", balances)
+	}
+}
+
+func TestSplitBalancesOfMember(t *testing.T) {
+	srv := newTestServer(t)
+	memberUser := srv.addUser("sam@example.com")
+	newSharedSubscription(t, srv, "SAM@example.com", 25)
+
+	var balances SplitBalances
+	if code := srv.do(&memberUser, http.MethodGet, "/api/splits/balances", nil, &balances); code != http.StatusOK {
+		t.Fatalf("balances: status %d", code)
+	}
+	if len(balances.IOwe) != 1 || len(balances.OwedToMe) != 0 || balances.NetTotal != -5 {
+		t.Errorf("member balances = %+v, want 5 owed by them", balances)
+	}
+}
+
+func TestRemoveSplitMember(t *testing.T) {
+	srv := newTestServer(t)
+	sub, member := newSharedSubscription(t, srv, "sam@example.com", 50)
+	path := "/api/subscriptions/" + sub.ID.String() + "/split/members/" + member.ID.String()
+
+	other := srv.addUser("other@example.com")
+	if code := srv.do(&other, http.MethodDelete, path, nil, nil); code != http.StatusNotFound {
+		t.Errorf("remove from another user's split: status %d, want 404", code)
+	}
+	if code := srv.do(nil, http.MethodDelete, path, nil, nil); code != http.StatusOK {
+		t.Fatalf("remove: status %d", code)
+	}
+	if code := srv.do(nil, http.MethodDelete, path, nil, nil); code != http.StatusNotFound {
+		t.Errorf("remove twice: status %d, want 404", code)
+	}
+}
+
+func TestMemberSettlesOwnShare(t *testing.T) {
+	srv := newTestServer(t)
+	memberUser := srv.addUser("sam@example.com")
+	stranger := srv.addUser("alex@example.com")
+	sub, member := newSharedSubscription(t, srv, "SAM@example.com", 50)
+	path := "/api/subscriptions/" + sub.ID.String() + "/split/members/" + member.ID.String() + "/settle"
+
+	if code := srv.do(&stranger, http.MethodPost, path, models.SettleSplitRequest{Amount: 4, Method: "cash"}, nil); code != http.StatusNotFound {
+		t.Errorf("settle someone else's share: status %d, want 404", code)
+	}
+	if code := srv.do(&memberUser, http.MethodPost, path, models.SettleSplitRequest{Amount: 4, Method: "cash"}, nil); code != http.StatusCreated {
+		t.Fatalf("member settles: status %d", code)
+	}
+
+	var balances SplitBalances
+	srv.do(&memberUser, http.MethodGet, "/api/splits/balances", nil, &balances)
+	if len(balances.IOwe) != 1 || balances.IOwe[0].Balance != 6 {
+		t.Errorf("member balances = %+v, want 6 still owed", balances)
+	}
+}
+
+func TestSettlementCountsPendingPayments(t *testing.T) {
+	srv := newTestServer(t)
+	sub, member := newSharedSubscription(t, srv, "sam@example.com", 50)
+	path := "/api/subscriptions/" + sub.ID.String() + "/split/members/" + member.ID.String() + "/settle"
+
+	// Charges today's 10, then an M-Pesa payment of 7 waits for its callback
+	srv.do(nil, http.MethodGet, "/api/subscriptions/"+sub.ID.String()+"/split", nil, nil)
+	mpesa, reference := "mpesa", "ws_CO_1"
+	pending := models.SplitLedgerEntry{SubscriptionID: sub.ID, MemberID: member.ID, Amount: 7, Method: &mpesa, Status: "pending", Reference: &reference}
+	if err := srv.store.Splits().RecordSettlement(context.Background(), &pending); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := srv.do(nil, http.MethodPost, path, models.SettleSplitRequest{Amount: 4, Method: "cash"}, nil); code != http.StatusBadRequest {
+		t.Errorf("settle past the pending payment: status %d, want 400", code)
+	}
+	if code := srv.do(nil, http.MethodPost, path, models.SettleSplitRequest{Amount: 3, Method: "cash"}, nil); code != http.StatusCreated {
+		t.Errorf("settle the rest: status %d, want 201", code)
+	}
+}
+
+// fakeDaraja stands in for the M-Pesa API. STK Pushes are accepted unless reject is set, and STK Push
+// queries answer with the result code in results for their CheckoutRequestID.
+type fakeDaraja struct {
+	results map[string]string
+	reject  bool
+	pushes  []map[string]interface{}
+}
+
+// newFakeDaraja points the M-Pesa client at a fakeDaraja for the rest of the test
+func newFakeDaraja(t *testing.T, results map[string]string) *fakeDaraja {
+	t.Helper()
+
+	daraja := &fakeDaraja{results: results}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth/v1/generate":
+			json.NewEncoder(w).Encode(map[string]string{"access_token": "token", "expires_in": "3599"})
+		case "/mpesa/stkpush/v1/processrequest":
+			var push map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&push)
+			daraja.pushes = append(daraja.pushes, push)
+			if daraja.reject {
+				json.NewEncoder(w).Encode(map[string]string{"ResponseCode": "1", "CustomerMessage": "Rejected"})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{
+				"ResponseCode":      "0",
+				"CheckoutRequestID": fmt.Sprintf("ws_CO_push%d", len(daraja.pushes)),
+			})
+		case "/mpesa/stkpushquery/v1/query":
+			var query struct{ CheckoutRequestID string }
+			json.NewDecoder(r.Body).Decode(&query)
+			result, ok := daraja.results[query.CheckoutRequestID]
+			if !ok {
+				http.Error(w, `{"errorMessage":"The transaction is being processed"}`, http.StatusInternalServerError)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{
+				"ResponseCode":      "0",
+				"CheckoutRequestID": query.CheckoutRequestID,
+				"ResultCode":        result,
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	baseURL := darajaBaseURL
+	darajaBaseURL = server.URL
+	t.Cleanup(func() { darajaBaseURL = baseURL })
+	t.Setenv("MPESA_CONSUMER_KEY", "key")
+	t.Setenv("MPESA_CONSUMER_SECRET", "secret")
+	t.Setenv("MPESA_SHORTCODE", "174379")
+	t.Setenv("MPESA_PASSKEY", "passkey")
+	return daraja
+}
+
+func TestMpesaSettlement(t *testing.T) {
+	srv := newTestServer(t)
+	sub, member := newSharedSubscription(t, srv, "sam@example.com", 50)
+	path := "/api/subscriptions/" + sub.ID.String() + "/split/members/" + member.ID.String() + "/settle"
+	daraja := newFakeDaraja(t, nil)
+	phone := "254700000000"
+
+	var invalid models.Problem
+	if code := srv.do(nil, http.MethodPost, path, models.SettleSplitRequest{Amount: 3.5, Method: "mpesa", PhoneNumber: &phone}, &invalid); code != http.StatusBadRequest {
+		t.Errorf("settle part of a shilling: status %d, want 400", code)
+	}
+	if len(invalid.Errors) != 1 || invalid.Errors[0].Field != "amount" || len(daraja.pushes) != 0 {
+		t.Errorf("problem = %+v after %d pushes, want an amount error and no push", invalid, len(daraja.pushes))
+	}
+
+	var entry models.SplitLedgerEntry
+	if code := srv.do(nil, http.MethodPost, path, models.SettleSplitRequest{Amount: 4, Method: "mpesa", PhoneNumber: &phone}, &entry); code != http.StatusCreated {
+		t.Fatalf("settle: status %d", code)
+	}
+	if entry.Status != "pending" || entry.Reference == nil || *entry.Reference != "ws_CO_push1" {
+		t.Errorf("settlement = %+v, want it pending on the STK Push", entry)
+	}
+	if amount := daraja.pushes[0]["Amount"]; amount != float64(4) {
+		t.Errorf("pushed amount = %v, want 4", amount)
+	}
+
+	// A rejected push leaves a failed settlement that no longer holds back the balance
+	daraja.reject = true
+	if code := srv.do(nil, http.MethodPost, path, models.SettleSplitRequest{Amount: 6, Method: "mpesa", PhoneNumber: &phone}, nil); code != http.StatusBadRequest {
+		t.Errorf("rejected push: status %d, want 400", code)
+	}
+	var ledger []models.SplitLedgerEntry
+	srv.do(nil, http.MethodGet, "/api/subscriptions/"+sub.ID.String()+"/split/ledger", nil, &ledger)
+	if len(ledger) != 3 || ledger[0].Status != "failed" || ledger[0].Reference != nil {
+		t.Errorf("ledger = %+v, want the rejected settlement failed", ledger)
+	}
+	if code := srv.do(nil, http.MethodPost, path, models.SettleSplitRequest{Amount: 6, Method: "cash"}, nil); code != http.StatusCreated {
+		t.Errorf("settle the rest in cash: status %d, want 201", code)
+	}
+}
+
+func TestMpesaCallbackIsConfirmedWithDaraja(t *testing.T) {
+	srv := newTestServer(t)
+	sub, member := newSharedSubscription(t, srv, "sam@example.com", 50)
+	newFakeDaraja(t, map[string]string{"ws_CO_1": "1032", "ws_CO_2": "0"})
+
+	srv.do(nil, http.MethodGet, "/api/subscriptions/"+sub.ID.String()+"/split", nil, nil)
+	mpesa := "mpesa"
+	for _, reference := range []string{"ws_CO_1", "ws_CO_2", "ws_CO_3"} {
+		reference := reference
+		pending := models.SplitLedgerEntry{SubscriptionID: sub.ID, MemberID: member.ID, Amount: 2, Method: &mpesa, Status: "pending", Reference: &reference}
+		if err := srv.store.Splits().RecordSettlement(context.Background(), &pending); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Every callback claims success, but only Daraja's answer counts
+	for _, reference := range []string{"ws_CO_1", "ws_CO_2", "ws_CO_3"} {
+		callback := map[string]interface{}{"Body": map[string]interface{}{"stkCallback": map[string]interface{}{
+			"CheckoutRequestID": reference,
+			"ResultCode":        0,
+		}}}
+		if code := srv.do(nil, http.MethodPost, "/api/payment/mpesa/callback", callback, nil); code != http.StatusOK {
+			t.Fatalf("callback: status %d", code)
+		}
+	}
+
+	var ledger []models.SplitLedgerEntry
+	srv.do(nil, http.MethodGet, "/api/subscriptions/"+sub.ID.String()+"/split/ledger", nil, &ledger)
+	want := map[string]string{"ws_CO_1": "failed", "ws_CO_2": "completed", "ws_CO_3": "pending"}
+	for _, entry := range ledger {
+		if entry.Reference != nil && entry.Status != want[*entry.Reference] {
+			t.Errorf("settlement %s is %s, want %s", *entry.Reference, entry.Status, want[*entry.Reference])
+		}
+	}
+}
+
+func TestPriceOn(t *testing.T) {
+	day := func(month time.Month, d int) time.Time { return time.Date(2024, month, d, 0, 0, 0, 0, time.UTC) }
+	history := []models.PriceChange{
+		{Price: 15, EffectiveDate: day(time.March, 1)},
+		{Price: 10, EffectiveDate: day(time.January, 5)},
+	}
+
+	tests := []struct {
+		date time.Time
+		want float64
+	}{
+		{day(time.January, 1), 10},
+		{day(time.January, 5), 10},
+		{day(time.February, 28), 10},
+		{day(time.March, 1), 15},
+		{day(time.June, 1), 15},
+	}
+	for _, tt := range tests {
+		if got := priceOn(history, tt.date, 20); got != tt.want {
+			t.Errorf("priceOn(%s) = %v, want %v", tt.date.Format(time.DateOnly), got, tt.want)
+		}
+	}
+	if got := priceOn(nil, day(time.June, 1), 20); got != 20 {
+		t.Errorf("priceOn without history = %v, want the current price", got)
+	}
+}
+
+func TestMpesaAccountReference(t *testing.T) {
+	tests := []struct{ name, want string }{
+		{"Netflix", "Netflix"},
+		{"YouTube Premium", "YouTube Prem"},
+		{"Ça Marche Plus Premium", "Ça Marche Pl"},
+		{"日本のストリーミングサービス", "日本のストリーミングサー"},
+	}
+	for _, tt := range tests {
+		if got := mpesaAccountReference(tt.name); got != tt.want {
+			t.Errorf("mpesaAccountReference(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -1,75 +1,79 @@
 package handlers
 
 import (
-	"database/sql"
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"time"
 
-	"subscription-tracker/internal/database"
 	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/problem"
+	"subscription-tracker/internal/store"
+	"subscription-tracker/internal/validate"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
 type SubscriptionHandler struct {
-	db *database.DB
+	store            store.Store
+	undoWindow       time.Duration
+	archiveRetention time.Duration
+	calendar         subscriptionSyncer // nil disables calendar sync
 }
 
-func NewSubscriptionHandler(db *database.DB) *SubscriptionHandler {
-	return &SubscriptionHandler{db: db}
+func NewSubscriptionHandler(st store.Store, undoWindow time.Duration, archiveRetentionDays int, calendar subscriptionSyncer) *SubscriptionHandler {
+	return &SubscriptionHandler{
+		store:            st,
+		undoWindow:       undoWindow,
+		archiveRetention: time.Duration(archiveRetentionDays) * 24 * time.Hour,
+		calendar:         calendar,
+	}
+}
+
+// syncCalendar mirrors a subscription change to the user's calendar in the background
+func (h *SubscriptionHandler) syncCalendar(ctx context.Context, userID, subscriptionID uuid.UUID) {
+	if h.calendar != nil {
+		h.calendar.SyncSubscription(ctx, userID, subscriptionID)
+	}
 }
 
 func (h *SubscriptionHandler) GetSubscriptions(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not authenticated"})
+		problem.Respond(c, http.StatusUnauthorized, problem.Unauthenticated, "User not authenticated")
 		return
 	}
 
-	rows, err := h.db.Query(`
-		SELECT s.id, s.user_id, s.name, s.price, s.billing_cycle, s.billing_date, s.category_id, s.status, 
-		       s.description, s.website_url, s.created_at, s.updated_at, s.payment_method,
-		       c.id, c.name
-		FROM subscriptions s
-		LEFT JOIN categories c ON s.category_id = c.id
-		WHERE s.user_id = $1
-		ORDER BY s.created_at DESC
-	`, userID.(uuid.UUID))
+	ctx := c.Request.Context()
 
+	query, err := parseSubscriptionListParams(c, storedLocale(ctx, h.store.Users(), userID.(uuid.UUID)).Today())
 	if err != nil {
-		println("Query error:", err.Error())
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Database error: " + err.Error()})
+		problem.Respond(c, http.StatusBadRequest, problem.InvalidRequest, err.Error())
 		return
 	}
-	defer rows.Close()
 
-	var subscriptions []models.Subscription
-	for rows.Next() {
-		var sub models.Subscription
-		var categoryID, categoryName sql.NullString
-
-		err := rows.Scan(
-			&sub.ID, &sub.UserID, &sub.Name, &sub.Price, &sub.BillingCycle, &sub.BillingDate,
-			&sub.CategoryID, &sub.Status, &sub.Description, &sub.WebsiteURL,
-			&sub.CreatedAt, &sub.UpdatedAt, &sub.PaymentMethod, &categoryID, &categoryName,
-		)
-		if err != nil {
-			println("Scan error:", err.Error())
-			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to scan subscription: " + err.Error()})
-			return
-		}
+	limit := query.Limit
+	if limit > 0 {
+		// Fetch one extra row to know whether there is a next page
+		query.Limit++
+	}
 
-		if categoryID.Valid {
-			catUUID, _ := uuid.Parse(categoryID.String)
-			sub.Category = &models.Category{
-				ID:   catUUID,
-				Name: categoryName.String,
-			}
-		}
+	subscriptions, total, err := h.store.Subscriptions().List(ctx, userID.(uuid.UUID), query)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to list subscriptions", "error", err)
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Database error")
+		return
+	}
 
-		subscriptions = append(subscriptions, sub)
+	// Pagination is reported in headers so the body stays a plain array
+	c.Header("X-Total-Count", strconv.Itoa(total))
+	if limit > 0 && len(subscriptions) > limit {
+		subscriptions = subscriptions[:limit]
+		c.Header("X-Next-Cursor", nextCursor(query, subscriptions[len(subscriptions)-1]))
 	}
 
 	c.JSON(http.StatusOK, subscriptions)
@@ -78,273 +82,348 @@ func (h *SubscriptionHandler) GetSubscriptions(c *gin.Context) {
 func (h *SubscriptionHandler) CreateSubscription(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not authenticated"})
+		problem.Respond(c, http.StatusUnauthorized, problem.Unauthenticated, "User not authenticated")
 		return
 	}
 
+	ctx := c.Request.Context()
+
 	var req models.CreateSubscriptionRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		problem.Invalid(c, err)
 		return
 	}
 
+	today := storedLocale(ctx, h.store.Users(), userID.(uuid.UUID)).Today()
+	defaultTrialStart(&req, today)
+
 	// Look up category ID by name if category name is provided
 	var finalCategoryID *uuid.UUID
 	if req.CategoryID != nil {
 		finalCategoryID = req.CategoryID
 	} else if req.Category != nil && *req.Category != "" {
-		var catID uuid.UUID
-		err := h.db.QueryRow("SELECT id FROM categories WHERE LOWER(name) = LOWER($1)", *req.Category).Scan(&catID)
-		if err == nil {
-			finalCategoryID = &catID
+		if category, err := h.store.Subscriptions().FindCategory(ctx, *req.Category); err == nil {
+			finalCategoryID = &category.ID
 		} else {
-			fmt.Printf("Warning: Category '%s' not found, using NULL\n", *req.Category)
+			slog.WarnContext(ctx, "Category not found, using NULL", "category", *req.Category)
 		}
 	}
 
-	subscriptionID := uuid.New()
+	actorID := userID.(uuid.UUID)
 	now := time.Now()
+	sub := newSubscription(req)
+	sub.ID = uuid.New()
+	sub.UserID = actorID
+	sub.CategoryID = finalCategoryID
+	sub.CreatedAt = now
+	sub.UpdatedAt = now
+	if errs := validate.Subscription(sub, today); len(errs) > 0 {
+		problem.Fields(c, errs...)
+		return
+	}
 
-	_, err := h.db.Exec(`
-		INSERT INTO subscriptions (id, user_id, name, price, billing_cycle, billing_date, category_id, status, payment_method, description, website_url, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
-	`, subscriptionID, userID.(uuid.UUID), req.Name, req.Price, req.BillingCycle, req.BillingDate, finalCategoryID, req.Status, req.PaymentMethod, req.Description, req.WebsiteURL, now, now)
-
+	// The subscription is created together with its initial price and history
+	err := h.store.WithTx(ctx, func(tx store.Store) error {
+		if err := tx.Subscriptions().Create(ctx, sub); err != nil {
+			return err
+		}
+		if err := tx.Subscriptions().RecordPrice(ctx, models.PriceChange{
+			SubscriptionID: sub.ID, Price: req.Price, EffectiveDate: now, Source: "initial",
+		}); err != nil {
+			return err
+		}
+		return auditSubscription(ctx, tx.Subscriptions(), actorID, &actorID, "create", nil, sub)
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to create subscription"})
+		slog.ErrorContext(ctx, "Failed to create subscription", "error", err)
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Failed to create subscription")
 		return
 	}
+	h.syncCalendar(ctx, actorID, sub.ID)
 
 	// Get created subscription with category
-	var sub models.Subscription
-	var categoryID, categoryName sql.NullString
-
-	err = h.db.QueryRow(`
-		SELECT s.id, s.user_id, s.name, s.price, s.billing_cycle, s.billing_date, s.category_id, s.status, 
-		       s.description, s.website_url, s.created_at, s.updated_at, s.payment_method,
-		       c.id, c.name
-		FROM subscriptions s
-		LEFT JOIN categories c ON s.category_id = c.id
-		WHERE s.id = $1
-	`, subscriptionID).Scan(
-		&sub.ID, &sub.UserID, &sub.Name, &sub.Price, &sub.BillingCycle, &sub.BillingDate,
-		&sub.CategoryID, &sub.Status, &sub.Description, &sub.WebsiteURL, &sub.CreatedAt, &sub.UpdatedAt, &sub.PaymentMethod,
-		&categoryID, &categoryName,
-	)
-
+	created, err := h.store.Subscriptions().Get(ctx, actorID, sub.ID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to retrieve created subscription"})
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Failed to retrieve created subscription")
 		return
 	}
 
-	if categoryID.Valid {
-		catUUID, _ := uuid.Parse(categoryID.String)
-		sub.Category = &models.Category{
-			ID:   catUUID,
-			Name: categoryName.String,
-		}
+	c.JSON(http.StatusCreated, created)
+}
+
+// defaultTrialStart starts a new trial on the user's today unless the request says otherwise
+func defaultTrialStart(req *models.CreateSubscriptionRequest, today time.Time) {
+	if req.Status == "trial" && req.TrialStartDate == nil {
+		req.TrialStartDate = &today
 	}
+}
 
-	c.JSON(http.StatusCreated, sub)
+// newSubscription converts a create request to the subscription it describes, without IDs or timestamps
+func newSubscription(req models.CreateSubscriptionRequest) *models.Subscription {
+	return &models.Subscription{
+		Name:           req.Name,
+		Price:          req.Price,
+		BillingCycle:   req.BillingCycle,
+		BillingDate:    req.BillingDate,
+		CategoryID:     req.CategoryID,
+		Status:         req.Status,
+		PaymentMethod:  req.PaymentMethod,
+		Description:    req.Description,
+		WebsiteURL:     req.WebsiteURL,
+		TrialStartDate: req.TrialStartDate,
+		TrialEndDate:   req.TrialEndDate,
+		PostTrialPrice: req.PostTrialPrice,
+	}
 }
 
 func (h *SubscriptionHandler) GetSubscription(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not authenticated"})
+		problem.Respond(c, http.StatusUnauthorized, problem.Unauthenticated, "User not authenticated")
 		return
 	}
 
 	subscriptionID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid subscription ID"})
+		problem.Respond(c, http.StatusBadRequest, problem.InvalidID, "Invalid subscription ID")
 		return
 	}
 
-	var sub models.Subscription
-	var categoryID, categoryName sql.NullString
-
-	err = h.db.QueryRow(`
-		SELECT s.id, s.user_id, s.name, s.price, s.billing_cycle, s.billing_date, s.category_id, s.status,
-		       s.description, s.website_url, s.created_at, s.updated_at, s.payment_method,
-		       c.id, c.name
-		FROM subscriptions s
-		LEFT JOIN categories c ON s.category_id = c.id
-		WHERE s.id = $1 AND s.user_id = $2
-	`, subscriptionID, userID.(uuid.UUID)).Scan(
-		&sub.ID, &sub.UserID, &sub.Name, &sub.Price, &sub.BillingCycle, &sub.BillingDate,
-		&sub.CategoryID, &sub.Status, &sub.Description, &sub.WebsiteURL, &sub.CreatedAt, &sub.UpdatedAt, &sub.PaymentMethod,
-		&categoryID, &categoryName,
-	)
-
+	sub, err := h.store.Subscriptions().Get(c.Request.Context(), userID.(uuid.UUID), subscriptionID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Subscription not found"})
+		if err == store.ErrNotFound {
+			problem.Respond(c, http.StatusNotFound, problem.NotFound, "Subscription not found")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Database error"})
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Database error")
 		return
 	}
 
-	if categoryID.Valid {
-		catUUID, _ := uuid.Parse(categoryID.String)
-		sub.Category = &models.Category{
-			ID:   catUUID,
-			Name: categoryName.String,
-		}
-	}
-
 	c.JSON(http.StatusOK, sub)
 }
 
 func (h *SubscriptionHandler) UpdateSubscription(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not authenticated"})
+		problem.Respond(c, http.StatusUnauthorized, problem.Unauthenticated, "User not authenticated")
 		return
 	}
 
+	ctx := c.Request.Context()
+
 	subscriptionID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid subscription ID"})
+		problem.Respond(c, http.StatusBadRequest, problem.InvalidID, "Invalid subscription ID")
 		return
 	}
 
 	var req models.UpdateSubscriptionRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		problem.Invalid(c, err)
 		return
 	}
 
-	// Build dynamic update query
-	updates := []string{}
-	args := []interface{}{}
-	argCount := 1
+	// Convert category name to ID; unknown names are ignored
+	categoryID := req.CategoryID
+	if categoryID == nil && req.Category != nil {
+		if category, err := h.store.Subscriptions().FindCategory(ctx, *req.Category); err == nil {
+			categoryID = &category.ID
+		}
+	}
 
-	if req.Name != nil {
-		updates = append(updates, fmt.Sprintf("name = $%d", argCount))
-		args = append(args, *req.Name)
-		argCount++
+	if !hasSubscriptionChanges(req, categoryID) {
+		problem.Respond(c, http.StatusBadRequest, problem.InvalidRequest, "No fields to update")
+		return
 	}
 
-	if req.Price != nil {
-		updates = append(updates, fmt.Sprintf("price = $%d", argCount))
-		args = append(args, *req.Price)
-		argCount++
+	actorID := userID.(uuid.UUID)
+	today := storedLocale(ctx, h.store.Users(), actorID).Today()
+	var before, after *models.Subscription
+	effectiveDate := time.Now()
+	if req.PriceEffectiveDate != nil {
+		if errs := validate.PriceEffectiveDate(*req.PriceEffectiveDate, today); len(errs) > 0 {
+			problem.Fields(c, errs...)
+			return
+		}
+		effectiveDate = *req.PriceEffectiveDate
 	}
 
-	if req.BillingCycle != nil {
-		updates = append(updates, fmt.Sprintf("billing_cycle = $%d", argCount))
-		args = append(args, *req.BillingCycle)
-		argCount++
+	err = h.store.WithTx(ctx, func(tx store.Store) error {
+		// Lock the row so price history and the audit log record what actually changed
+		var err error
+		if before, err = tx.Subscriptions().GetForUpdate(ctx, actorID, subscriptionID); err != nil {
+			return err
+		}
+
+		updated := *before
+		applySubscriptionUpdate(&updated, req, categoryID)
+		if errs := updateErrors(validate.Subscription(&updated, today), req); len(errs) > 0 {
+			return errs
+		}
+		updated.UpdatedAt = time.Now()
+		if err := tx.Subscriptions().Update(ctx, &updated); err != nil {
+			return err
+		}
+		after = &updated
+
+		if err := auditSubscription(ctx, tx.Subscriptions(), before.UserID, &actorID, "update", before, after); err != nil {
+			return fmt.Errorf("failed to record history: %w", err)
+		}
+		if req.Price != nil && roundMoney(*req.Price) != roundMoney(before.Price) {
+			oldPrice := before.Price
+			if err := tx.Subscriptions().RecordPrice(ctx, models.PriceChange{
+				SubscriptionID: subscriptionID, Price: *req.Price, PreviousPrice: &oldPrice, EffectiveDate: effectiveDate, Source: "manual",
+			}); err != nil {
+				return fmt.Errorf("failed to record price change: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if err == store.ErrNotFound {
+			problem.Respond(c, http.StatusNotFound, problem.NotFound, "Subscription not found")
+			return
+		}
+		var invalid validate.Errors
+		if errors.As(err, &invalid) {
+			problem.Fields(c, invalid...)
+			return
+		}
+		slog.ErrorContext(ctx, "Failed to update subscription", "subscription_id", subscriptionID, "error", err)
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Failed to update subscription")
+		return
 	}
 
-	if req.BillingDate != nil {
-		updates = append(updates, fmt.Sprintf("billing_date = $%d", argCount))
-		args = append(args, *req.BillingDate)
-		argCount++
+	if roundMoney(after.Price) != roundMoney(before.Price) {
+		notifyPriceChange(ctx, h.store, actorID, after.Name, before.Price, after.Price, effectiveDate)
 	}
+	h.syncCalendar(ctx, actorID, subscriptionID)
 
-	if req.CategoryID != nil {
-		updates = append(updates, fmt.Sprintf("category_id = $%d", argCount))
-		args = append(args, *req.CategoryID)
-		argCount++
-	} else if req.Category != nil {
-		// Convert category name to ID
-		var categoryID uuid.UUID
-		err := h.db.QueryRow("SELECT id FROM categories WHERE LOWER(name) = LOWER($1)", *req.Category).Scan(&categoryID)
-		if err == nil {
-			updates = append(updates, fmt.Sprintf("category_id = $%d", argCount))
-			args = append(args, categoryID)
-			argCount++
+	// Return updated subscription
+	h.GetSubscription(c)
+}
+
+// hasSubscriptionChanges reports whether an update request sets any field. categoryID is the resolved category.
+func hasSubscriptionChanges(req models.UpdateSubscriptionRequest, categoryID *uuid.UUID) bool {
+	return req.Name != nil || req.Price != nil || req.BillingCycle != nil || req.BillingDate != nil ||
+		categoryID != nil || req.Status != nil || req.PaymentMethod != nil || req.Description != nil ||
+		req.WebsiteURL != nil || req.TrialStartDate != nil || req.TrialEndDate != nil || req.PostTrialPrice != nil
+}
+
+// updateErrors keeps the errors about fields req changes, so values saved before a rule existed don't block
+// unrelated edits. Changing the status also checks the trial dates, which a trial requires.
+func updateErrors(errs validate.Errors, req models.UpdateSubscriptionRequest) validate.Errors {
+	changed := map[string]bool{
+		"name":             req.Name != nil,
+		"price":            req.Price != nil,
+		"billing_cycle":    req.BillingCycle != nil,
+		"billing_date":     req.BillingDate != nil,
+		"status":           req.Status != nil,
+		"payment_method":   req.PaymentMethod != nil,
+		"website_url":      req.WebsiteURL != nil,
+		"trial_start_date": req.TrialStartDate != nil,
+		"trial_end_date":   req.TrialEndDate != nil || req.TrialStartDate != nil || req.Status != nil,
+		"post_trial_price": req.PostTrialPrice != nil,
+	}
+	var kept validate.Errors
+	for _, fe := range errs {
+		if changed[fe.Field] {
+			kept = append(kept, fe)
 		}
 	}
+	return kept
+}
 
+// applySubscriptionUpdate copies the fields set in req onto sub
+func applySubscriptionUpdate(sub *models.Subscription, req models.UpdateSubscriptionRequest, categoryID *uuid.UUID) {
+	if req.Name != nil {
+		sub.Name = *req.Name
+	}
+	if req.Price != nil {
+		sub.Price = *req.Price
+	}
+	if req.BillingCycle != nil {
+		sub.BillingCycle = *req.BillingCycle
+	}
+	if req.BillingDate != nil {
+		sub.BillingDate = *req.BillingDate
+	}
+	if categoryID != nil {
+		sub.CategoryID = categoryID
+	}
 	if req.Status != nil {
-		updates = append(updates, fmt.Sprintf("status = $%d", argCount))
-		args = append(args, *req.Status)
-		argCount++
+		sub.Status = *req.Status
 	}
-
 	if req.PaymentMethod != nil {
-		updates = append(updates, fmt.Sprintf("payment_method = $%d", argCount))
-		args = append(args, *req.PaymentMethod)
-		argCount++
+		sub.PaymentMethod = req.PaymentMethod
 	}
-
 	if req.Description != nil {
-		updates = append(updates, fmt.Sprintf("description = $%d", argCount))
-		args = append(args, *req.Description)
-		argCount++
+		sub.Description = req.Description
 	}
-
 	if req.WebsiteURL != nil {
-		updates = append(updates, fmt.Sprintf("website_url = $%d", argCount))
-		args = append(args, *req.WebsiteURL)
-		argCount++
+		sub.WebsiteURL = req.WebsiteURL
 	}
-
-	if len(updates) == 0 {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "No fields to update"})
-		return
+	if req.TrialStartDate != nil {
+		sub.TrialStartDate = req.TrialStartDate
 	}
-
-	updates = append(updates, fmt.Sprintf("updated_at = $%d", argCount))
-	args = append(args, time.Now())
-	argCount++
-
-	args = append(args, subscriptionID, userID.(uuid.UUID))
-	query := "UPDATE subscriptions SET " + updates[0]
-	for i := 1; i < len(updates); i++ {
-		query += ", " + updates[i]
+	if req.TrialEndDate != nil {
+		sub.TrialEndDate = req.TrialEndDate
 	}
-	query += fmt.Sprintf(" WHERE id = $%d AND user_id = $%d", argCount, argCount+1)
-
-	result, err := h.db.Exec(query, args...)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to update subscription"})
-		return
+	if req.PostTrialPrice != nil {
+		sub.PostTrialPrice = req.PostTrialPrice
 	}
-
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Subscription not found"})
-		return
-	}
-
-	// Return updated subscription
-	h.GetSubscription(c)
 }
 
 func (h *SubscriptionHandler) DeleteSubscription(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not authenticated"})
+		problem.Respond(c, http.StatusUnauthorized, problem.Unauthenticated, "User not authenticated")
 		return
 	}
 
+	ctx := c.Request.Context()
+
 	subscriptionID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid subscription ID"})
+		problem.Respond(c, http.StatusBadRequest, problem.InvalidID, "Invalid subscription ID")
 		return
 	}
 
-	result, err := h.db.Exec(
-		"DELETE FROM subscriptions WHERE id = $1 AND user_id = $2",
-		subscriptionID, userID.(uuid.UUID),
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to delete subscription"})
-		return
-	}
+	actorID := userID.(uuid.UUID)
+	var deletedAt time.Time
+	err = h.store.WithTx(ctx, func(tx store.Store) error {
+		before, err := tx.Subscriptions().GetForUpdate(ctx, actorID, subscriptionID)
+		if err != nil {
+			return err
+		}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Subscription not found"})
+		// Archive rather than delete; PurgeArchived removes it for good after the retention period
+		if deletedAt, err = tx.Subscriptions().Archive(ctx, actorID, subscriptionID); err != nil {
+			return err
+		}
+		if err := auditSubscription(ctx, tx.Subscriptions(), before.UserID, &actorID, "delete", before, nil); err != nil {
+			return fmt.Errorf("failed to record history: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		if err == store.ErrNotFound {
+			problem.Respond(c, http.StatusNotFound, problem.NotFound, "Subscription not found")
+			return
+		}
+		slog.ErrorContext(ctx, "Failed to delete subscription", "subscription_id", subscriptionID, "error", err)
+		problem.Respond(c, http.StatusInternalServerError, problem.Internal, "Failed to delete subscription")
 		return
 	}
+	h.syncCalendar(ctx, actorID, subscriptionID)
 
 	c.JSON(http.StatusOK, models.SuccessResponse{
 		Message: "Subscription deleted successfully",
+		Data: gin.H{
+			"id":         subscriptionID,
+			"deleted_at": deletedAt,
+			"undo_until": deletedAt.Add(h.undoWindow),
+			"purge_at":   deletedAt.Add(h.archiveRetention),
+		},
 	})
 }
@@ -0,0 +1,18 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"subscription-tracker/internal/metrics"
+)
+
+// RecordSubscriptionMetrics refreshes the subscription counts exported on /metrics
+func (h *SubscriptionHandler) RecordSubscriptionMetrics(ctx context.Context) error {
+	counts, err := h.store.Subscriptions().CountByStatus(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to count subscriptions: %w", err)
+	}
+	metrics.SetSubscriptions(counts)
+	return nil
+}
@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/store"
+	"subscription-tracker/internal/validate"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	maxSubscriptionPageSize = 100
+	defaultSubscriptionSort = "-created_at"
+)
+
+var (
+	validSubscriptionStatuses = enumSet(validate.SubscriptionStatuses)
+	validBillingCycles        = enumSet(validate.BillingCycles)
+	validPaymentMethods       = enumSet(validate.SubscriptionPaymentMethods)
+)
+
+func enumSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
+
+// subscriptionCursor is the JSON form of a store.Cursor, with the sort it was made for
+type subscriptionCursor struct {
+	Sort   string        `json:"s"`
+	Values []interface{} `json:"v"`
+	ID     uuid.UUID     `json:"id"`
+}
+
+// parseSubscriptionFilter reads the list filters from the query string:
+// q, status, category, payment_method, billing_cycle (comma-separated),
+// min_price, max_price, renewal_from, renewal_to (YYYY-MM-DD) and renews_within (days from today)
+func parseSubscriptionFilter(c *gin.Context, today time.Time) (store.SubscriptionFilter, error) {
+	f := store.SubscriptionFilter{
+		Search:     strings.TrimSpace(c.Query("q")),
+		Categories: splitQueryList(c.Query("category")),
+	}
+
+	var err error
+	if f.Statuses, err = parseEnumList(c.Query("status"), "status", validSubscriptionStatuses); err != nil {
+		return f, err
+	}
+	if f.PaymentMethods, err = parseEnumList(c.Query("payment_method"), "payment_method", validPaymentMethods); err != nil {
+		return f, err
+	}
+	if f.BillingCycles, err = parseEnumList(c.Query("billing_cycle"), "billing_cycle", validBillingCycles); err != nil {
+		return f, err
+	}
+
+	if f.MinPrice, err = parseOptionalFloat(c.Query("min_price"), "min_price"); err != nil {
+		return f, err
+	}
+	if f.MaxPrice, err = parseOptionalFloat(c.Query("max_price"), "max_price"); err != nil {
+		return f, err
+	}
+	if f.MinPrice != nil && f.MaxPrice != nil && *f.MinPrice > *f.MaxPrice {
+		return f, fmt.Errorf("min_price must not be greater than max_price")
+	}
+
+	if f.RenewalFrom, err = parseOptionalDate(c.Query("renewal_from"), "renewal_from"); err != nil {
+		return f, err
+	}
+	if f.RenewalTo, err = parseOptionalDate(c.Query("renewal_to"), "renewal_to"); err != nil {
+		return f, err
+	}
+	if days := c.Query("renews_within"); days != "" {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return f, fmt.Errorf("renews_within must be a non-negative number of days")
+		}
+		until := today.AddDate(0, 0, n)
+		f.RenewalFrom, f.RenewalTo = &today, &until
+	}
+
+	return f, nil
+}
+
+// parseSubscriptionListParams reads filters plus sort (e.g. "-price,name"), limit and cursor
+func parseSubscriptionListParams(c *gin.Context, today time.Time) (store.SubscriptionQuery, error) {
+	var p store.SubscriptionQuery
+	var err error
+
+	if p.Filter, err = parseSubscriptionFilter(c, today); err != nil {
+		return p, err
+	}
+
+	sortParam := c.DefaultQuery("sort", defaultSubscriptionSort)
+	for _, key := range splitQueryList(sortParam) {
+		desc := strings.HasPrefix(key, "-")
+		key = strings.TrimPrefix(key, "-")
+		if !store.SubscriptionSortKeys[key] {
+			return p, fmt.Errorf("invalid sort key %q", key)
+		}
+		p.Sort = append(p.Sort, store.SortKey{Key: key, Desc: desc})
+	}
+	if len(p.Sort) == 0 {
+		return p, fmt.Errorf("sort must not be empty")
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		p.Limit, err = strconv.Atoi(limit)
+		if err != nil || p.Limit < 1 || p.Limit > maxSubscriptionPageSize {
+			return p, fmt.Errorf("limit must be between 1 and %d", maxSubscriptionPageSize)
+		}
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		if p.After, err = decodeSubscriptionCursor(cursor, p.Sort); err != nil {
+			return p, err
+		}
+	}
+
+	return p, nil
+}
+
+func sortString(sort []store.SortKey) string {
+	keys := make([]string, len(sort))
+	for i, k := range sort {
+		if k.Desc {
+			keys[i] = "-" + k.Key
+		} else {
+			keys[i] = k.Key
+		}
+	}
+	return strings.Join(keys, ",")
+}
+
+// nextCursor encodes the position after sub for the query's sort
+func nextCursor(q store.SubscriptionQuery, sub models.Subscription) string {
+	cursor := subscriptionCursor{Sort: sortString(q.Sort), ID: sub.ID}
+	for _, k := range q.Sort {
+		value := store.SortValue(sub, k.Key)
+		if t, ok := value.(time.Time); ok {
+			value = t.Format(time.RFC3339Nano)
+		}
+		cursor.Values = append(cursor.Values, value)
+	}
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeSubscriptionCursor(encoded string, sort []store.SortKey) (*store.Cursor, error) {
+	invalid := fmt.Errorf("invalid cursor")
+
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, invalid
+	}
+	var cursor subscriptionCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, invalid
+	}
+
+	if cursor.Sort != sortString(sort) || len(cursor.Values) != len(sort) {
+		return nil, fmt.Errorf("cursor does not match the requested sort")
+	}
+
+	// JSON loses the value types; restore them so they compare correctly in the store
+	for i, k := range sort {
+		switch k.Key {
+		case "price":
+			v, ok := cursor.Values[i].(float64)
+			if !ok {
+				return nil, invalid
+			}
+			cursor.Values[i] = v
+		case "billing_date", "created_at", "updated_at":
+			s, ok := cursor.Values[i].(string)
+			if !ok {
+				return nil, invalid
+			}
+			t, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				return nil, invalid
+			}
+			cursor.Values[i] = t
+		default:
+			if _, ok := cursor.Values[i].(string); !ok {
+				return nil, invalid
+			}
+		}
+	}
+
+	return &store.Cursor{Values: cursor.Values, ID: cursor.ID}, nil
+}
+
+func splitQueryList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func parseEnumList(value, name string, valid map[string]bool) ([]string, error) {
+	items := splitQueryList(value)
+	for _, item := range items {
+		if !valid[item] {
+			return nil, fmt.Errorf("invalid %s %q", name, item)
+		}
+	}
+	return items, nil
+}
+
+func parseOptionalFloat(value, name string) (*float64, error) {
+	if value == "" {
+		return nil, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a number", name)
+	}
+	return &f, nil
+}
+
+func parseOptionalDate(value, name string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a date in YYYY-MM-DD format", name)
+	}
+	return &t, nil
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"subscription-tracker/internal/locale"
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// defaultReminderDays is used when a user hasn't set notifications.reminderDays, or set it to 0
+const defaultReminderDays = 3
+
+// reminderDays is how many days ahead the user wants to hear about renewals and trial ends
+func reminderDays(prefs *models.UserPreferences) int {
+	if prefs == nil || prefs.Notifications == nil || prefs.Notifications.ReminderDays <= 0 {
+		return defaultReminderDays
+	}
+	return prefs.Notifications.ReminderDays
+}
+
+// preferencesLoader returns a function that loads each user's preferences once, for jobs that go
+// through many users' subscriptions. Users that fail to load get the defaults.
+func preferencesLoader(users store.UserStore) func(ctx context.Context, userID uuid.UUID) *models.UserPreferences {
+	loaded := map[uuid.UUID]*models.UserPreferences{}
+	return func(ctx context.Context, userID uuid.UUID) *models.UserPreferences {
+		if prefs, ok := loaded[userID]; ok {
+			return prefs
+		}
+		var prefs *models.UserPreferences
+		if user, err := users.Get(ctx, userID); err == nil {
+			prefs = user.Preferences
+		} else {
+			slog.WarnContext(ctx, "Failed to load preferences", "user_id", userID, "error", err)
+		}
+		loaded[userID] = prefs
+		return prefs
+	}
+}
+
+// SendTrialAlerts warns users about trials that convert to paid within their reminder window,
+// counted in each user's own timezone. Each trial is alerted once per end date.
+func (h *SubscriptionHandler) SendTrialAlerts(ctx context.Context) error {
+	trials, err := h.store.Subscriptions().UnalertedTrials(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to query ending trials: %w", err)
+	}
+
+	preferences := preferencesLoader(h.store.Users())
+	failed := 0
+	for _, t := range trials {
+		prefs := preferences(ctx, t.UserID)
+		settings := localeFromUserPreferences(prefs)
+		if t.TrialEndDate.After(settings.Today().AddDate(0, 0, reminderDays(prefs))) {
+			continue
+		}
+		if err := h.alertTrial(ctx, t, settings); err != nil {
+			slog.ErrorContext(ctx, "Trial alert failed", "subscription_id", t.ID, "error", err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("trial alerts failed for %d of %d trials", failed, len(trials))
+	}
+	return nil
+}
+
+// alertTrial tells the user their trial is ending and marks it alerted. Both commit together, so a trial is
+// neither alerted twice nor marked without its alert.
+func (h *SubscriptionHandler) alertTrial(ctx context.Context, t models.Subscription, settings locale.Settings) error {
+	price := t.Price
+	if t.PostTrialPrice != nil {
+		price = *t.PostTrialPrice
+	}
+	return h.store.WithTx(ctx, func(tx store.Store) error {
+		err := tx.Notifications().Create(ctx, &models.Notification{
+			ID:     uuid.New(),
+			UserID: t.UserID,
+			Title:  t.Name + " trial ending soon",
+			Message: fmt.Sprintf("Your %s free trial ends on %s and will convert to a paid subscription of %s. Cancel before then to avoid being charged.",
+				t.Name, settings.FormatDate(*t.TrialEndDate), settings.FormatMoney(price)),
+			Type: "warning",
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create trial alert: %w", err)
+		}
+
+		if err := tx.Subscriptions().MarkTrialAlerted(ctx, t.ID); err != nil {
+			return fmt.Errorf("failed to mark trial alert sent: %w", err)
+		}
+		return nil
+	})
+}
+
+// ConvertEndedTrials moves trials past their end date in the user's timezone to active, switching to the
+// post-trial price. The first paid billing date is the trial end date unless a later one was already set.
+func (h *SubscriptionHandler) ConvertEndedTrials(ctx context.Context) error {
+	// No timezone is more than a day ahead of UTC, so this covers every user's today
+	trials, err := h.store.Subscriptions().EndingTrials(ctx, time.Now().UTC().AddDate(0, 0, 1))
+	if err != nil {
+		return fmt.Errorf("failed to query ended trials: %w", err)
+	}
+
+	preferences := preferencesLoader(h.store.Users())
+	failed := 0
+	for _, t := range trials {
+		settings := localeFromUserPreferences(preferences(ctx, t.UserID))
+		if t.TrialEndDate.After(settings.Today()) {
+			continue
+		}
+		if err := h.convertTrial(ctx, t.UserID, t.ID, settings); err != nil {
+			slog.ErrorContext(ctx, "Trial conversion failed", "subscription_id", t.ID, "error", err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("trial conversion failed for %d of %d trials", failed, len(trials))
+	}
+	return nil
+}
+
+// convertTrial converts one ended trial, recording the change in its history and telling the user.
+// All of it commits together, so a failure leaves the trial to be converted on the next run.
+func (h *SubscriptionHandler) convertTrial(ctx context.Context, userID, subscriptionID uuid.UUID, settings locale.Settings) error {
+	err := h.store.WithTx(ctx, func(tx store.Store) error {
+		before, err := tx.Subscriptions().GetForUpdate(ctx, userID, subscriptionID)
+		if err != nil {
+			return err
+		}
+		if before.Status != "trial" || before.TrialEndDate == nil {
+			return store.ErrNotFound
+		}
+
+		after := *before
+		after.Status = "active"
+		if before.PostTrialPrice != nil {
+			after.Price = *before.PostTrialPrice
+		}
+		if before.TrialEndDate.After(before.BillingDate) {
+			after.BillingDate = *before.TrialEndDate
+		}
+		after.UpdatedAt = time.Now()
+		if err := tx.Subscriptions().Update(ctx, &after); err != nil {
+			return err
+		}
+
+		if err := auditSubscription(ctx, tx.Subscriptions(), userID, nil, "update", before, &after); err != nil {
+			return fmt.Errorf("failed to record trial conversion history: %w", err)
+		}
+
+		if roundMoney(after.Price) != roundMoney(before.Price) {
+			trialPrice := before.Price
+			if err := tx.Subscriptions().RecordPrice(ctx, models.PriceChange{
+				SubscriptionID: subscriptionID, Price: after.Price, PreviousPrice: &trialPrice, EffectiveDate: *before.TrialEndDate, Source: "trial_conversion",
+			}); err != nil {
+				return fmt.Errorf("failed to record trial conversion price: %w", err)
+			}
+		}
+
+		err = tx.Notifications().Create(ctx, &models.Notification{
+			ID:      uuid.New(),
+			UserID:  userID,
+			Title:   after.Name + " trial converted",
+			Message: fmt.Sprintf("Your %s free trial has ended and is now an active subscription at %s.", after.Name, settings.FormatMoney(after.Price)),
+			Type:    "info",
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create trial conversion notification: %w", err)
+		}
+		return nil
+	})
+	if err == store.ErrNotFound {
+		// Archived, edited or converted since it was listed
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to convert ended trial: %w", err)
+	}
+
+	h.syncCalendar(ctx, userID, subscriptionID)
+	return nil
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"subscription-tracker/internal/models"
+)
+
+func TestConvertEndedTrials(t *testing.T) {
+	srv := newTestServer(t)
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	trialEnd := today.AddDate(0, 0, -1)
+	trialStart := trialEnd.AddDate(0, 0, -14)
+	postTrialPrice := 15.0
+	ended := srv.createSubscription(models.CreateSubscriptionRequest{
+		Name: "Ended", Price: 1, Status: "trial", BillingDate: trialEnd.AddDate(0, 0, -5),
+		TrialStartDate: &trialStart, TrialEndDate: &trialEnd, PostTrialPrice: &postTrialPrice,
+	})
+	laterEnd := today.AddDate(0, 0, 20)
+	running := srv.createSubscription(models.CreateSubscriptionRequest{
+		Name: "Running", Price: 1, Status: "trial", TrialEndDate: &laterEnd, PostTrialPrice: &postTrialPrice,
+	})
+
+	if err := srv.subs.ConvertEndedTrials(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var sub models.Subscription
+	srv.do(nil, http.MethodGet, "/api/subscriptions/"+ended.ID.String(), nil, &sub)
+	if sub.Status != "active" || sub.Price != 15 || !sub.BillingDate.Equal(trialEnd) {
+		t.Errorf("ended trial = %s at %v billed %s, want active at 15 billed %s", sub.Status, sub.Price, sub.BillingDate, trialEnd)
+	}
+	srv.do(nil, http.MethodGet, "/api/subscriptions/"+running.ID.String(), nil, &sub)
+	if sub.Status != "trial" {
+		t.Errorf("running trial = %s, want trial", sub.Status)
+	}
+
+	var history []models.PriceChange
+	srv.do(nil, http.MethodGet, "/api/subscriptions/"+ended.ID.String()+"/price-history", nil, &history)
+	converted := false
+	for _, pc := range history {
+		converted = converted || (pc.Source == "trial_conversion" && pc.Price == 15)
+	}
+	if !converted {
+		t.Errorf("price history = %+v, want a trial_conversion entry", history)
+	}
+
+	// Converting again finds nothing to do
+	if err := srv.subs.ConvertEndedTrials(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	notifications, _ := srv.store.Notifications().List(context.Background(), srv.user.ID)
+	if len(notifications) != 1 {
+		t.Errorf("notifications = %+v, want one conversion notice", notifications)
+	}
+}
+
+func TestSendTrialAlertsOnce(t *testing.T) {
+	srv := newTestServer(t)
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	soon, later := today.AddDate(0, 0, 2), today.AddDate(0, 0, 30)
+	srv.createSubscription(models.CreateSubscriptionRequest{Name: "Soon", Price: 5, Status: "trial", TrialEndDate: &soon})
+	srv.createSubscription(models.CreateSubscriptionRequest{Name: "Later", Price: 5, Status: "trial", TrialEndDate: &later})
+
+	for i := 0; i < 2; i++ {
+		if err := srv.subs.SendTrialAlerts(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	notifications, _ := srv.store.Notifications().List(context.Background(), srv.user.ID)
+	if len(notifications) != 1 || notifications[0].Title != "Soon trial ending soon" {
+		t.Errorf("notifications = %+v, want one alert for Soon", notifications)
+	}
+}
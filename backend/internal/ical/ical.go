@@ -0,0 +1,203 @@
+// Package ical writes iCalendar (RFC 5545) feeds one event at a time.
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// maxLineOctets is the longest content line allowed before folding
+const maxLineOctets = 75
+
+// Event is a single VEVENT. All-day events only use the date part of Start.
+type Event struct {
+	UID         string
+	Summary     string
+	Description string
+	URL         string
+	Categories  []string
+	Start       time.Time
+	End         *time.Time // Defaults to one day after Start for all-day events
+	AllDay      bool
+	RRule       string // e.g. "FREQ=MONTHLY"
+	Updated     time.Time
+	Alarms      []Alarm
+}
+
+// Alarm is a VALARM display reminder shown Before the event starts
+type Alarm struct {
+	Before      time.Duration
+	Description string
+}
+
+// Writer streams a VCALENDAR to an io.Writer
+type Writer struct {
+	w   *bufio.Writer
+	err error
+}
+
+// NewWriter writes the calendar header. name is shown by clients as the calendar title.
+func NewWriter(w io.Writer, name string) *Writer {
+	cw := &Writer{w: bufio.NewWriter(w)}
+	cw.line("BEGIN:VCALENDAR")
+	cw.line("VERSION:2.0")
+	cw.line("PRODID:-//Subscription Tracker//EN")
+	cw.line("CALSCALE:GREGORIAN")
+	cw.line("METHOD:PUBLISH")
+	if name != "" {
+		cw.line("X-WR-CALNAME:" + escapeText(name))
+	}
+	return cw
+}
+
+// SetRefreshInterval suggests how often subscribed clients should poll the calendar.
+// It must be called before the first event is written.
+func (cw *Writer) SetRefreshInterval(d time.Duration) {
+	cw.line("REFRESH-INTERVAL;VALUE=DURATION:" + formatDuration(d))
+	cw.line("X-PUBLISHED-TTL:" + formatDuration(d))
+}
+
+// WriteEvent appends a VEVENT to the calendar
+func (cw *Writer) WriteEvent(e Event) error {
+	stamp := e.Updated
+	if stamp.IsZero() {
+		stamp = time.Now()
+	}
+
+	cw.line("BEGIN:VEVENT")
+	cw.line("UID:" + escapeText(e.UID))
+	cw.line("DTSTAMP:" + formatDateTime(stamp))
+	if e.AllDay {
+		end := e.Start.AddDate(0, 0, 1)
+		if e.End != nil {
+			end = *e.End
+		}
+		cw.line("DTSTART;VALUE=DATE:" + e.Start.Format("20060102"))
+		cw.line("DTEND;VALUE=DATE:" + end.Format("20060102"))
+	} else {
+		cw.line("DTSTART:" + formatDateTime(e.Start))
+		if e.End != nil {
+			cw.line("DTEND:" + formatDateTime(*e.End))
+		}
+	}
+	if e.RRule != "" {
+		cw.line("RRULE:" + e.RRule)
+	}
+	cw.line("SUMMARY:" + escapeText(e.Summary))
+	if e.Description != "" {
+		cw.line("DESCRIPTION:" + escapeText(e.Description))
+	}
+	if e.URL != "" {
+		cw.line("URL:" + e.URL)
+	}
+	if len(e.Categories) > 0 {
+		categories := make([]string, len(e.Categories))
+		for i, category := range e.Categories {
+			categories[i] = escapeText(category)
+		}
+		cw.line("CATEGORIES:" + strings.Join(categories, ","))
+	}
+	for _, alarm := range e.Alarms {
+		cw.line("BEGIN:VALARM")
+		cw.line("ACTION:DISPLAY")
+		cw.line("TRIGGER:" + formatTrigger(alarm.Before))
+		cw.line("DESCRIPTION:" + escapeText(alarm.Description))
+		cw.line("END:VALARM")
+	}
+	cw.line("END:VEVENT")
+	return cw.err
+}
+
+// Flush sends buffered events to the underlying writer
+func (cw *Writer) Flush() error {
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	return cw.err
+}
+
+// Close ends the calendar and flushes it. It does not close the underlying writer.
+func (cw *Writer) Close() error {
+	cw.line("END:VCALENDAR")
+	return cw.Flush()
+}
+
+// MonthlyRule returns the RRULE for a monthly or yearly charge on date's day of month.
+// Days past the 28th fall back to the last day of shorter months, matching how billing dates advance.
+func MonthlyRule(freq string, date time.Time) string {
+	rule := "FREQ=" + freq
+	if freq == "YEARLY" {
+		rule += fmt.Sprintf(";BYMONTH=%d", int(date.Month()))
+	}
+	day := date.Day()
+	if day <= 28 {
+		return rule + fmt.Sprintf(";BYMONTHDAY=%d", day)
+	}
+	days := make([]string, 0, day-27)
+	for d := 28; d <= day; d++ {
+		days = append(days, fmt.Sprint(d))
+	}
+	return rule + ";BYMONTHDAY=" + strings.Join(days, ",") + ";BYSETPOS=-1"
+}
+
+// line writes a content line, folding it at 75 octets without splitting UTF-8 sequences
+func (cw *Writer) line(s string) {
+	if cw.err != nil {
+		return
+	}
+	limit := maxLineOctets
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && s[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		if _, cw.err = cw.w.WriteString(s[:cut] + "\r\n "); cw.err != nil {
+			return
+		}
+		s = s[cut:]
+		// Continuation lines start with a space, which counts towards the limit
+		limit = maxLineOctets - 1
+	}
+	_, cw.err = cw.w.WriteString(s + "\r\n")
+}
+
+func formatDateTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// formatDuration formats a positive duration as an RFC 5545 duration, e.g. P3D or PT1H30M
+func formatDuration(d time.Duration) string {
+	days := d / (24 * time.Hour)
+	d -= days * 24 * time.Hour
+	out := "P"
+	if days > 0 {
+		out += fmt.Sprintf("%dD", days)
+	}
+	if d > 0 || days == 0 {
+		out += "T"
+		if h := d / time.Hour; h > 0 {
+			out += fmt.Sprintf("%dH", h)
+		}
+		if m := (d % time.Hour) / time.Minute; m > 0 || d < time.Hour {
+			out += fmt.Sprintf("%dM", m)
+		}
+	}
+	return out
+}
+
+// formatTrigger formats an alarm offset before the event start
+func formatTrigger(before time.Duration) string {
+	if before <= 0 {
+		return "PT0M"
+	}
+	return "-" + formatDuration(before)
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
@@ -0,0 +1,217 @@
+// Package locale formats money and dates and works out "today" for a user's timezone and locale.
+// It covers the locales and currencies the app is used with rather than full CLDR data.
+package locale
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	// Embed the timezone database so user timezones load in minimal containers
+	_ "time/tzdata"
+)
+
+// Defaults match the behavior before users could choose, for accounts without preferences
+const (
+	DefaultTimezone = "Africa/Nairobi"
+	DefaultLocale   = "en-KE"
+	DefaultCurrency = "KES"
+)
+
+// Settings are a user's regional preferences
+type Settings struct {
+	Location *time.Location
+	Locale   string // BCP 47 tag, e.g. "en-KE" or "de-DE"
+	Currency string // ISO 4217 code, e.g. "KES"
+}
+
+var currencySymbols = map[string]string{
+	"KES": "KSh", "UGX": "USh", "TZS": "TSh", "RWF": "FRw", "NGN": "₦", "GHS": "GH₵", "ZAR": "R",
+	"USD": "$", "CAD": "CA$", "AUD": "A$", "EUR": "€", "GBP": "£", "INR": "₹", "JPY": "¥", "CNY": "CN¥",
+}
+
+// currencyDecimals lists currencies without two minor digits
+var currencyDecimals = map[string]int{"JPY": 0, "UGX": 0, "RWF": 0, "KRW": 0}
+
+type numberFormat struct {
+	group, decimal string
+	symbolFirst    bool
+}
+
+// numberFormats are keyed by language, with a few regional overrides keyed by the full tag
+var numberFormats = map[string]numberFormat{
+	"en": {",", ".", true}, "sw": {",", ".", true}, "ja": {",", ".", true}, "zh": {",", ".", true},
+	"hi": {",", ".", true}, "ko": {",", ".", true},
+	"de": {".", ",", false}, "es": {".", ",", false}, "it": {".", ",", false}, "pt": {".", ",", false},
+	"nl": {".", ",", true}, "id": {".", ",", true}, "tr": {".", ",", false}, "da": {".", ",", false},
+	"fr": {" ", ",", false}, "ru": {" ", ",", false}, "pl": {" ", ",", false},
+	"sv": {" ", ",", false}, "nb": {" ", ",", false}, "fi": {" ", ",", false},
+	"cs":    {" ", ",", false},
+	"de-CH": {"’", ".", true}, "fr-CH": {"’", ".", true},
+}
+
+// dateLayouts are Go layouts for medium-length dates, keyed like numberFormats
+var dateLayouts = map[string]string{
+	"en": "2 Jan 2006", "en-US": "Jan 2, 2006", "en-CA": "Jan 2, 2006", "en-PH": "Jan 2, 2006",
+	"de": "02.01.2006", "ru": "02.01.2006", "pl": "02.01.2006", "tr": "02.01.2006", "fi": "2.1.2006",
+	"cs": "2. 1. 2006", "nb": "02.01.2006", "da": "02.01.2006",
+	"fr": "02/01/2006", "es": "02/01/2006", "it": "02/01/2006", "pt": "02/01/2006", "sw": "02/01/2006",
+	"id": "02/01/2006", "hi": "02/01/2006",
+	"nl": "02-01-2006", "sv": "2006-01-02",
+	"ja": "2006/01/02", "zh": "2006/01/02", "ko": "2006. 1. 2.",
+}
+
+// New builds settings from stored preferences, falling back to the defaults for empty or invalid values
+func New(timezone, localeTag, currency string) Settings {
+	s := Default()
+	if timezone != "" {
+		if loc, err := time.LoadLocation(timezone); err == nil {
+			s.Location = loc
+		}
+	}
+	if ValidLocale(localeTag) {
+		s.Locale = canonicalLocale(localeTag)
+	}
+	if len(currency) == 3 {
+		s.Currency = strings.ToUpper(currency)
+	}
+	return s
+}
+
+// Default returns the settings used for users without preferences
+func Default() Settings {
+	loc, err := time.LoadLocation(DefaultTimezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	return Settings{Location: loc, Locale: DefaultLocale, Currency: DefaultCurrency}
+}
+
+// ValidTimezone reports whether name is a known IANA timezone
+func ValidTimezone(name string) bool {
+	_, err := time.LoadLocation(name)
+	return err == nil && name != "" && name != "Local"
+}
+
+// ValidLocale reports whether tag looks like a BCP 47 language tag such as "en" or "en-KE"
+func ValidLocale(tag string) bool {
+	parts := strings.Split(tag, "-")
+	if len(parts[0]) < 2 || len(parts[0]) > 3 || !isLetters(parts[0]) {
+		return false
+	}
+	for _, part := range parts[1:] {
+		if len(part) < 2 || len(part) > 8 {
+			return false
+		}
+	}
+	return true
+}
+
+// Timezone returns the IANA name of the user's timezone
+func (s Settings) Timezone() string {
+	return s.Location.String()
+}
+
+// Now is the current time in the user's timezone
+func (s Settings) Now() time.Time {
+	return time.Now().In(s.Location)
+}
+
+// Today is the user's current calendar date at midnight UTC, the same form DATE columns are read in
+func (s Settings) Today() time.Time {
+	now := s.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// FormatMoney formats an amount in the user's currency and locale, e.g. "KSh 1,100.00" or "1.100,00 €"
+func (s Settings) FormatMoney(amount float64) string {
+	format := s.numberFormat()
+	decimals, ok := currencyDecimals[s.Currency]
+	if !ok {
+		decimals = 2
+	}
+
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	number := strconv.FormatFloat(math.Round(amount*math.Pow10(decimals))/math.Pow10(decimals), 'f', decimals, 64)
+
+	whole, fraction := number, ""
+	if i := strings.IndexByte(number, '.'); i >= 0 {
+		whole, fraction = number[:i], number[i+1:]
+	}
+	var b strings.Builder
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteString(format.group)
+		}
+		b.WriteRune(digit)
+	}
+	if fraction != "" {
+		b.WriteString(format.decimal + fraction)
+	}
+
+	symbol, ok := currencySymbols[s.Currency]
+	if !ok {
+		symbol = s.Currency
+	}
+	if !format.symbolFirst {
+		return sign + b.String() + " " + symbol
+	}
+	// Letter symbols like KSh read better with a space before the number
+	if last, _ := utf8.DecodeLastRuneInString(symbol); unicode.IsLetter(last) {
+		return sign + symbol + " " + b.String()
+	}
+	return sign + symbol + b.String()
+}
+
+// FormatDate formats the date part of t for the user's locale
+func (s Settings) FormatDate(t time.Time) string {
+	if layout, ok := dateLayouts[s.Locale]; ok {
+		return t.Format(layout)
+	}
+	if layout, ok := dateLayouts[s.language()]; ok {
+		return t.Format(layout)
+	}
+	return t.Format("2006-01-02")
+}
+
+func (s Settings) numberFormat() numberFormat {
+	if format, ok := numberFormats[s.Locale]; ok {
+		return format
+	}
+	if format, ok := numberFormats[s.language()]; ok {
+		return format
+	}
+	return numberFormats["en"]
+}
+
+func (s Settings) language() string {
+	return strings.ToLower(strings.SplitN(s.Locale, "-", 2)[0])
+}
+
+// canonicalLocale normalizes case, e.g. "EN-ke" to "en-KE"
+func canonicalLocale(tag string) string {
+	parts := strings.Split(tag, "-")
+	parts[0] = strings.ToLower(parts[0])
+	for i := 1; i < len(parts); i++ {
+		if len(parts[i]) == 2 {
+			parts[i] = strings.ToUpper(parts[i])
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+func isLetters(s string) bool {
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,105 @@
+package logging
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are attribute keys whose values are never logged, matched after lowercasing
+// and dropping "-" and "_"
+var sensitiveKeys = []string{"token", "password", "secret", "authorization", "verifier", "apikey", "cookie"}
+
+var (
+	// Credentials embedded in URLs, form bodies and JSON error responses from providers
+	credentialParam = regexp.MustCompile(`(?i)\b(access_token|refresh_token|id_token|client_secret|code_verifier|code|password)=[^&\s"']+`)
+	credentialField = regexp.MustCompile(`(?i)"(access_token|refresh_token|id_token|client_secret|code_verifier|password|token)"\s*:\s*"[^"]*"`)
+	bearerToken     = regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/=-]+`)
+	jwt             = regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`)
+	email           = regexp.MustCompile(`[A-Za-z0-9._%+-]+@([A-Za-z0-9-]+\.)+[A-Za-z]{2,}`)
+	// Phone numbers in international or local form, such as M-Pesa's 2547XXXXXXXX
+	phoneNumber = regexp.MustCompile(`\+?\d{9,15}`)
+)
+
+// Redact masks credentials, email addresses and phone numbers in s. Emails keep their domain and
+// phone numbers their last three digits, which is usually enough to tell records apart.
+func Redact(s string) string {
+	s = credentialParam.ReplaceAllString(s, "$1="+redacted)
+	s = credentialField.ReplaceAllString(s, `"$1":"`+redacted+`"`)
+	s = bearerToken.ReplaceAllString(s, "Bearer "+redacted)
+	s = jwt.ReplaceAllString(s, redacted)
+	s = email.ReplaceAllStringFunc(s, func(match string) string {
+		return "***" + match[strings.LastIndex(match, "@"):]
+	})
+	return maskPhoneNumbers(s)
+}
+
+// maskPhoneNumbers masks digit runs that stand on their own, leaving those that are part of
+// a longer token such as a UUID, a decimal or an identifier
+func maskPhoneNumbers(s string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range phoneNumber.FindAllStringIndex(s, -1) {
+		start, end := loc[0], loc[1]
+		if partOfToken(s, start-1, -1) || partOfToken(s, end, 1) {
+			continue
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(strings.Repeat("*", end-start-3))
+		b.WriteString(s[end-3 : end])
+		last = end
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// partOfToken reports whether the character at i, next to a digit run, joins it to a longer token.
+// A dot only does when another letter or digit follows it, so a number ending a sentence still counts.
+func partOfToken(s string, i, dir int) bool {
+	if i < 0 || i >= len(s) {
+		return false
+	}
+	if s[i] == '.' {
+		next := i + dir
+		return next >= 0 && next < len(s) && alphanumeric(s[next])
+	}
+	return alphanumeric(s[i]) || s[i] == '-' || s[i] == '_'
+}
+
+func alphanumeric(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// redactAttr is the handler's ReplaceAttr hook. It runs on the message and on every attribute,
+// including those nested in groups.
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) == 0 && (a.Key == slog.TimeKey || a.Key == slog.LevelKey) {
+		return a
+	}
+	if sensitiveKey(a.Key) {
+		return slog.String(a.Key, redacted)
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, Redact(a.Value.String()))
+	case slog.KindAny:
+		// Errors often wrap provider responses, so they are logged by their redacted message
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, Redact(err.Error()))
+		}
+	}
+	return a
+}
+
+func sensitiveKey(key string) bool {
+	key = strings.NewReplacer("-", "", "_", "").Replace(strings.ToLower(key))
+	for _, k := range sensitiveKeys {
+		if strings.Contains(key, k) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+// Package metrics defines the Prometheus metrics the server exposes on /metrics: HTTP requests, database
+// queries and pool usage, calls to payment and calendar providers, background jobs and business totals.
+// Metrics are registered on their own registry rather than the global one.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "subscription_tracker"
+
+// Registry holds every metric below along with the Go runtime and process collectors
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests handled, by route pattern and status code.",
+	}, []string{"method", "route", "status"})
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to handle HTTP requests, by route pattern.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	dbQueries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_queries_total",
+		Help:      "Database statements run outside transactions, by operation and outcome.",
+	}, []string{"operation", "outcome"})
+	dbDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Time taken by database statements run outside transactions, by operation.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"operation"})
+
+	providerRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "provider_requests_total",
+		Help:      "Calls to external providers, by provider and outcome (2xx, 4xx, 5xx or error).",
+	}, []string{"provider", "method", "outcome"})
+	providerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "provider_request_duration_seconds",
+		Help:      "Time taken by calls to external providers.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"provider", "method"})
+
+	jobRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "job_runs_total",
+		Help:      "Background job runs, by job and outcome (success, failure or panic).",
+	}, []string{"job", "outcome"})
+	jobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "job_duration_seconds",
+		Help:      "Time taken by background job runs.",
+		Buckets:   []float64{.1, .5, 1, 5, 15, 30, 60, 300, 900},
+	}, []string{"job"})
+	jobLastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "job_last_success_timestamp_seconds",
+		Help:      "When each background job last completed without error.",
+	}, []string{"job"})
+
+	subscriptions = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "subscriptions",
+		Help:      "Subscriptions across all users that are not archived, by status.",
+	}, []string{"status"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration,
+		dbQueries, dbDuration,
+		providerRequests, providerDuration,
+		jobRuns, jobDuration, jobLastSuccess,
+		subscriptions,
+	)
+}
+
+// Handler serves the registry in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// RegisterDB exports the connection pool statistics of db (open, idle and in-use connections and waits)
+func RegisterDB(db *sql.DB, name string) {
+	Registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// ObserveRequest records a handled HTTP request. route is the route pattern, not the path, to keep label values bounded.
+func ObserveRequest(method, route string, status int, elapsed time.Duration) {
+	httpRequests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	httpDuration.WithLabelValues(method, route).Observe(elapsed.Seconds())
+}
+
+// ObserveQuery records a database statement. operation is "exec", "query" or "query_row".
+func ObserveQuery(operation string, elapsed time.Duration, err error) {
+	dbQueries.WithLabelValues(operation, outcome(err)).Inc()
+	dbDuration.WithLabelValues(operation).Observe(elapsed.Seconds())
+}
+
+// ObserveJob records a run of a background job. outcome is "success", "failure" or "panic".
+func ObserveJob(job, outcome string, elapsed time.Duration) {
+	jobRuns.WithLabelValues(job, outcome).Inc()
+	jobDuration.WithLabelValues(job).Observe(elapsed.Seconds())
+	if outcome == "success" {
+		jobLastSuccess.WithLabelValues(job).SetToCurrentTime()
+	}
+}
+
+// SetSubscriptions replaces the subscription counts by status. Statuses missing from counts are reset to zero.
+func SetSubscriptions(counts map[string]int) {
+	subscriptions.Reset()
+	for status, count := range counts {
+		subscriptions.WithLabelValues(status).Set(float64(count))
+	}
+}
+
+func outcome(err error) string {
+	if err != nil && err != sql.ErrNoRows {
+		return "error"
+	}
+	return "success"
+}
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"subscription-tracker/internal/tracing"
+)
+
+// Transport wraps base, or http.DefaultTransport when nil, so every call made through it is counted
+// and timed under provider. Only the provider and method are recorded: paths carry IDs and tokens.
+func Transport(provider string, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{provider: provider, base: base}
+}
+
+// Client returns an HTTP client with the given timeout whose calls are recorded and traced under provider
+func Client(provider string, timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: tracing.Transport(provider, Transport(provider, nil))}
+}
+
+type transport struct {
+	provider string
+	base     http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	providerDuration.WithLabelValues(t.provider, req.Method).Observe(time.Since(start).Seconds())
+
+	result := "error"
+	if err == nil {
+		result = statusClass(resp.StatusCode)
+	}
+	providerRequests.WithLabelValues(t.provider, req.Method, result).Inc()
+	return resp, err
+}
+
+func statusClass(status int) string {
+	switch {
+	case status >= 500:
+		return "5xx"
+	case status >= 400:
+		return "4xx"
+	case status >= 300:
+		return "3xx"
+	default:
+		return "2xx"
+	}
+}
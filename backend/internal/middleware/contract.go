@@ -0,0 +1,187 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/problem"
+	"subscription-tracker/openapi"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/gin-gonic/gin"
+)
+
+// maxContractBody bounds how much of a response is buffered for checking; larger bodies, such as big
+// exports, only have their status and headers checked
+const maxContractBody = 1 << 20
+
+// Contract checks every request and response against the OpenAPI spec, so the handlers and the spec can't
+// drift apart unnoticed in development and tests. Mismatches are logged; with enforce, requests that don't
+// match are also rejected before they reach the handler. Responses are never altered.
+func Contract(doc *openapi3.T, enforce bool) gin.HandlerFunc {
+	options := &openapi3filter.Options{
+		MultiError:            true,
+		IncludeResponseStatus: true,
+		SkipSettingDefaults:   true,
+		// Authentication is left to AuthMiddleware
+		AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+	}
+
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			c.Next()
+			return
+		}
+		ctx := c.Request.Context()
+
+		path, item, op := openapi.Operation(doc, c.Request.Method, route)
+		if op == nil {
+			slog.WarnContext(ctx, "Route is not in the OpenAPI spec", "method", c.Request.Method, "route", route)
+			c.Next()
+			return
+		}
+
+		params := make(map[string]string, len(c.Params))
+		for _, p := range c.Params {
+			params[p.Key] = p.Value
+		}
+		input := &openapi3filter.RequestValidationInput{
+			Request:    c.Request,
+			PathParams: params,
+			Route:      &routers.Route{Spec: doc, Path: path, PathItem: item, Method: c.Request.Method, Operation: op},
+			Options:    options,
+		}
+
+		if err := openapi3filter.ValidateRequest(ctx, input); err != nil {
+			fields := contractErrors("", err)
+			slog.WarnContext(ctx, "Request does not match the OpenAPI spec", "method", c.Request.Method, "route", route, "errors", describeFieldErrors(fields))
+			if enforce {
+				rejectRequest(c, fields)
+				return
+			}
+		}
+
+		w := &capturingWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+
+		responseOptions := *options
+		if w.truncated || !isJSON(w.Header().Get("Content-Type")) {
+			responseOptions.ExcludeResponseBody = true
+		}
+		err := openapi3filter.ValidateResponse(ctx, &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: input,
+			Status:                 w.Status(),
+			Header:                 w.Header(),
+			Body:                   io.NopCloser(bytes.NewReader(w.body.Bytes())),
+			Options:                &responseOptions,
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "Response does not match the OpenAPI spec", "method", c.Request.Method, "route", route,
+				"status", w.Status(), "errors", describeFieldErrors(contractErrors("", err)))
+		}
+	}
+}
+
+// rejectRequest answers 400, listing the fields when every error could be tied to one
+func rejectRequest(c *gin.Context, fields []models.FieldError) {
+	for _, f := range fields {
+		if f.Field == "" {
+			problem.Abort(c, http.StatusBadRequest, problem.InvalidRequest, "The request does not match the API specification: "+f.Message)
+			return
+		}
+	}
+	problem.Fields(c, fields...)
+	c.Abort()
+}
+
+// contractErrors flattens a validation error into field errors. Messages come from the validator's reason,
+// which never includes the rejected value, so secrets such as passwords stay out of logs and responses.
+func contractErrors(field string, err error) []models.FieldError {
+	switch e := err.(type) {
+	case openapi3.MultiError:
+		var fields []models.FieldError
+		for _, inner := range e {
+			fields = append(fields, contractErrors(field, inner)...)
+		}
+		return fields
+	case *openapi3filter.RequestError:
+		if e.Parameter != nil {
+			field = e.Parameter.Name
+		}
+		if e.Err != nil {
+			return contractErrors(field, e.Err)
+		}
+		return []models.FieldError{{Field: field, Code: "invalid", Message: e.Reason}}
+	case *openapi3filter.ResponseError:
+		if e.Err != nil {
+			return contractErrors(field, e.Err)
+		}
+		return []models.FieldError{{Field: field, Code: "invalid", Message: e.Reason}}
+	case *openapi3.SchemaError:
+		if pointer := e.JSONPointer(); len(pointer) > 0 {
+			if field != "" {
+				field += "."
+			}
+			field += strings.Join(pointer, ".")
+		}
+		return []models.FieldError{{Field: field, Code: e.SchemaField, Message: e.Reason}}
+	case *openapi3filter.ParseError:
+		return []models.FieldError{{Field: field, Code: "type", Message: field + " could not be parsed"}}
+	default:
+		return []models.FieldError{{Field: field, Code: "invalid", Message: err.Error()}}
+	}
+}
+
+func describeFieldErrors(fields []models.FieldError) []string {
+	described := make([]string, len(fields))
+	for i, f := range fields {
+		described[i] = f.Field + ": " + f.Message
+		if f.Field == "" {
+			described[i] = f.Message
+		}
+	}
+	return described
+}
+
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
+
+// capturingWriter keeps a copy of the response body for the contract check
+type capturingWriter struct {
+	gin.ResponseWriter
+	body      bytes.Buffer
+	truncated bool
+}
+
+func (w *capturingWriter) Write(data []byte) (int, error) {
+	w.capture(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *capturingWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *capturingWriter) capture(data []byte) {
+	if w.truncated {
+		return
+	}
+	if w.body.Len()+len(data) > maxContractBody {
+		w.truncated = true
+		w.body.Reset()
+		return
+	}
+	w.body.Write(data)
+}
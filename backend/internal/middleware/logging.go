@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"subscription-tracker/internal/logging"
+	"subscription-tracker/internal/problem"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries the request ID in both directions, so a client or proxy can correlate its own logs
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength caps IDs supplied by clients, which end up in every log line of the request
+const maxRequestIDLength = 64
+
+// RequestID tags each request with the caller's X-Request-ID, or a new one if it is missing or malformed.
+// The ID is echoed in the response and stored in the request context for logging.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+
+		c.Set("requestID", id)
+		c.Header(RequestIDHeader, id)
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+// RequestLogger logs one line per request once it has been handled. It logs the route pattern rather
+// than the path, since paths and query strings can hold secrets such as calendar feed tokens and OAuth codes.
+func RequestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := c.Writer.Status()
+		attrs := []any{
+			"method", c.Request.Method,
+			"route", route,
+			"status", status,
+			"duration", time.Since(start),
+			"bytes", c.Writer.Size(),
+		}
+		if userID, ok := c.Get("userID"); ok {
+			attrs = append(attrs, "user_id", userID)
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, "errors", c.Errors.String())
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+		slog.Log(c.Request.Context(), level, "Request handled", attrs...)
+	}
+}
+
+// Recovery turns a panic in a handler into a 500 response and logs it with the request ID and stack
+func Recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if r := recover(); r != nil {
+				slog.ErrorContext(c.Request.Context(), "Handler panicked", "panic", r, "stack", string(debug.Stack()))
+				problem.Abort(c, http.StatusInternalServerError, problem.Internal, "Internal server error")
+			}
+		}()
+		c.Next()
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"time"
+
+	"subscription-tracker/internal/metrics"
+	"subscription-tracker/internal/problem"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Metrics records the count and latency of every request by route pattern
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.ObserveRequest(c.Request.Method, route, c.Writer.Status(), time.Since(start))
+	}
+}
+
+// MetricsAuth requires "Authorization: Bearer <token>" on the metrics endpoint. An empty token leaves it open,
+// for deployments where only the internal network can reach it.
+func MetricsAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token != "" && subtle.ConstantTimeCompare([]byte(c.GetHeader("Authorization")), []byte("Bearer "+token)) != 1 {
+			problem.Abort(c, http.StatusUnauthorized, problem.InvalidToken, "Invalid metrics token")
+			return
+		}
+		c.Next()
+	}
+}
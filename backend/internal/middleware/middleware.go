@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"subscription-tracker/internal/auth"
+	"subscription-tracker/internal/problem"
 
 	"github.com/gin-gonic/gin"
 )
@@ -13,22 +14,19 @@ func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
-			c.Abort()
+			problem.Abort(c, http.StatusUnauthorized, problem.Unauthenticated, "Authorization header required")
 			return
 		}
 
 		bearerToken := strings.Split(authHeader, " ")
 		if len(bearerToken) != 2 || bearerToken[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
-			c.Abort()
+			problem.Abort(c, http.StatusUnauthorized, problem.Unauthenticated, "Invalid authorization header format")
 			return
 		}
 
 		claims, err := auth.ValidateToken(bearerToken[1], jwtSecret)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token", "details": err.Error()})
-			c.Abort()
+			problem.Abort(c, http.StatusUnauthorized, problem.InvalidToken, "Invalid or expired token")
 			return
 		}
 
@@ -7,15 +7,17 @@ import (
 )
 
 type UserPreferences struct {
-	Budget        *BudgetPreferences        `json:"budget,omitempty"`
-	Notifications *NotificationPreferences  `json:"notifications,omitempty"`
-	AI            *AIPreferences            `json:"ai,omitempty"`
-	Calendar      *CalendarPreferences      `json:"calendar,omitempty"`
+	Budget        *BudgetPreferences       `json:"budget,omitempty"`
+	Notifications *NotificationPreferences `json:"notifications,omitempty"`
+	AI            *AIPreferences           `json:"ai,omitempty"`
+	Calendar      *CalendarPreferences     `json:"calendar,omitempty"`
+	Timezone      string                   `json:"timezone,omitempty"` // IANA name, e.g. "Africa/Nairobi"
+	Locale        string                   `json:"locale,omitempty"`   // BCP 47 tag, e.g. "en-KE"
 }
 
 type BudgetPreferences struct {
 	Monthly      float64 `json:"monthly"`
-	Currency     string  `json:"currency"`
+	Currency     string  `json:"currency"` // ISO 4217 code used to format money, e.g. "KES"
 	CheckBalance bool    `json:"checkBalance"`
 }
 
@@ -33,19 +35,17 @@ type AIPreferences struct {
 }
 
 type CalendarPreferences struct {
-	GoogleSync bool `json:"googleSync"`
+	GoogleSync    bool `json:"googleSync"`
+	MicrosoftSync bool `json:"microsoftSync"`
 }
 
 type User struct {
-	ID                 uuid.UUID        `json:"id" db:"id"`
-	Email              string           `json:"email" db:"email"`
-	PasswordHash       string           `json:"-" db:"password_hash"`
-	Name               *string          `json:"name" db:"name"`
-	Preferences        *UserPreferences `json:"preferences,omitempty" db:"preferences"`
-	GoogleAccessToken  *string          `json:"-" db:"google_access_token"`
-	GoogleRefreshToken *string          `json:"-" db:"google_refresh_token"`
-	GoogleTokenExpiry  *time.Time       `json:"-" db:"google_token_expiry"`
-	CreatedAt          time.Time        `json:"created_at" db:"created_at"`
+	ID           uuid.UUID        `json:"id" db:"id"`
+	Email        string           `json:"email" db:"email"`
+	PasswordHash string           `json:"-" db:"password_hash"`
+	Name         *string          `json:"name" db:"name"`
+	Preferences  *UserPreferences `json:"preferences,omitempty" db:"preferences"`
+	CreatedAt    time.Time        `json:"created_at" db:"created_at"`
 }
 
 type Category struct {
@@ -54,20 +54,24 @@ type Category struct {
 }
 
 type Subscription struct {
-	ID            uuid.UUID  `json:"id" db:"id"`
-	UserID        uuid.UUID  `json:"user_id" db:"user_id"`
-	Name          string     `json:"name" db:"name"`
-	Price         float64    `json:"price" db:"price"`
-	BillingCycle  string     `json:"billing_cycle" db:"billing_cycle"`
-	BillingDate   time.Time  `json:"billing_date" db:"billing_date"`
-	CategoryID    *uuid.UUID `json:"category_id" db:"category_id"`
-	Status        string     `json:"status" db:"status"`
-	PaymentMethod *string    `json:"payment_method" db:"payment_method"`
-	Description   *string    `json:"description" db:"description"`
-	WebsiteURL    *string    `json:"website_url" db:"website_url"`
-	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
-	UpdatedAt     time.Time  `json:"updated_at" db:"updated_at"`
-	Category      *Category  `json:"category,omitempty"`
+	ID             uuid.UUID  `json:"id" db:"id"`
+	UserID         uuid.UUID  `json:"user_id" db:"user_id"`
+	Name           string     `json:"name" db:"name"`
+	Price          float64    `json:"price" db:"price"`
+	BillingCycle   string     `json:"billing_cycle" db:"billing_cycle"`
+	BillingDate    time.Time  `json:"billing_date" db:"billing_date"`
+	CategoryID     *uuid.UUID `json:"category_id" db:"category_id"`
+	Status         string     `json:"status" db:"status"`
+	PaymentMethod  *string    `json:"payment_method" db:"payment_method"`
+	Description    *string    `json:"description" db:"description"`
+	WebsiteURL     *string    `json:"website_url" db:"website_url"`
+	TrialStartDate *time.Time `json:"trial_start_date" db:"trial_start_date"`
+	TrialEndDate   *time.Time `json:"trial_end_date" db:"trial_end_date"`
+	PostTrialPrice *float64   `json:"post_trial_price" db:"post_trial_price"`
+	DeletedAt      *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at" db:"updated_at"`
+	Category       *Category  `json:"category,omitempty"`
 }
 
 type PaymentMethod struct {
@@ -76,9 +80,9 @@ type PaymentMethod struct {
 	Type             string     `json:"type" db:"type"` // credit_card, debit_card, mpesa, paypal, paystack, bank_transfer
 	Last4            *string    `json:"last4" db:"last4"`
 	Brand            *string    `json:"brand" db:"brand"`
-	PhoneNumber      *string    `json:"phone_number,omitempty" db:"phone_number"`       // For M-Pesa
-	AccountEmail     *string    `json:"account_email,omitempty" db:"account_email"`     // For PayPal/Paystack
-	APIKeyEncrypted  *string    `json:"-" db:"api_key_encrypted"`                       // For Paystack (never exposed)
+	PhoneNumber      *string    `json:"phone_number,omitempty" db:"phone_number"`   // For M-Pesa
+	AccountEmail     *string    `json:"account_email,omitempty" db:"account_email"` // For PayPal/Paystack
+	APIKeyEncrypted  *string    `json:"-" db:"api_key_encrypted"`                   // For Paystack (never exposed)
 	LastBalanceCheck *time.Time `json:"last_balance_check,omitempty" db:"last_balance_check"`
 	BalanceCents     *int64     `json:"balance_cents,omitempty" db:"balance_cents"`
 	Currency         *string    `json:"currency,omitempty" db:"currency"`
@@ -89,7 +93,9 @@ type PaymentMethod struct {
 type Notification struct {
 	ID        uuid.UUID `json:"id" db:"id"`
 	UserID    uuid.UUID `json:"user_id" db:"user_id"`
+	Title     string    `json:"title" db:"title"`
 	Message   string    `json:"message" db:"message"`
+	Type      string    `json:"type" db:"type"` // info, warning, error, success
 	Read      bool      `json:"read" db:"read"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 }
@@ -110,6 +116,81 @@ type AnalyticsResult struct {
 	CreatedAt time.Time   `json:"created_at" db:"created_at"`
 }
 
+type PriceChange struct {
+	ID             uuid.UUID `json:"id" db:"id"`
+	SubscriptionID uuid.UUID `json:"subscription_id" db:"subscription_id"`
+	Price          float64   `json:"price" db:"price"`
+	PreviousPrice  *float64  `json:"previous_price" db:"previous_price"`
+	EffectiveDate  time.Time `json:"effective_date" db:"effective_date"`
+	Source         string    `json:"source" db:"source"` // initial, manual, trial_conversion, import
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+}
+
+// FieldChange is the before and after value of a single audited field
+type FieldChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+type SubscriptionAuditEntry struct {
+	ID             uuid.UUID              `json:"id" db:"id"`
+	SubscriptionID uuid.UUID              `json:"subscription_id" db:"subscription_id"`
+	UserID         uuid.UUID              `json:"user_id" db:"user_id"`
+	ActorID        *uuid.UUID             `json:"actor_id" db:"actor_id"` // nil for background jobs
+	Action         string                 `json:"action" db:"action"`     // create, update, delete, revert
+	Version        int                    `json:"version" db:"version"`
+	Changes        map[string]FieldChange `json:"changes" db:"changes"`
+	Snapshot       *Subscription          `json:"snapshot" db:"snapshot"`
+	CreatedAt      time.Time              `json:"created_at" db:"created_at"`
+}
+
+type SplitMember struct {
+	ID             uuid.UUID `json:"id" db:"id"`
+	SubscriptionID uuid.UUID `json:"subscription_id" db:"subscription_id"`
+	Name           string    `json:"name" db:"name"`
+	Email          *string   `json:"email" db:"email"`
+	PhoneNumber    *string   `json:"phone_number" db:"phone_number"` // For M-Pesa settle-up (format: 254XXXXXXXXX)
+	SharePercent   float64   `json:"share_percent" db:"share_percent"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+}
+
+type SplitLedgerEntry struct {
+	ID             uuid.UUID  `json:"id" db:"id"`
+	SubscriptionID uuid.UUID  `json:"subscription_id" db:"subscription_id"`
+	MemberID       uuid.UUID  `json:"member_id" db:"member_id"`
+	Type           string     `json:"type" db:"type"` // charge, settlement
+	Amount         float64    `json:"amount" db:"amount"`
+	PeriodDate     *time.Time `json:"period_date,omitempty" db:"period_date"`
+	Method         *string    `json:"method,omitempty" db:"method"` // cash, mpesa
+	Status         string     `json:"status" db:"status"`           // pending, completed, failed
+	Reference      *string    `json:"reference,omitempty" db:"reference"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+}
+
+// SplitBalance is the net amount a member owes the subscription owner
+type SplitBalance struct {
+	MemberID         uuid.UUID `json:"member_id"`
+	MemberName       string    `json:"member_name"`
+	MemberEmail      *string   `json:"member_email,omitempty"`
+	SubscriptionID   uuid.UUID `json:"subscription_id"`
+	SubscriptionName string    `json:"subscription_name"`
+	OwnerID          uuid.UUID `json:"owner_id"`
+	TotalCharged     float64   `json:"total_charged"`
+	TotalSettled     float64   `json:"total_settled"`
+	Balance          float64   `json:"balance"`
+	// M-Pesa settlements still waiting for their callback; they aren't taken off Balance yet
+	TotalPending float64 `json:"total_pending"`
+}
+
+// CalendarFeed describes a user's secret iCalendar feed. URL and WebcalURL are only returned when the feed is created.
+type CalendarFeed struct {
+	Enabled        bool       `json:"enabled"`
+	URL            string     `json:"url,omitempty"`
+	WebcalURL      string     `json:"webcal_url,omitempty"`
+	CreatedAt      *time.Time `json:"created_at,omitempty"`
+	LastAccessedAt *time.Time `json:"last_accessed_at,omitempty"`
+}
+
 // Request/Response DTOs
 type LoginRequest struct {
 	Email    string `json:"email" binding:"required,email"`
@@ -129,29 +210,41 @@ type UpdateUserRequest struct {
 }
 
 type CreateSubscriptionRequest struct {
-	Name          string     `json:"name" binding:"required"`
-	Price         float64    `json:"price" binding:"required"`
-	BillingCycle  string     `json:"billing_cycle" binding:"required"`
-	BillingDate   time.Time  `json:"billing_date" binding:"required"`
-	CategoryID    *uuid.UUID `json:"category_id"`
-	Category      *string    `json:"category"` // Category name (will be converted to ID)
-	Status        string     `json:"status" binding:"required"`
-	PaymentMethod *string    `json:"payment_method"`
-	Description   *string    `json:"description"`
-	WebsiteURL    *string    `json:"website_url"`
+	Name           string     `json:"name" binding:"required"`
+	Price          float64    `json:"price" binding:"required"`
+	BillingCycle   string     `json:"billing_cycle" binding:"required"`
+	BillingDate    time.Time  `json:"billing_date" binding:"required"`
+	CategoryID     *uuid.UUID `json:"category_id"`
+	Category       *string    `json:"category"` // Category name (will be converted to ID)
+	Status         string     `json:"status" binding:"required"`
+	PaymentMethod  *string    `json:"payment_method"`
+	Description    *string    `json:"description"`
+	WebsiteURL     *string    `json:"website_url"`
+	TrialStartDate *time.Time `json:"trial_start_date"`
+	TrialEndDate   *time.Time `json:"trial_end_date"`   // Required when status is "trial"
+	PostTrialPrice *float64   `json:"post_trial_price"` // Price once the trial converts (defaults to price)
 }
 
 type UpdateSubscriptionRequest struct {
-	Name          *string    `json:"name"`
-	Price         *float64   `json:"price"`
-	BillingCycle  *string    `json:"billing_cycle"`
-	BillingDate   *time.Time `json:"billing_date"`
-	CategoryID    *uuid.UUID `json:"category_id"`
-	Category      *string    `json:"category"` // Category name (will be converted to ID)
-	Status        *string    `json:"status"`
-	PaymentMethod *string    `json:"payment_method"`
-	Description   *string    `json:"description"`
-	WebsiteURL    *string    `json:"website_url"`
+	Name           *string    `json:"name"`
+	Price          *float64   `json:"price"`
+	BillingCycle   *string    `json:"billing_cycle"`
+	BillingDate    *time.Time `json:"billing_date"`
+	CategoryID     *uuid.UUID `json:"category_id"`
+	Category       *string    `json:"category"` // Category name (will be converted to ID)
+	Status         *string    `json:"status"`
+	PaymentMethod  *string    `json:"payment_method"`
+	Description    *string    `json:"description"`
+	WebsiteURL     *string    `json:"website_url"`
+	TrialStartDate *time.Time `json:"trial_start_date"`
+	TrialEndDate   *time.Time `json:"trial_end_date"`
+	PostTrialPrice *float64   `json:"post_trial_price"`
+	// Date a price change takes effect (defaults to today)
+	PriceEffectiveDate *time.Time `json:"price_effective_date"`
+}
+
+type RevertSubscriptionRequest struct {
+	Version int `json:"version" binding:"required"`
 }
 
 type CreatePaymentMethodRequest struct {
@@ -168,16 +261,79 @@ type CreateBudgetRequest struct {
 	Period string  `json:"period" binding:"required"`
 }
 
+type CreateSplitMemberRequest struct {
+	Name         string  `json:"name" binding:"required"`
+	Email        *string `json:"email"`
+	PhoneNumber  *string `json:"phone_number"`
+	SharePercent float64 `json:"share_percent" binding:"required"`
+}
+
+type SettleSplitRequest struct {
+	Amount      float64 `json:"amount" binding:"required"`
+	Method      string  `json:"method" binding:"required"` // cash, mpesa
+	PhoneNumber *string `json:"phone_number"`              // Overrides the member's phone number for M-Pesa
+}
+
+// ImportRowResult is the outcome of a single row of a bulk import
+type ImportRowResult struct {
+	Row          int                        `json:"row"`    // 1-based data row, excluding the CSV header
+	Status       string                     `json:"status"` // valid, imported, duplicate, invalid
+	Errors       []string                   `json:"errors,omitempty"`
+	Warnings     []string                   `json:"warnings,omitempty"`
+	Subscription *CreateSubscriptionRequest `json:"subscription,omitempty"`
+	ID           *uuid.UUID                 `json:"id,omitempty"` // Set once imported
+}
+
+type ImportResult struct {
+	DryRun     bool              `json:"dry_run"`
+	Total      int               `json:"total"`
+	Valid      int               `json:"valid"`
+	Imported   int               `json:"imported"`
+	Duplicates int               `json:"duplicates"`
+	Invalid    int               `json:"invalid"`
+	Rows       []ImportRowResult `json:"rows"`
+}
+
 type AuthResponse struct {
 	Token string `json:"token"`
 	User  User   `json:"user"`
 }
 
-type ErrorResponse struct {
+// Problem is an RFC 7807 error response, served as application/problem+json. Code is stable and meant
+// for clients to branch on; Title and Detail are for people and may change.
+type Problem struct {
+	Type    string       `json:"type"`
+	Title   string       `json:"title"`
+	Status  int          `json:"status"`
+	Detail  string       `json:"detail,omitempty"`
+	Code    string       `json:"code"`
+	Errors  []FieldError `json:"errors,omitempty"` // Set when Code is validation_failed
+	TraceID string       `json:"trace_id,omitempty"`
+	// Deprecated: same as Detail, kept for clients written against the old {"error": ...} responses
 	Error string `json:"error"`
 }
 
+// FieldError explains why one field of a request was rejected
+type FieldError struct {
+	Field   string `json:"field"` // JSON name, dotted for nested fields, e.g. "reminders.0.days_before"
+	Code    string `json:"code"`  // The rule that failed, e.g. required, oneof, min, type
+	Message string `json:"message"`
+}
+
 type SuccessResponse struct {
 	Message string      `json:"message"`
 	Data    interface{} `json:"data,omitempty"`
 }
+
+// HealthResponse reports the outcome of a readiness probe and of each dependency it checked
+type HealthResponse struct {
+	Status string                 `json:"status"` // ok, unavailable, shutting_down
+	Checks map[string]HealthCheck `json:"checks,omitempty"`
+}
+
+type HealthCheck struct {
+	Status   string `json:"status"` // ok, failed
+	Critical bool   `json:"critical"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
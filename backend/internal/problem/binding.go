@@ -0,0 +1,129 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"subscription-tracker/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+func init() {
+	// Report fields by their JSON names, which is what clients send, rather than the Go field names
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			for _, tag := range []string{"json", "form"} {
+				if name := strings.Split(field.Tag.Get(tag), ",")[0]; name != "" && name != "-" {
+					return name
+				}
+			}
+			return field.Name
+		})
+	}
+}
+
+// Invalid responds 400 to an error from binding a request body or query string. Validation failures
+// are listed per field; anything else is described without echoing the decoder's message.
+func Invalid(c *gin.Context, err error) {
+	var validationErrs validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	var timeErr *time.ParseError
+
+	switch {
+	case errors.As(err, &validationErrs):
+		fields := make([]models.FieldError, 0, len(validationErrs))
+		for _, fe := range validationErrs {
+			fields = append(fields, fieldError(fe))
+		}
+		Fields(c, fields...)
+	case errors.As(err, &typeErr):
+		Fields(c, models.FieldError{
+			Field:   typeErr.Field,
+			Code:    "type",
+			Message: fmt.Sprintf("%s must be %s", typeErr.Field, jsonType(typeErr.Type)),
+		})
+	case errors.As(err, &timeErr):
+		Respond(c, http.StatusBadRequest, ValidationFailed, "Dates and times must be in RFC 3339 format, e.g. 2024-01-31T00:00:00Z")
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		Respond(c, http.StatusBadRequest, InvalidRequest, "Request body is not valid JSON")
+	case errors.Is(err, io.EOF):
+		Respond(c, http.StatusBadRequest, InvalidRequest, "Request body is empty")
+	default:
+		Respond(c, http.StatusBadRequest, InvalidRequest, "Request could not be read")
+	}
+}
+
+// fieldError describes a failed validation tag. The namespace starts with the struct's name, which is dropped.
+func fieldError(fe validator.FieldError) models.FieldError {
+	field := fe.Namespace()
+	if i := strings.Index(field, "."); i >= 0 {
+		field = field[i+1:]
+	}
+	field = strings.NewReplacer("[", ".", "]", "").Replace(field)
+
+	var message string
+	switch fe.Tag() {
+	case "required", "required_without", "required_if":
+		message = field + " is required"
+	case "oneof":
+		message = fmt.Sprintf("%s must be one of: %s", field, strings.ReplaceAll(fe.Param(), " ", ", "))
+	case "min", "gte":
+		message = fmt.Sprintf("%s must be at least %s%s", field, fe.Param(), lengthUnit(fe))
+	case "max", "lte":
+		message = fmt.Sprintf("%s must be at most %s%s", field, fe.Param(), lengthUnit(fe))
+	case "gt":
+		message = fmt.Sprintf("%s must be greater than %s", field, fe.Param())
+	case "lt":
+		message = fmt.Sprintf("%s must be less than %s", field, fe.Param())
+	case "email":
+		message = field + " must be a valid email address"
+	case "url", "http_url":
+		message = field + " must be a valid URL"
+	case "e164":
+		message = field + " must be a phone number in international format, e.g. +254712345678"
+	case "len":
+		message = fmt.Sprintf("%s must be exactly %s%s", field, fe.Param(), lengthUnit(fe))
+	default:
+		message = field + " is invalid"
+	}
+	return models.FieldError{Field: field, Code: fe.Tag(), Message: message}
+}
+
+// lengthUnit qualifies a min or max bound on a string or list, which limits its length rather than its value
+func lengthUnit(fe validator.FieldError) string {
+	switch fe.Kind() {
+	case reflect.String:
+		return " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return " items"
+	}
+	return ""
+}
+
+// jsonType names the JSON type a Go type is decoded from
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	}
+	return "an object"
+}
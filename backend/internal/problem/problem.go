@@ -0,0 +1,86 @@
+// Package problem writes error responses as RFC 7807 problem details. Every problem carries a stable
+// code; details are written for people and never include internal errors, which handlers log instead.
+package problem
+
+import (
+	"net/http"
+
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/tracing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContentType is the media type of problem responses
+const ContentType = "application/problem+json"
+
+// typePrefix turns a code into the problem's type URI
+const typePrefix = "urn:subscription-tracker:problem:"
+
+// Code identifies the kind of error, independent of the wording of the detail
+type Code string
+
+const (
+	// Authentication
+	Unauthenticated    Code = "unauthenticated"
+	InvalidToken       Code = "invalid_token"
+	InvalidCredentials Code = "invalid_credentials"
+
+	// Malformed or invalid requests
+	InvalidRequest   Code = "invalid_request"
+	ValidationFailed Code = "validation_failed"
+	InvalidID        Code = "invalid_id"
+
+	// State of the resource
+	NotFound      Code = "not_found"
+	AlreadyExists Code = "already_exists"
+	Expired       Code = "expired"
+
+	// External providers
+	ProviderNotConfigured Code = "provider_not_configured"
+	ProviderNotConnected  Code = "provider_not_connected"
+	ProviderError         Code = "provider_error"
+	PaymentRejected       Code = "payment_rejected"
+
+	// Server
+	RouteNotFound    Code = "route_not_found"
+	MethodNotAllowed Code = "method_not_allowed"
+	Internal         Code = "internal_error"
+)
+
+// New builds the problem for status and code. The trace ID lets a report be matched to the server's logs and traces.
+func New(c *gin.Context, status int, code Code, detail string) models.Problem {
+	return models.Problem{
+		Type:    typePrefix + string(code),
+		Title:   http.StatusText(status),
+		Status:  status,
+		Detail:  detail,
+		Code:    string(code),
+		TraceID: tracing.TraceID(c.Request.Context()),
+		Error:   detail,
+	}
+}
+
+// Respond writes a problem response. Handlers return right after, as with c.JSON.
+func Respond(c *gin.Context, status int, code Code, detail string) {
+	Write(c, New(c, status, code, detail))
+}
+
+// Abort writes a problem response and stops the remaining handlers, for use in middleware
+func Abort(c *gin.Context, status int, code Code, detail string) {
+	Respond(c, status, code, detail)
+	c.Abort()
+}
+
+// Write sends p, which may carry field errors or other details added by the caller
+func Write(c *gin.Context, p models.Problem) {
+	c.Header("Content-Type", ContentType)
+	c.JSON(p.Status, p)
+}
+
+// Fields responds 400 with a validation_failed problem listing why each field was rejected
+func Fields(c *gin.Context, errs ...models.FieldError) {
+	p := New(c, http.StatusBadRequest, ValidationFailed, "The request has invalid fields")
+	p.Errors = errs
+	Write(c, p)
+}
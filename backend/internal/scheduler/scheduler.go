@@ -0,0 +1,108 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"subscription-tracker/internal/metrics"
+	"subscription-tracker/internal/tracing"
+)
+
+// Job is a background task run on a fixed interval
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+}
+
+// Scheduler runs registered jobs in their own goroutines until shut down
+type Scheduler struct {
+	jobs []Job
+	// ctx is passed to runs and cancelled only when a shutdown gives up waiting for them
+	ctx    context.Context
+	cancel context.CancelFunc
+	// stop is closed to stop scheduling new runs
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func New() *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{ctx: ctx, cancel: cancel, stop: make(chan struct{})}
+}
+
+// Add registers a job. Jobs must be added before Start is called.
+func (s *Scheduler) Add(name string, interval time.Duration, run func(ctx context.Context) error) {
+	s.jobs = append(s.jobs, Job{Name: name, Interval: interval, Run: run})
+}
+
+// Start runs every job once immediately and then on each tick of its interval
+func (s *Scheduler) Start() {
+	for _, job := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(job)
+	}
+}
+
+// Shutdown stops scheduling new runs and waits for in-flight ones to finish. If ctx ends first, the
+// runs' context is cancelled and Shutdown returns ctx's error once they have returned.
+func (s *Scheduler) Shutdown(ctx context.Context) error {
+	close(s.stop)
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	defer s.cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (s *Scheduler) loop(job Job) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.run(job)
+
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// run executes one run of job as the root of a new trace, so its queries and provider calls are grouped
+func (s *Scheduler) run(job Job) {
+	start := time.Now()
+	ctx, span := tracing.Tracer().Start(s.ctx, "job "+job.Name)
+	defer func() {
+		if r := recover(); r != nil {
+			slog.ErrorContext(ctx, "Job panicked", "job", job.Name, "panic", r)
+			metrics.ObserveJob(job.Name, "panic", time.Since(start))
+			tracing.End(span, fmt.Errorf("panic: %v", r))
+		}
+	}()
+
+	err := job.Run(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "Job failed", "job", job.Name, "error", err)
+		metrics.ObserveJob(job.Name, "failure", time.Since(start))
+	} else {
+		metrics.ObserveJob(job.Name, "success", time.Since(start))
+	}
+	tracing.End(span, err)
+}
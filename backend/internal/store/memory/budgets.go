@@ -0,0 +1,39 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/store"
+
+	"github.com/google/uuid"
+)
+
+type budgetStore struct {
+	*Store
+}
+
+func (s *budgetStore) Current(ctx context.Context, userID uuid.UUID) (*models.Budget, error) {
+	defer s.lock()()
+
+	var current *models.Budget
+	for _, b := range s.data.budgets {
+		if b.UserID == userID && (current == nil || b.CreatedAt.After(current.CreatedAt)) {
+			budget := b
+			current = &budget
+		}
+	}
+	if current == nil {
+		return nil, store.ErrNotFound
+	}
+	return current, nil
+}
+
+func (s *budgetStore) Create(ctx context.Context, budget *models.Budget) error {
+	defer s.lock()()
+
+	budget.CreatedAt = time.Now()
+	s.data.budgets[budget.ID] = *budget
+	return nil
+}
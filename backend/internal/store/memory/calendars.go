@@ -0,0 +1,198 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// providerKey identifies a user's connection to, or a subscription's event in, one provider
+type providerKey struct {
+	id       uuid.UUID
+	provider string
+}
+
+type feedRecord struct {
+	tokenHash      string
+	createdAt      time.Time
+	lastAccessedAt *time.Time
+}
+
+type calendarStore struct {
+	*Store
+}
+
+func (s *calendarStore) Connections(ctx context.Context, userID uuid.UUID) ([]store.CalendarConnection, error) {
+	defer s.lock()()
+
+	return s.connections(func(conn store.CalendarConnection) bool { return conn.UserID == userID }), nil
+}
+
+func (s *calendarStore) AllConnections(ctx context.Context) ([]store.CalendarConnection, error) {
+	defer s.lock()()
+
+	return s.connections(func(store.CalendarConnection) bool { return true }), nil
+}
+
+// connections returns the connections that match, by user then provider
+func (s *calendarStore) connections(match func(store.CalendarConnection) bool) []store.CalendarConnection {
+	var connections []store.CalendarConnection
+	for _, conn := range s.data.connections {
+		if match(conn) {
+			connections = append(connections, conn)
+		}
+	}
+	sort.Slice(connections, func(i, j int) bool {
+		if connections[i].UserID != connections[j].UserID {
+			return connections[i].UserID.String() < connections[j].UserID.String()
+		}
+		return connections[i].Provider < connections[j].Provider
+	})
+	return connections
+}
+
+func (s *calendarStore) GetConnection(ctx context.Context, userID uuid.UUID, provider string) (*store.CalendarConnection, error) {
+	defer s.lock()()
+
+	conn, ok := s.data.connections[providerKey{userID, provider}]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return &conn, nil
+}
+
+func (s *calendarStore) SaveConnection(ctx context.Context, conn store.CalendarConnection) error {
+	defer s.lock()()
+
+	key := providerKey{conn.UserID, conn.Provider}
+	if existing, ok := s.data.connections[key]; ok && conn.RefreshToken == "" {
+		conn.RefreshToken = existing.RefreshToken
+	}
+	s.data.connections[key] = conn
+	return nil
+}
+
+func (s *calendarStore) DeleteConnection(ctx context.Context, userID uuid.UUID, provider string) error {
+	defer s.lock()()
+
+	delete(s.data.connections, providerKey{userID, provider})
+	return nil
+}
+
+func (s *calendarStore) GetEvent(ctx context.Context, subscriptionID uuid.UUID, provider string) (*store.SyncedEvent, error) {
+	defer s.lock()()
+
+	event, ok := s.data.events[providerKey{subscriptionID, provider}]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return &event, nil
+}
+
+func (s *calendarStore) EventSubscriptions(ctx context.Context, userID uuid.UUID, provider string) ([]uuid.UUID, error) {
+	defer s.lock()()
+
+	var ids []uuid.UUID
+	for _, event := range s.data.events {
+		if event.UserID == userID && event.Provider == provider {
+			ids = append(ids, event.SubscriptionID)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].String() < ids[j].String() })
+	return ids, nil
+}
+
+func (s *calendarStore) SaveEvent(ctx context.Context, event store.SyncedEvent) error {
+	defer s.lock()()
+
+	event.SyncedAt = time.Now()
+	s.data.events[providerKey{event.SubscriptionID, event.Provider}] = event
+	return nil
+}
+
+func (s *calendarStore) DeleteEvent(ctx context.Context, subscriptionID uuid.UUID, provider string) error {
+	defer s.lock()()
+
+	delete(s.data.events, providerKey{subscriptionID, provider})
+	return nil
+}
+
+func (s *calendarStore) GetFeed(ctx context.Context, userID uuid.UUID) (*models.CalendarFeed, error) {
+	defer s.lock()()
+
+	feed, ok := s.data.feeds[userID]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	createdAt := feed.createdAt
+	return &models.CalendarFeed{Enabled: true, CreatedAt: &createdAt, LastAccessedAt: feed.lastAccessedAt}, nil
+}
+
+func (s *calendarStore) SaveFeed(ctx context.Context, userID uuid.UUID, tokenHash string) (time.Time, error) {
+	defer s.lock()()
+
+	for id, feed := range s.data.feeds {
+		if feed.tokenHash == tokenHash && id != userID {
+			return time.Time{}, store.ErrConflict
+		}
+	}
+	createdAt := time.Now()
+	s.data.feeds[userID] = feedRecord{tokenHash: tokenHash, createdAt: createdAt}
+	return createdAt, nil
+}
+
+func (s *calendarStore) DeleteFeed(ctx context.Context, userID uuid.UUID) error {
+	defer s.lock()()
+
+	if _, ok := s.data.feeds[userID]; !ok {
+		return store.ErrNotFound
+	}
+	delete(s.data.feeds, userID)
+	return nil
+}
+
+func (s *calendarStore) UseFeed(ctx context.Context, tokenHash string) (uuid.UUID, error) {
+	defer s.lock()()
+
+	for userID, feed := range s.data.feeds {
+		if feed.tokenHash == tokenHash {
+			now := time.Now()
+			feed.lastAccessedAt = &now
+			s.data.feeds[userID] = feed
+			return userID, nil
+		}
+	}
+	return uuid.Nil, store.ErrNotFound
+}
+
+func (s *calendarStore) CreateOAuthState(ctx context.Context, state store.OAuthState) error {
+	defer s.lock()()
+
+	now := time.Now()
+	for nonceHash, existing := range s.data.oauthStates {
+		if existing.ExpiresAt.Before(now) {
+			delete(s.data.oauthStates, nonceHash)
+		}
+	}
+	if _, ok := s.data.oauthStates[state.NonceHash]; ok {
+		return store.ErrConflict
+	}
+	s.data.oauthStates[state.NonceHash] = state
+	return nil
+}
+
+func (s *calendarStore) ConsumeOAuthState(ctx context.Context, userID uuid.UUID, provider, nonceHash string) (string, error) {
+	defer s.lock()()
+
+	state, ok := s.data.oauthStates[nonceHash]
+	if !ok || state.UserID != userID || state.Provider != provider || state.ExpiresAt.Before(time.Now()) {
+		return "", store.ErrNotFound
+	}
+	delete(s.data.oauthStates, nonceHash)
+	return state.CodeVerifier, nil
+}
@@ -0,0 +1,157 @@
+// Package memory implements the stores in process memory, for tests that shouldn't need a database
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// defaultCategories mirror those seeded by the initial migration
+var defaultCategories = []string{
+	"Entertainment", "Software", "Gaming", "Music", "News & Media", "Fitness",
+	"Food & Delivery", "Transportation", "Utilities", "Education", "Other",
+}
+
+// data is everything the store holds. Records are kept by value so a copy of data is a snapshot.
+type data struct {
+	users          map[uuid.UUID]models.User
+	subscriptions  map[uuid.UUID]subscriptionRecord
+	categories     []models.Category
+	prices         []models.PriceChange
+	audit          []models.SubscriptionAuditEntry
+	paymentMethods map[uuid.UUID]models.PaymentMethod
+	notifications  map[uuid.UUID]models.Notification
+	budgets        map[uuid.UUID]models.Budget
+	splitMembers   map[uuid.UUID]models.SplitMember
+	ledger         []models.SplitLedgerEntry
+	connections    map[providerKey]store.CalendarConnection
+	events         map[providerKey]store.SyncedEvent
+	feeds          map[uuid.UUID]feedRecord    // By user
+	oauthStates    map[string]store.OAuthState // By nonce hash
+}
+
+// subscriptionRecord is a stored subscription and the columns models.Subscription doesn't carry
+type subscriptionRecord struct {
+	sub       models.Subscription
+	archived  bool
+	alertSent bool
+}
+
+func (d *data) clone() *data {
+	c := &data{
+		users:          make(map[uuid.UUID]models.User, len(d.users)),
+		subscriptions:  make(map[uuid.UUID]subscriptionRecord, len(d.subscriptions)),
+		categories:     append([]models.Category(nil), d.categories...),
+		prices:         append([]models.PriceChange(nil), d.prices...),
+		audit:          append([]models.SubscriptionAuditEntry(nil), d.audit...),
+		paymentMethods: make(map[uuid.UUID]models.PaymentMethod, len(d.paymentMethods)),
+		notifications:  make(map[uuid.UUID]models.Notification, len(d.notifications)),
+		budgets:        make(map[uuid.UUID]models.Budget, len(d.budgets)),
+		splitMembers:   make(map[uuid.UUID]models.SplitMember, len(d.splitMembers)),
+		ledger:         append([]models.SplitLedgerEntry(nil), d.ledger...),
+		connections:    make(map[providerKey]store.CalendarConnection, len(d.connections)),
+		events:         make(map[providerKey]store.SyncedEvent, len(d.events)),
+		feeds:          make(map[uuid.UUID]feedRecord, len(d.feeds)),
+		oauthStates:    make(map[string]store.OAuthState, len(d.oauthStates)),
+	}
+	for k, v := range d.users {
+		c.users[k] = v
+	}
+	for k, v := range d.subscriptions {
+		c.subscriptions[k] = v
+	}
+	for k, v := range d.paymentMethods {
+		c.paymentMethods[k] = v
+	}
+	for k, v := range d.notifications {
+		c.notifications[k] = v
+	}
+	for k, v := range d.budgets {
+		c.budgets[k] = v
+	}
+	for k, v := range d.splitMembers {
+		c.splitMembers[k] = v
+	}
+	for k, v := range d.connections {
+		c.connections[k] = v
+	}
+	for k, v := range d.events {
+		c.events[k] = v
+	}
+	for k, v := range d.feeds {
+		c.feeds[k] = v
+	}
+	for k, v := range d.oauthStates {
+		c.oauthStates[k] = v
+	}
+	return c
+}
+
+// Store is safe for concurrent use. Transactions hold the lock until they finish, so they are serialized.
+type Store struct {
+	mu   *sync.Mutex
+	data *data
+	tx   bool
+}
+
+func New() *Store {
+	d := &data{
+		users:          map[uuid.UUID]models.User{},
+		subscriptions:  map[uuid.UUID]subscriptionRecord{},
+		paymentMethods: map[uuid.UUID]models.PaymentMethod{},
+		notifications:  map[uuid.UUID]models.Notification{},
+		budgets:        map[uuid.UUID]models.Budget{},
+		splitMembers:   map[uuid.UUID]models.SplitMember{},
+		connections:    map[providerKey]store.CalendarConnection{},
+		events:         map[providerKey]store.SyncedEvent{},
+		feeds:          map[uuid.UUID]feedRecord{},
+		oauthStates:    map[string]store.OAuthState{},
+	}
+	for _, name := range defaultCategories {
+		d.categories = append(d.categories, models.Category{ID: uuid.New(), Name: name})
+	}
+	return &Store{mu: &sync.Mutex{}, data: d}
+}
+
+func (s *Store) Subscriptions() store.SubscriptionStore { return &subscriptionStore{s} }
+func (s *Store) Users() store.UserStore                 { return &userStore{s} }
+func (s *Store) Payments() store.PaymentStore           { return &paymentStore{s} }
+func (s *Store) Notifications() store.NotificationStore { return &notificationStore{s} }
+func (s *Store) Budgets() store.BudgetStore             { return &budgetStore{s} }
+func (s *Store) Splits() store.SplitStore               { return &splitStore{s} }
+func (s *Store) Calendars() store.CalendarStore         { return &calendarStore{s} }
+
+// WithTx runs fn against a copy of the data, which replaces the original only if fn succeeds
+// and ctx has not ended
+func (s *Store) WithTx(ctx context.Context, fn func(tx store.Store) error) error {
+	if s.tx {
+		return fn(s)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := s.data.clone()
+	if err := fn(&Store{mu: s.mu, data: snapshot, tx: true}); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	*s.data = *snapshot
+	return nil
+}
+
+// lock guards a single operation; inside a transaction the lock is already held
+func (s *Store) lock() func() {
+	if s.tx {
+		return func() {}
+	}
+	s.mu.Lock()
+	return s.mu.Unlock
+}
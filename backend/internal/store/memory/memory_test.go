@@ -0,0 +1,12 @@
+package memory
+
+import (
+	"testing"
+
+	"subscription-tracker/internal/store"
+	"subscription-tracker/internal/store/storetest"
+)
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store { return New() })
+}
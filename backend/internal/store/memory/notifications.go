@@ -0,0 +1,52 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/store"
+
+	"github.com/google/uuid"
+)
+
+type notificationStore struct {
+	*Store
+}
+
+func (s *notificationStore) List(ctx context.Context, userID uuid.UUID) ([]models.Notification, error) {
+	defer s.lock()()
+
+	notifications := []models.Notification{}
+	for _, n := range s.data.notifications {
+		if n.UserID == userID {
+			notifications = append(notifications, n)
+		}
+	}
+	sort.Slice(notifications, func(i, j int) bool {
+		return notifications[i].CreatedAt.After(notifications[j].CreatedAt)
+	})
+	return notifications, nil
+}
+
+func (s *notificationStore) Create(ctx context.Context, n *models.Notification) error {
+	defer s.lock()()
+
+	n.Read = false
+	n.CreatedAt = time.Now()
+	s.data.notifications[n.ID] = *n
+	return nil
+}
+
+func (s *notificationStore) MarkRead(ctx context.Context, userID, id uuid.UUID) error {
+	defer s.lock()()
+
+	n, ok := s.data.notifications[id]
+	if !ok || n.UserID != userID {
+		return store.ErrNotFound
+	}
+	n.Read = true
+	s.data.notifications[id] = n
+	return nil
+}
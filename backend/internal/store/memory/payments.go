@@ -0,0 +1,56 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/store"
+
+	"github.com/google/uuid"
+)
+
+type paymentStore struct {
+	*Store
+}
+
+func (s *paymentStore) List(ctx context.Context, userID uuid.UUID) ([]models.PaymentMethod, error) {
+	defer s.lock()()
+
+	paymentMethods := []models.PaymentMethod{}
+	for _, pm := range s.data.paymentMethods {
+		if pm.UserID == userID {
+			paymentMethods = append(paymentMethods, pm)
+		}
+	}
+	sort.Slice(paymentMethods, func(i, j int) bool {
+		a, b := paymentMethods[i], paymentMethods[j]
+		if a.IsDefault != b.IsDefault {
+			return a.IsDefault
+		}
+		return a.CreatedAt.After(b.CreatedAt)
+	})
+	return paymentMethods, nil
+}
+
+func (s *paymentStore) Create(ctx context.Context, pm *models.PaymentMethod, apiKeyEncrypted *string) error {
+	defer s.lock()()
+
+	var balance int64
+	pm.BalanceCents = &balance
+	pm.CreatedAt = time.Now()
+	s.data.paymentMethods[pm.ID] = *pm
+	return nil
+}
+
+func (s *paymentStore) Delete(ctx context.Context, userID, id uuid.UUID) error {
+	defer s.lock()()
+
+	pm, ok := s.data.paymentMethods[id]
+	if !ok || pm.UserID != userID {
+		return store.ErrNotFound
+	}
+	delete(s.data.paymentMethods, id)
+	return nil
+}
@@ -0,0 +1,206 @@
+package memory
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/store"
+
+	"github.com/google/uuid"
+)
+
+type splitStore struct {
+	*Store
+}
+
+func (s *splitStore) Members(ctx context.Context, subscriptionID uuid.UUID) ([]models.SplitMember, error) {
+	defer s.lock()()
+
+	return s.members(subscriptionID), nil
+}
+
+// members returns a subscription's members in the order they joined
+func (s *splitStore) members(subscriptionID uuid.UUID) []models.SplitMember {
+	members := []models.SplitMember{}
+	for _, m := range s.data.splitMembers {
+		if m.SubscriptionID == subscriptionID {
+			members = append(members, m)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if !members[i].CreatedAt.Equal(members[j].CreatedAt) {
+			return members[i].CreatedAt.Before(members[j].CreatedAt)
+		}
+		return members[i].ID.String() < members[j].ID.String()
+	})
+	return members
+}
+
+func (s *splitStore) GetMemberForUpdate(ctx context.Context, subscriptionID, memberID uuid.UUID) (*models.SplitMember, error) {
+	defer s.lock()()
+
+	m, ok := s.data.splitMembers[memberID]
+	if !ok || m.SubscriptionID != subscriptionID {
+		return nil, store.ErrNotFound
+	}
+	return &m, nil
+}
+
+func (s *splitStore) AddMember(ctx context.Context, member *models.SplitMember) error {
+	defer s.lock()()
+
+	member.CreatedAt = time.Now()
+	s.data.splitMembers[member.ID] = *member
+	return nil
+}
+
+func (s *splitStore) RemoveMember(ctx context.Context, subscriptionID, memberID uuid.UUID) error {
+	defer s.lock()()
+
+	m, ok := s.data.splitMembers[memberID]
+	if !ok || m.SubscriptionID != subscriptionID {
+		return store.ErrNotFound
+	}
+	delete(s.data.splitMembers, memberID)
+	s.data.ledger = filter(s.data.ledger, func(e models.SplitLedgerEntry) bool { return e.MemberID != memberID })
+	return nil
+}
+
+func (s *splitStore) Ledger(ctx context.Context, subscriptionID uuid.UUID) ([]models.SplitLedgerEntry, error) {
+	defer s.lock()()
+
+	entries := []models.SplitLedgerEntry{}
+	for i := len(s.data.ledger) - 1; i >= 0; i-- {
+		if e := s.data.ledger[i]; e.SubscriptionID == subscriptionID {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+func (s *splitStore) RecordCharge(ctx context.Context, entry *models.SplitLedgerEntry) error {
+	defer s.lock()()
+
+	for _, e := range s.data.ledger {
+		if e.Type == "charge" && e.MemberID == entry.MemberID && e.PeriodDate.Equal(*entry.PeriodDate) {
+			return nil
+		}
+	}
+	charge := *entry
+	charge.ID = uuid.New()
+	charge.Type = "charge"
+	charge.Status = "completed"
+	charge.CreatedAt = time.Now()
+	s.data.ledger = append(s.data.ledger, charge)
+	return nil
+}
+
+func (s *splitStore) RecordSettlement(ctx context.Context, entry *models.SplitLedgerEntry) error {
+	defer s.lock()()
+
+	entry.ID = uuid.New()
+	entry.Type = "settlement"
+	entry.CreatedAt = time.Now()
+	s.data.ledger = append(s.data.ledger, *entry)
+	return nil
+}
+
+func (s *splitStore) SetSettlementStatus(ctx context.Context, reference, status string) error {
+	defer s.lock()()
+
+	for i, e := range s.data.ledger {
+		if e.Type == "settlement" && e.Status == "pending" && e.Reference != nil && *e.Reference == reference {
+			s.data.ledger[i].Status = status
+			return nil
+		}
+	}
+	return store.ErrNotFound
+}
+
+func (s *splitStore) SetSettlementReference(ctx context.Context, id uuid.UUID, reference string) error {
+	defer s.lock()()
+
+	for i, e := range s.data.ledger {
+		if e.ID == id && e.Type == "settlement" && e.Status == "pending" {
+			s.data.ledger[i].Reference = &reference
+			return nil
+		}
+	}
+	return store.ErrNotFound
+}
+
+func (s *splitStore) FailSettlement(ctx context.Context, id uuid.UUID) error {
+	defer s.lock()()
+
+	for i, e := range s.data.ledger {
+		if e.ID == id && e.Type == "settlement" && e.Status == "pending" {
+			s.data.ledger[i].Status = "failed"
+			return nil
+		}
+	}
+	return store.ErrNotFound
+}
+
+func (s *splitStore) Balances(ctx context.Context, filter store.BalanceFilter) ([]models.SplitBalance, error) {
+	defer s.lock()()
+
+	balances := []models.SplitBalance{}
+	for _, m := range s.data.splitMembers {
+		rec, ok := s.data.subscriptions[m.SubscriptionID]
+		if !ok || rec.archived || !matchesBalanceFilter(m, rec.sub, filter) {
+			continue
+		}
+		b := models.SplitBalance{
+			MemberID:         m.ID,
+			MemberName:       m.Name,
+			MemberEmail:      m.Email,
+			SubscriptionID:   rec.sub.ID,
+			SubscriptionName: rec.sub.Name,
+			OwnerID:          rec.sub.UserID,
+		}
+		for _, e := range s.data.ledger {
+			switch {
+			case e.MemberID != m.ID:
+			case e.Type == "charge":
+				b.TotalCharged += e.Amount
+			case e.Status == "completed":
+				b.TotalSettled += e.Amount
+			case e.Status == "pending":
+				b.TotalPending += e.Amount
+			}
+		}
+		b.Balance = math.Round((b.TotalCharged-b.TotalSettled)*100) / 100
+		balances = append(balances, b)
+	}
+	sort.Slice(balances, func(i, j int) bool {
+		a, b := balances[i], balances[j]
+		if a.SubscriptionName != b.SubscriptionName {
+			return a.SubscriptionName < b.SubscriptionName
+		}
+		if a.MemberName != b.MemberName {
+			return a.MemberName < b.MemberName
+		}
+		return a.MemberID.String() < b.MemberID.String()
+	})
+	return balances, nil
+}
+
+func matchesBalanceFilter(m models.SplitMember, sub models.Subscription, f store.BalanceFilter) bool {
+	switch {
+	case f.SubscriptionID != nil && sub.ID != *f.SubscriptionID:
+		return false
+	case f.MemberID != nil && m.ID != *f.MemberID:
+		return false
+	case f.OwnerID != nil && sub.UserID != *f.OwnerID:
+		return false
+	case f.MemberEmail != "" && (m.Email == nil || !strings.EqualFold(*m.Email, f.MemberEmail)):
+		return false
+	case f.NotOwnerID != nil && sub.UserID == *f.NotOwnerID:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,474 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/store"
+
+	"github.com/google/uuid"
+)
+
+type subscriptionStore struct {
+	*Store
+}
+
+func (s *subscriptionStore) List(ctx context.Context, userID uuid.UUID, q store.SubscriptionQuery) ([]models.Subscription, int, error) {
+	defer s.lock()()
+
+	matches := s.matching(userID, q)
+	total := len(matches)
+	if q.After != nil {
+		i := sort.Search(len(matches), func(i int) bool {
+			return compareToCursor(matches[i], q.Sort, q.After) > 0
+		})
+		matches = matches[i:]
+	}
+	if q.Limit > 0 && len(matches) > q.Limit {
+		matches = matches[:q.Limit]
+	}
+	return matches, total, nil
+}
+
+func (s *subscriptionStore) Each(ctx context.Context, userID uuid.UUID, q store.SubscriptionQuery, fn func(models.Subscription) error) error {
+	unlock := s.lock()
+	matches := s.matching(userID, q)
+	unlock()
+
+	for _, sub := range matches {
+		if err := fn(sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matching returns the user's live subscriptions that pass the filter, sorted, with categories filled in
+func (s *subscriptionStore) matching(userID uuid.UUID, q store.SubscriptionQuery) []models.Subscription {
+	matches := []models.Subscription{}
+	for _, rec := range s.data.subscriptions {
+		if rec.archived || rec.sub.UserID != userID {
+			continue
+		}
+		sub := s.withCategory(rec.sub)
+		if matchesFilter(sub, q.Filter) {
+			matches = append(matches, sub)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return compareSubscriptions(matches[i], matches[j], q.Sort) < 0
+	})
+	return matches
+}
+
+func (s *subscriptionStore) Get(ctx context.Context, userID, id uuid.UUID) (*models.Subscription, error) {
+	defer s.lock()()
+
+	rec, ok := s.data.subscriptions[id]
+	if !ok || rec.archived || rec.sub.UserID != userID {
+		return nil, store.ErrNotFound
+	}
+	sub := s.withCategory(rec.sub)
+	return &sub, nil
+}
+
+func (s *subscriptionStore) GetForUpdate(ctx context.Context, userID, id uuid.UUID) (*models.Subscription, error) {
+	defer s.lock()()
+
+	rec, ok := s.data.subscriptions[id]
+	if !ok || rec.archived || rec.sub.UserID != userID {
+		return nil, store.ErrNotFound
+	}
+	sub := rec.sub
+	return &sub, nil
+}
+
+func (s *subscriptionStore) Create(ctx context.Context, sub *models.Subscription) error {
+	defer s.lock()()
+
+	stored := *sub
+	stored.Category = nil
+	s.data.subscriptions[sub.ID] = subscriptionRecord{sub: stored}
+	return nil
+}
+
+func (s *subscriptionStore) Update(ctx context.Context, sub *models.Subscription) error {
+	defer s.lock()()
+
+	rec, ok := s.data.subscriptions[sub.ID]
+	if !ok || rec.archived || rec.sub.UserID != sub.UserID {
+		return store.ErrNotFound
+	}
+	if !sameDate(rec.sub.TrialEndDate, sub.TrialEndDate) {
+		rec.alertSent = false
+	}
+	rec.sub = *sub
+	rec.sub.Category = nil
+	s.data.subscriptions[sub.ID] = rec
+	return nil
+}
+
+func (s *subscriptionStore) Archive(ctx context.Context, userID, id uuid.UUID) (time.Time, error) {
+	defer s.lock()()
+
+	rec, ok := s.data.subscriptions[id]
+	if !ok || rec.archived || rec.sub.UserID != userID {
+		return time.Time{}, store.ErrNotFound
+	}
+	now := time.Now()
+	rec.archived = true
+	rec.sub.DeletedAt = &now
+	s.data.subscriptions[id] = rec
+	return now, nil
+}
+
+func (s *subscriptionStore) CountByStatus(ctx context.Context) (map[string]int, error) {
+	defer s.lock()()
+
+	counts := map[string]int{}
+	for _, rec := range s.data.subscriptions {
+		if !rec.archived {
+			counts[rec.sub.Status]++
+		}
+	}
+	return counts, nil
+}
+
+func (s *subscriptionStore) FindCategory(ctx context.Context, name string) (*models.Category, error) {
+	defer s.lock()()
+
+	for _, c := range s.data.categories {
+		if strings.EqualFold(c.Name, name) {
+			category := c
+			return &category, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *subscriptionStore) RecordPrice(ctx context.Context, change models.PriceChange) error {
+	defer s.lock()()
+
+	change.ID = uuid.New()
+	change.CreatedAt = time.Now()
+	s.data.prices = append(s.data.prices, change)
+	return nil
+}
+
+func (s *subscriptionStore) RecordAudit(ctx context.Context, entry models.SubscriptionAuditEntry) error {
+	defer s.lock()()
+
+	entry.ID = uuid.New()
+	entry.Version = 1
+	for _, e := range s.data.audit {
+		if e.SubscriptionID == entry.SubscriptionID && e.Version >= entry.Version {
+			entry.Version = e.Version + 1
+		}
+	}
+	entry.CreatedAt = time.Now()
+	s.data.audit = append(s.data.audit, entry)
+	return nil
+}
+
+func (s *subscriptionStore) ListArchived(ctx context.Context, userID uuid.UUID) ([]models.Subscription, error) {
+	defer s.lock()()
+
+	archived := []models.Subscription{}
+	for _, rec := range s.data.subscriptions {
+		if rec.archived && rec.sub.UserID == userID {
+			archived = append(archived, s.withCategory(rec.sub))
+		}
+	}
+	sort.Slice(archived, func(i, j int) bool {
+		if !archived[i].DeletedAt.Equal(*archived[j].DeletedAt) {
+			return archived[i].DeletedAt.After(*archived[j].DeletedAt)
+		}
+		return archived[i].ID.String() < archived[j].ID.String()
+	})
+	return archived, nil
+}
+
+func (s *subscriptionStore) GetArchivedForUpdate(ctx context.Context, userID, id uuid.UUID) (*models.Subscription, error) {
+	defer s.lock()()
+
+	rec, ok := s.data.subscriptions[id]
+	if !ok || !rec.archived || rec.sub.UserID != userID {
+		return nil, store.ErrNotFound
+	}
+	sub := rec.sub
+	return &sub, nil
+}
+
+func (s *subscriptionStore) Restore(ctx context.Context, userID, id uuid.UUID) error {
+	defer s.lock()()
+
+	rec, ok := s.data.subscriptions[id]
+	if !ok || !rec.archived || rec.sub.UserID != userID {
+		return store.ErrNotFound
+	}
+	rec.archived = false
+	rec.sub.DeletedAt = nil
+	s.data.subscriptions[id] = rec
+	return nil
+}
+
+// Purge also drops the purged subscriptions' price history and split members, as the database's
+// cascading deletes do. Their audit trail is kept.
+func (s *subscriptionStore) Purge(ctx context.Context, cutoff time.Time) ([]models.Subscription, error) {
+	defer s.lock()()
+
+	var purged []models.Subscription
+	for id, rec := range s.data.subscriptions {
+		if rec.archived && rec.sub.DeletedAt.Before(cutoff) {
+			purged = append(purged, rec.sub)
+			delete(s.data.subscriptions, id)
+		}
+	}
+	for _, sub := range purged {
+		s.data.prices = filter(s.data.prices, func(pc models.PriceChange) bool { return pc.SubscriptionID != sub.ID })
+		s.data.ledger = filter(s.data.ledger, func(e models.SplitLedgerEntry) bool { return e.SubscriptionID != sub.ID })
+		for memberID, m := range s.data.splitMembers {
+			if m.SubscriptionID == sub.ID {
+				delete(s.data.splitMembers, memberID)
+			}
+		}
+	}
+	return purged, nil
+}
+
+func (s *subscriptionStore) EndingTrials(ctx context.Context, date time.Time) ([]models.Subscription, error) {
+	return s.trials(func(rec subscriptionRecord) bool { return !rec.sub.TrialEndDate.After(date) }), nil
+}
+
+func (s *subscriptionStore) UnalertedTrials(ctx context.Context) ([]models.Subscription, error) {
+	return s.trials(func(rec subscriptionRecord) bool { return !rec.alertSent }), nil
+}
+
+// trials returns every user's live trials that have an end date and meet condition, by end date
+func (s *subscriptionStore) trials(condition func(subscriptionRecord) bool) []models.Subscription {
+	defer s.lock()()
+
+	var trials []models.Subscription
+	for _, rec := range s.data.subscriptions {
+		if !rec.archived && rec.sub.Status == "trial" && rec.sub.TrialEndDate != nil && condition(rec) {
+			trials = append(trials, rec.sub)
+		}
+	}
+	sort.Slice(trials, func(i, j int) bool {
+		if !trials[i].TrialEndDate.Equal(*trials[j].TrialEndDate) {
+			return trials[i].TrialEndDate.Before(*trials[j].TrialEndDate)
+		}
+		return trials[i].ID.String() < trials[j].ID.String()
+	})
+	return trials
+}
+
+func (s *subscriptionStore) MarkTrialAlerted(ctx context.Context, id uuid.UUID) error {
+	defer s.lock()()
+
+	rec, ok := s.data.subscriptions[id]
+	if !ok {
+		return store.ErrNotFound
+	}
+	rec.alertSent = true
+	s.data.subscriptions[id] = rec
+	return nil
+}
+
+func (s *subscriptionStore) Categories(ctx context.Context) ([]models.Category, error) {
+	defer s.lock()()
+
+	categories := append([]models.Category{}, s.data.categories...)
+	sort.Slice(categories, func(i, j int) bool { return categories[i].Name < categories[j].Name })
+	return categories, nil
+}
+
+func (s *subscriptionStore) PriceHistory(ctx context.Context, userID, id uuid.UUID) ([]models.PriceChange, error) {
+	defer s.lock()()
+
+	rec, ok := s.data.subscriptions[id]
+	if !ok || rec.sub.UserID != userID {
+		return nil, store.ErrNotFound
+	}
+	return s.priceChanges(func(pc models.PriceChange) bool { return pc.SubscriptionID == id }), nil
+}
+
+func (s *subscriptionStore) PriceChangesSince(ctx context.Context, userID uuid.UUID, since time.Time) ([]models.PriceChange, error) {
+	defer s.lock()()
+
+	return s.priceChanges(func(pc models.PriceChange) bool {
+		rec, ok := s.data.subscriptions[pc.SubscriptionID]
+		return ok && !rec.archived && rec.sub.UserID == userID && !pc.EffectiveDate.Before(since)
+	}), nil
+}
+
+// priceChanges returns the price changes that match, most recent first
+func (s *subscriptionStore) priceChanges(match func(models.PriceChange) bool) []models.PriceChange {
+	changes := filter(append([]models.PriceChange{}, s.data.prices...), match)
+	sort.SliceStable(changes, func(i, j int) bool {
+		if !changes[i].EffectiveDate.Equal(changes[j].EffectiveDate) {
+			return changes[i].EffectiveDate.After(changes[j].EffectiveDate)
+		}
+		return changes[i].CreatedAt.After(changes[j].CreatedAt)
+	})
+	return changes
+}
+
+func (s *subscriptionStore) History(ctx context.Context, userID, id uuid.UUID) ([]models.SubscriptionAuditEntry, error) {
+	defer s.lock()()
+
+	history := []models.SubscriptionAuditEntry{}
+	for i := len(s.data.audit) - 1; i >= 0; i-- {
+		if e := s.data.audit[i]; e.SubscriptionID == id && e.UserID == userID {
+			history = append(history, e)
+		}
+	}
+	return history, nil
+}
+
+func (s *subscriptionStore) GetVersion(ctx context.Context, userID, id uuid.UUID, version int) (*models.SubscriptionAuditEntry, error) {
+	defer s.lock()()
+
+	for _, e := range s.data.audit {
+		if e.SubscriptionID == id && e.UserID == userID && e.Version == version {
+			entry := e
+			return &entry, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *subscriptionStore) withCategory(sub models.Subscription) models.Subscription {
+	if sub.CategoryID != nil {
+		for _, c := range s.data.categories {
+			if c.ID == *sub.CategoryID {
+				category := c
+				sub.Category = &category
+			}
+		}
+	}
+	return sub
+}
+
+// matchesFilter applies a filter the way the Postgres store does, with search as a case-insensitive substring match
+func matchesFilter(sub models.Subscription, f store.SubscriptionFilter) bool {
+	if f.Search != "" {
+		search := strings.ToLower(f.Search)
+		description := ""
+		if sub.Description != nil {
+			description = *sub.Description
+		}
+		if !strings.Contains(strings.ToLower(sub.Name), search) && !strings.Contains(strings.ToLower(description), search) {
+			return false
+		}
+	}
+	if len(f.Statuses) > 0 && !contains(f.Statuses, sub.Status) {
+		return false
+	}
+	if len(f.Categories) > 0 {
+		if sub.Category == nil {
+			return false
+		}
+		found := false
+		for _, c := range f.Categories {
+			if strings.EqualFold(c, sub.Category.Name) || strings.EqualFold(c, sub.Category.ID.String()) {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(f.PaymentMethods) > 0 && (sub.PaymentMethod == nil || !contains(f.PaymentMethods, *sub.PaymentMethod)) {
+		return false
+	}
+	if len(f.BillingCycles) > 0 && !contains(f.BillingCycles, sub.BillingCycle) {
+		return false
+	}
+	if f.MinPrice != nil && sub.Price < *f.MinPrice {
+		return false
+	}
+	if f.MaxPrice != nil && sub.Price > *f.MaxPrice {
+		return false
+	}
+	if f.RenewalFrom != nil && sub.BillingDate.Before(*f.RenewalFrom) {
+		return false
+	}
+	if f.RenewalTo != nil && sub.BillingDate.After(*f.RenewalTo) {
+		return false
+	}
+	return true
+}
+
+// compareSubscriptions orders two subscriptions by the sort keys, then by ID
+func compareSubscriptions(a, b models.Subscription, keys []store.SortKey) int {
+	for _, k := range keys {
+		if c := compareValues(store.SortValue(a, k.Key), store.SortValue(b, k.Key)); c != 0 {
+			if k.Desc {
+				return -c
+			}
+			return c
+		}
+	}
+	return strings.Compare(a.ID.String(), b.ID.String())
+}
+
+// compareToCursor orders a subscription against a cursor position
+func compareToCursor(sub models.Subscription, keys []store.SortKey, cursor *store.Cursor) int {
+	for i, k := range keys {
+		if c := compareValues(store.SortValue(sub, k.Key), cursor.Values[i]); c != 0 {
+			if k.Desc {
+				return -c
+			}
+			return c
+		}
+	}
+	return strings.Compare(sub.ID.String(), cursor.ID.String())
+}
+
+func compareValues(a, b interface{}) int {
+	switch av := a.(type) {
+	case string:
+		return strings.Compare(av, b.(string))
+	case float64:
+		bv := b.(float64)
+		if av < bv {
+			return -1
+		} else if av > bv {
+			return 1
+		}
+	case time.Time:
+		return av.Compare(b.(time.Time))
+	}
+	return 0
+}
+
+// filter keeps the items that match, reusing the slice
+func filter[T any](items []T, match func(T) bool) []T {
+	kept := items[:0]
+	for _, item := range items {
+		if match(item) {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func sameDate(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
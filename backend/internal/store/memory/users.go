@@ -0,0 +1,88 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/store"
+
+	"github.com/google/uuid"
+)
+
+type userStore struct {
+	*Store
+}
+
+func (s *userStore) Create(ctx context.Context, user *models.User) error {
+	defer s.lock()()
+
+	if s.emailTaken(user.Email, uuid.Nil) {
+		return store.ErrConflict
+	}
+	user.CreatedAt = time.Now()
+	s.data.users[user.ID] = *user
+	return nil
+}
+
+func (s *userStore) Get(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	defer s.lock()()
+
+	user, ok := s.data.users[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	user.PasswordHash = ""
+	if user.Preferences == nil {
+		user.Preferences = &models.UserPreferences{}
+	}
+	return &user, nil
+}
+
+func (s *userStore) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	defer s.lock()()
+
+	for _, user := range s.data.users {
+		if user.Email == email {
+			user.Preferences = nil
+			return &user, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *userStore) Update(ctx context.Context, id uuid.UUID, changes store.UserChanges) error {
+	defer s.lock()()
+
+	user, ok := s.data.users[id]
+	if !ok {
+		return store.ErrNotFound
+	}
+	if changes.Email != nil && s.emailTaken(*changes.Email, id) {
+		return store.ErrConflict
+	}
+
+	if changes.Name != nil {
+		name := *changes.Name
+		user.Name = &name
+	}
+	if changes.Email != nil {
+		user.Email = *changes.Email
+	}
+	if changes.Preferences != nil {
+		prefs := *changes.Preferences
+		user.Preferences = &prefs
+	}
+	s.data.users[id] = user
+	return nil
+}
+
+// emailTaken reports whether another user than except has the email. Postgres compares emails exactly too.
+func (s *userStore) emailTaken(email string, except uuid.UUID) bool {
+	for id, user := range s.data.users {
+		if id != except && user.Email == email {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,233 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"subscription-tracker/internal/database"
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/store"
+
+	"github.com/google/uuid"
+)
+
+const connectionColumns = "user_id, provider, access_token, refresh_token, token_expiry"
+
+type calendarStore struct {
+	q  querier
+	db *database.DB
+}
+
+func scanConnection(row rowScanner) (*store.CalendarConnection, error) {
+	var conn store.CalendarConnection
+	if err := row.Scan(&conn.UserID, &conn.Provider, &conn.AccessToken, &conn.RefreshToken, &conn.TokenExpiry); err != nil {
+		return nil, err
+	}
+	return &conn, nil
+}
+
+func (s *calendarStore) Connections(ctx context.Context, userID uuid.UUID) ([]store.CalendarConnection, error) {
+	return s.connections(ctx, "SELECT "+connectionColumns+" FROM calendar_connections WHERE user_id = $1 ORDER BY provider", userID)
+}
+
+func (s *calendarStore) AllConnections(ctx context.Context) ([]store.CalendarConnection, error) {
+	return s.connections(ctx, "SELECT "+connectionColumns+" FROM calendar_connections ORDER BY user_id, provider")
+}
+
+func (s *calendarStore) connections(ctx context.Context, query string, args ...interface{}) ([]store.CalendarConnection, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var connections []store.CalendarConnection
+	for rows.Next() {
+		conn, err := scanConnection(rows)
+		if err != nil {
+			return nil, err
+		}
+		connections = append(connections, *conn)
+	}
+	return connections, rows.Err()
+}
+
+func (s *calendarStore) GetConnection(ctx context.Context, userID uuid.UUID, provider string) (*store.CalendarConnection, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	row := s.q.QueryRowContext(ctx,
+		"SELECT "+connectionColumns+" FROM calendar_connections WHERE user_id = $1 AND provider = $2",
+		userID, provider,
+	)
+	conn, err := scanConnection(row)
+	return conn, notFound(err)
+}
+
+func (s *calendarStore) SaveConnection(ctx context.Context, conn store.CalendarConnection) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO calendar_connections (user_id, provider, access_token, refresh_token, token_expiry)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, provider) DO UPDATE SET
+			access_token = EXCLUDED.access_token,
+			refresh_token = COALESCE(NULLIF(EXCLUDED.refresh_token, ''), calendar_connections.refresh_token),
+			token_expiry = EXCLUDED.token_expiry,
+			updated_at = NOW()`,
+		conn.UserID, conn.Provider, conn.AccessToken, conn.RefreshToken, conn.TokenExpiry,
+	)
+	return err
+}
+
+func (s *calendarStore) DeleteConnection(ctx context.Context, userID uuid.UUID, provider string) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := s.q.ExecContext(ctx, "DELETE FROM calendar_connections WHERE user_id = $1 AND provider = $2", userID, provider)
+	return err
+}
+
+func (s *calendarStore) GetEvent(ctx context.Context, subscriptionID uuid.UUID, provider string) (*store.SyncedEvent, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	var event store.SyncedEvent
+	err := s.q.QueryRowContext(ctx, `
+		SELECT subscription_id, user_id, provider, external_event_id, synced_hash, synced_at
+		FROM subscription_calendar_events
+		WHERE subscription_id = $1 AND provider = $2`, subscriptionID, provider,
+	).Scan(&event.SubscriptionID, &event.UserID, &event.Provider, &event.EventID, &event.SyncedHash, &event.SyncedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &event, nil
+}
+
+func (s *calendarStore) EventSubscriptions(ctx context.Context, userID uuid.UUID, provider string) ([]uuid.UUID, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.q.QueryContext(ctx,
+		"SELECT subscription_id FROM subscription_calendar_events WHERE user_id = $1 AND provider = $2 ORDER BY subscription_id",
+		userID, provider,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (s *calendarStore) SaveEvent(ctx context.Context, event store.SyncedEvent) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO subscription_calendar_events (subscription_id, user_id, provider, external_event_id, synced_hash, synced_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		ON CONFLICT (subscription_id, provider)
+		DO UPDATE SET external_event_id = EXCLUDED.external_event_id, synced_hash = EXCLUDED.synced_hash, synced_at = NOW()`,
+		event.SubscriptionID, event.UserID, event.Provider, event.EventID, event.SyncedHash,
+	)
+	return err
+}
+
+func (s *calendarStore) DeleteEvent(ctx context.Context, subscriptionID uuid.UUID, provider string) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := s.q.ExecContext(ctx,
+		"DELETE FROM subscription_calendar_events WHERE subscription_id = $1 AND provider = $2",
+		subscriptionID, provider,
+	)
+	return err
+}
+
+func (s *calendarStore) GetFeed(ctx context.Context, userID uuid.UUID) (*models.CalendarFeed, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	feed := models.CalendarFeed{Enabled: true}
+	err := s.q.QueryRowContext(ctx,
+		"SELECT created_at, last_accessed_at FROM calendar_feeds WHERE user_id = $1",
+		userID,
+	).Scan(&feed.CreatedAt, &feed.LastAccessedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &feed, nil
+}
+
+func (s *calendarStore) SaveFeed(ctx context.Context, userID uuid.UUID, tokenHash string) (time.Time, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	var createdAt time.Time
+	err := s.q.QueryRowContext(ctx, `
+		INSERT INTO calendar_feeds (user_id, token_hash)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET token_hash = EXCLUDED.token_hash, created_at = NOW(), last_accessed_at = NULL
+		RETURNING created_at`, userID, tokenHash,
+	).Scan(&createdAt)
+	return createdAt, err
+}
+
+func (s *calendarStore) DeleteFeed(ctx context.Context, userID uuid.UUID) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	return affected(s.q.ExecContext(ctx, "DELETE FROM calendar_feeds WHERE user_id = $1", userID))
+}
+
+func (s *calendarStore) UseFeed(ctx context.Context, tokenHash string) (uuid.UUID, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	var userID uuid.UUID
+	err := s.q.QueryRowContext(ctx,
+		"UPDATE calendar_feeds SET last_accessed_at = NOW() WHERE token_hash = $1 RETURNING user_id",
+		tokenHash,
+	).Scan(&userID)
+	return userID, notFound(err)
+}
+
+func (s *calendarStore) CreateOAuthState(ctx context.Context, state store.OAuthState) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	if _, err := s.q.ExecContext(ctx, "DELETE FROM oauth_states WHERE expires_at < NOW()"); err != nil {
+		return err
+	}
+	_, err := s.q.ExecContext(ctx,
+		"INSERT INTO oauth_states (user_id, provider, nonce_hash, code_verifier, expires_at) VALUES ($1, $2, $3, $4, $5)",
+		state.UserID, state.Provider, state.NonceHash, state.CodeVerifier, state.ExpiresAt,
+	)
+	return err
+}
+
+func (s *calendarStore) ConsumeOAuthState(ctx context.Context, userID uuid.UUID, provider, nonceHash string) (string, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	var verifier string
+	err := s.q.QueryRowContext(ctx, `
+		DELETE FROM oauth_states
+		WHERE nonce_hash = $1 AND user_id = $2 AND provider = $3 AND expires_at >= NOW()
+		RETURNING code_verifier`, nonceHash, userID, provider,
+	).Scan(&verifier)
+	return verifier, notFound(err)
+}
@@ -0,0 +1,56 @@
+package postgres
+
+import (
+	"context"
+
+	"subscription-tracker/internal/database"
+	"subscription-tracker/internal/models"
+
+	"github.com/google/uuid"
+)
+
+type notificationStore struct {
+	q  querier
+	db *database.DB
+}
+
+func (s *notificationStore) List(ctx context.Context, userID uuid.UUID) ([]models.Notification, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.q.QueryContext(ctx,
+		"SELECT id, user_id, title, message, type, read, created_at FROM notifications WHERE user_id = $1 ORDER BY created_at DESC",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []models.Notification{}
+	for rows.Next() {
+		var n models.Notification
+		if err := rows.Scan(&n.ID, &n.UserID, &n.Title, &n.Message, &n.Type, &n.Read, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+func (s *notificationStore) Create(ctx context.Context, n *models.Notification) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	return s.q.QueryRowContext(ctx,
+		"INSERT INTO notifications (id, user_id, title, message, type) VALUES ($1, $2, $3, $4, $5) RETURNING read, created_at",
+		n.ID, n.UserID, n.Title, n.Message, n.Type,
+	).Scan(&n.Read, &n.CreatedAt)
+}
+
+func (s *notificationStore) MarkRead(ctx context.Context, userID, id uuid.UUID) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	return affected(s.q.ExecContext(ctx, "UPDATE notifications SET read = true WHERE id = $1 AND user_id = $2", id, userID))
+}
@@ -0,0 +1,74 @@
+package postgres
+
+import (
+	"context"
+
+	"subscription-tracker/internal/database"
+	"subscription-tracker/internal/models"
+
+	"github.com/google/uuid"
+)
+
+const paymentMethodColumns = `id, user_id, type, last4, brand, phone_number, account_email,
+		        last_balance_check, balance_cents, currency, is_default, created_at`
+
+type paymentStore struct {
+	q  querier
+	db *database.DB
+}
+
+func scanPaymentMethod(row rowScanner) (*models.PaymentMethod, error) {
+	var pm models.PaymentMethod
+	err := row.Scan(&pm.ID, &pm.UserID, &pm.Type, &pm.Last4, &pm.Brand,
+		&pm.PhoneNumber, &pm.AccountEmail, &pm.LastBalanceCheck,
+		&pm.BalanceCents, &pm.Currency, &pm.IsDefault, &pm.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &pm, nil
+}
+
+func (s *paymentStore) List(ctx context.Context, userID uuid.UUID) ([]models.PaymentMethod, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.q.QueryContext(ctx,
+		`SELECT `+paymentMethodColumns+`
+		 FROM payment_methods WHERE user_id = $1 ORDER BY is_default DESC, created_at DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	paymentMethods := []models.PaymentMethod{}
+	for rows.Next() {
+		pm, err := scanPaymentMethod(rows)
+		if err != nil {
+			return nil, err
+		}
+		paymentMethods = append(paymentMethods, *pm)
+	}
+	return paymentMethods, rows.Err()
+}
+
+func (s *paymentStore) Create(ctx context.Context, pm *models.PaymentMethod, apiKeyEncrypted *string) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	return s.q.QueryRowContext(ctx,
+		`INSERT INTO payment_methods (id, user_id, type, last4, brand, phone_number, account_email, api_key_encrypted, currency)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		 RETURNING balance_cents, is_default, created_at`,
+		pm.ID, pm.UserID, pm.Type, pm.Last4, pm.Brand,
+		pm.PhoneNumber, pm.AccountEmail, apiKeyEncrypted, pm.Currency,
+	).Scan(&pm.BalanceCents, &pm.IsDefault, &pm.CreatedAt)
+}
+
+func (s *paymentStore) Delete(ctx context.Context, userID, id uuid.UUID) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	return affected(s.q.ExecContext(ctx, "DELETE FROM payment_methods WHERE id = $1 AND user_id = $2", id, userID))
+}
@@ -0,0 +1,77 @@
+// Package postgres implements the stores on PostgreSQL
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"subscription-tracker/internal/database"
+	"subscription-tracker/internal/store"
+)
+
+// querier is satisfied by both *database.DB and *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Store runs queries on the database, or on a transaction inside WithTx.
+// Each query is bounded by the database's query timeout as well as the caller's context.
+type Store struct {
+	db *database.DB
+	q  querier
+	tx bool
+}
+
+func New(db *database.DB) *Store {
+	return &Store{db: db, q: db}
+}
+
+func (s *Store) Subscriptions() store.SubscriptionStore { return &subscriptionStore{q: s.q, db: s.db} }
+func (s *Store) Users() store.UserStore                 { return &userStore{q: s.q, db: s.db} }
+func (s *Store) Payments() store.PaymentStore           { return &paymentStore{q: s.q, db: s.db} }
+func (s *Store) Notifications() store.NotificationStore { return &notificationStore{q: s.q, db: s.db} }
+func (s *Store) Budgets() store.BudgetStore             { return &budgetStore{q: s.q, db: s.db} }
+func (s *Store) Splits() store.SplitStore               { return &splitStore{q: s.q, db: s.db} }
+func (s *Store) Calendars() store.CalendarStore         { return &calendarStore{q: s.q, db: s.db} }
+
+func (s *Store) WithTx(ctx context.Context, fn func(tx store.Store) error) error {
+	if s.tx {
+		return fn(s)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(&Store{db: s.db, q: tx, tx: true}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// notFound maps sql.ErrNoRows to store.ErrNotFound
+func notFound(err error) error {
+	if err == sql.ErrNoRows {
+		return store.ErrNotFound
+	}
+	return err
+}
+
+// affected returns store.ErrNotFound when an update or delete matched no rows
+func affected(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package postgres
+
+import (
+	"os"
+	"testing"
+
+	"subscription-tracker/internal/database"
+	"subscription-tracker/internal/store"
+	"subscription-tracker/internal/store/storetest"
+	"subscription-tracker/migrations"
+)
+
+// TestStore runs against the database in TEST_DATABASE_URL, which it migrates and leaves its data in
+func TestStore(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	db, err := database.Connect(url, database.PoolConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	migrator, err := database.NewMigrator(db, migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	st := New(db)
+	storetest.Run(t, func(t *testing.T) store.Store { return st })
+}
@@ -0,0 +1,241 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"subscription-tracker/internal/database"
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/store"
+
+	"github.com/google/uuid"
+)
+
+const splitMemberColumns = "id, subscription_id, name, email, phone_number, share_percent, created_at"
+
+const ledgerColumns = "id, subscription_id, member_id, type, amount, period_date, method, status, reference, created_at"
+
+type splitStore struct {
+	q  querier
+	db *database.DB
+}
+
+func scanSplitMember(row rowScanner) (*models.SplitMember, error) {
+	var m models.SplitMember
+	err := row.Scan(&m.ID, &m.SubscriptionID, &m.Name, &m.Email, &m.PhoneNumber, &m.SharePercent, &m.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func scanLedgerEntry(row rowScanner) (*models.SplitLedgerEntry, error) {
+	var e models.SplitLedgerEntry
+	err := row.Scan(&e.ID, &e.SubscriptionID, &e.MemberID, &e.Type, &e.Amount, &e.PeriodDate,
+		&e.Method, &e.Status, &e.Reference, &e.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (s *splitStore) Members(ctx context.Context, subscriptionID uuid.UUID) ([]models.SplitMember, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT `+splitMemberColumns+`
+		FROM subscription_split_members
+		WHERE subscription_id = $1
+		ORDER BY created_at ASC, id`, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []models.SplitMember{}
+	for rows.Next() {
+		m, err := scanSplitMember(rows)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, *m)
+	}
+	return members, rows.Err()
+}
+
+func (s *splitStore) GetMemberForUpdate(ctx context.Context, subscriptionID, memberID uuid.UUID) (*models.SplitMember, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	row := s.q.QueryRowContext(ctx, `
+		SELECT `+splitMemberColumns+`
+		FROM subscription_split_members
+		WHERE id = $1 AND subscription_id = $2
+		FOR UPDATE`, memberID, subscriptionID)
+	m, err := scanSplitMember(row)
+	return m, notFound(err)
+}
+
+func (s *splitStore) AddMember(ctx context.Context, member *models.SplitMember) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	return s.q.QueryRowContext(ctx, `
+		INSERT INTO subscription_split_members (id, subscription_id, name, email, phone_number, share_percent)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING created_at`,
+		member.ID, member.SubscriptionID, member.Name, member.Email, member.PhoneNumber, member.SharePercent,
+	).Scan(&member.CreatedAt)
+}
+
+func (s *splitStore) RemoveMember(ctx context.Context, subscriptionID, memberID uuid.UUID) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	return affected(s.q.ExecContext(ctx,
+		"DELETE FROM subscription_split_members WHERE id = $1 AND subscription_id = $2",
+		memberID, subscriptionID,
+	))
+}
+
+func (s *splitStore) Ledger(ctx context.Context, subscriptionID uuid.UUID) ([]models.SplitLedgerEntry, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT `+ledgerColumns+`
+		FROM split_ledger_entries
+		WHERE subscription_id = $1
+		ORDER BY created_at DESC, period_date DESC, id`, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.SplitLedgerEntry{}
+	for rows.Next() {
+		e, err := scanLedgerEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *e)
+	}
+	return entries, rows.Err()
+}
+
+func (s *splitStore) RecordCharge(ctx context.Context, entry *models.SplitLedgerEntry) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO split_ledger_entries (id, subscription_id, member_id, type, amount, period_date)
+		VALUES ($1, $2, $3, 'charge', $4, $5)
+		ON CONFLICT (member_id, period_date) WHERE type = 'charge' DO NOTHING`,
+		uuid.New(), entry.SubscriptionID, entry.MemberID, entry.Amount, entry.PeriodDate,
+	)
+	return err
+}
+
+func (s *splitStore) RecordSettlement(ctx context.Context, entry *models.SplitLedgerEntry) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	entry.ID = uuid.New()
+	entry.Type = "settlement"
+	return s.q.QueryRowContext(ctx, `
+		INSERT INTO split_ledger_entries (id, subscription_id, member_id, type, amount, method, status, reference)
+		VALUES ($1, $2, $3, 'settlement', $4, $5, $6, $7)
+		RETURNING created_at`,
+		entry.ID, entry.SubscriptionID, entry.MemberID, entry.Amount, entry.Method, entry.Status, entry.Reference,
+	).Scan(&entry.CreatedAt)
+}
+
+func (s *splitStore) SetSettlementStatus(ctx context.Context, reference, status string) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	return affected(s.q.ExecContext(ctx,
+		"UPDATE split_ledger_entries SET status = $1 WHERE reference = $2 AND type = 'settlement' AND status = 'pending'",
+		status, reference,
+	))
+}
+
+func (s *splitStore) SetSettlementReference(ctx context.Context, id uuid.UUID, reference string) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	return affected(s.q.ExecContext(ctx,
+		"UPDATE split_ledger_entries SET reference = $1 WHERE id = $2 AND type = 'settlement' AND status = 'pending'",
+		reference, id,
+	))
+}
+
+func (s *splitStore) FailSettlement(ctx context.Context, id uuid.UUID) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	return affected(s.q.ExecContext(ctx,
+		"UPDATE split_ledger_entries SET status = 'failed' WHERE id = $1 AND type = 'settlement' AND status = 'pending'",
+		id,
+	))
+}
+
+func (s *splitStore) Balances(ctx context.Context, filter store.BalanceFilter) ([]models.SplitBalance, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	conditions := []string{"s.deleted_at IS NULL"}
+	if filter.SubscriptionID != nil {
+		conditions = append(conditions, "s.id = "+arg(*filter.SubscriptionID))
+	}
+	if filter.MemberID != nil {
+		conditions = append(conditions, "m.id = "+arg(*filter.MemberID))
+	}
+	if filter.OwnerID != nil {
+		conditions = append(conditions, "s.user_id = "+arg(*filter.OwnerID))
+	}
+	if filter.MemberEmail != "" {
+		conditions = append(conditions, "LOWER(m.email) = LOWER("+arg(filter.MemberEmail)+")")
+	}
+	if filter.NotOwnerID != nil {
+		conditions = append(conditions, "s.user_id <> "+arg(*filter.NotOwnerID))
+	}
+
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT m.id, m.name, m.email, s.id, s.name, s.user_id,
+		       COALESCE(SUM(e.amount) FILTER (WHERE e.type = 'charge'), 0),
+		       COALESCE(SUM(e.amount) FILTER (WHERE e.type = 'settlement' AND e.status = 'completed'), 0),
+		       COALESCE(SUM(e.amount) FILTER (WHERE e.type = 'settlement' AND e.status = 'pending'), 0)
+		FROM subscription_split_members m
+		JOIN subscriptions s ON s.id = m.subscription_id
+		LEFT JOIN split_ledger_entries e ON e.member_id = m.id
+		WHERE `+strings.Join(conditions, " AND ")+`
+		GROUP BY m.id, s.id
+		ORDER BY s.name, m.name, m.id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	balances := []models.SplitBalance{}
+	for rows.Next() {
+		var b models.SplitBalance
+		err := rows.Scan(&b.MemberID, &b.MemberName, &b.MemberEmail, &b.SubscriptionID, &b.SubscriptionName,
+			&b.OwnerID, &b.TotalCharged, &b.TotalSettled, &b.TotalPending)
+		if err != nil {
+			return nil, err
+		}
+		b.Balance = math.Round((b.TotalCharged-b.TotalSettled)*100) / 100
+		balances = append(balances, b)
+	}
+	return balances, rows.Err()
+}
@@ -0,0 +1,42 @@
+package sqlite
+
+import (
+	"context"
+
+	"subscription-tracker/internal/database"
+	"subscription-tracker/internal/models"
+
+	"github.com/google/uuid"
+)
+
+type budgetStore struct {
+	q  querier
+	db *database.DB
+}
+
+func (s *budgetStore) Current(ctx context.Context, userID uuid.UUID) (*models.Budget, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	var budget models.Budget
+	err := s.q.QueryRowContext(ctx,
+		"SELECT id, user_id, amount, period, created_at FROM budgets WHERE user_id = ?1 ORDER BY created_at DESC LIMIT 1",
+		userID,
+	).Scan(&budget.ID, &budget.UserID, &budget.Amount, &budget.Period, &budget.CreatedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &budget, nil
+}
+
+func (s *budgetStore) Create(ctx context.Context, budget *models.Budget) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	budget.CreatedAt = now()
+	_, err := s.q.ExecContext(ctx,
+		"INSERT INTO budgets (id, user_id, amount, period, created_at, updated_at) VALUES (?1, ?2, ?3, ?4, ?5, ?5)",
+		budget.ID, budget.UserID, budget.Amount, budget.Period, budget.CreatedAt,
+	)
+	return err
+}
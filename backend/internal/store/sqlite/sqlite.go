@@ -0,0 +1,119 @@
+// Package sqlite implements the stores on SQLite, for single-user and offline deployments.
+//
+// Queries use numbered ?N placeholders: SQLite numbers $N parameters in order of appearance,
+// not by N. Times are stored in UTC so that comparing them as text orders them correctly.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"subscription-tracker/internal/database"
+	"subscription-tracker/internal/store"
+)
+
+// querier is satisfied by both *database.DB and *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// utcQuerier converts time arguments to UTC before running a query
+type utcQuerier struct {
+	q querier
+}
+
+func (u utcQuerier) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return u.q.ExecContext(ctx, query, utc(args)...)
+}
+
+func (u utcQuerier) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return u.q.QueryContext(ctx, query, utc(args)...)
+}
+
+func (u utcQuerier) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return u.q.QueryRowContext(ctx, query, utc(args)...)
+}
+
+func utc(args []interface{}) []interface{} {
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case time.Time:
+			args[i] = v.UTC()
+		case *time.Time:
+			if v != nil {
+				args[i] = v.UTC()
+			}
+		}
+	}
+	return args
+}
+
+// now is the current time as it is stored
+func now() time.Time {
+	return time.Now().UTC()
+}
+
+// Store runs queries on the database, or on a transaction inside WithTx.
+// Each query is bounded by the database's query timeout as well as the caller's context.
+type Store struct {
+	db *database.DB
+	q  querier
+	tx bool
+}
+
+func New(db *database.DB) *Store {
+	return &Store{db: db, q: utcQuerier{db}}
+}
+
+func (s *Store) Subscriptions() store.SubscriptionStore { return &subscriptionStore{q: s.q, db: s.db} }
+func (s *Store) Users() store.UserStore                 { return &userStore{q: s.q, db: s.db} }
+func (s *Store) Payments() store.PaymentStore           { return &paymentStore{q: s.q, db: s.db} }
+func (s *Store) Notifications() store.NotificationStore { return &notificationStore{q: s.q, db: s.db} }
+func (s *Store) Budgets() store.BudgetStore             { return &budgetStore{q: s.q, db: s.db} }
+func (s *Store) Splits() store.SplitStore               { return &splitStore{q: s.q, db: s.db} }
+func (s *Store) Calendars() store.CalendarStore         { return &calendarStore{q: s.q, db: s.db} }
+
+// WithTx begins an immediate transaction (see database.Connect), which holds SQLite's write lock
+// throughout; that stands in for Postgres' row locks in GetForUpdate
+func (s *Store) WithTx(ctx context.Context, fn func(tx store.Store) error) error {
+	if s.tx {
+		return fn(s)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(&Store{db: s.db, q: utcQuerier{tx}, tx: true}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// notFound maps sql.ErrNoRows to store.ErrNotFound
+func notFound(err error) error {
+	if err == sql.ErrNoRows {
+		return store.ErrNotFound
+	}
+	return err
+}
+
+// affected returns store.ErrNotFound when an update or delete matched no rows
+func affected(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package sqlite
+
+import (
+	"path/filepath"
+	"testing"
+
+	"subscription-tracker/internal/database"
+	"subscription-tracker/internal/store"
+	"subscription-tracker/internal/store/storetest"
+	"subscription-tracker/migrations"
+)
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		db, err := database.Connect("sqlite://"+filepath.Join(t.TempDir(), "test.db"), database.PoolConfig{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		migrator, err := database.NewMigrator(db, migrations.SQLite)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := migrator.Up(); err != nil {
+			t.Fatal(err)
+		}
+		return New(db)
+	})
+}
@@ -0,0 +1,624 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"subscription-tracker/internal/database"
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// subscriptionColumns are the stored fields of a subscription, in the order scanSubscription reads them
+const subscriptionColumns = `s.id, s.user_id, s.name, s.price, s.billing_cycle, s.billing_date, s.category_id, s.status,
+		       s.description, s.website_url, s.created_at, s.updated_at, s.payment_method,
+		       s.trial_start_date, s.trial_end_date, s.post_trial_price`
+
+// subscriptionSelect reads subscriptions with their category
+const subscriptionSelect = `
+		SELECT ` + subscriptionColumns + `,
+		       c.id, c.name
+		FROM subscriptions s
+		LEFT JOIN categories c ON s.category_id = c.id`
+
+// sortColumns maps store.SubscriptionSortKeys to their (non-nullable) columns
+var sortColumns = map[string]string{
+	"name":          "s.name",
+	"price":         "s.price",
+	"billing_date":  "s.billing_date",
+	"billing_cycle": "s.billing_cycle",
+	"status":        "s.status",
+	"created_at":    "s.created_at",
+	"updated_at":    "s.updated_at",
+}
+
+type subscriptionStore struct {
+	q  querier
+	db *database.DB
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanSubscription reads subscriptionColumns, then s.deleted_at when archived is set, then c.id and c.name
+// when withCategory is
+func scanSubscription(row rowScanner, withCategory, archived bool) (*models.Subscription, error) {
+	var sub models.Subscription
+	dest := []interface{}{
+		&sub.ID, &sub.UserID, &sub.Name, &sub.Price, &sub.BillingCycle, &sub.BillingDate,
+		&sub.CategoryID, &sub.Status, &sub.Description, &sub.WebsiteURL, &sub.CreatedAt, &sub.UpdatedAt, &sub.PaymentMethod,
+		&sub.TrialStartDate, &sub.TrialEndDate, &sub.PostTrialPrice,
+	}
+	if archived {
+		dest = append(dest, &sub.DeletedAt)
+	}
+	var categoryID uuid.NullUUID
+	var categoryName sql.NullString
+	if withCategory {
+		dest = append(dest, &categoryID, &categoryName)
+	}
+
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	if categoryID.Valid {
+		sub.Category = &models.Category{ID: categoryID.UUID, Name: categoryName.String}
+	}
+	return &sub, nil
+}
+
+func (s *subscriptionStore) List(ctx context.Context, userID uuid.UUID, q store.SubscriptionQuery) ([]models.Subscription, int, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	args := []interface{}{}
+	where := filterWhere(q.Filter, userID, &args)
+
+	// Total matching subscriptions, regardless of page
+	var total int
+	err := s.q.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM subscriptions s
+		LEFT JOIN categories c ON s.category_id = c.id`+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if q.After != nil {
+		where += after(q, &args)
+	}
+	query := subscriptionSelect + where + orderBy(q.Sort)
+	if q.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", q.Limit)
+	}
+
+	subscriptions := []models.Subscription{}
+	err = s.each(ctx, query, args, func(sub models.Subscription) error {
+		subscriptions = append(subscriptions, sub)
+		return nil
+	})
+	return subscriptions, total, err
+}
+
+func (s *subscriptionStore) Each(ctx context.Context, userID uuid.UUID, q store.SubscriptionQuery, fn func(models.Subscription) error) error {
+	args := []interface{}{}
+	query := subscriptionSelect + filterWhere(q.Filter, userID, &args) + orderBy(q.Sort)
+	return s.each(ctx, query, args, fn)
+}
+
+func (s *subscriptionStore) each(ctx context.Context, query string, args []interface{}, fn func(models.Subscription) error) error {
+	rows, err := s.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		sub, err := scanSubscription(rows, true, false)
+		if err != nil {
+			return err
+		}
+		if err := fn(*sub); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *subscriptionStore) Get(ctx context.Context, userID, id uuid.UUID) (*models.Subscription, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	row := s.q.QueryRowContext(ctx, subscriptionSelect+`
+		WHERE s.id = ?1 AND s.user_id = ?2 AND s.deleted_at IS NULL`, id, userID)
+	sub, err := scanSubscription(row, true, false)
+	return sub, notFound(err)
+}
+
+// GetForUpdate needs no row lock: inside WithTx the transaction already holds the database's write lock
+func (s *subscriptionStore) GetForUpdate(ctx context.Context, userID, id uuid.UUID) (*models.Subscription, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	row := s.q.QueryRowContext(ctx, `
+		SELECT `+subscriptionColumns+`
+		FROM subscriptions s
+		WHERE s.id = ?1 AND s.user_id = ?2 AND s.deleted_at IS NULL`, id, userID)
+	sub, err := scanSubscription(row, false, false)
+	return sub, notFound(err)
+}
+
+func (s *subscriptionStore) Create(ctx context.Context, sub *models.Subscription) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO subscriptions (id, user_id, name, price, billing_cycle, billing_date, category_id, status, payment_method, description, website_url,
+		                           trial_start_date, trial_end_date, post_trial_price, created_at, updated_at)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9, ?10, ?11, ?12, ?13, ?14, ?15, ?16)
+	`, sub.ID, sub.UserID, sub.Name, sub.Price, sub.BillingCycle, sub.BillingDate, sub.CategoryID, sub.Status, sub.PaymentMethod, sub.Description, sub.WebsiteURL,
+		sub.TrialStartDate, sub.TrialEndDate, sub.PostTrialPrice, sub.CreatedAt, sub.UpdatedAt)
+	return err
+}
+
+func (s *subscriptionStore) Update(ctx context.Context, sub *models.Subscription) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	return affected(s.q.ExecContext(ctx, `
+		UPDATE subscriptions
+		SET name = ?1, price = ?2, billing_cycle = ?3, billing_date = ?4, category_id = ?5, status = ?6,
+		    payment_method = ?7, description = ?8, website_url = ?9,
+		    trial_start_date = ?10, trial_end_date = ?11, post_trial_price = ?12, updated_at = ?13,
+		    trial_alert_sent_at = CASE WHEN trial_end_date IS NOT ?11 THEN NULL ELSE trial_alert_sent_at END
+		WHERE id = ?14 AND user_id = ?15 AND deleted_at IS NULL
+	`, sub.Name, sub.Price, sub.BillingCycle, sub.BillingDate, sub.CategoryID, sub.Status,
+		sub.PaymentMethod, sub.Description, sub.WebsiteURL,
+		sub.TrialStartDate, sub.TrialEndDate, sub.PostTrialPrice, sub.UpdatedAt,
+		sub.ID, sub.UserID))
+}
+
+func (s *subscriptionStore) Archive(ctx context.Context, userID, id uuid.UUID) (time.Time, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	deletedAt := now()
+	err := affected(s.q.ExecContext(ctx,
+		"UPDATE subscriptions SET deleted_at = ?1 WHERE id = ?2 AND user_id = ?3 AND deleted_at IS NULL",
+		deletedAt, id, userID,
+	))
+	return deletedAt, err
+}
+
+func (s *subscriptionStore) CountByStatus(ctx context.Context) (map[string]int, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.q.QueryContext(ctx, "SELECT status, COUNT(*) FROM subscriptions WHERE deleted_at IS NULL GROUP BY status")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		counts[status] = count
+	}
+	return counts, rows.Err()
+}
+
+func (s *subscriptionStore) FindCategory(ctx context.Context, name string) (*models.Category, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	var category models.Category
+	err := s.q.QueryRowContext(ctx, "SELECT id, name FROM categories WHERE LOWER(name) = LOWER(?1)", name).Scan(&category.ID, &category.Name)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &category, nil
+}
+
+func (s *subscriptionStore) RecordPrice(ctx context.Context, change models.PriceChange) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO subscription_price_history (id, subscription_id, price, previous_price, effective_date, source, created_at)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7)
+	`, uuid.New(), change.SubscriptionID, change.Price, change.PreviousPrice, change.EffectiveDate, change.Source, now())
+	return err
+}
+
+func (s *subscriptionStore) RecordAudit(ctx context.Context, entry models.SubscriptionAuditEntry) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	changesJSON, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return fmt.Errorf("failed to marshal changes: %w", err)
+	}
+	snapshotJSON, err := json.Marshal(entry.Snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to marshal snapshot: %w", err)
+	}
+
+	_, err = s.q.ExecContext(ctx, `
+		INSERT INTO subscription_audit_log (id, subscription_id, user_id, actor_id, action, version, changes, snapshot, created_at)
+		VALUES (?1, ?2, ?3, ?4, ?5,
+		        (SELECT COALESCE(MAX(version), 0) + 1 FROM subscription_audit_log WHERE subscription_id = ?2),
+		        ?6, ?7, ?8)
+	`, uuid.New(), entry.SubscriptionID, entry.UserID, entry.ActorID, entry.Action, string(changesJSON), string(snapshotJSON), now())
+	return err
+}
+
+func (s *subscriptionStore) ListArchived(ctx context.Context, userID uuid.UUID) ([]models.Subscription, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT `+subscriptionColumns+`, s.deleted_at,
+		       c.id, c.name
+		FROM subscriptions s
+		LEFT JOIN categories c ON s.category_id = c.id
+		WHERE s.user_id = ?1 AND s.deleted_at IS NOT NULL
+		ORDER BY s.deleted_at DESC, s.id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subscriptions := []models.Subscription{}
+	for rows.Next() {
+		sub, err := scanSubscription(rows, true, true)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, *sub)
+	}
+	return subscriptions, rows.Err()
+}
+
+// GetArchivedForUpdate needs no row lock, as with GetForUpdate
+func (s *subscriptionStore) GetArchivedForUpdate(ctx context.Context, userID, id uuid.UUID) (*models.Subscription, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	row := s.q.QueryRowContext(ctx, `
+		SELECT `+subscriptionColumns+`, s.deleted_at
+		FROM subscriptions s
+		WHERE s.id = ?1 AND s.user_id = ?2 AND s.deleted_at IS NOT NULL`, id, userID)
+	sub, err := scanSubscription(row, false, true)
+	return sub, notFound(err)
+}
+
+func (s *subscriptionStore) Restore(ctx context.Context, userID, id uuid.UUID) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	return affected(s.q.ExecContext(ctx,
+		"UPDATE subscriptions SET deleted_at = NULL WHERE id = ?1 AND user_id = ?2 AND deleted_at IS NOT NULL",
+		id, userID,
+	))
+}
+
+func (s *subscriptionStore) Purge(ctx context.Context, cutoff time.Time) ([]models.Subscription, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	// RETURNING can't name the table in SQLite, so it takes the columns without their s. prefix
+	rows, err := s.q.QueryContext(ctx, `
+		DELETE FROM subscriptions
+		WHERE deleted_at IS NOT NULL AND deleted_at < ?1
+		RETURNING `+strings.ReplaceAll(subscriptionColumns, "s.", "")+`, deleted_at`, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var purged []models.Subscription
+	for rows.Next() {
+		sub, err := scanSubscription(rows, false, true)
+		if err != nil {
+			return nil, err
+		}
+		purged = append(purged, *sub)
+	}
+	return purged, rows.Err()
+}
+
+func (s *subscriptionStore) EndingTrials(ctx context.Context, date time.Time) ([]models.Subscription, error) {
+	return s.trials(ctx, "s.trial_end_date <= ?1", date)
+}
+
+func (s *subscriptionStore) UnalertedTrials(ctx context.Context) ([]models.Subscription, error) {
+	return s.trials(ctx, "s.trial_alert_sent_at IS NULL")
+}
+
+// trials reads every user's live trials that have an end date and meet condition
+func (s *subscriptionStore) trials(ctx context.Context, condition string, args ...interface{}) ([]models.Subscription, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT `+subscriptionColumns+`
+		FROM subscriptions s
+		WHERE s.status = 'trial' AND s.deleted_at IS NULL AND s.trial_end_date IS NOT NULL AND `+condition+`
+		ORDER BY s.trial_end_date, s.id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var trials []models.Subscription
+	for rows.Next() {
+		sub, err := scanSubscription(rows, false, false)
+		if err != nil {
+			return nil, err
+		}
+		trials = append(trials, *sub)
+	}
+	return trials, rows.Err()
+}
+
+func (s *subscriptionStore) MarkTrialAlerted(ctx context.Context, id uuid.UUID) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	return affected(s.q.ExecContext(ctx, "UPDATE subscriptions SET trial_alert_sent_at = ?1 WHERE id = ?2", now(), id))
+}
+
+func (s *subscriptionStore) Categories(ctx context.Context) ([]models.Category, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.q.QueryContext(ctx, "SELECT id, name FROM categories ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []models.Category{}
+	for rows.Next() {
+		var c models.Category
+		if err := rows.Scan(&c.ID, &c.Name); err != nil {
+			return nil, err
+		}
+		categories = append(categories, c)
+	}
+	return categories, rows.Err()
+}
+
+func (s *subscriptionStore) PriceHistory(ctx context.Context, userID, id uuid.UUID) ([]models.PriceChange, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	var owned bool
+	err := s.q.QueryRowContext(ctx,
+		"SELECT EXISTS(SELECT 1 FROM subscriptions WHERE id = ?1 AND user_id = ?2)",
+		id, userID,
+	).Scan(&owned)
+	if err != nil {
+		return nil, err
+	}
+	if !owned {
+		return nil, store.ErrNotFound
+	}
+
+	return s.priceChanges(ctx, `
+		SELECT ph.id, ph.subscription_id, ph.price, ph.previous_price, ph.effective_date, ph.source, ph.created_at
+		FROM subscription_price_history ph
+		WHERE ph.subscription_id = ?1
+		ORDER BY ph.effective_date DESC, ph.created_at DESC`, id)
+}
+
+func (s *subscriptionStore) PriceChangesSince(ctx context.Context, userID uuid.UUID, since time.Time) ([]models.PriceChange, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	return s.priceChanges(ctx, `
+		SELECT ph.id, ph.subscription_id, ph.price, ph.previous_price, ph.effective_date, ph.source, ph.created_at
+		FROM subscription_price_history ph
+		JOIN subscriptions s ON s.id = ph.subscription_id
+		WHERE s.user_id = ?1 AND s.deleted_at IS NULL AND ph.effective_date >= ?2
+		ORDER BY ph.effective_date DESC, ph.created_at DESC`, userID, since)
+}
+
+func (s *subscriptionStore) priceChanges(ctx context.Context, query string, args ...interface{}) ([]models.PriceChange, error) {
+	rows, err := s.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []models.PriceChange{}
+	for rows.Next() {
+		var pc models.PriceChange
+		if err := rows.Scan(&pc.ID, &pc.SubscriptionID, &pc.Price, &pc.PreviousPrice, &pc.EffectiveDate, &pc.Source, &pc.CreatedAt); err != nil {
+			return nil, err
+		}
+		changes = append(changes, pc)
+	}
+	return changes, rows.Err()
+}
+
+// auditColumns are the columns of an audit entry, in the order scanAuditEntry reads them
+const auditColumns = "id, subscription_id, user_id, actor_id, action, version, changes, snapshot, created_at"
+
+func scanAuditEntry(row rowScanner) (*models.SubscriptionAuditEntry, error) {
+	var entry models.SubscriptionAuditEntry
+	var changesJSON, snapshotJSON []byte
+	err := row.Scan(&entry.ID, &entry.SubscriptionID, &entry.UserID, &entry.ActorID, &entry.Action,
+		&entry.Version, &changesJSON, &snapshotJSON, &entry.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(changesJSON, &entry.Changes); err != nil {
+		return nil, fmt.Errorf("failed to parse changes: %w", err)
+	}
+	if err := json.Unmarshal(snapshotJSON, &entry.Snapshot); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot: %w", err)
+	}
+	return &entry, nil
+}
+
+func (s *subscriptionStore) History(ctx context.Context, userID, id uuid.UUID) ([]models.SubscriptionAuditEntry, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT `+auditColumns+`
+		FROM subscription_audit_log
+		WHERE subscription_id = ?1 AND user_id = ?2
+		ORDER BY version DESC`, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []models.SubscriptionAuditEntry{}
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, *entry)
+	}
+	return history, rows.Err()
+}
+
+func (s *subscriptionStore) GetVersion(ctx context.Context, userID, id uuid.UUID, version int) (*models.SubscriptionAuditEntry, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	row := s.q.QueryRowContext(ctx, `
+		SELECT `+auditColumns+`
+		FROM subscription_audit_log
+		WHERE subscription_id = ?1 AND user_id = ?2 AND version = ?3`, id, userID, version)
+	entry, err := scanAuditEntry(row)
+	return entry, notFound(err)
+}
+
+// filterWhere appends the filter conditions for userID to args and returns the WHERE clause.
+// The query must alias subscriptions as s and categories as c.
+func filterWhere(f store.SubscriptionFilter, userID uuid.UUID, args *[]interface{}) string {
+	arg := func(v interface{}) string {
+		*args = append(*args, v)
+		return fmt.Sprintf("?%d", len(*args))
+	}
+	list := func(values []string) string {
+		placeholders := make([]string, len(values))
+		for i, v := range values {
+			placeholders[i] = arg(v)
+		}
+		return "(" + strings.Join(placeholders, ", ") + ")"
+	}
+
+	conditions := []string{"s.user_id = " + arg(userID), "s.deleted_at IS NULL"}
+
+	if f.Search != "" {
+		// LIKE ignores ASCII case in SQLite, like ILIKE on Postgres
+		conditions = append(conditions, fmt.Sprintf(
+			`(s.name LIKE %s ESCAPE '\' OR s.description LIKE %[1]s ESCAPE '\')`,
+			arg("%"+escapeLike(f.Search)+"%"),
+		))
+	}
+	if len(f.Statuses) > 0 {
+		conditions = append(conditions, "s.status IN "+list(f.Statuses))
+	}
+	if len(f.Categories) > 0 {
+		lowered := make([]string, len(f.Categories))
+		for i, c := range f.Categories {
+			lowered[i] = strings.ToLower(c)
+		}
+		values := list(lowered)
+		conditions = append(conditions, fmt.Sprintf("(LOWER(c.name) IN %s OR s.category_id IN %[1]s)", values))
+	}
+	if len(f.PaymentMethods) > 0 {
+		conditions = append(conditions, "s.payment_method IN "+list(f.PaymentMethods))
+	}
+	if len(f.BillingCycles) > 0 {
+		conditions = append(conditions, "s.billing_cycle IN "+list(f.BillingCycles))
+	}
+	if f.MinPrice != nil {
+		conditions = append(conditions, "s.price >= "+arg(*f.MinPrice))
+	}
+	if f.MaxPrice != nil {
+		conditions = append(conditions, "s.price <= "+arg(*f.MaxPrice))
+	}
+	if f.RenewalFrom != nil {
+		conditions = append(conditions, "s.billing_date >= "+arg(*f.RenewalFrom))
+	}
+	if f.RenewalTo != nil {
+		conditions = append(conditions, "s.billing_date <= "+arg(*f.RenewalTo))
+	}
+
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// orderBy returns the ORDER BY clause, with the ID as a final tiebreaker so pages are stable
+func orderBy(sort []store.SortKey) string {
+	terms := make([]string, 0, len(sort)+1)
+	for _, k := range sort {
+		dir := "ASC"
+		if k.Desc {
+			dir = "DESC"
+		}
+		terms = append(terms, sortColumns[k.Key]+" "+dir)
+	}
+	terms = append(terms, "s.id ASC")
+	return " ORDER BY " + strings.Join(terms, ", ")
+}
+
+// after returns the keyset condition selecting rows that sort after the cursor
+func after(q store.SubscriptionQuery, args *[]interface{}) string {
+	arg := func(v interface{}) string {
+		*args = append(*args, v)
+		return fmt.Sprintf("?%d", len(*args))
+	}
+
+	columns := make([]string, 0, len(q.Sort)+1)
+	ops := make([]string, 0, len(q.Sort)+1)
+	values := make([]string, 0, len(q.Sort)+1)
+	for i, k := range q.Sort {
+		columns = append(columns, sortColumns[k.Key])
+		op := ">"
+		if k.Desc {
+			op = "<"
+		}
+		ops = append(ops, op)
+		values = append(values, arg(q.After.Values[i]))
+	}
+	columns = append(columns, "s.id")
+	ops = append(ops, ">")
+	values = append(values, arg(q.After.ID))
+
+	// (a > x) OR (a = x AND b > y) OR (a = x AND b = y AND id > z)
+	var alternatives []string
+	for i := range columns {
+		var terms []string
+		for j := 0; j < i; j++ {
+			terms = append(terms, columns[j]+" = "+values[j])
+		}
+		terms = append(terms, columns[i]+" "+ops[i]+" "+values[i])
+		alternatives = append(alternatives, "("+strings.Join(terms, " AND ")+")")
+	}
+	return " AND (" + strings.Join(alternatives, " OR ") + ")"
+}
+
+// escapeLike escapes LIKE wildcards so user input matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,117 @@
+package sqlite
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"subscription-tracker/internal/database"
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/store"
+
+	"github.com/google/uuid"
+	"github.com/mattn/go-sqlite3"
+)
+
+type userStore struct {
+	q  querier
+	db *database.DB
+}
+
+func (s *userStore) Create(ctx context.Context, user *models.User) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	user.CreatedAt = now()
+	_, err := s.q.ExecContext(ctx,
+		"INSERT INTO users (id, email, password_hash, name, created_at, updated_at) VALUES (?1, ?2, ?3, ?4, ?5, ?5)",
+		user.ID, user.Email, user.PasswordHash, user.Name, user.CreatedAt,
+	)
+	if isUniqueViolation(err) {
+		return store.ErrConflict
+	}
+	return err
+}
+
+func (s *userStore) Get(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	var user models.User
+	var preferencesJSON []byte
+	err := s.q.QueryRowContext(ctx,
+		"SELECT id, email, name, COALESCE(preferences, '{}'), created_at FROM users WHERE id = ?1",
+		id,
+	).Scan(&user.ID, &user.Email, &user.Name, &preferencesJSON, &user.CreatedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	var prefs models.UserPreferences
+	if err := json.Unmarshal(preferencesJSON, &prefs); err == nil {
+		user.Preferences = &prefs
+	}
+	return &user, nil
+}
+
+func (s *userStore) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	var user models.User
+	err := s.q.QueryRowContext(ctx,
+		"SELECT id, email, password_hash, name, created_at FROM users WHERE email = ?1",
+		email,
+	).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.Name, &user.CreatedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (s *userStore) Update(ctx context.Context, id uuid.UUID, changes store.UserChanges) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	updates := []string{}
+	args := []interface{}{}
+	set := func(column string, value interface{}) {
+		args = append(args, value)
+		updates = append(updates, fmt.Sprintf("%s = ?%d", column, len(args)))
+	}
+
+	if changes.Name != nil {
+		set("name", *changes.Name)
+	}
+	if changes.Email != nil {
+		set("email", *changes.Email)
+	}
+	if changes.Preferences != nil {
+		preferencesJSON, err := json.Marshal(changes.Preferences)
+		if err != nil {
+			return fmt.Errorf("failed to marshal preferences: %w", err)
+		}
+		set("preferences", string(preferencesJSON))
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+
+	args = append(args, id)
+	err := affected(s.q.ExecContext(ctx,
+		fmt.Sprintf("UPDATE users SET %s WHERE id = ?%d", strings.Join(updates, ", "), len(args)),
+		args...,
+	))
+	if isUniqueViolation(err) {
+		return store.ErrConflict
+	}
+	return err
+}
+
+// isUniqueViolation reports whether err is SQLite rejecting a duplicate key
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
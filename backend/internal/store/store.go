@@ -0,0 +1,303 @@
+// Package store defines how handlers read and write data, independent of the database behind it.
+// The postgres package implements it for production, sqlite for single-user deployments and memory for tests.
+// Every method takes the caller's context, so work stops once a request is abandoned.
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"subscription-tracker/internal/models"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrNotFound means no record matched, or it belongs to another user
+	ErrNotFound = errors.New("not found")
+	// ErrConflict means the write would break a uniqueness rule, e.g. a second user with the same email
+	ErrConflict = errors.New("conflict")
+)
+
+// Store gives access to every store, and to transactions spanning several of them
+type Store interface {
+	Subscriptions() SubscriptionStore
+	Users() UserStore
+	Payments() PaymentStore
+	Notifications() NotificationStore
+	Budgets() BudgetStore
+	Splits() SplitStore
+	Calendars() CalendarStore
+
+	// WithTx runs fn with a Store whose writes are committed together when fn returns nil,
+	// and discarded when it returns an error or ctx ends. Calling WithTx inside fn joins the same transaction.
+	WithTx(ctx context.Context, fn func(tx Store) error) error
+}
+
+// SubscriptionStore manages a user's subscriptions along with their price history and audit trail.
+// Reads never return archived subscriptions.
+type SubscriptionStore interface {
+	// List returns a page of subscriptions matching q, with the category filled in, and how many match in total
+	List(ctx context.Context, userID uuid.UUID, q SubscriptionQuery) ([]models.Subscription, int, error)
+	// Each calls fn for every subscription matching q, in order, without holding them all in memory.
+	// q.Limit and q.After are ignored.
+	Each(ctx context.Context, userID uuid.UUID, q SubscriptionQuery, fn func(models.Subscription) error) error
+	// Get returns a subscription with its category filled in
+	Get(ctx context.Context, userID, id uuid.UUID) (*models.Subscription, error)
+	// GetForUpdate returns the stored fields of a subscription, locking it until the transaction ends
+	GetForUpdate(ctx context.Context, userID, id uuid.UUID) (*models.Subscription, error)
+	// Create stores sub as given, including its ID and timestamps
+	Create(ctx context.Context, sub *models.Subscription) error
+	// Update overwrites the stored fields of sub. Changing the trial end date re-arms the trial alert.
+	Update(ctx context.Context, sub *models.Subscription) error
+	// Archive soft-deletes a subscription and returns when it was archived
+	Archive(ctx context.Context, userID, id uuid.UUID) (time.Time, error)
+	// CountByStatus counts every user's subscriptions by status, for metrics
+	CountByStatus(ctx context.Context) (map[string]int, error)
+
+	// FindCategory looks a category up by name, ignoring case
+	FindCategory(ctx context.Context, name string) (*models.Category, error)
+	// RecordPrice appends to a subscription's price history
+	RecordPrice(ctx context.Context, change models.PriceChange) error
+	// RecordAudit appends the next version to a subscription's audit trail
+	RecordAudit(ctx context.Context, entry models.SubscriptionAuditEntry) error
+
+	// ListArchived returns the user's archived subscriptions with their category, most recently archived first
+	ListArchived(ctx context.Context, userID uuid.UUID) ([]models.Subscription, error)
+	// GetArchivedForUpdate returns the stored fields of an archived subscription, including when it was
+	// archived, locking it until the transaction ends
+	GetArchivedForUpdate(ctx context.Context, userID, id uuid.UUID) (*models.Subscription, error)
+	// Restore brings an archived subscription back
+	Restore(ctx context.Context, userID, id uuid.UUID) error
+	// Purge permanently deletes every user's subscriptions archived before cutoff and returns them as last stored
+	Purge(ctx context.Context, cutoff time.Time) ([]models.Subscription, error)
+
+	// EndingTrials returns every user's trials whose end date is on or before date
+	EndingTrials(ctx context.Context, date time.Time) ([]models.Subscription, error)
+	// UnalertedTrials returns every user's trials with an end date whose trial alert hasn't been sent
+	UnalertedTrials(ctx context.Context) ([]models.Subscription, error)
+	// MarkTrialAlerted records that a trial's alert was sent. Update re-arms it when the end date changes.
+	MarkTrialAlerted(ctx context.Context, id uuid.UUID) error
+
+	// Categories returns every category, by name
+	Categories(ctx context.Context) ([]models.Category, error)
+	// PriceHistory returns the prices of a live or archived subscription, most recent first
+	PriceHistory(ctx context.Context, userID, id uuid.UUID) ([]models.PriceChange, error)
+	// PriceChangesSince returns the price changes effective on or after since to the user's live subscriptions,
+	// most recent first
+	PriceChangesSince(ctx context.Context, userID uuid.UUID, since time.Time) ([]models.PriceChange, error)
+	// History returns the audit trail of a subscription, newest version first. It outlives the subscription.
+	History(ctx context.Context, userID, id uuid.UUID) ([]models.SubscriptionAuditEntry, error)
+	// GetVersion returns one version of a subscription's audit trail
+	GetVersion(ctx context.Context, userID, id uuid.UUID, version int) (*models.SubscriptionAuditEntry, error)
+}
+
+// UserStore manages user accounts and their preferences
+type UserStore interface {
+	// Create stores a new user, returning ErrConflict when the email is taken
+	Create(ctx context.Context, user *models.User) error
+	// Get returns a user with their preferences, without the password hash
+	Get(ctx context.Context, id uuid.UUID) (*models.User, error)
+	// GetByEmail returns a user including the password hash, for signing in
+	GetByEmail(ctx context.Context, email string) (*models.User, error)
+	// Update applies the non-nil fields of changes
+	Update(ctx context.Context, id uuid.UUID, changes UserChanges) error
+}
+
+// UserChanges are the profile fields a user can change; nil fields are left alone
+type UserChanges struct {
+	Name        *string
+	Email       *string
+	Preferences *models.UserPreferences
+}
+
+// PaymentStore manages a user's saved payment methods
+type PaymentStore interface {
+	// List returns the user's payment methods, default first, then newest first
+	List(ctx context.Context, userID uuid.UUID) ([]models.PaymentMethod, error)
+	// Create stores a payment method. The encrypted API key is stored but never read back.
+	Create(ctx context.Context, pm *models.PaymentMethod, apiKeyEncrypted *string) error
+	Delete(ctx context.Context, userID, id uuid.UUID) error
+}
+
+// NotificationStore manages in-app notifications
+type NotificationStore interface {
+	// List returns the user's notifications, newest first
+	List(ctx context.Context, userID uuid.UUID) ([]models.Notification, error)
+	Create(ctx context.Context, notification *models.Notification) error
+	MarkRead(ctx context.Context, userID, id uuid.UUID) error
+}
+
+// BudgetStore manages spending budgets. The most recently created budget is the current one.
+type BudgetStore interface {
+	Current(ctx context.Context, userID uuid.UUID) (*models.Budget, error)
+	Create(ctx context.Context, budget *models.Budget) error
+}
+
+// SplitStore manages the members sharing a subscription and the ledger of what they owe its owner.
+// It doesn't check who owns the subscription; handlers do that first.
+type SplitStore interface {
+	// Members returns a subscription's members in the order they joined
+	Members(ctx context.Context, subscriptionID uuid.UUID) ([]models.SplitMember, error)
+	// GetMemberForUpdate returns a member, locking it until the transaction ends so settlements are serialized
+	GetMemberForUpdate(ctx context.Context, subscriptionID, memberID uuid.UUID) (*models.SplitMember, error)
+	// AddMember stores a member as given, setting when they joined
+	AddMember(ctx context.Context, member *models.SplitMember) error
+	// RemoveMember deletes a member along with their ledger entries
+	RemoveMember(ctx context.Context, subscriptionID, memberID uuid.UUID) error
+
+	// Ledger returns a subscription's charges and settlements, newest first
+	Ledger(ctx context.Context, subscriptionID uuid.UUID) ([]models.SplitLedgerEntry, error)
+	// RecordCharge records a member's share for the billing date in entry.PeriodDate. A member is charged
+	// once per billing date; charging again does nothing.
+	RecordCharge(ctx context.Context, entry *models.SplitLedgerEntry) error
+	// RecordSettlement records a payment from a member, setting its ID and creation time
+	RecordSettlement(ctx context.Context, entry *models.SplitLedgerEntry) error
+	// SetSettlementStatus completes or fails the pending settlement waiting on a payment reference
+	SetSettlementStatus(ctx context.Context, reference, status string) error
+	// SetSettlementReference sets the payment reference of a pending settlement once its payment is initiated
+	SetSettlementReference(ctx context.Context, id uuid.UUID, reference string) error
+	// FailSettlement marks a pending settlement failed when its payment couldn't be initiated
+	FailSettlement(ctx context.Context, id uuid.UUID) error
+
+	// Balances returns what members of live subscriptions owe, by subscription name then member name
+	Balances(ctx context.Context, filter BalanceFilter) ([]models.SplitBalance, error)
+}
+
+// BalanceFilter selects split balances; zero fields match everything
+type BalanceFilter struct {
+	SubscriptionID *uuid.UUID
+	MemberID       *uuid.UUID
+	OwnerID        *uuid.UUID
+	MemberEmail    string     // Compared ignoring case
+	NotOwnerID     *uuid.UUID // Leaves out subscriptions this user owns
+}
+
+// CalendarStore manages connections to calendar providers, the events synced to them, iCalendar feeds
+// and the state of OAuth flows in progress
+type CalendarStore interface {
+	// Connections returns the user's connected providers, by name
+	Connections(ctx context.Context, userID uuid.UUID) ([]CalendarConnection, error)
+	// AllConnections returns every user's connected providers, for background syncs
+	AllConnections(ctx context.Context) ([]CalendarConnection, error)
+	GetConnection(ctx context.Context, userID uuid.UUID, provider string) (*CalendarConnection, error)
+	// SaveConnection stores a provider's tokens, keeping the stored refresh token when conn has none
+	SaveConnection(ctx context.Context, conn CalendarConnection) error
+	DeleteConnection(ctx context.Context, userID uuid.UUID, provider string) error
+
+	// GetEvent returns the event synced for a subscription in one provider
+	GetEvent(ctx context.Context, subscriptionID uuid.UUID, provider string) (*SyncedEvent, error)
+	// EventSubscriptions lists the subscriptions, including deleted ones, that have an event in the user's calendar
+	EventSubscriptions(ctx context.Context, userID uuid.UUID, provider string) ([]uuid.UUID, error)
+	// SaveEvent records that an event is in sync as of now
+	SaveEvent(ctx context.Context, event SyncedEvent) error
+	DeleteEvent(ctx context.Context, subscriptionID uuid.UUID, provider string) error
+
+	// GetFeed reports when the user's feed was created and last read, without its URL
+	GetFeed(ctx context.Context, userID uuid.UUID) (*models.CalendarFeed, error)
+	// SaveFeed creates the user's feed or replaces its token, and returns when it was created
+	SaveFeed(ctx context.Context, userID uuid.UUID, tokenHash string) (time.Time, error)
+	DeleteFeed(ctx context.Context, userID uuid.UUID) error
+	// UseFeed records a read of the feed with the token hash and returns whose feed it is
+	UseFeed(ctx context.Context, tokenHash string) (uuid.UUID, error)
+
+	// CreateOAuthState saves the state of a new OAuth flow, clearing out expired ones
+	CreateOAuthState(ctx context.Context, state OAuthState) error
+	// ConsumeOAuthState deletes an unexpired state so it can't be replayed, and returns its PKCE code verifier
+	ConsumeOAuthState(ctx context.Context, userID uuid.UUID, provider, nonceHash string) (string, error)
+}
+
+// CalendarConnection holds a user's tokens for one calendar provider
+type CalendarConnection struct {
+	UserID       uuid.UUID
+	Provider     string
+	AccessToken  string
+	RefreshToken string
+	TokenExpiry  *time.Time
+}
+
+// SyncedEvent links a subscription to the event created for it in one provider
+type SyncedEvent struct {
+	SubscriptionID uuid.UUID
+	UserID         uuid.UUID
+	Provider       string
+	EventID        string
+	SyncedHash     string // Hash of the event as last pushed, to skip unchanged subscriptions
+	SyncedAt       time.Time
+}
+
+// OAuthState is a calendar connect flow waiting for the provider's callback
+type OAuthState struct {
+	UserID       uuid.UUID
+	Provider     string
+	NonceHash    string
+	CodeVerifier string
+	ExpiresAt    time.Time
+}
+
+// SubscriptionFilter narrows a subscription listing; zero values match everything
+type SubscriptionFilter struct {
+	Search         string
+	Statuses       []string
+	Categories     []string // category names or IDs
+	PaymentMethods []string
+	BillingCycles  []string
+	MinPrice       *float64
+	MaxPrice       *float64
+	RenewalFrom    *time.Time
+	RenewalTo      *time.Time
+}
+
+// SortKey orders subscriptions by one of SubscriptionSortKeys
+type SortKey struct {
+	Key  string
+	Desc bool
+}
+
+// SubscriptionSortKeys are the fields subscriptions can be sorted by
+var SubscriptionSortKeys = map[string]bool{
+	"name":          true,
+	"price":         true,
+	"billing_date":  true,
+	"billing_cycle": true,
+	"status":        true,
+	"created_at":    true,
+	"updated_at":    true,
+}
+
+// SubscriptionQuery is a filtered, sorted and optionally paginated listing.
+// The ID is always the final tiebreaker, so pages are stable.
+type SubscriptionQuery struct {
+	Filter SubscriptionFilter
+	Sort   []SortKey
+	Limit  int     // 0 returns every match
+	After  *Cursor // Start after this row, for keyset pagination
+}
+
+// Cursor is the position of a row: its values for each sort key, in order, and its ID
+type Cursor struct {
+	Values []interface{} // string, float64 or time.Time, matching the sort key
+	ID     uuid.UUID
+}
+
+// SortValue returns a subscription's value for a sort key, in the form Cursor.Values holds it
+func SortValue(sub models.Subscription, key string) interface{} {
+	switch key {
+	case "name":
+		return sub.Name
+	case "price":
+		return sub.Price
+	case "billing_date":
+		return sub.BillingDate
+	case "billing_cycle":
+		return sub.BillingCycle
+	case "status":
+		return sub.Status
+	case "created_at":
+		return sub.CreatedAt
+	case "updated_at":
+		return sub.UpdatedAt
+	}
+	return nil
+}
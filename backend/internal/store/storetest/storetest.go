@@ -0,0 +1,722 @@
+// Package storetest checks that a store.Store behaves the way handlers rely on. The postgres, sqlite and memory
+// packages run the same suite, so a query that only works on one database shows up as a failing test.
+//
+// Stores may be shared between tests, e.g. one PostgreSQL database, so each test works on its own users
+// and only looks at their data in results that span every user.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"subscription-tracker/internal/models"
+	"subscription-tracker/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// Run runs the suite, calling newStore for a store to use in each test
+func Run(t *testing.T, newStore func(t *testing.T) store.Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, st store.Store)
+	}{
+		{"Transactions", testTransactions},
+		{"ArchiveAndRestore", testArchiveAndRestore},
+		{"Purge", testPurge},
+		{"Trials", testTrials},
+		{"PriceHistory", testPriceHistory},
+		{"AuditTrail", testAuditTrail},
+		{"Categories", testCategories},
+		{"Splits", testSplits},
+		{"CalendarConnections", testCalendarConnections},
+		{"CalendarEvents", testCalendarEvents},
+		{"CalendarFeeds", testCalendarFeeds},
+		{"OAuthStates", testOAuthStates},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+var ctx = context.Background()
+
+// date is midnight UTC, the way dates come back from every store
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func today() time.Time {
+	return time.Now().UTC().Truncate(24 * time.Hour)
+}
+
+func newUser(t *testing.T, st store.Store) models.User {
+	t.Helper()
+
+	user := models.User{ID: uuid.New(), Email: uuid.NewString() + "@example.com", PasswordHash: "x"}
+	if err := st.Users().Create(ctx, &user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+// newSubscription stores an active monthly subscription, after edit makes any changes to it
+func newSubscription(t *testing.T, st store.Store, userID uuid.UUID, edit func(*models.Subscription)) models.Subscription {
+	t.Helper()
+
+	now := time.Now()
+	sub := models.Subscription{
+		ID:           uuid.New(),
+		UserID:       userID,
+		Name:         "Netflix",
+		Price:        20,
+		BillingCycle: "monthly",
+		BillingDate:  today(),
+		Status:       "active",
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if edit != nil {
+		edit(&sub)
+	}
+	if err := st.Subscriptions().Create(ctx, &sub); err != nil {
+		t.Fatalf("create subscription: %v", err)
+	}
+	return sub
+}
+
+// ids picks out the subscriptions with the given IDs, so tests ignore other tests' data
+func ids(subs []models.Subscription, want ...uuid.UUID) []uuid.UUID {
+	var found []uuid.UUID
+	for _, sub := range subs {
+		for _, id := range want {
+			if sub.ID == id {
+				found = append(found, id)
+			}
+		}
+	}
+	return found
+}
+
+func wantNotFound(t *testing.T, what string, err error) {
+	t.Helper()
+	if err != store.ErrNotFound {
+		t.Errorf("%s: err = %v, want ErrNotFound", what, err)
+	}
+}
+
+func testTransactions(t *testing.T, st store.Store) {
+	user := newUser(t, st)
+
+	failed := errors.New("failed")
+	var id uuid.UUID
+	err := st.WithTx(ctx, func(tx store.Store) error {
+		id = newSubscription(t, tx, user.ID, nil).ID
+		if _, err := tx.Subscriptions().Get(ctx, user.ID, id); err != nil {
+			t.Errorf("read own write in transaction: %v", err)
+		}
+		return failed
+	})
+	if err != failed {
+		t.Fatalf("WithTx = %v, want the error from fn", err)
+	}
+	_, err = st.Subscriptions().Get(ctx, user.ID, id)
+	wantNotFound(t, "get after rollback", err)
+
+	err = st.WithTx(ctx, func(tx store.Store) error {
+		id = newSubscription(t, tx, user.ID, nil).ID
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.Subscriptions().Get(ctx, user.ID, id); err != nil {
+		t.Errorf("get after commit: %v", err)
+	}
+}
+
+func testArchiveAndRestore(t *testing.T, st store.Store) {
+	user := newUser(t, st)
+	entertainment, err := st.Subscriptions().FindCategory(ctx, "entertainment")
+	if err != nil {
+		t.Fatalf("find category: %v", err)
+	}
+	archived := newSubscription(t, st, user.ID, func(s *models.Subscription) { s.CategoryID = &entertainment.ID })
+	live := newSubscription(t, st, user.ID, nil)
+
+	deletedAt, err := st.Subscriptions().Archive(ctx, user.ID, archived.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = st.Subscriptions().Archive(ctx, user.ID, archived.ID)
+	wantNotFound(t, "archive twice", err)
+	_, err = st.Subscriptions().Get(ctx, user.ID, archived.ID)
+	wantNotFound(t, "get archived", err)
+
+	list, err := st.Subscriptions().ListArchived(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].ID != archived.ID || list[0].DeletedAt == nil || list[0].Category == nil || list[0].Category.Name != entertainment.Name {
+		t.Fatalf("archived = %+v, want the archived subscription with its category", list)
+	}
+	if list[0].DeletedAt.Sub(deletedAt).Abs() > time.Second {
+		t.Errorf("archived at %s, want %s", list[0].DeletedAt, deletedAt)
+	}
+
+	before, err := st.Subscriptions().GetArchivedForUpdate(ctx, user.ID, archived.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The undo window is measured from this DeletedAt
+	if before.DeletedAt == nil || before.DeletedAt.Sub(deletedAt).Abs() > time.Second || before.Name != archived.Name {
+		t.Errorf("archived for update = %+v, want it with when it was archived (%s)", before, deletedAt)
+	}
+	_, err = st.Subscriptions().GetArchivedForUpdate(ctx, user.ID, live.ID)
+	wantNotFound(t, "get live subscription as archived", err)
+	other := newUser(t, st)
+	_, err = st.Subscriptions().GetArchivedForUpdate(ctx, other.ID, archived.ID)
+	wantNotFound(t, "get another user's archived subscription", err)
+	wantNotFound(t, "restore another user's subscription", st.Subscriptions().Restore(ctx, other.ID, archived.ID))
+
+	if err := st.Subscriptions().Restore(ctx, user.ID, archived.ID); err != nil {
+		t.Fatal(err)
+	}
+	wantNotFound(t, "restore twice", st.Subscriptions().Restore(ctx, user.ID, archived.ID))
+	restored, err := st.Subscriptions().Get(ctx, user.ID, archived.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.DeletedAt != nil {
+		t.Errorf("restored subscription still archived at %s", restored.DeletedAt)
+	}
+}
+
+func testPurge(t *testing.T, st store.Store) {
+	user := newUser(t, st)
+	purged := newSubscription(t, st, user.ID, func(s *models.Subscription) { s.Name = "Purged" })
+	recent := newSubscription(t, st, user.ID, nil)
+	live := newSubscription(t, st, user.ID, nil)
+
+	if err := st.Subscriptions().RecordPrice(ctx, models.PriceChange{SubscriptionID: purged.ID, Price: 20, EffectiveDate: today(), Source: "initial"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Subscriptions().RecordAudit(ctx, models.SubscriptionAuditEntry{SubscriptionID: purged.ID, UserID: user.ID, Action: "create", Snapshot: &purged}); err != nil {
+		t.Fatal(err)
+	}
+	member := models.SplitMember{ID: uuid.New(), SubscriptionID: purged.ID, Name: "Sam", SharePercent: 50}
+	if err := st.Splits().AddMember(ctx, &member); err != nil {
+		t.Fatal(err)
+	}
+	period := today()
+	if err := st.Splits().RecordCharge(ctx, &models.SplitLedgerEntry{SubscriptionID: purged.ID, MemberID: member.ID, Amount: 10, PeriodDate: &period}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := st.Subscriptions().Archive(ctx, user.ID, purged.ID); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	cutoff := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	if _, err := st.Subscriptions().Archive(ctx, user.ID, recent.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := st.Subscriptions().Purge(ctx, cutoff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(removed, purged.ID, recent.ID, live.ID); len(got) != 1 || got[0] != purged.ID {
+		t.Fatalf("purged %v, want only the subscription archived before the cutoff", got)
+	}
+	for _, sub := range removed {
+		if sub.ID == purged.ID && (sub.Name != "Purged" || sub.UserID != user.ID || sub.DeletedAt == nil) {
+			t.Errorf("purged subscription = %+v, want it as last stored", sub)
+		}
+	}
+
+	_, err = st.Subscriptions().GetArchivedForUpdate(ctx, user.ID, purged.ID)
+	wantNotFound(t, "get purged subscription", err)
+	_, err = st.Subscriptions().PriceHistory(ctx, user.ID, purged.ID)
+	wantNotFound(t, "price history of purged subscription", err)
+	if members, err := st.Splits().Members(ctx, purged.ID); err != nil || len(members) != 0 {
+		t.Errorf("members of purged subscription = %+v, %v, want none", members, err)
+	}
+	if ledger, err := st.Splits().Ledger(ctx, purged.ID); err != nil || len(ledger) != 0 {
+		t.Errorf("ledger of purged subscription = %+v, %v, want none", ledger, err)
+	}
+	if history, err := st.Subscriptions().History(ctx, user.ID, purged.ID); err != nil || len(history) != 1 {
+		t.Errorf("history of purged subscription = %+v, %v, want it kept", history, err)
+	}
+	if _, err := st.Subscriptions().GetArchivedForUpdate(ctx, user.ID, recent.ID); err != nil {
+		t.Errorf("subscription archived after the cutoff: %v", err)
+	}
+}
+
+func testTrials(t *testing.T, st store.Store) {
+	user := newUser(t, st)
+	ended, later := today().AddDate(0, 0, -1), today().AddDate(0, 0, 10)
+	endedTrial := newSubscription(t, st, user.ID, func(s *models.Subscription) { s.Status = "trial"; s.TrialEndDate = &ended })
+	laterTrial := newSubscription(t, st, user.ID, func(s *models.Subscription) { s.Status = "trial"; s.TrialEndDate = &later })
+	active := newSubscription(t, st, user.ID, func(s *models.Subscription) { s.TrialEndDate = &ended })
+
+	ending, err := st.Subscriptions().EndingTrials(ctx, today())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(ending, endedTrial.ID, laterTrial.ID, active.ID); len(got) != 1 || got[0] != endedTrial.ID {
+		t.Errorf("ending trials = %v, want only the ended trial", got)
+	}
+
+	unalerted := func() []uuid.UUID {
+		t.Helper()
+		trials, err := st.Subscriptions().UnalertedTrials(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ids(trials, endedTrial.ID, laterTrial.ID, active.ID)
+	}
+	if got := unalerted(); len(got) != 2 {
+		t.Errorf("unalerted trials = %v, want both trials", got)
+	}
+
+	if err := st.Subscriptions().MarkTrialAlerted(ctx, laterTrial.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := unalerted(); len(got) != 1 || got[0] != endedTrial.ID {
+		t.Errorf("unalerted trials after alerting = %v, want only the ended trial", got)
+	}
+
+	// Editing the trial leaves the alert sent; moving its end date re-arms it
+	renamed := laterTrial
+	renamed.Name = "Renamed"
+	if err := st.Subscriptions().Update(ctx, &renamed); err != nil {
+		t.Fatal(err)
+	}
+	if got := unalerted(); len(got) != 1 {
+		t.Errorf("unalerted trials after a rename = %v, want the alert still sent", got)
+	}
+	extended := later.AddDate(0, 0, 7)
+	renamed.TrialEndDate = &extended
+	if err := st.Subscriptions().Update(ctx, &renamed); err != nil {
+		t.Fatal(err)
+	}
+	if got := unalerted(); len(got) != 2 {
+		t.Errorf("unalerted trials after extending = %v, want the alert re-armed", got)
+	}
+}
+
+func testPriceHistory(t *testing.T, st store.Store) {
+	user := newUser(t, st)
+	sub := newSubscription(t, st, user.ID, nil)
+	first, second := 10.0, 15.0
+	changes := []models.PriceChange{
+		{SubscriptionID: sub.ID, Price: first, EffectiveDate: date(2024, time.January, 5), Source: "initial"},
+		{SubscriptionID: sub.ID, Price: second, PreviousPrice: &first, EffectiveDate: date(2024, time.March, 1), Source: "manual"},
+		{SubscriptionID: sub.ID, Price: 20, PreviousPrice: &second, EffectiveDate: date(2024, time.June, 1), Source: "manual"},
+	}
+	for _, pc := range changes {
+		if err := st.Subscriptions().RecordPrice(ctx, pc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	history, err := st.Subscriptions().PriceHistory(ctx, user.ID, sub.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 3 || history[0].Price != 20 || history[2].Price != 10 || history[2].PreviousPrice != nil {
+		t.Fatalf("price history = %+v, want most recent first", history)
+	}
+	if history[0].PreviousPrice == nil || *history[0].PreviousPrice != 15 || !history[0].EffectiveDate.Equal(date(2024, time.June, 1)) {
+		t.Errorf("latest price change = %+v, want 15 to 20 on 2024-06-01", history[0])
+	}
+
+	since, err := st.Subscriptions().PriceChangesSince(ctx, user.ID, date(2024, time.March, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(since) != 2 || since[0].Price != 20 || since[1].Price != 15 {
+		t.Errorf("changes since March = %+v, want June then March", since)
+	}
+
+	other := newUser(t, st)
+	_, err = st.Subscriptions().PriceHistory(ctx, other.ID, sub.ID)
+	wantNotFound(t, "another user's price history", err)
+
+	// Archived subscriptions keep their history but drop out of the user's recent changes
+	if _, err := st.Subscriptions().Archive(ctx, user.ID, sub.ID); err != nil {
+		t.Fatal(err)
+	}
+	if history, err := st.Subscriptions().PriceHistory(ctx, user.ID, sub.ID); err != nil || len(history) != 3 {
+		t.Errorf("archived price history = %+v, %v, want all three", history, err)
+	}
+	if since, err := st.Subscriptions().PriceChangesSince(ctx, user.ID, date(2024, time.January, 1)); err != nil || len(since) != 0 {
+		t.Errorf("changes of archived subscription = %+v, %v, want none", since, err)
+	}
+}
+
+func testAuditTrail(t *testing.T, st store.Store) {
+	user := newUser(t, st)
+	sub := newSubscription(t, st, user.ID, nil)
+	updated := sub
+	updated.Name = "Netflix Premium"
+
+	entries := []models.SubscriptionAuditEntry{
+		{SubscriptionID: sub.ID, UserID: user.ID, ActorID: &user.ID, Action: "create", Snapshot: &sub},
+		{SubscriptionID: sub.ID, UserID: user.ID, Action: "update", Snapshot: &updated,
+			Changes: map[string]models.FieldChange{"name": {Old: sub.Name, New: updated.Name}}},
+	}
+	for _, e := range entries {
+		if err := st.Subscriptions().RecordAudit(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	history, err := st.Subscriptions().History(ctx, user.ID, sub.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].Version != 2 || history[1].Version != 1 {
+		t.Fatalf("history = %+v, want versions 2 then 1", history)
+	}
+	if history[0].ActorID != nil || history[1].ActorID == nil || *history[1].ActorID != user.ID {
+		t.Errorf("actors = %v and %v, want none then the user", history[0].ActorID, history[1].ActorID)
+	}
+	if change, ok := history[0].Changes["name"]; !ok || change.New != "Netflix Premium" {
+		t.Errorf("changes = %+v, want the name change", history[0].Changes)
+	}
+
+	version, err := st.Subscriptions().GetVersion(ctx, user.ID, sub.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version.Action != "create" || version.Snapshot == nil || version.Snapshot.Name != "Netflix" || version.Snapshot.Price != 20 {
+		t.Errorf("version 1 = %+v, want the create snapshot", version)
+	}
+	_, err = st.Subscriptions().GetVersion(ctx, user.ID, sub.ID, 3)
+	wantNotFound(t, "missing version", err)
+
+	other := newUser(t, st)
+	_, err = st.Subscriptions().GetVersion(ctx, other.ID, sub.ID, 1)
+	wantNotFound(t, "another user's version", err)
+	if history, err := st.Subscriptions().History(ctx, other.ID, sub.ID); err != nil || len(history) != 0 {
+		t.Errorf("another user's history = %+v, %v, want none", history, err)
+	}
+}
+
+func testCategories(t *testing.T, st store.Store) {
+	categories, err := st.Subscriptions().Categories(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(categories) == 0 {
+		t.Fatal("no categories")
+	}
+	for i := 1; i < len(categories); i++ {
+		if categories[i-1].Name > categories[i].Name {
+			t.Errorf("categories out of order: %q before %q", categories[i-1].Name, categories[i].Name)
+		}
+	}
+}
+
+func testSplits(t *testing.T, st store.Store) {
+	owner, member := newUser(t, st), newUser(t, st)
+	sub := newSubscription(t, st, owner.ID, nil)
+	splits := st.Splits()
+
+	email := member.Email
+	sam := models.SplitMember{ID: uuid.New(), SubscriptionID: sub.ID, Name: "Sam", Email: &email, SharePercent: 50}
+	if err := splits.AddMember(ctx, &sam); err != nil {
+		t.Fatal(err)
+	}
+	if sam.CreatedAt.IsZero() {
+		t.Error("AddMember didn't set CreatedAt")
+	}
+	alex := models.SplitMember{ID: uuid.New(), SubscriptionID: sub.ID, Name: "Alex", SharePercent: 25}
+	if err := splits.AddMember(ctx, &alex); err != nil {
+		t.Fatal(err)
+	}
+
+	members, err := splits.Members(ctx, sub.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 2 || members[0].ID != sam.ID || members[1].ID != alex.ID {
+		t.Fatalf("members = %+v, want Sam then Alex", members)
+	}
+	if got, err := splits.GetMemberForUpdate(ctx, sub.ID, sam.ID); err != nil || got.Name != "Sam" || got.SharePercent != 50 {
+		t.Errorf("member = %+v, %v, want Sam", got, err)
+	}
+	_, err = splits.GetMemberForUpdate(ctx, uuid.New(), sam.ID)
+	wantNotFound(t, "member of another subscription", err)
+
+	// Charges are recorded once per billing date
+	period := date(2024, time.May, 1)
+	for i := 0; i < 2; i++ {
+		if err := splits.RecordCharge(ctx, &models.SplitLedgerEntry{SubscriptionID: sub.ID, MemberID: sam.ID, Amount: 10, PeriodDate: &period}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cash, mpesa, reference := "cash", "mpesa", uuid.NewString()
+	settled := models.SplitLedgerEntry{SubscriptionID: sub.ID, MemberID: sam.ID, Amount: 3, Method: &cash, Status: "completed"}
+	if err := splits.RecordSettlement(ctx, &settled); err != nil {
+		t.Fatal(err)
+	}
+	if settled.ID == uuid.Nil || settled.Type != "settlement" || settled.CreatedAt.IsZero() {
+		t.Errorf("settlement = %+v, want its ID, type and creation time set", settled)
+	}
+	pending := models.SplitLedgerEntry{SubscriptionID: sub.ID, MemberID: sam.ID, Amount: 2, Method: &mpesa, Status: "pending", Reference: &reference}
+	if err := splits.RecordSettlement(ctx, &pending); err != nil {
+		t.Fatal(err)
+	}
+
+	ledger, err := splits.Ledger(ctx, sub.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ledger) != 3 || ledger[0].ID != pending.ID || ledger[2].Type != "charge" || ledger[2].PeriodDate == nil || !ledger[2].PeriodDate.Equal(period) {
+		t.Fatalf("ledger = %+v, want the pending settlement, the cash settlement and one charge", ledger)
+	}
+
+	balance := func(filter store.BalanceFilter) []models.SplitBalance {
+		t.Helper()
+		balances, err := splits.Balances(ctx, filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var own []models.SplitBalance
+		for _, b := range balances {
+			if b.SubscriptionID == sub.ID {
+				own = append(own, b)
+			}
+		}
+		return own
+	}
+	balances := balance(store.BalanceFilter{SubscriptionID: &sub.ID})
+	if len(balances) != 2 || balances[0].MemberName != "Alex" || balances[1].MemberName != "Sam" {
+		t.Fatalf("balances = %+v, want Alex then Sam", balances)
+	}
+	if b := balances[1]; b.TotalCharged != 10 || b.TotalSettled != 3 || b.TotalPending != 2 || b.Balance != 7 || b.OwnerID != owner.ID || b.SubscriptionName != "Netflix" {
+		t.Errorf("Sam's balance = %+v, want 10 charged, 3 settled, 2 pending, 7 owed to the owner", b)
+	}
+
+	if err := splits.SetSettlementStatus(ctx, reference, "completed"); err != nil {
+		t.Fatal(err)
+	}
+	wantNotFound(t, "complete a settlement twice", splits.SetSettlementStatus(ctx, reference, "failed"))
+	wantNotFound(t, "set the reference of a completed settlement", splits.SetSettlementReference(ctx, pending.ID, "ws_CO_2"))
+	wantNotFound(t, "fail a completed settlement", splits.FailSettlement(ctx, pending.ID))
+
+	// A settlement is recorded before its payment is initiated, then given the payment's reference or failed
+	unsent := models.SplitLedgerEntry{SubscriptionID: sub.ID, MemberID: sam.ID, Amount: 1, Method: &mpesa, Status: "pending"}
+	if err := splits.RecordSettlement(ctx, &unsent); err != nil {
+		t.Fatal(err)
+	}
+	if err := splits.SetSettlementReference(ctx, unsent.ID, "ws_CO_2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := splits.FailSettlement(ctx, unsent.ID); err != nil {
+		t.Fatal(err)
+	}
+	wantNotFound(t, "complete a failed settlement", splits.SetSettlementStatus(ctx, "ws_CO_2", "completed"))
+	if b := balance(store.BalanceFilter{SubscriptionID: &sub.ID, MemberID: &sam.ID}); len(b) != 1 || b[0].Balance != 5 || b[0].TotalPending != 0 {
+		t.Errorf("balance after the M-Pesa payment = %+v, want 5", b)
+	}
+
+	if b := balance(store.BalanceFilter{OwnerID: &owner.ID}); len(b) != 2 {
+		t.Errorf("owner's balances = %+v, want both members", b)
+	}
+	if b := balance(store.BalanceFilter{MemberEmail: strings.ToUpper(member.Email), NotOwnerID: &member.ID}); len(b) != 1 || b[0].MemberID != sam.ID {
+		t.Errorf("balances by email = %+v, want Sam's, ignoring case", b)
+	}
+	if b := balance(store.BalanceFilter{MemberEmail: member.Email, NotOwnerID: &owner.ID}); len(b) != 0 {
+		t.Errorf("balances leaving out the owner's subscriptions = %+v, want none", b)
+	}
+
+	if err := splits.RemoveMember(ctx, sub.ID, sam.ID); err != nil {
+		t.Fatal(err)
+	}
+	wantNotFound(t, "remove twice", splits.RemoveMember(ctx, sub.ID, sam.ID))
+	wantNotFound(t, "remove from another subscription", splits.RemoveMember(ctx, uuid.New(), alex.ID))
+	if ledger, err := splits.Ledger(ctx, sub.ID); err != nil || len(ledger) != 0 {
+		t.Errorf("ledger after removing Sam = %+v, %v, want empty", ledger, err)
+	}
+
+	// Archived subscriptions have no balances
+	if _, err := st.Subscriptions().Archive(ctx, owner.ID, sub.ID); err != nil {
+		t.Fatal(err)
+	}
+	if b := balance(store.BalanceFilter{OwnerID: &owner.ID}); len(b) != 0 {
+		t.Errorf("balances of an archived subscription = %+v, want none", b)
+	}
+}
+
+func testCalendarConnections(t *testing.T, st store.Store) {
+	user := newUser(t, st)
+	calendars := st.Calendars()
+
+	expiry := time.Now().Add(time.Hour)
+	conn := store.CalendarConnection{UserID: user.ID, Provider: "google", AccessToken: "a1", RefreshToken: "r1", TokenExpiry: &expiry}
+	if err := calendars.SaveConnection(ctx, conn); err != nil {
+		t.Fatal(err)
+	}
+	conn.AccessToken, conn.RefreshToken = "a2", ""
+	if err := calendars.SaveConnection(ctx, conn); err != nil {
+		t.Fatal(err)
+	}
+	if err := calendars.SaveConnection(ctx, store.CalendarConnection{UserID: user.ID, Provider: "microsoft", AccessToken: "m1", RefreshToken: "mr1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := calendars.GetConnection(ctx, user.ID, "google")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.AccessToken != "a2" || got.RefreshToken != "r1" || got.TokenExpiry == nil || got.TokenExpiry.Sub(expiry).Abs() > time.Second {
+		t.Errorf("connection = %+v, want the new access token and the stored refresh token", got)
+	}
+
+	connections, err := calendars.Connections(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(connections) != 2 || connections[0].Provider != "google" || connections[1].Provider != "microsoft" {
+		t.Errorf("connections = %+v, want google then microsoft", connections)
+	}
+	all, err := calendars.AllConnections(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	own := 0
+	for _, c := range all {
+		if c.UserID == user.ID {
+			own++
+		}
+	}
+	if own != 2 {
+		t.Errorf("all connections include %d of the user's, want 2", own)
+	}
+
+	if err := calendars.DeleteConnection(ctx, user.ID, "google"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = calendars.GetConnection(ctx, user.ID, "google")
+	wantNotFound(t, "deleted connection", err)
+}
+
+func testCalendarEvents(t *testing.T, st store.Store) {
+	user := newUser(t, st)
+	sub := newSubscription(t, st, user.ID, nil)
+	calendars := st.Calendars()
+
+	_, err := calendars.GetEvent(ctx, sub.ID, "google")
+	wantNotFound(t, "event before syncing", err)
+
+	for _, hash := range []string{"h1", "h2"} {
+		if err := calendars.SaveEvent(ctx, store.SyncedEvent{SubscriptionID: sub.ID, UserID: user.ID, Provider: "google", EventID: "e1", SyncedHash: hash}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	event, err := calendars.GetEvent(ctx, sub.ID, "google")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.EventID != "e1" || event.SyncedHash != "h2" || event.UserID != user.ID || time.Since(event.SyncedAt).Abs() > time.Minute {
+		t.Errorf("event = %+v, want e1 synced just now with the latest hash", event)
+	}
+
+	if ids, err := calendars.EventSubscriptions(ctx, user.ID, "google"); err != nil || len(ids) != 1 || ids[0] != sub.ID {
+		t.Errorf("event subscriptions = %v, %v, want the subscription", ids, err)
+	}
+	if ids, err := calendars.EventSubscriptions(ctx, user.ID, "microsoft"); err != nil || len(ids) != 0 {
+		t.Errorf("event subscriptions in another provider = %v, %v, want none", ids, err)
+	}
+
+	if err := calendars.DeleteEvent(ctx, sub.ID, "google"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = calendars.GetEvent(ctx, sub.ID, "google")
+	wantNotFound(t, "deleted event", err)
+}
+
+func testCalendarFeeds(t *testing.T, st store.Store) {
+	user := newUser(t, st)
+	calendars := st.Calendars()
+
+	_, err := calendars.GetFeed(ctx, user.ID)
+	wantNotFound(t, "feed before creating it", err)
+	wantNotFound(t, "delete missing feed", calendars.DeleteFeed(ctx, user.ID))
+
+	hash := uuid.NewString()
+	createdAt, err := calendars.SaveFeed(ctx, user.ID, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(createdAt).Abs() > time.Minute {
+		t.Errorf("feed created at %s, want now", createdAt)
+	}
+
+	owner, err := calendars.UseFeed(ctx, hash)
+	if err != nil || owner != user.ID {
+		t.Fatalf("use feed = %s, %v, want the user", owner, err)
+	}
+	feed, err := calendars.GetFeed(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !feed.Enabled || feed.CreatedAt == nil || feed.LastAccessedAt == nil {
+		t.Errorf("feed = %+v, want enabled and read", feed)
+	}
+
+	// Rotating the token stops the old one working
+	rotated := uuid.NewString()
+	if _, err := calendars.SaveFeed(ctx, user.ID, rotated); err != nil {
+		t.Fatal(err)
+	}
+	_, err = calendars.UseFeed(ctx, hash)
+	wantNotFound(t, "use rotated token", err)
+	if feed, err := calendars.GetFeed(ctx, user.ID); err != nil || feed.LastAccessedAt != nil {
+		t.Errorf("feed after rotating = %+v, %v, want it unread", feed, err)
+	}
+
+	if err := calendars.DeleteFeed(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	_, err = calendars.UseFeed(ctx, rotated)
+	wantNotFound(t, "use deleted feed", err)
+}
+
+func testOAuthStates(t *testing.T, st store.Store) {
+	user := newUser(t, st)
+	calendars := st.Calendars()
+
+	state := store.OAuthState{UserID: user.ID, Provider: "google", NonceHash: uuid.NewString(), CodeVerifier: "verifier", ExpiresAt: time.Now().Add(10 * time.Minute)}
+	if err := calendars.CreateOAuthState(ctx, state); err != nil {
+		t.Fatal(err)
+	}
+	expired := store.OAuthState{UserID: user.ID, Provider: "google", NonceHash: uuid.NewString(), CodeVerifier: "old", ExpiresAt: time.Now().Add(-time.Minute)}
+	if err := calendars.CreateOAuthState(ctx, expired); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := calendars.ConsumeOAuthState(ctx, user.ID, "microsoft", state.NonceHash)
+	wantNotFound(t, "consume for another provider", err)
+	_, err = calendars.ConsumeOAuthState(ctx, uuid.New(), "google", state.NonceHash)
+	wantNotFound(t, "consume for another user", err)
+	_, err = calendars.ConsumeOAuthState(ctx, user.ID, "google", expired.NonceHash)
+	wantNotFound(t, "consume expired state", err)
+
+	verifier, err := calendars.ConsumeOAuthState(ctx, user.ID, "google", state.NonceHash)
+	if err != nil || verifier != "verifier" {
+		t.Fatalf("consume = %q, %v, want the code verifier", verifier, err)
+	}
+	_, err = calendars.ConsumeOAuthState(ctx, user.ID, "google", state.NonceHash)
+	wantNotFound(t, "consume twice", err)
+}
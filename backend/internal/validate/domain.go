@@ -0,0 +1,111 @@
+package validate
+
+import (
+	"time"
+
+	"subscription-tracker/internal/locale"
+	"subscription-tracker/internal/models"
+)
+
+// Subscription checks a subscription as it is about to be saved, after a create request is converted or an
+// update is applied, so rules spanning several fields hold whichever of them changed. today is the user's date.
+func Subscription(sub *models.Subscription, today time.Time) Errors {
+	var errs Errors
+	if errs.required("name", sub.Name) {
+		errs.maxLength("name", sub.Name, 255)
+	}
+	errs.amount("price", sub.Price, false)
+	if errs.required("billing_cycle", sub.BillingCycle) {
+		errs.oneOf("billing_cycle", sub.BillingCycle, BillingCycles)
+	}
+	errs.date("billing_date", sub.BillingDate, today)
+	if errs.required("status", sub.Status) {
+		errs.oneOf("status", sub.Status, SubscriptionStatuses)
+	}
+	if sub.PaymentMethod != nil && *sub.PaymentMethod != "" {
+		errs.oneOf("payment_method", *sub.PaymentMethod, SubscriptionPaymentMethods)
+	}
+	if sub.WebsiteURL != nil && *sub.WebsiteURL != "" {
+		errs.maxLength("website_url", *sub.WebsiteURL, 500)
+		errs.websiteURL("website_url", *sub.WebsiteURL)
+	}
+	if sub.PostTrialPrice != nil {
+		errs.amount("post_trial_price", *sub.PostTrialPrice, false)
+	}
+
+	// Trials need an end date so they can be converted to paid subscriptions
+	if sub.Status == "trial" && sub.TrialEndDate == nil {
+		errs.add("trial_end_date", "required", "trial_end_date is required for trial subscriptions")
+	}
+	if sub.TrialStartDate != nil {
+		errs.date("trial_start_date", *sub.TrialStartDate, today)
+	}
+	if sub.TrialEndDate != nil {
+		errs.date("trial_end_date", *sub.TrialEndDate, today)
+	}
+	if sub.TrialStartDate != nil && sub.TrialEndDate != nil && sub.TrialEndDate.Before(*sub.TrialStartDate) {
+		errs.add("trial_end_date", "gtefield", "trial_end_date must be on or after trial_start_date")
+	}
+	return errs
+}
+
+// PriceEffectiveDate checks the date a price change applies from
+func PriceEffectiveDate(date time.Time, today time.Time) Errors {
+	var errs Errors
+	errs.date("price_effective_date", date, today)
+	return errs
+}
+
+// Budget checks a new budget
+func Budget(req *models.CreateBudgetRequest) Errors {
+	var errs Errors
+	errs.amount("amount", req.Amount, true)
+	errs.oneOf("period", req.Period, BudgetPeriods)
+	return errs
+}
+
+// PaymentMethod checks a new payment method, including the details its type needs
+func PaymentMethod(req *models.CreatePaymentMethodRequest) Errors {
+	var errs Errors
+	errs.oneOf("type", req.Type, PaymentMethodTypes)
+
+	switch {
+	case req.Type == "mpesa" && (req.PhoneNumber == nil || *req.PhoneNumber == ""):
+		errs.add("phone_number", "required", "phone_number is required for M-Pesa")
+	case req.PhoneNumber != nil && *req.PhoneNumber != "" && !Phone(*req.PhoneNumber):
+		errs.add("phone_number", "e164", "phone_number must be in international format, e.g. +254712345678")
+	}
+
+	switch {
+	case (req.Type == "paypal" || req.Type == "paystack") && (req.AccountEmail == nil || *req.AccountEmail == ""):
+		errs.add("account_email", "required", "account_email is required for PayPal and Paystack")
+	case req.AccountEmail != nil && *req.AccountEmail != "" && !email.MatchString(*req.AccountEmail):
+		errs.add("account_email", "email", "account_email must be a valid email address")
+	}
+
+	if req.Last4 != nil && *req.Last4 != "" && !last4.MatchString(*req.Last4) {
+		errs.add("last4", "len", "last4 must be the last 4 digits of the card")
+	}
+	if req.Brand != nil {
+		errs.maxLength("brand", *req.Brand, 50)
+	}
+	return errs
+}
+
+// Preferences checks the regional settings used to format dates and money
+func Preferences(prefs *models.UserPreferences) Errors {
+	var errs Errors
+	if prefs.Timezone != "" && !locale.ValidTimezone(prefs.Timezone) {
+		errs.add("preferences.timezone", "timezone", "preferences.timezone must be an IANA time zone, e.g. Africa/Nairobi")
+	}
+	if prefs.Locale != "" && !locale.ValidLocale(prefs.Locale) {
+		errs.add("preferences.locale", "locale", "preferences.locale must be a language tag, e.g. en-KE")
+	}
+	if prefs.Budget != nil {
+		if prefs.Budget.Currency != "" && !Currency(prefs.Budget.Currency) {
+			errs.add("preferences.budget.currency", "iso4217", "preferences.budget.currency must be a 3-letter ISO 4217 code, e.g. KES")
+		}
+		errs.amount("preferences.budget.monthly", prefs.Budget.Monthly, false)
+	}
+	return errs
+}
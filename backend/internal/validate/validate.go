@@ -0,0 +1,124 @@
+// Package validate checks requests against the rules of the domain before they reach the database, whose
+// CHECK constraints would otherwise turn a bad value into a 500. Every function reports all the problems
+// it finds as field errors, ready for a 400 response.
+package validate
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"subscription-tracker/internal/models"
+)
+
+// Allowed values, matching the CHECK constraints in migrations
+var (
+	BillingCycles              = []string{"weekly", "monthly", "yearly"}
+	SubscriptionStatuses       = []string{"active", "trial", "cancelled", "paused"}
+	SubscriptionPaymentMethods = []string{"card", "mpesa", "paypal", "bank_transfer"}
+	PaymentMethodTypes         = []string{"credit_card", "debit_card", "mpesa", "paypal", "paystack", "bank_transfer"}
+	BudgetPeriods              = []string{"weekly", "monthly", "yearly"}
+)
+
+const (
+	// MaxAmount is the largest value a NUMERIC(10,2) column holds
+	MaxAmount = 99_999_999.99
+	// Dates further ahead than this are almost always typos, such as 2204 for 2024
+	maxYearsAhead = 10
+)
+
+var (
+	e164     = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
+	currency = regexp.MustCompile(`^[A-Z]{3}$`)
+	email    = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+	last4    = regexp.MustCompile(`^[0-9]{4}$`)
+	// earliestDate bounds dates from below, catching zero values and two-digit years
+	earliestDate = time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// Errors collects the field errors found by one validation
+type Errors []models.FieldError
+
+func (e *Errors) add(field, code, message string) {
+	*e = append(*e, models.FieldError{Field: field, Code: code, Message: message})
+}
+
+// Error makes Errors usable as an error, so validation inside a transaction can abort it
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, fe := range e {
+		messages[i] = fe.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e *Errors) required(field, value string) bool {
+	if strings.TrimSpace(value) == "" {
+		e.add(field, "required", field+" is required")
+		return false
+	}
+	return true
+}
+
+func (e *Errors) maxLength(field, value string, max int) {
+	if len([]rune(value)) > max {
+		e.add(field, "max", fmt.Sprintf("%s must be at most %d characters", field, max))
+	}
+}
+
+func (e *Errors) oneOf(field, value string, allowed []string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	e.add(field, "oneof", fmt.Sprintf("%s must be one of: %s", field, strings.Join(allowed, ", ")))
+}
+
+// amount checks a money value fits its column. Zero is allowed unless positive is set, for free tiers.
+func (e *Errors) amount(field string, value float64, positive bool) {
+	switch {
+	case math.IsNaN(value) || math.IsInf(value, 0):
+		e.add(field, "type", field+" must be a number")
+	case positive && value <= 0:
+		e.add(field, "gt", field+" must be greater than 0")
+	case value < 0:
+		e.add(field, "min", field+" must not be negative")
+	case value > MaxAmount:
+		e.add(field, "max", fmt.Sprintf("%s must be at most %.2f", field, MaxAmount))
+	case math.Abs(value*100-math.Round(value*100)) > 1e-6:
+		e.add(field, "decimals", field+" must have at most 2 decimal places")
+	}
+}
+
+// date checks a date is set and not implausibly far in the past or future
+func (e *Errors) date(field string, value time.Time, today time.Time) {
+	switch {
+	case value.IsZero():
+		e.add(field, "required", field+" is required")
+	case value.Before(earliestDate):
+		e.add(field, "min", field+" must not be before 1970")
+	case value.After(today.AddDate(maxYearsAhead, 0, 0)):
+		e.add(field, "max", fmt.Sprintf("%s must be within %d years from today", field, maxYearsAhead))
+	}
+}
+
+func (e *Errors) websiteURL(field, value string) {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		e.add(field, "url", field+" must be an http or https URL, e.g. https://example.com")
+	}
+}
+
+// Phone reports whether number is in E.164 format: a plus sign, the country code and up to 15 digits
+func Phone(number string) bool {
+	return e164.MatchString(number)
+}
+
+// Currency reports whether code looks like an ISO 4217 code such as KES or USD, in either case
+func Currency(code string) bool {
+	return currency.MatchString(strings.ToUpper(code))
+}
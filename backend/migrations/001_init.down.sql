@@ -0,0 +1,9 @@
+-- Revert 001: drop the initial schema
+DROP TABLE IF EXISTS analytics_results;
+DROP TABLE IF EXISTS budgets;
+DROP TABLE IF EXISTS notifications;
+DROP TABLE IF EXISTS payment_methods;
+DROP TABLE IF EXISTS subscriptions;
+DROP TABLE IF EXISTS categories;
+DROP TABLE IF EXISTS users;
+DROP FUNCTION IF EXISTS update_updated_at_column();
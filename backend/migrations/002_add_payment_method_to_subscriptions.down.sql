@@ -0,0 +1,3 @@
+-- Revert 002: remove payment_method from subscriptions
+DROP INDEX IF EXISTS idx_subscriptions_payment_method;
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS payment_method;
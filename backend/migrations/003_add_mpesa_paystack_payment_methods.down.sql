@@ -0,0 +1,17 @@
+-- Revert 003: remove M-Pesa and Paystack payment methods
+-- Payment methods of the removed types are deleted, since the old constraint can't hold them
+DROP INDEX IF EXISTS idx_payment_methods_email;
+DROP INDEX IF EXISTS idx_payment_methods_phone;
+
+ALTER TABLE payment_methods DROP COLUMN IF EXISTS currency;
+ALTER TABLE payment_methods DROP COLUMN IF EXISTS balance_cents;
+ALTER TABLE payment_methods DROP COLUMN IF EXISTS last_balance_check;
+ALTER TABLE payment_methods DROP COLUMN IF EXISTS api_key_encrypted;
+ALTER TABLE payment_methods DROP COLUMN IF EXISTS account_email;
+ALTER TABLE payment_methods DROP COLUMN IF EXISTS phone_number;
+
+DELETE FROM payment_methods WHERE type IN ('mpesa', 'paystack');
+ALTER TABLE payment_methods DROP CONSTRAINT IF EXISTS payment_methods_type_check;
+ALTER TABLE payment_methods
+ADD CONSTRAINT payment_methods_type_check
+CHECK (type IN ('credit_card', 'debit_card', 'paypal', 'bank_transfer'));
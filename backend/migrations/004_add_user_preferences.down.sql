@@ -0,0 +1,3 @@
+-- Revert 004: remove user preferences
+DROP INDEX IF EXISTS idx_users_preferences;
+ALTER TABLE users DROP COLUMN IF EXISTS preferences;
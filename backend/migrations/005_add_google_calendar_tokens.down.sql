@@ -0,0 +1,5 @@
+-- Revert 005: remove Google Calendar tokens from users
+DROP INDEX IF EXISTS idx_users_google_tokens;
+ALTER TABLE users DROP COLUMN IF EXISTS google_token_expiry;
+ALTER TABLE users DROP COLUMN IF EXISTS google_refresh_token;
+ALTER TABLE users DROP COLUMN IF EXISTS google_access_token;
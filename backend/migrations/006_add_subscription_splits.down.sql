@@ -0,0 +1,3 @@
+-- Revert 006: remove cost splitting
+DROP TABLE IF EXISTS split_ledger_entries;
+DROP TABLE IF EXISTS subscription_split_members;
@@ -0,0 +1,39 @@
+-- Migration: Add cost splitting between members of a shared subscription
+-- The subscription owner pays the provider; members owe the owner their share each billing cycle
+
+CREATE TABLE IF NOT EXISTS subscription_split_members (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  subscription_id UUID NOT NULL REFERENCES subscriptions(id) ON DELETE CASCADE,
+  name VARCHAR(255) NOT NULL,
+  email VARCHAR(255),
+  phone_number VARCHAR(20),
+  share_percent NUMERIC(5,2) NOT NULL CHECK (share_percent > 0 AND share_percent <= 100),
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Ledger of charges (a member's share for one billing cycle) and settlements (payments back to the owner)
+CREATE TABLE IF NOT EXISTS split_ledger_entries (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  subscription_id UUID NOT NULL REFERENCES subscriptions(id) ON DELETE CASCADE,
+  member_id UUID NOT NULL REFERENCES subscription_split_members(id) ON DELETE CASCADE,
+  type VARCHAR(20) NOT NULL CHECK (type IN ('charge', 'settlement')),
+  amount NUMERIC(10,2) NOT NULL CHECK (amount > 0),
+  period_date DATE,
+  method VARCHAR(20) CHECK (method IN ('cash', 'mpesa')),
+  status VARCHAR(20) NOT NULL DEFAULT 'completed' CHECK (status IN ('pending', 'completed', 'failed')),
+  reference VARCHAR(100),
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- A member is charged at most once per billing date
+CREATE UNIQUE INDEX IF NOT EXISTS idx_split_ledger_charge_period
+  ON split_ledger_entries(member_id, period_date) WHERE type = 'charge';
+
+CREATE INDEX IF NOT EXISTS idx_split_members_subscription_id ON subscription_split_members(subscription_id);
+CREATE INDEX IF NOT EXISTS idx_split_members_email ON subscription_split_members(LOWER(email)) WHERE email IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_split_ledger_member_id ON split_ledger_entries(member_id);
+CREATE INDEX IF NOT EXISTS idx_split_ledger_reference ON split_ledger_entries(reference) WHERE reference IS NOT NULL;
+
+COMMENT ON COLUMN subscription_split_members.share_percent IS 'Percentage of the subscription price owed by this member each billing cycle';
+COMMENT ON COLUMN split_ledger_entries.period_date IS 'Billing date the charge was accrued for (NULL for settlements)';
+COMMENT ON COLUMN split_ledger_entries.reference IS 'External reference, e.g. the M-Pesa CheckoutRequestID of an STK push settlement';
@@ -0,0 +1,15 @@
+-- Revert 007: remove free-trial tracking
+-- Subscriptions still in a trial become active, since the old constraint has no 'trial' status
+DROP INDEX IF EXISTS idx_subscriptions_trial_end;
+ALTER TABLE subscriptions DROP CONSTRAINT IF EXISTS subscriptions_trial_dates_check;
+
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS trial_alert_sent_at;
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS post_trial_price;
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS trial_end_date;
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS trial_start_date;
+
+UPDATE subscriptions SET status = 'active' WHERE status = 'trial';
+ALTER TABLE subscriptions DROP CONSTRAINT IF EXISTS subscriptions_status_check;
+ALTER TABLE subscriptions
+ADD CONSTRAINT subscriptions_status_check
+CHECK (status IN ('active', 'cancelled', 'paused'));
@@ -0,0 +1,26 @@
+-- Migration: Add free-trial tracking to subscriptions
+-- Trials convert to 'active' at trial_end_date, switching to post_trial_price when set
+
+-- Step 1: Allow the 'trial' status
+ALTER TABLE subscriptions DROP CONSTRAINT IF EXISTS subscriptions_status_check;
+
+ALTER TABLE subscriptions
+ADD CONSTRAINT subscriptions_status_check
+CHECK (status IN ('active', 'trial', 'cancelled', 'paused'));
+
+-- Step 2: Add trial columns
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS trial_start_date DATE;
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS trial_end_date DATE;
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS post_trial_price NUMERIC(10,2) CHECK (post_trial_price >= 0);
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS trial_alert_sent_at TIMESTAMP WITH TIME ZONE;
+
+ALTER TABLE subscriptions
+ADD CONSTRAINT subscriptions_trial_dates_check
+CHECK (trial_start_date IS NULL OR trial_end_date IS NULL OR trial_start_date <= trial_end_date);
+
+COMMENT ON COLUMN subscriptions.trial_end_date IS 'Date the free trial converts to a paid subscription';
+COMMENT ON COLUMN subscriptions.post_trial_price IS 'Price charged once the trial converts (defaults to price)';
+COMMENT ON COLUMN subscriptions.trial_alert_sent_at IS 'When the user was warned about the upcoming trial conversion';
+
+-- Index for the trial conversion and alert jobs
+CREATE INDEX IF NOT EXISTS idx_subscriptions_trial_end ON subscriptions(trial_end_date) WHERE status = 'trial';
@@ -0,0 +1,2 @@
+-- Revert 008: remove subscription price history
+DROP TABLE IF EXISTS subscription_price_history;
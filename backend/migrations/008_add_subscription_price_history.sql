@@ -0,0 +1,23 @@
+-- Migration: Record every subscription price change
+-- UpdateSubscription used to overwrite price in place; this keeps the history for analytics
+
+CREATE TABLE IF NOT EXISTS subscription_price_history (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  subscription_id UUID NOT NULL REFERENCES subscriptions(id) ON DELETE CASCADE,
+  price NUMERIC(10,2) NOT NULL CHECK (price >= 0),
+  previous_price NUMERIC(10,2),
+  effective_date DATE NOT NULL,
+  source VARCHAR(30) NOT NULL CHECK (source IN ('initial', 'manual', 'trial_conversion', 'import')),
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_price_history_subscription ON subscription_price_history(subscription_id, effective_date DESC);
+
+COMMENT ON COLUMN subscription_price_history.previous_price IS 'Price before this change (NULL for the initial price)';
+COMMENT ON COLUMN subscription_price_history.source IS 'What caused the change: initial, manual, trial_conversion or import';
+
+-- Backfill the current price of existing subscriptions as their initial price
+INSERT INTO subscription_price_history (subscription_id, price, effective_date, source, created_at)
+SELECT id, price, created_at::date, 'initial', created_at
+FROM subscriptions s
+WHERE NOT EXISTS (SELECT 1 FROM subscription_price_history h WHERE h.subscription_id = s.id);
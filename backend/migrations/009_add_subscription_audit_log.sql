@@ -0,0 +1,23 @@
+-- Migration: Audit trail of subscription changes
+-- Each create/update/delete/revert stores field-level diffs and a snapshot of the resulting version.
+-- subscription_id has no foreign key so history survives the subscription being deleted.
+
+CREATE TABLE IF NOT EXISTS subscription_audit_log (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  subscription_id UUID NOT NULL,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  actor_id UUID REFERENCES users(id) ON DELETE SET NULL,
+  action VARCHAR(20) NOT NULL CHECK (action IN ('create', 'update', 'delete', 'revert')),
+  version INTEGER NOT NULL,
+  changes JSONB NOT NULL DEFAULT '{}'::jsonb,
+  snapshot JSONB NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+  UNIQUE (subscription_id, version)
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_user_id ON subscription_audit_log(user_id);
+
+COMMENT ON COLUMN subscription_audit_log.user_id IS 'Owner of the subscription';
+COMMENT ON COLUMN subscription_audit_log.actor_id IS 'User who made the change (NULL for background jobs such as trial conversion)';
+COMMENT ON COLUMN subscription_audit_log.changes IS 'Changed fields as {"field": {"old": ..., "new": ...}}';
+COMMENT ON COLUMN subscription_audit_log.snapshot IS 'Subscription as it was after this change (before it, for deletes)';
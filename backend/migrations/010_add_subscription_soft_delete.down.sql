@@ -0,0 +1,12 @@
+-- Revert 010: remove soft delete
+-- Archived subscriptions are deleted, since without deleted_at they would reappear as live
+DELETE FROM subscription_audit_log WHERE action IN ('restore', 'purge');
+ALTER TABLE subscription_audit_log DROP CONSTRAINT IF EXISTS subscription_audit_log_action_check;
+ALTER TABLE subscription_audit_log
+ADD CONSTRAINT subscription_audit_log_action_check
+CHECK (action IN ('create', 'update', 'delete', 'revert'));
+
+DELETE FROM subscriptions WHERE deleted_at IS NOT NULL;
+DROP INDEX IF EXISTS idx_subscriptions_deleted_at;
+DROP INDEX IF EXISTS idx_subscriptions_user_live;
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,16 @@
+-- Migration: Soft delete and archive for subscriptions
+-- Deleted subscriptions are archived (deleted_at set) and purged after the configured retention period
+
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+
+COMMENT ON COLUMN subscriptions.deleted_at IS 'When the subscription was archived; NULL for live subscriptions';
+
+CREATE INDEX IF NOT EXISTS idx_subscriptions_user_live ON subscriptions(user_id) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_subscriptions_deleted_at ON subscriptions(deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- Record restores and purges in the audit trail
+ALTER TABLE subscription_audit_log DROP CONSTRAINT IF EXISTS subscription_audit_log_action_check;
+
+ALTER TABLE subscription_audit_log
+ADD CONSTRAINT subscription_audit_log_action_check
+CHECK (action IN ('create', 'update', 'delete', 'revert', 'restore', 'purge'));
@@ -0,0 +1,3 @@
+-- Revert 011: remove the search and pagination indexes
+DROP INDEX IF EXISTS idx_subscriptions_user_created;
+DROP INDEX IF EXISTS idx_subscriptions_search;
@@ -0,0 +1,6 @@
+-- Migration: Index subscription name/description for full-text search on GET /api/subscriptions?q=
+CREATE INDEX IF NOT EXISTS idx_subscriptions_search
+  ON subscriptions USING gin(to_tsvector('simple', name || ' ' || COALESCE(description, '')));
+
+-- Keyset pagination on the default sort
+CREATE INDEX IF NOT EXISTS idx_subscriptions_user_created ON subscriptions(user_id, created_at DESC, id);
@@ -0,0 +1,11 @@
+-- Migration: Secret-token iCalendar feeds
+-- Each user can publish one feed of their renewals at an unguessable URL. Only a hash of the token is stored,
+-- so the URL is shown once when the feed is created or rotated.
+
+CREATE TABLE IF NOT EXISTS calendar_feeds (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    last_accessed_at TIMESTAMP WITH TIME ZONE
+);
@@ -0,0 +1,16 @@
+-- Migration: Link subscriptions to the calendar events created for them
+-- subscription_id has no foreign key so the sync job can still delete the event of a purged subscription
+
+CREATE TABLE IF NOT EXISTS subscription_calendar_events (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    subscription_id UUID NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(20) NOT NULL DEFAULT 'google',
+    external_event_id TEXT NOT NULL,
+    synced_hash VARCHAR(64) NOT NULL, -- Hash of the event last pushed, to detect local changes
+    synced_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE(subscription_id, provider)
+);
+
+CREATE INDEX IF NOT EXISTS idx_subscription_calendar_events_user ON subscription_calendar_events(user_id, provider);
@@ -0,0 +1,15 @@
+-- Revert 015: move Google Calendar tokens back onto users
+-- Outlook connections have nowhere to go and are dropped
+ALTER TABLE users ADD COLUMN IF NOT EXISTS google_access_token TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS google_refresh_token TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS google_token_expiry TIMESTAMP WITH TIME ZONE;
+CREATE INDEX IF NOT EXISTS idx_users_google_tokens ON users(id) WHERE google_access_token IS NOT NULL;
+
+UPDATE users u
+SET google_access_token = c.access_token,
+    google_refresh_token = c.refresh_token,
+    google_token_expiry = c.token_expiry
+FROM calendar_connections c
+WHERE c.user_id = u.id AND c.provider = 'google';
+
+DROP TABLE IF EXISTS calendar_connections;
@@ -0,0 +1,29 @@
+-- Migration: Calendar provider connections
+-- OAuth tokens for each connected calendar provider (Google, Microsoft) move out of the users table,
+-- so a user can connect more than one provider.
+
+CREATE TABLE IF NOT EXISTS calendar_connections (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(20) NOT NULL,
+    access_token TEXT NOT NULL,
+    refresh_token TEXT NOT NULL,
+    token_expiry TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE(user_id, provider)
+);
+
+CREATE INDEX IF NOT EXISTS idx_calendar_connections_provider ON calendar_connections(provider);
+
+-- Carry over existing Google Calendar connections
+INSERT INTO calendar_connections (user_id, provider, access_token, refresh_token, token_expiry)
+SELECT id, 'google', google_access_token, google_refresh_token, google_token_expiry
+FROM users
+WHERE google_access_token IS NOT NULL AND google_refresh_token IS NOT NULL
+ON CONFLICT (user_id, provider) DO NOTHING;
+
+DROP INDEX IF EXISTS idx_users_google_tokens;
+ALTER TABLE users DROP COLUMN IF EXISTS google_access_token;
+ALTER TABLE users DROP COLUMN IF EXISTS google_refresh_token;
+ALTER TABLE users DROP COLUMN IF EXISTS google_token_expiry;
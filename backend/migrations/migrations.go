@@ -0,0 +1,19 @@
+// Package migrations embeds the SQL migrations so the server binary can apply them itself.
+//
+// Each migration is NNN_name.sql, with an optional NNN_name.down.sql that reverts it.
+// The sqlite directory holds the SQLite equivalent of each migration, under the same version.
+package migrations
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed *.sql
+var FS embed.FS
+
+//go:embed sqlite/*.sql
+var sqliteFiles embed.FS
+
+// SQLite holds the migrations for SQLite databases
+var SQLite, _ = fs.Sub(sqliteFiles, "sqlite")
@@ -0,0 +1,5 @@
+-- Migration: Add payment_method column to subscriptions table
+ALTER TABLE subscriptions
+ADD COLUMN payment_method VARCHAR(50) CHECK (payment_method IN ('card', 'mpesa', 'paypal', 'bank_transfer'));
+
+CREATE INDEX idx_subscriptions_payment_method ON subscriptions(payment_method);
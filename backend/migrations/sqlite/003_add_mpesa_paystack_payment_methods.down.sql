@@ -0,0 +1,12 @@
+-- Revert 003: remove M-Pesa and Paystack payment methods
+DROP INDEX IF EXISTS idx_payment_methods_email;
+DROP INDEX IF EXISTS idx_payment_methods_phone;
+
+ALTER TABLE payment_methods DROP COLUMN currency;
+ALTER TABLE payment_methods DROP COLUMN balance_cents;
+ALTER TABLE payment_methods DROP COLUMN last_balance_check;
+ALTER TABLE payment_methods DROP COLUMN api_key_encrypted;
+ALTER TABLE payment_methods DROP COLUMN account_email;
+ALTER TABLE payment_methods DROP COLUMN phone_number;
+
+DELETE FROM payment_methods WHERE type IN ('mpesa', 'paystack');
@@ -0,0 +1,11 @@
+-- Migration: Add M-Pesa and Paystack to payment methods
+-- 001 already allows the mpesa and paystack types; this adds their columns
+ALTER TABLE payment_methods ADD COLUMN phone_number VARCHAR(20);
+ALTER TABLE payment_methods ADD COLUMN account_email VARCHAR(255);
+ALTER TABLE payment_methods ADD COLUMN api_key_encrypted TEXT;
+ALTER TABLE payment_methods ADD COLUMN last_balance_check TIMESTAMP;
+ALTER TABLE payment_methods ADD COLUMN balance_cents BIGINT DEFAULT 0;
+ALTER TABLE payment_methods ADD COLUMN currency VARCHAR(3) DEFAULT 'KES';
+
+CREATE INDEX idx_payment_methods_phone ON payment_methods(phone_number) WHERE phone_number IS NOT NULL;
+CREATE INDEX idx_payment_methods_email ON payment_methods(account_email) WHERE account_email IS NOT NULL;
@@ -0,0 +1,2 @@
+-- Revert 004: remove user preferences
+ALTER TABLE users DROP COLUMN preferences;
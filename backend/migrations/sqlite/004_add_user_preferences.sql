@@ -0,0 +1,2 @@
+-- Add preferences column to users table, as JSON text
+ALTER TABLE users ADD COLUMN preferences TEXT DEFAULT '{}';
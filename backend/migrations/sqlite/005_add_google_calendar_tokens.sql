@@ -0,0 +1,6 @@
+-- Add Google Calendar token storage to users table
+ALTER TABLE users ADD COLUMN google_access_token TEXT;
+ALTER TABLE users ADD COLUMN google_refresh_token TEXT;
+ALTER TABLE users ADD COLUMN google_token_expiry TIMESTAMP;
+
+CREATE INDEX idx_users_google_tokens ON users(id) WHERE google_access_token IS NOT NULL;
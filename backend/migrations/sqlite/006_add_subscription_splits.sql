@@ -0,0 +1,32 @@
+-- Migration: Add cost splitting between members of a shared subscription
+CREATE TABLE subscription_split_members (
+  id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' || substr(lower(hex(randomblob(2))), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) || substr(lower(hex(randomblob(2))), 2) || '-' || lower(hex(randomblob(6)))),
+  subscription_id TEXT NOT NULL REFERENCES subscriptions(id) ON DELETE CASCADE,
+  name VARCHAR(255) NOT NULL,
+  email VARCHAR(255),
+  phone_number VARCHAR(20),
+  share_percent NUMERIC(5,2) NOT NULL CHECK (share_percent > 0 AND share_percent <= 100),
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE split_ledger_entries (
+  id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' || substr(lower(hex(randomblob(2))), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) || substr(lower(hex(randomblob(2))), 2) || '-' || lower(hex(randomblob(6)))),
+  subscription_id TEXT NOT NULL REFERENCES subscriptions(id) ON DELETE CASCADE,
+  member_id TEXT NOT NULL REFERENCES subscription_split_members(id) ON DELETE CASCADE,
+  type VARCHAR(20) NOT NULL CHECK (type IN ('charge', 'settlement')),
+  amount NUMERIC(10,2) NOT NULL CHECK (amount > 0),
+  period_date DATE,
+  method VARCHAR(20) CHECK (method IN ('cash', 'mpesa')),
+  status VARCHAR(20) NOT NULL DEFAULT 'completed' CHECK (status IN ('pending', 'completed', 'failed')),
+  reference VARCHAR(100),
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- A member is charged at most once per billing date
+CREATE UNIQUE INDEX idx_split_ledger_charge_period
+  ON split_ledger_entries(member_id, period_date) WHERE type = 'charge';
+
+CREATE INDEX idx_split_members_subscription_id ON subscription_split_members(subscription_id);
+CREATE INDEX idx_split_members_email ON subscription_split_members(LOWER(email)) WHERE email IS NOT NULL;
+CREATE INDEX idx_split_ledger_member_id ON split_ledger_entries(member_id);
+CREATE INDEX idx_split_ledger_reference ON split_ledger_entries(reference) WHERE reference IS NOT NULL;
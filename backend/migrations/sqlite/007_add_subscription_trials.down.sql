@@ -0,0 +1,10 @@
+-- Revert 007: remove free-trial tracking
+-- Subscriptions still in a trial become active
+DROP INDEX IF EXISTS idx_subscriptions_trial_end;
+
+ALTER TABLE subscriptions DROP COLUMN trial_alert_sent_at;
+ALTER TABLE subscriptions DROP COLUMN post_trial_price;
+ALTER TABLE subscriptions DROP COLUMN trial_end_date;
+ALTER TABLE subscriptions DROP COLUMN trial_start_date;
+
+UPDATE subscriptions SET status = 'active' WHERE status = 'trial';
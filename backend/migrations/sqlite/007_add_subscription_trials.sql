@@ -0,0 +1,10 @@
+-- Migration: Add free-trial tracking to subscriptions
+-- 001 already allows the 'trial' status. The date check sits on trial_end_date so 007 can be reverted;
+-- SQLite can't drop a column named in a table-level constraint.
+ALTER TABLE subscriptions ADD COLUMN trial_start_date DATE;
+ALTER TABLE subscriptions ADD COLUMN trial_end_date DATE
+  CHECK (trial_start_date IS NULL OR trial_end_date IS NULL OR trial_start_date <= trial_end_date);
+ALTER TABLE subscriptions ADD COLUMN post_trial_price NUMERIC(10,2) CHECK (post_trial_price >= 0);
+ALTER TABLE subscriptions ADD COLUMN trial_alert_sent_at TIMESTAMP;
+
+CREATE INDEX idx_subscriptions_trial_end ON subscriptions(trial_end_date) WHERE status = 'trial';
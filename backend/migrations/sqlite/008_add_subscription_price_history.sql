@@ -0,0 +1,18 @@
+-- Migration: Record every subscription price change
+CREATE TABLE subscription_price_history (
+  id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' || substr(lower(hex(randomblob(2))), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) || substr(lower(hex(randomblob(2))), 2) || '-' || lower(hex(randomblob(6)))),
+  subscription_id TEXT NOT NULL REFERENCES subscriptions(id) ON DELETE CASCADE,
+  price NUMERIC(10,2) NOT NULL CHECK (price >= 0),
+  previous_price NUMERIC(10,2),
+  effective_date DATE NOT NULL,
+  source VARCHAR(30) NOT NULL CHECK (source IN ('initial', 'manual', 'trial_conversion', 'import')),
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_price_history_subscription ON subscription_price_history(subscription_id, effective_date DESC);
+
+-- Backfill the current price of existing subscriptions as their initial price
+INSERT INTO subscription_price_history (subscription_id, price, effective_date, source, created_at)
+SELECT id, price, date(created_at), 'initial', created_at
+FROM subscriptions s
+WHERE NOT EXISTS (SELECT 1 FROM subscription_price_history h WHERE h.subscription_id = s.id);
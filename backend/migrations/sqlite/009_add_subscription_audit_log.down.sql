@@ -0,0 +1,2 @@
+-- Revert 009: remove the subscription audit trail
+DROP TABLE IF EXISTS subscription_audit_log;
@@ -0,0 +1,17 @@
+-- Migration: Audit trail of subscription changes
+-- subscription_id has no foreign key so history survives the subscription being deleted.
+-- action already allows 'restore' and 'purge', which 010 adds on Postgres.
+CREATE TABLE subscription_audit_log (
+  id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' || substr(lower(hex(randomblob(2))), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) || substr(lower(hex(randomblob(2))), 2) || '-' || lower(hex(randomblob(6)))),
+  subscription_id TEXT NOT NULL,
+  user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  actor_id TEXT REFERENCES users(id) ON DELETE SET NULL,
+  action VARCHAR(20) NOT NULL CHECK (action IN ('create', 'update', 'delete', 'revert', 'restore', 'purge')),
+  version INTEGER NOT NULL,
+  changes TEXT NOT NULL DEFAULT '{}',
+  snapshot TEXT NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE (subscription_id, version)
+);
+
+CREATE INDEX idx_audit_log_user_id ON subscription_audit_log(user_id);
@@ -0,0 +1,8 @@
+-- Revert 010: remove soft delete
+-- Archived subscriptions are deleted, since without deleted_at they would reappear as live
+DELETE FROM subscription_audit_log WHERE action IN ('restore', 'purge');
+
+DELETE FROM subscriptions WHERE deleted_at IS NOT NULL;
+DROP INDEX IF EXISTS idx_subscriptions_deleted_at;
+DROP INDEX IF EXISTS idx_subscriptions_user_live;
+ALTER TABLE subscriptions DROP COLUMN deleted_at;
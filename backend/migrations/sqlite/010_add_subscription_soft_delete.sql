@@ -0,0 +1,5 @@
+-- Migration: Soft delete and archive for subscriptions
+ALTER TABLE subscriptions ADD COLUMN deleted_at TIMESTAMP;
+
+CREATE INDEX idx_subscriptions_user_live ON subscriptions(user_id) WHERE deleted_at IS NULL;
+CREATE INDEX idx_subscriptions_deleted_at ON subscriptions(deleted_at) WHERE deleted_at IS NOT NULL;
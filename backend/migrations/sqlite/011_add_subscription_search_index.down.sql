@@ -0,0 +1,2 @@
+-- Revert 011: remove the pagination index
+DROP INDEX IF EXISTS idx_subscriptions_user_created;
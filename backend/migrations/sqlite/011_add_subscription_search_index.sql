@@ -0,0 +1,3 @@
+-- Migration: Keyset pagination on the default sort
+-- SQLite has no index for substring search, so there is no equivalent of idx_subscriptions_search
+CREATE INDEX idx_subscriptions_user_created ON subscriptions(user_id, created_at DESC, id);
@@ -0,0 +1,2 @@
+-- Revert 012: remove iCalendar feeds
+DROP TABLE IF EXISTS calendar_feeds;
@@ -0,0 +1,2 @@
+-- Revert 013: remove subscription calendar event links
+DROP TABLE IF EXISTS subscription_calendar_events;
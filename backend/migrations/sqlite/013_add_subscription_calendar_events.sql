@@ -0,0 +1,14 @@
+-- Migration: Link subscriptions to the calendar events created for them
+CREATE TABLE subscription_calendar_events (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' || substr(lower(hex(randomblob(2))), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) || substr(lower(hex(randomblob(2))), 2) || '-' || lower(hex(randomblob(6)))),
+    subscription_id TEXT NOT NULL,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(20) NOT NULL DEFAULT 'google',
+    external_event_id TEXT NOT NULL,
+    synced_hash VARCHAR(64) NOT NULL,
+    synced_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(subscription_id, provider)
+);
+
+CREATE INDEX idx_subscription_calendar_events_user ON subscription_calendar_events(user_id, provider);
@@ -0,0 +1,2 @@
+-- Revert 014: remove OAuth states
+DROP TABLE IF EXISTS oauth_states;
@@ -0,0 +1,15 @@
+-- Revert 015: move Google Calendar tokens back onto users
+-- Outlook connections have nowhere to go and are dropped
+ALTER TABLE users ADD COLUMN google_access_token TEXT;
+ALTER TABLE users ADD COLUMN google_refresh_token TEXT;
+ALTER TABLE users ADD COLUMN google_token_expiry TIMESTAMP;
+CREATE INDEX idx_users_google_tokens ON users(id) WHERE google_access_token IS NOT NULL;
+
+UPDATE users
+SET google_access_token = c.access_token,
+    google_refresh_token = c.refresh_token,
+    google_token_expiry = c.token_expiry
+FROM calendar_connections c
+WHERE c.user_id = users.id AND c.provider = 'google';
+
+DROP TABLE IF EXISTS calendar_connections;
@@ -0,0 +1,26 @@
+-- Migration: Calendar provider connections
+CREATE TABLE calendar_connections (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' || substr(lower(hex(randomblob(2))), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) || substr(lower(hex(randomblob(2))), 2) || '-' || lower(hex(randomblob(6)))),
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(20) NOT NULL,
+    access_token TEXT NOT NULL,
+    refresh_token TEXT NOT NULL,
+    token_expiry TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(user_id, provider)
+);
+
+CREATE INDEX idx_calendar_connections_provider ON calendar_connections(provider);
+
+-- Carry over existing Google Calendar connections
+INSERT INTO calendar_connections (user_id, provider, access_token, refresh_token, token_expiry)
+SELECT id, 'google', google_access_token, google_refresh_token, google_token_expiry
+FROM users
+WHERE google_access_token IS NOT NULL AND google_refresh_token IS NOT NULL
+ON CONFLICT (user_id, provider) DO NOTHING;
+
+DROP INDEX IF EXISTS idx_users_google_tokens;
+ALTER TABLE users DROP COLUMN google_access_token;
+ALTER TABLE users DROP COLUMN google_refresh_token;
+ALTER TABLE users DROP COLUMN google_token_expiry;
@@ -0,0 +1,95 @@
+// Package openapi embeds the OpenAPI 3 description of the HTTP API, served at /api/openapi.json and
+// used by middleware.Contract to check requests and responses against it.
+//
+// openapi.yaml is maintained by hand: a route or DTO change goes with a matching change to the spec.
+package openapi
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+//go:embed openapi.yaml
+var spec []byte
+
+func init() {
+	// The spec uses these formats, which kin-openapi only checks once they are defined. They accept
+	// what the handlers accept.
+	openapi3.DefineStringFormatValidator("uuid", openapi3.NewCallbackValidator(func(value string) error {
+		if _, err := uuid.Parse(value); err != nil {
+			return errors.New("not a valid UUID")
+		}
+		return nil
+	}))
+	openapi3.DefineStringFormatValidator("email", openapi3.NewCallbackValidator(func(value string) error {
+		if _, err := mail.ParseAddress(value); err != nil {
+			return errors.New("not a valid email address")
+		}
+		return nil
+	}))
+}
+
+// Load parses and validates the embedded spec
+func Load() (*openapi3.T, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAPI spec: %w", err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI spec: %w", err)
+	}
+	return doc, nil
+}
+
+// Path turns a Gin route such as /api/subscriptions/:id into its OpenAPI template, /api/subscriptions/{id}
+func Path(route string) string {
+	segments := strings.Split(route, "/")
+	for i, s := range segments {
+		if strings.HasPrefix(s, ":") || strings.HasPrefix(s, "*") {
+			segments[i] = "{" + s[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// Operation finds the operation documenting a Gin route, or nil when the spec doesn't describe it
+func Operation(doc *openapi3.T, method, route string) (string, *openapi3.PathItem, *openapi3.Operation) {
+	path := Path(route)
+	item := doc.Paths.Value(path)
+	if item == nil {
+		return path, nil, nil
+	}
+	return path, item, item.GetOperation(method)
+}
+
+// Undocumented lists the routes, as "METHOD /path", that have no operation in the spec
+func Undocumented(doc *openapi3.T, routes gin.RoutesInfo) []string {
+	var missing []string
+	for _, r := range routes {
+		if r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			continue
+		}
+		if _, _, op := Operation(doc, r.Method, r.Path); op == nil {
+			missing = append(missing, r.Method+" "+r.Path)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// Handler serves the spec as JSON
+func Handler(doc *openapi3.T) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, doc)
+	}
+}